@@ -33,6 +33,7 @@ var DefaultCollapseSidebar = false // default value of collapse sidebar
 // Any options with "Secret", "Token" in its key won't be return by GetOptions
 
 var SessionSecret = uuid.New().String()
+var SessionMaxAge = 2592000 // 30 days, 登录会话 cookie 与服务端会话记录的有效期
 var CryptoSecret = uuid.New().String()
 
 var OptionMap map[string]string
@@ -106,6 +107,9 @@ var QuotaForInvitee = 0
 var ChannelDisableThreshold = 5.0
 var AutomaticDisableChannelEnabled = false
 var AutomaticEnableChannelEnabled = false
+
+// PreferLowCostChannelEnabled 同一优先级内只在上游成本最低的渠道间按权重选择
+var PreferLowCostChannelEnabled = false
 var QuotaRemindThreshold = 1000
 var PreConsumedQuota = 500
 
@@ -135,6 +139,8 @@ var CohereSafetySetting string
 
 const (
 	RequestIdKey = "X-Oneapi-Request-Id"
+	// RelayDryRunHeader 在任意中继路由上携带该请求头即只估算费用
+	RelayDryRunHeader = "X-NewAPI-Dry-Run"
 )
 
 const (
@@ -175,6 +181,9 @@ var (
 
 	DownloadRateLimitNum            = 10
 	DownloadRateLimitDuration int64 = 60
+
+	StatusPageRateLimitNum            = 30
+	StatusPageRateLimitDuration int64 = 60
 )
 
 var RateLimitKeyExpirationDuration = 20 * time.Minute
@@ -191,6 +200,13 @@ const (
 	TokenStatusExhausted = 4
 )
 
+// 令牌的客户端证书认证策略，证书认证只在 mTLS 监听上可用
+const (
+	TokenCertAuthNone       = ""             // 仅使用密钥认证
+	TokenCertAuthCertOnly   = "cert"         // 凭匹配的客户端证书认证，无需密钥
+	TokenCertAuthCertAndKey = "cert_and_key" // 同时要求密钥与匹配的客户端证书
+)
+
 const (
 	RedemptionCodeStatusEnabled  = 1 // don't use 0, 0 is the default value!
 	RedemptionCodeStatusDisabled = 2 // also don't use 0
@@ -205,7 +221,8 @@ const (
 )
 
 const (
-	TopUpStatusPending = "pending"
-	TopUpStatusSuccess = "success"
-	TopUpStatusExpired = "expired"
+	TopUpStatusPending  = "pending"
+	TopUpStatusSuccess  = "success"
+	TopUpStatusExpired  = "expired"
+	TopUpStatusRefunded = "refunded" // 已全额退款，部分退款时仍为 success
 )
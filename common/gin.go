@@ -8,6 +8,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -138,6 +139,15 @@ func GetContextKeyType[T any](c *gin.Context, key constant.ContextKey) (T, bool)
 	return t, false
 }
 
+// IsRelayDryRun 判断中继请求是否仅估算费用（/v1/estimate 或携带 RelayDryRunHeader）
+func IsRelayDryRun(c *gin.Context) bool {
+	if GetContextKeyBool(c, constant.ContextKeyDryRun) {
+		return true
+	}
+	dryRun, _ := strconv.ParseBool(c.GetHeader(RelayDryRunHeader))
+	return dryRun
+}
+
 func ApiError(c *gin.Context, err error) {
 	c.JSON(http.StatusOK, gin.H{
 		"success": false,
@@ -92,6 +92,10 @@ func InitEnv() {
 			}
 		}
 	}
+	MTLSPort = os.Getenv("MTLS_PORT")
+	MTLSCertFile = os.Getenv("MTLS_CERT_FILE")
+	MTLSKeyFile = os.Getenv("MTLS_KEY_FILE")
+	MTLSClientCAFile = os.Getenv("MTLS_CLIENT_CA_FILE")
 
 	// Parse requestInterval and set RequestInterval
 	requestInterval, _ = strconv.Atoi(os.Getenv("POLLING_INTERVAL"))
@@ -0,0 +1,61 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// mTLS 监听配置：设置 MTLS_PORT 后额外启动一个要求客户端证书的 HTTPS 监听，原端口的密钥认证不受影响
+var (
+	MTLSPort         = ""
+	MTLSCertFile     = ""
+	MTLSKeyFile      = ""
+	MTLSClientCAFile = ""
+)
+
+// LoadMTLSConfig 加载服务端证书与客户端 CA，客户端必须提供由该 CA 签发的证书
+func LoadMTLSConfig() (*tls.Config, error) {
+	if MTLSCertFile == "" || MTLSKeyFile == "" || MTLSClientCAFile == "" {
+		return nil, fmt.Errorf("MTLS_CERT_FILE, MTLS_KEY_FILE and MTLS_CLIENT_CA_FILE are required when MTLS_PORT is set")
+	}
+	cert, err := tls.LoadX509KeyPair(MTLSCertFile, MTLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load mTLS server certificate: %w", err)
+	}
+	caData, err := os.ReadFile(MTLSClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mTLS client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("no valid certificate found in %s", MTLSClientCAFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// GetClientCertIdentities 返回已验证的客户端证书中可用于匹配令牌的身份：URI SAN（如 SPIFFE ID）、DNS SAN、邮箱 SAN 与 Subject CN。
+// 未经过 mTLS 监听或证书未通过验证时返回 nil
+func GetClientCertIdentities(state *tls.ConnectionState) []string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	leaf := state.VerifiedChains[0][0]
+	identities := make([]string, 0, len(leaf.URIs)+len(leaf.DNSNames)+len(leaf.EmailAddresses)+1)
+	for _, uri := range leaf.URIs {
+		identities = append(identities, uri.String())
+	}
+	identities = append(identities, leaf.DNSNames...)
+	identities = append(identities, leaf.EmailAddresses...)
+	if cn := strings.TrimSpace(leaf.Subject.CommonName); cn != "" {
+		identities = append(identities, cn)
+	}
+	return identities
+}
@@ -0,0 +1,107 @@
+package common
+
+// 管理后台权限，格式为 资源:操作
+const (
+	PermissionChannelsRead       = "channels:read"
+	PermissionChannelsWrite      = "channels:write"
+	PermissionChannelsKeys       = "channels:keys" // 查看渠道密钥
+	PermissionUsersRead          = "users:read"
+	PermissionUsersWrite         = "users:write"
+	PermissionUsersQuota         = "users:quota" // 调整用户额度
+	PermissionTopUpsRead         = "topups:read"
+	PermissionTopUpsWrite        = "topups:write" // 补单、退款与对账
+	PermissionRedemptionsRead    = "redemptions:read"
+	PermissionRedemptionsWrite   = "redemptions:write"
+	PermissionLogsRead           = "logs:read"
+	PermissionLogsWrite          = "logs:write" // 清理历史日志
+	PermissionPricingRead        = "pricing:read"
+	PermissionPricingWrite       = "pricing:write"
+	PermissionSubscriptionsRead  = "subscriptions:read"
+	PermissionSubscriptionsWrite = "subscriptions:write"
+	PermissionStatementsRead     = "statements:read"
+	PermissionStatementsWrite    = "statements:write"
+	PermissionLedgerRead         = "ledger:read"
+	PermissionLedgerWrite        = "ledger:write"
+	PermissionGroupsRead         = "groups:read"
+	PermissionGroupsWrite        = "groups:write"
+	PermissionModelsRead         = "models:read"
+	PermissionModelsWrite        = "models:write"
+	PermissionDeploymentsRead    = "deployments:read"
+	PermissionDeploymentsWrite   = "deployments:write"
+	PermissionSystemStatus       = "system:status"
+	PermissionOptionsWrite       = "options:write" // 系统设置与倍率同步
+	PermissionRolesRead          = "roles:read"
+	PermissionRolesWrite         = "roles:write" // 管理角色并分配给用户
+	PermissionAuditRead          = "audit:read"
+)
+
+var AllPermissions = []string{
+	PermissionChannelsRead,
+	PermissionChannelsWrite,
+	PermissionChannelsKeys,
+	PermissionUsersRead,
+	PermissionUsersWrite,
+	PermissionUsersQuota,
+	PermissionTopUpsRead,
+	PermissionTopUpsWrite,
+	PermissionRedemptionsRead,
+	PermissionRedemptionsWrite,
+	PermissionLogsRead,
+	PermissionLogsWrite,
+	PermissionPricingRead,
+	PermissionPricingWrite,
+	PermissionSubscriptionsRead,
+	PermissionSubscriptionsWrite,
+	PermissionStatementsRead,
+	PermissionStatementsWrite,
+	PermissionLedgerRead,
+	PermissionLedgerWrite,
+	PermissionGroupsRead,
+	PermissionGroupsWrite,
+	PermissionModelsRead,
+	PermissionModelsWrite,
+	PermissionDeploymentsRead,
+	PermissionDeploymentsWrite,
+	PermissionSystemStatus,
+	PermissionOptionsWrite,
+	PermissionRolesRead,
+	PermissionRolesWrite,
+	PermissionAuditRead,
+}
+
+// rootOnlyPermissions 原先仅超级管理员可用的操作，管理员预设不包含
+var rootOnlyPermissions = map[string]bool{
+	PermissionChannelsKeys:       true,
+	PermissionSubscriptionsWrite: true,
+	PermissionLedgerWrite:        true,
+	PermissionOptionsWrite:       true,
+	PermissionRolesWrite:         true,
+	PermissionAuditRead:          true,
+}
+
+func IsValidPermission(permission string) bool {
+	for _, p := range AllPermissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRolePresetPermissions 内置角色（普通用户、管理员、超级管理员）的预设权限
+func GetRolePresetPermissions(role int) []string {
+	switch {
+	case role >= RoleRootUser:
+		return AllPermissions
+	case role >= RoleAdminUser:
+		permissions := make([]string, 0, len(AllPermissions))
+		for _, p := range AllPermissions {
+			if !rootOnlyPermissions[p] {
+				permissions = append(permissions, p)
+			}
+		}
+		return permissions
+	default:
+		return []string{}
+	}
+}
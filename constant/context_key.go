@@ -19,6 +19,10 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenAllowedTags       ContextKey = "token_allowed_tags"
+
+	// ContextKeyRequestTags 经令牌白名单过滤后的成本归属标签（map[string]string），随消费日志落库
+	ContextKeyRequestTags ContextKey = "request_tags"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -56,6 +60,9 @@ const (
 
 	ContextKeySystemPromptOverride ContextKey = "system_prompt_override"
 
+	// ContextKeyDryRun 仅估算费用，不请求上游也不扣费
+	ContextKeyDryRun ContextKey = "dry_run"
+
 	// ContextKeyAdminRejectReason stores an admin-only reject/block reason extracted from upstream responses.
 	// It is not returned to end users, but can be persisted into consume/error logs for debugging.
 	ContextKeyAdminRejectReason ContextKey = "admin_reject_reason"
@@ -3,6 +3,11 @@ package constant
 type MultiKeyMode string
 
 const (
-	MultiKeyModeRandom  MultiKeyMode = "random"  // 随机
-	MultiKeyModePolling MultiKeyMode = "polling" // 轮询
+	MultiKeyModeRandom    MultiKeyMode = "random"     // 随机
+	MultiKeyModePolling   MultiKeyMode = "polling"    // 轮询
+	MultiKeyModeLeastUsed MultiKeyMode = "least_used" // 最久未使用优先
+	MultiKeyModeWeighted  MultiKeyMode = "weighted"   // 按key权重随机
 )
+
+// MultiKeyDefaultRateLimitCooldown 多Key渠道中key触发429后的默认冷却时间（秒）
+const MultiKeyDefaultRateLimitCooldown = 60
@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetAuditLogs(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	query := &model.AuditLogQuery{
+		UserId:     userId,
+		Username:   c.Query("username"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetId:   c.Query("target_id"),
+		StartTime:  startTimestamp,
+		EndTime:    endTimestamp,
+	}
+	logs, total, err := model.GetAuditLogs(query, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
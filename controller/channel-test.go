@@ -39,9 +39,43 @@ type testResult struct {
 	context     *gin.Context
 	localErr    error
 	newAPIError *types.NewAPIError
+	ttft        int64 // 流式测试的首字时间（毫秒），非流式或未收到数据时为 0
 }
 
-func testChannel(channel *model.Channel, testModel string, endpointType string) testResult {
+func getChannelTestModel(channel *model.Channel, testModel string) string {
+	testModel = strings.TrimSpace(testModel)
+	if testModel == "" {
+		if channel.TestModel != nil && *channel.TestModel != "" {
+			testModel = strings.TrimSpace(*channel.TestModel)
+		} else {
+			models := channel.GetModels()
+			if len(models) > 0 {
+				testModel = strings.TrimSpace(models[0])
+			}
+			if testModel == "" {
+				testModel = "gpt-4o-mini"
+			}
+		}
+	}
+	return testModel
+}
+
+// recordChannelTestResult 记录测试结果到渠道健康历史
+func recordChannelTestResult(channel *model.Channel, testModel string, result testResult, newAPIError *types.NewAPIError, milliseconds int64) {
+	if result.context == nil {
+		// 不支持测试的渠道类型
+		return
+	}
+	reason := ""
+	if newAPIError != nil {
+		reason = newAPIError.MaskSensitiveError()
+	} else if result.localErr != nil {
+		reason = result.localErr.Error()
+	}
+	model.RecordChannelTestEvent(channel.Id, getChannelTestModel(channel, testModel), reason == "", milliseconds, reason)
+}
+
+func testChannel(channel *model.Channel, testModel string, endpointType string, isStream bool) testResult {
 	tik := time.Now()
 	var unsupportedTestChannelTypes = []int{
 		constant.ChannelTypeMidjourney,
@@ -61,20 +95,7 @@ func testChannel(channel *model.Channel, testModel string, endpointType string)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 
-	testModel = strings.TrimSpace(testModel)
-	if testModel == "" {
-		if channel.TestModel != nil && *channel.TestModel != "" {
-			testModel = strings.TrimSpace(*channel.TestModel)
-		} else {
-			models := channel.GetModels()
-			if len(models) > 0 {
-				testModel = strings.TrimSpace(models[0])
-			}
-			if testModel == "" {
-				testModel = "gpt-4o-mini"
-			}
-		}
-	}
+	testModel = getChannelTestModel(channel, testModel)
 
 	requestPath := "/v1/chat/completions"
 
@@ -201,6 +222,9 @@ func testChannel(channel *model.Channel, testModel string, endpointType string)
 	}
 
 	request := buildTestRequest(testModel, endpointType, channel)
+	if isStream {
+		setTestRequestStream(request)
+	}
 
 	info, err := relaycommon.GenRelayInfo(c, relayFormat, request, nil)
 
@@ -466,10 +490,26 @@ func testChannel(channel *model.Channel, testModel string, endpointType string)
 		Other:            other,
 	})
 	common.SysLog(fmt.Sprintf("testing channel #%d, response: \n%s", channel.Id, string(respBody)))
+	var ttft int64
+	if info.IsStream && info.FirstResponseTime.After(info.StartTime) {
+		ttft = info.FirstResponseTime.Sub(info.StartTime).Milliseconds()
+	}
 	return testResult{
 		context:     c,
 		localErr:    nil,
 		newAPIError: nil,
+		ttft:        ttft,
+	}
+}
+
+// setTestRequestStream 将测试请求改为流式请求，仅对话与 Responses 请求支持
+func setTestRequestStream(request dto.Request) {
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		r.Stream = true
+		r.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	case *dto.OpenAIResponsesRequest:
+		r.Stream = true
 	}
 }
 
@@ -618,8 +658,13 @@ func TestChannel(c *gin.Context) {
 	//}()
 	testModel := c.Query("model")
 	endpointType := c.Query("endpoint_type")
+	isStream, _ := strconv.ParseBool(c.Query("stream"))
 	tik := time.Now()
-	result := testChannel(channel, testModel, endpointType)
+	result := testChannel(channel, testModel, endpointType, isStream)
+	testMilliseconds := time.Since(tik).Milliseconds()
+	gopool.Go(func() {
+		recordChannelTestResult(channel, testModel, result, result.newAPIError, testMilliseconds)
+	})
 	if result.localErr != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -644,6 +689,7 @@ func TestChannel(c *gin.Context) {
 		"success": true,
 		"message": "",
 		"time":    consumedTime,
+		"ttft":    float64(result.ttft) / 1000.0,
 	})
 }
 
@@ -678,23 +724,25 @@ func testAllChannels(notify bool) error {
 		for _, channel := range channels {
 			isChannelEnabled := channel.Status == common.ChannelStatusEnabled
 			tik := time.Now()
-			result := testChannel(channel, "", "")
+			result := testChannel(channel, "", "", false)
 			tok := time.Now()
 			milliseconds := tok.Sub(tik).Milliseconds()
 
+			testModel := getChannelTestModel(channel, "")
 			shouldBanChannel := false
+			shouldBanModel := false
 			newAPIError := result.newAPIError
-			// request error disables the channel
+			// 密钥失效、余额不足等错误影响整个渠道
 			if newAPIError != nil {
 				shouldBanChannel = service.ShouldDisableChannel(channel.Type, result.newAPIError)
 			}
 
-			// 当错误检查通过，才检查响应时间
+			// 当错误检查通过，才检查响应时间；响应慢只说明被测模型有问题，只禁用该模型
 			if common.AutomaticDisableChannelEnabled && !shouldBanChannel {
 				if milliseconds > disableThreshold {
 					err := fmt.Errorf("响应时间 %.2fs 超过阈值 %.2fs", float64(milliseconds)/1000.0, float64(disableThreshold)/1000.0)
 					newAPIError = types.NewOpenAIError(err, types.ErrorCodeChannelResponseTimeExceeded, http.StatusRequestTimeout)
-					shouldBanChannel = true
+					shouldBanModel = true
 				}
 			}
 
@@ -702,12 +750,19 @@ func testAllChannels(notify bool) error {
 			if isChannelEnabled && shouldBanChannel && channel.GetAutoBan() {
 				processChannelError(result.context, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(result.context, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
 			}
+			if isChannelEnabled && shouldBanModel && channel.GetAutoBan() {
+				disableChannelModel(channel, testModel, newAPIError.Error())
+			}
 
 			// enable channel
 			if !isChannelEnabled && service.ShouldEnableChannel(newAPIError, channel.Status) {
 				service.EnableChannel(channel.Id, common.GetContextKeyString(result.context, constant.ContextKeyChannelKey), channel.Name)
 			}
+			if newAPIError == nil && common.AutomaticEnableChannelEnabled {
+				enableChannelModel(channel, testModel)
+			}
 
+			recordChannelTestResult(channel, "", result, newAPIError, milliseconds)
 			channel.UpdateResponseTime(milliseconds)
 			time.Sleep(common.RequestInterval)
 		}
@@ -575,6 +575,15 @@ func validateChannel(channel *model.Channel, isAdd bool) error {
 	if err := channel.ValidateSettings(); err != nil {
 		return fmt.Errorf("渠道额外设置[channel setting] 格式错误：%s", err.Error())
 	}
+	if channel.OtherSettings != "" {
+		otherSettings := dto.ChannelOtherSettings{}
+		if err := common.UnmarshalJsonStr(channel.OtherSettings, &otherSettings); err != nil {
+			return fmt.Errorf("渠道其他设置格式错误：%s", err.Error())
+		}
+		if err := otherSettings.CostProfile.Validate(); err != nil {
+			return fmt.Errorf("渠道成本设置错误：%s", err.Error())
+		}
+	}
 
 	// 如果是添加操作，检查 channel 和 key 是否为空
 	if isAdd {
@@ -1094,6 +1103,7 @@ func UpdateChannel(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	model.RecordChannelManualStatusEvent(channel.Id, originChannel.Status, channel.Status)
 	model.InitChannelCache()
 	service.ResetProxyClientCache()
 	channel.Key = ""
@@ -1343,12 +1353,15 @@ func CopyChannel(c *gin.Context) {
 
 // MultiKeyManageRequest represents the request for multi-key management operations
 type MultiKeyManageRequest struct {
-	ChannelId int    `json:"channel_id"`
-	Action    string `json:"action"`              // "disable_key", "enable_key", "delete_key", "delete_disabled_keys", "get_key_status"
-	KeyIndex  *int   `json:"key_index,omitempty"` // for disable_key, enable_key, and delete_key actions
-	Page      int    `json:"page,omitempty"`      // for get_key_status pagination
-	PageSize  int    `json:"page_size,omitempty"` // for get_key_status pagination
-	Status    *int   `json:"status,omitempty"`    // for get_key_status filtering: 1=enabled, 2=manual_disabled, 3=auto_disabled, nil=all
+	ChannelId       int    `json:"channel_id"`
+	Action          string `json:"action"`                      // "disable_key", "enable_key", "delete_key", "delete_disabled_keys", "get_key_status", "set_key_weight", "set_key_daily_quota_limit", "set_rate_limit_cooldown"
+	KeyIndex        *int   `json:"key_index,omitempty"`         // for disable_key, enable_key, delete_key, set_key_weight and set_key_daily_quota_limit actions
+	Page            int    `json:"page,omitempty"`              // for get_key_status pagination
+	PageSize        int    `json:"page_size,omitempty"`         // for get_key_status pagination
+	Status          *int   `json:"status,omitempty"`            // for get_key_status filtering: 1=enabled, 2=manual_disabled, 3=auto_disabled, nil=all
+	Weight          *int   `json:"weight,omitempty"`            // for set_key_weight
+	DailyQuotaLimit *int64 `json:"daily_quota_limit,omitempty"` // for set_key_daily_quota_limit, 0 means unlimited
+	Cooldown        *int   `json:"cooldown,omitempty"`          // for set_rate_limit_cooldown, in seconds
 }
 
 // MultiKeyStatusResponse represents the response for key status query
@@ -1365,11 +1378,16 @@ type MultiKeyStatusResponse struct {
 }
 
 type KeyStatus struct {
-	Index        int    `json:"index"`
-	Status       int    `json:"status"` // 1: enabled, 2: disabled
-	DisabledTime int64  `json:"disabled_time,omitempty"`
-	Reason       string `json:"reason,omitempty"`
-	KeyPreview   string `json:"key_preview"` // first 10 chars of key for identification
+	Index           int    `json:"index"`
+	Status          int    `json:"status"` // 1: enabled, 2: disabled
+	DisabledTime    int64  `json:"disabled_time,omitempty"`
+	Reason          string `json:"reason,omitempty"`
+	KeyPreview      string `json:"key_preview"` // first 10 chars of key for identification
+	Weight          int    `json:"weight"`
+	DailyQuotaLimit int64  `json:"daily_quota_limit"`
+	DailyUsedQuota  int64  `json:"daily_used_quota"`
+	CooldownUntil   int64  `json:"cooldown_until,omitempty"`   // rate limit cooldown on this node
+	AutoEnableTime  int64  `json:"auto_enable_time,omitempty"` // auto re-enable time of a rate limited key
 }
 
 // ManageMultiKeys handles multi-key management operations
@@ -1398,6 +1416,9 @@ func ManageMultiKeys(c *gin.Context) {
 		return
 	}
 
+	// snapshot runtime state before taking the polling lock, it locks internally
+	cooldownUntil, pendingUsage := model.GetMultiKeyRuntimeSnapshot(channel.Id)
+
 	lock := model.GetChannelPollingLock(channel.Id)
 	lock.Lock()
 	defer lock.Unlock()
@@ -1405,6 +1426,11 @@ func ManageMultiKeys(c *gin.Context) {
 	switch request.Action {
 	case "get_key_status":
 		keys := channel.GetKeys()
+		dailyUsage, err := model.GetChannelKeyDailyUsage(channel.Id)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
 
 		// Default pagination parameters
 		page := request.Page
@@ -1457,12 +1483,22 @@ func ManageMultiKeys(c *gin.Context) {
 				keyPreview = key[:10] + "..."
 			}
 
+			weight := 1
+			if w, exists := channel.ChannelInfo.MultiKeyWeights[i]; exists {
+				weight = w
+			}
+
 			allKeyStatusList = append(allKeyStatusList, KeyStatus{
-				Index:        i,
-				Status:       status,
-				DisabledTime: disabledTime,
-				Reason:       reason,
-				KeyPreview:   keyPreview,
+				Index:           i,
+				Status:          status,
+				DisabledTime:    disabledTime,
+				Reason:          reason,
+				KeyPreview:      keyPreview,
+				Weight:          weight,
+				DailyQuotaLimit: channel.ChannelInfo.MultiKeyDailyQuotaLimit[i],
+				DailyUsedQuota:  dailyUsage[i] + pendingUsage[i],
+				CooldownUntil:   cooldownUntil[i],
+				AutoEnableTime:  channel.ChannelInfo.MultiKeyAutoEnableTime[i],
 			})
 		}
 
@@ -1588,6 +1624,9 @@ func ManageMultiKeys(c *gin.Context) {
 		if channel.ChannelInfo.MultiKeyDisabledReason != nil {
 			delete(channel.ChannelInfo.MultiKeyDisabledReason, keyIndex)
 		}
+		if channel.ChannelInfo.MultiKeyAutoEnableTime != nil {
+			delete(channel.ChannelInfo.MultiKeyAutoEnableTime, keyIndex)
+		}
 
 		err = channel.Update()
 		if err != nil {
@@ -1612,6 +1651,7 @@ func ManageMultiKeys(c *gin.Context) {
 		channel.ChannelInfo.MultiKeyStatusList = make(map[int]int)
 		channel.ChannelInfo.MultiKeyDisabledTime = make(map[int]int64)
 		channel.ChannelInfo.MultiKeyDisabledReason = make(map[int]string)
+		channel.ChannelInfo.MultiKeyAutoEnableTime = nil
 
 		err = channel.Update()
 		if err != nil {
@@ -1696,6 +1736,7 @@ func ManageMultiKeys(c *gin.Context) {
 		var newStatusList = make(map[int]int)
 		var newDisabledTime = make(map[int]int64)
 		var newDisabledReason = make(map[int]string)
+		var keyIndexMapping = make(map[int]int)
 
 		newIndex := 0
 		for i, key := range keys {
@@ -1705,6 +1746,7 @@ func ManageMultiKeys(c *gin.Context) {
 			}
 
 			remainingKeys = append(remainingKeys, key)
+			keyIndexMapping[i] = newIndex
 
 			// 保留其他密钥的状态信息，重新索引
 			if channel.ChannelInfo.MultiKeyStatusList != nil {
@@ -1739,12 +1781,17 @@ func ManageMultiKeys(c *gin.Context) {
 		channel.ChannelInfo.MultiKeyStatusList = newStatusList
 		channel.ChannelInfo.MultiKeyDisabledTime = newDisabledTime
 		channel.ChannelInfo.MultiKeyDisabledReason = newDisabledReason
+		channel.ChannelInfo.RemapMultiKeyIndexes(keyIndexMapping)
 
 		err = channel.Update()
 		if err != nil {
 			common.ApiError(c, err)
 			return
 		}
+		if err = model.RemapChannelKeyUsage(channel.Id, keyIndexMapping); err != nil {
+			common.SysLog(fmt.Sprintf("failed to remap multi-key usage: channel_id=%d, error=%v", channel.Id, err))
+		}
+		model.ResetMultiKeyRuntimeState(channel.Id)
 
 		model.InitChannelCache()
 		c.JSON(http.StatusOK, gin.H{
@@ -1760,6 +1807,7 @@ func ManageMultiKeys(c *gin.Context) {
 		var newStatusList = make(map[int]int)
 		var newDisabledTime = make(map[int]int64)
 		var newDisabledReason = make(map[int]string)
+		var keyIndexMapping = make(map[int]int)
 
 		newIndex := 0
 		for i, key := range keys {
@@ -1775,6 +1823,7 @@ func ManageMultiKeys(c *gin.Context) {
 				deletedCount++
 			} else {
 				remainingKeys = append(remainingKeys, key)
+				keyIndexMapping[i] = newIndex
 				// 保留非自动禁用密钥的状态信息，重新索引
 				if status != 1 {
 					newStatusList[newIndex] = status
@@ -1807,12 +1856,17 @@ func ManageMultiKeys(c *gin.Context) {
 		channel.ChannelInfo.MultiKeyStatusList = newStatusList
 		channel.ChannelInfo.MultiKeyDisabledTime = newDisabledTime
 		channel.ChannelInfo.MultiKeyDisabledReason = newDisabledReason
+		channel.ChannelInfo.RemapMultiKeyIndexes(keyIndexMapping)
 
 		err = channel.Update()
 		if err != nil {
 			common.ApiError(c, err)
 			return
 		}
+		if err = model.RemapChannelKeyUsage(channel.Id, keyIndexMapping); err != nil {
+			common.SysLog(fmt.Sprintf("failed to remap multi-key usage: channel_id=%d, error=%v", channel.Id, err))
+		}
+		model.ResetMultiKeyRuntimeState(channel.Id)
 
 		model.InitChannelCache()
 		c.JSON(http.StatusOK, gin.H{
@@ -1822,6 +1876,91 @@ func ManageMultiKeys(c *gin.Context) {
 		})
 		return
 
+	case "set_key_weight", "set_key_daily_quota_limit":
+		if request.KeyIndex == nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "未指定密钥索引",
+			})
+			return
+		}
+
+		keyIndex := *request.KeyIndex
+		if keyIndex < 0 || keyIndex >= channel.ChannelInfo.MultiKeySize {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "密钥索引超出范围",
+			})
+			return
+		}
+
+		if request.Action == "set_key_weight" {
+			if request.Weight == nil || *request.Weight < 0 {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "权重不能为空且不能小于0",
+				})
+				return
+			}
+			if channel.ChannelInfo.MultiKeyWeights == nil {
+				channel.ChannelInfo.MultiKeyWeights = make(map[int]int)
+			}
+			channel.ChannelInfo.MultiKeyWeights[keyIndex] = *request.Weight
+		} else {
+			if request.DailyQuotaLimit == nil || *request.DailyQuotaLimit < 0 {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "每日额度上限不能为空且不能小于0",
+				})
+				return
+			}
+			if channel.ChannelInfo.MultiKeyDailyQuotaLimit == nil {
+				channel.ChannelInfo.MultiKeyDailyQuotaLimit = make(map[int]int64)
+			}
+			if *request.DailyQuotaLimit == 0 {
+				delete(channel.ChannelInfo.MultiKeyDailyQuotaLimit, keyIndex)
+			} else {
+				channel.ChannelInfo.MultiKeyDailyQuotaLimit[keyIndex] = *request.DailyQuotaLimit
+			}
+		}
+
+		err = channel.Update()
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+
+		model.InitChannelCache()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "密钥配置已更新",
+		})
+		return
+
+	case "set_rate_limit_cooldown":
+		if request.Cooldown == nil || *request.Cooldown < 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "冷却时间不能为空且不能小于0",
+			})
+			return
+		}
+
+		channel.ChannelInfo.MultiKeyRateLimitCooldown = *request.Cooldown
+
+		err = channel.Update()
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+
+		model.InitChannelCache()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "冷却时间已更新",
+		})
+		return
+
 	default:
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
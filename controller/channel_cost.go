@@ -0,0 +1,23 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetChannelMargins 按渠道、模型与日期统计计费额度、上游成本与毛利
+func GetChannelMargins(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	margins, err := model.GetChannelMargins(channelId, c.Query("model_name"), startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, margins)
+}
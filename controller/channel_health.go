@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	channelHealthDefaultWindow = 24 * time.Hour
+	channelHealthMaxWindow     = model.ChannelHealthRetentionDays * 24 * time.Hour
+	channelHealthEventLimit    = 200
+)
+
+// parseChannelHealthWindow 解析统计窗口，支持 window=24h/7d/30d 或 start_timestamp/end_timestamp
+func parseChannelHealthWindow(c *gin.Context) (int64, int64, error) {
+	endTime := common.GetTimestamp()
+	if endStr := c.Query("end_timestamp"); endStr != "" {
+		parsed, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("无效的结束时间")
+		}
+		endTime = min(parsed, endTime)
+	}
+	if startStr := c.Query("start_timestamp"); startStr != "" {
+		startTime, err := strconv.ParseInt(startStr, 10, 64)
+		if err != nil || startTime >= endTime {
+			return 0, 0, errors.New("无效的开始时间")
+		}
+		return startTime, endTime, nil
+	}
+
+	window := channelHealthDefaultWindow
+	if windowStr := c.Query("window"); windowStr != "" {
+		var err error
+		if days, ok := strings.CutSuffix(windowStr, "d"); ok {
+			var n int
+			n, err = strconv.Atoi(days)
+			window = time.Duration(n) * 24 * time.Hour
+		} else {
+			window, err = time.ParseDuration(windowStr)
+		}
+		if err != nil || window <= 0 {
+			return 0, 0, errors.New("无效的统计窗口")
+		}
+	}
+	window = min(window, channelHealthMaxWindow)
+	return endTime - int64(window.Seconds()), endTime, nil
+}
+
+type channelHealthItem struct {
+	*model.ChannelHealthSummary
+	Name         string `json:"name"`
+	Type         int    `json:"type"`
+	Status       int    `json:"status"`
+	TestTime     int64  `json:"test_time"`
+	ResponseTime int    `json:"response_time"`
+}
+
+// GetChannelsHealth 返回所有渠道在统计窗口内的可用率与成功率
+func GetChannelsHealth(c *gin.Context) {
+	startTime, endTime, err := parseChannelHealthWindow(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channels, err := model.GetAllChannels(0, 0, true, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channelIds := make([]int, 0, len(channels))
+	for _, channel := range channels {
+		channelIds = append(channelIds, channel.Id)
+	}
+	summaries, err := model.GetChannelHealthSummaries(channelIds, startTime, endTime)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	items := make([]*channelHealthItem, 0, len(channels))
+	for _, channel := range channels {
+		items = append(items, &channelHealthItem{
+			ChannelHealthSummary: summaries[channel.Id],
+			Name:                 channel.Name,
+			Type:                 channel.Type,
+			Status:               channel.Status,
+			TestTime:             channel.TestTime,
+			ResponseTime:         channel.ResponseTime,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"start_timestamp": startTime,
+			"end_timestamp":   endTime,
+			"items":           items,
+		},
+	})
+}
+
+// GetChannelHealth 返回单个渠道的可用率、故障时间线、各模型成功率与健康事件
+func GetChannelHealth(c *gin.Context) {
+	channelId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	startTime, endTime, err := parseChannelHealthWindow(c)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(channelId, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	summaries, err := model.GetChannelHealthSummaries([]int{channelId}, startTime, endTime)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	events, err := model.GetChannelHealthEvents(channelId, startTime, endTime, c.Query("event_type"), channelHealthEventLimit)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"start_timestamp": startTime,
+			"end_timestamp":   endTime,
+			"health": &channelHealthItem{
+				ChannelHealthSummary: summaries[channelId],
+				Name:                 channel.Name,
+				Type:                 channel.Type,
+				Status:               channel.Status,
+				TestTime:             channel.TestTime,
+				ResponseTime:         channel.ResponseTime,
+			},
+			"events": events,
+		},
+	})
+}
@@ -0,0 +1,398 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+// 测试计划支持的端点类型
+var channelTestPlanEndpointTypes = []constant.EndpointType{
+	constant.EndpointTypeOpenAI,
+	constant.EndpointTypeOpenAIResponse,
+	constant.EndpointTypeEmbeddings,
+	constant.EndpointTypeImageGeneration,
+}
+
+func validateChannelTestPlan(plan *model.ChannelTestPlan) error {
+	if err := plan.Validate(); err != nil {
+		return err
+	}
+	for _, endpointType := range plan.GetEndpointTypes() {
+		if !lo.Contains(channelTestPlanEndpointTypes, constant.EndpointType(endpointType)) {
+			return fmt.Errorf("不支持的端点类型：%s", endpointType)
+		}
+	}
+	return nil
+}
+
+func GetChannelTestPlans(c *gin.Context) {
+	plans, err := model.GetAllChannelTestPlans()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plans,
+	})
+}
+
+func AddChannelTestPlan(c *gin.Context) {
+	plan := model.ChannelTestPlan{}
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plan.Id = 0
+	plan.LastRunTime = 0
+	if plan.Status == 0 {
+		plan.Status = model.ChannelTestPlanStatusEnabled
+	}
+	if err := validateChannelTestPlan(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := plan.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+}
+
+func UpdateChannelTestPlan(c *gin.Context) {
+	plan := model.ChannelTestPlan{}
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetChannelTestPlanById(plan.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateChannelTestPlan(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := plan.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+}
+
+func DeleteChannelTestPlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteChannelTestPlanById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// RunChannelTestPlan 立即在后台执行一次测试计划
+func RunChannelTestPlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	plan, err := model.GetChannelTestPlanById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !startChannelTestPlan(plan) {
+		common.ApiErrorMsg(c, "该测试计划正在运行中")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetChannelModelTests 返回渠道各模型的最近测试结果与被自动禁用的模型
+func GetChannelModelTests(c *gin.Context) {
+	channelId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	results, err := model.GetChannelModelTests(channelId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	disabledModels, err := model.GetChannelDisabledModels(channelId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"results":         results,
+			"disabled_models": disabledModels,
+		},
+	})
+}
+
+type channelModelStatusRequest struct {
+	ModelName string `json:"model_name"`
+	Enabled   bool   `json:"enabled"`
+}
+
+// UpdateChannelModelStatus 手动启用或禁用渠道下的单个模型
+func UpdateChannelModelStatus(c *gin.Context) {
+	channelId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	req := channelModelStatusRequest{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.ModelName == "" {
+		common.ApiErrorMsg(c, "模型名称不能为空")
+		return
+	}
+	if req.Enabled {
+		_, err = model.EnableChannelModel(channelId, req.ModelName)
+	} else {
+		err = model.DisableChannelModelManually(channelId, req.ModelName)
+	}
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+var runningChannelTestPlans sync.Map
+
+func startChannelTestPlan(plan *model.ChannelTestPlan) bool {
+	if _, running := runningChannelTestPlans.LoadOrStore(plan.Id, true); running {
+		return false
+	}
+	gopool.Go(func() {
+		defer runningChannelTestPlans.Delete(plan.Id)
+		runChannelTestPlan(plan)
+	})
+	return true
+}
+
+func runChannelTestPlan(plan *model.ChannelTestPlan) {
+	if err := plan.UpdateLastRunTime(common.GetTimestamp()); err != nil {
+		common.SysLog(fmt.Sprintf("failed to update channel test plan #%d: %v", plan.Id, err))
+	}
+	var channels []*model.Channel
+	if plan.ChannelId != 0 {
+		channel, err := model.GetChannelById(plan.ChannelId, true)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("channel test plan #%d: failed to get channel #%d: %v", plan.Id, plan.ChannelId, err))
+			return
+		}
+		channels = append(channels, channel)
+	} else {
+		var err error
+		channels, err = model.GetChannelsByTag(plan.Tag, true, true)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("channel test plan #%d: failed to get channels of tag %s: %v", plan.Id, plan.Tag, err))
+			return
+		}
+	}
+
+	for _, channel := range channels {
+		if channel.Status == common.ChannelStatusManuallyDisabled {
+			continue
+		}
+		channelModels := channel.GetModels()
+		testModels := plan.GetModels()
+		if len(testModels) == 0 {
+			testModels = channelModels
+		}
+		for _, testModel := range testModels {
+			if !lo.Contains(channelModels, testModel) {
+				continue
+			}
+			testChannelModelByPlan(plan, channel, testModel)
+		}
+	}
+}
+
+// testChannelModelByPlan 按计划测试渠道下的单个模型，并根据结果禁用或恢复该模型
+func testChannelModelByPlan(plan *model.ChannelTestPlan, channel *model.Channel, testModel string) {
+	endpointTypes := plan.GetEndpointTypes()
+	if len(endpointTypes) == 0 {
+		endpointTypes = []string{""}
+	}
+
+	var failures []string
+	runCheck := func(endpointType string, isStream bool) {
+		tik := time.Now()
+		result := testChannel(channel, testModel, endpointType, isStream)
+		milliseconds := time.Since(tik).Milliseconds()
+		if result.context == nil {
+			// 不支持测试的渠道类型
+			return
+		}
+
+		var checkErr error
+		if result.newAPIError != nil {
+			checkErr = errors.New(result.newAPIError.MaskSensitiveError())
+		} else if result.localErr != nil {
+			checkErr = result.localErr
+		} else if isStream && plan.TTFTThreshold > 0 && (result.ttft == 0 || result.ttft > int64(plan.TTFTThreshold)) {
+			checkErr = fmt.Errorf("首字时间 %.2fs 超过阈值 %.2fs", float64(result.ttft)/1000.0, float64(plan.TTFTThreshold)/1000.0)
+		}
+
+		message := ""
+		if checkErr != nil {
+			message = checkErr.Error()
+			failures = append(failures, fmt.Sprintf("[%s] %s", describeTestCheck(endpointType, isStream), message))
+		}
+		err := model.SaveChannelModelTest(&model.ChannelModelTest{
+			ChannelId:    channel.Id,
+			ModelName:    testModel,
+			EndpointType: endpointType,
+			IsStream:     isStream,
+			Success:      checkErr == nil,
+			ResponseTime: milliseconds,
+			TTFT:         result.ttft,
+			Message:      message,
+			TestTime:     common.GetTimestamp(),
+		})
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to save channel model test: channel_id=%d, model=%s, error=%v", channel.Id, testModel, err))
+		}
+		model.RecordChannelTestEvent(channel.Id, testModel, checkErr == nil, milliseconds, message)
+		time.Sleep(common.RequestInterval)
+	}
+
+	for _, endpointType := range endpointTypes {
+		runCheck(endpointType, false)
+	}
+	if plan.StreamEnabled {
+		// 流式检查只适用于对话类端点
+		streamEndpointType := ""
+		for _, endpointType := range endpointTypes {
+			if endpointType == string(constant.EndpointTypeOpenAI) || endpointType == string(constant.EndpointTypeOpenAIResponse) {
+				streamEndpointType = endpointType
+				break
+			}
+		}
+		if streamEndpointType != "" || lo.Contains(endpointTypes, "") {
+			runCheck(streamEndpointType, true)
+		}
+	}
+
+	if !plan.AutoDisable {
+		return
+	}
+	if len(failures) > 0 {
+		if !common.AutomaticDisableChannelEnabled || !channel.GetAutoBan() {
+			return
+		}
+		disableChannelModel(channel, testModel, strings.Join(failures, "; "))
+		return
+	}
+	if !common.AutomaticEnableChannelEnabled {
+		return
+	}
+	enableChannelModel(channel, testModel)
+}
+
+// disableChannelModel 只禁用渠道下测试失败的模型并通知，渠道的其他模型不受影响
+func disableChannelModel(channel *model.Channel, testModel string, reason string) {
+	disabled, err := model.DisableChannelModel(channel.Id, testModel, reason)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to disable channel model: channel_id=%d, model=%s, error=%v", channel.Id, testModel, err))
+		return
+	}
+	if disabled {
+		subject := fmt.Sprintf("通道「%s」（#%d）的模型 %s 已被禁用", channel.Name, channel.Id, testModel)
+		content := fmt.Sprintf("通道「%s」（#%d）的模型 %s 测试失败，已被禁用，原因：%s", channel.Name, channel.Id, testModel, reason)
+		service.NotifyRootUser(formatChannelModelNotifyType(channel.Id, testModel), subject, content)
+	}
+}
+
+func enableChannelModel(channel *model.Channel, testModel string) {
+	enabled, err := model.AutoEnableChannelModel(channel.Id, testModel)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to enable channel model: channel_id=%d, model=%s, error=%v", channel.Id, testModel, err))
+		return
+	}
+	if enabled {
+		subject := fmt.Sprintf("通道「%s」（#%d）的模型 %s 已被启用", channel.Name, channel.Id, testModel)
+		service.NotifyRootUser(formatChannelModelNotifyType(channel.Id, testModel), subject, subject)
+	}
+}
+
+func describeTestCheck(endpointType string, isStream bool) string {
+	if endpointType == "" {
+		endpointType = "auto"
+	}
+	if isStream {
+		return endpointType + ", stream"
+	}
+	return endpointType
+}
+
+func formatChannelModelNotifyType(channelId int, modelName string) string {
+	return fmt.Sprintf("%s_%d_%s", dto.NotifyTypeChannelUpdate, channelId, modelName)
+}
+
+var autoRunChannelTestPlansOnce sync.Once
+
+// AutomaticallyRunChannelTestPlans 按各测试计划自己的间隔执行测试
+func AutomaticallyRunChannelTestPlans() {
+	// 只在Master节点执行测试计划
+	if !common.IsMasterNode {
+		return
+	}
+	autoRunChannelTestPlansOnce.Do(func() {
+		for {
+			time.Sleep(1 * time.Minute)
+			plans, err := model.GetAllChannelTestPlans()
+			if err != nil {
+				common.SysLog(fmt.Sprintf("failed to load channel test plans: %v", err))
+				continue
+			}
+			now := common.GetTimestamp()
+			for _, plan := range plans {
+				if plan.IsDue(now) {
+					startChannelTestPlan(plan)
+				}
+			}
+		}
+	})
+}
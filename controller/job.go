@@ -0,0 +1,219 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	jobListDefaultLimit = 20
+	jobListMaxLimit     = 100
+)
+
+func jobError(c *gin.Context, statusCode int, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    "invalid_request_error",
+		},
+	})
+}
+
+// ListJobs 统一列出 Midjourney、Suno 与视频等异步任务
+func ListJobs(c *gin.Context) {
+	userId := c.GetInt("id")
+
+	limit := jobListDefaultLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			jobError(c, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(parsed, jobListMaxLimit)
+	}
+
+	status := c.Query("status")
+	if status != "" && !model.IsValidJobStatus(status) {
+		jobError(c, http.StatusBadRequest, "invalid status: "+status)
+		return
+	}
+
+	cursor, err := model.ParseJobCursor(c.Query("cursor"))
+	if err != nil {
+		jobError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, next, err := model.GetUserJobs(userId, limit, model.JobQueryParams{
+		Platform: c.Query("platform"),
+		Status:   status,
+		Cursor:   cursor,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"message": "failed to query jobs",
+				"type":    "server_error",
+			},
+		})
+		return
+	}
+
+	list := &dto.JobList{
+		Object: "list",
+		Data:   make([]*dto.Job, 0, len(records)),
+	}
+	for _, record := range records {
+		list.Data = append(list.Data, JobRecord2Dto(record))
+	}
+	if next != nil {
+		list.HasMore = true
+		list.NextCursor = next.Encode()
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// GetJob 获取单个异步任务
+func GetJob(c *gin.Context) {
+	userId := c.GetInt("id")
+	record, exist, err := model.GetUserJob(userId, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"message": "failed to query job",
+				"type":    "server_error",
+			},
+		})
+		return
+	}
+	if !exist {
+		jobError(c, http.StatusNotFound, "job not found")
+		return
+	}
+	c.JSON(http.StatusOK, JobRecord2Dto(record))
+}
+
+func JobRecord2Dto(record *model.JobRecord) *dto.Job {
+	if record.Midjourney != nil {
+		return midjourney2Job(record.Midjourney)
+	}
+	return task2Job(record.Task)
+}
+
+func parseJobProgress(progress string) int {
+	p, _ := strconv.Atoi(strings.TrimSuffix(progress, "%"))
+	return p
+}
+
+func midjourney2Job(mj *model.Midjourney) *dto.Job {
+	job := dto.NewJob()
+	job.ID = mj.MjId
+	job.Platform = model.JobSourceMidjourney
+	job.Action = mj.Action
+	job.Status = model.MidjourneyJobStatus(mj.Status)
+	job.RawStatus = mj.Status
+	job.Progress = parseJobProgress(mj.Progress)
+	job.Cost = mj.Quota
+	job.CreatedAt = mj.SubmitTime
+	job.StartedAt = mj.StartTime
+	job.CompletedAt = mj.FinishTime
+
+	if mj.FailReason != "" && job.Status == dto.JobStatusFailed {
+		job.Error = &dto.JobError{Message: mj.FailReason}
+	}
+
+	imageUrl := mj.ImageUrl
+	if setting.MjForwardUrlEnabled && imageUrl != "" {
+		imageUrl = system_setting.ServerAddress + "/mj/image/" + mj.MjId
+	}
+	job.AddArtifact(dto.JobArtifactImage, imageUrl)
+	job.AddArtifact(dto.JobArtifactVideo, mj.VideoUrl)
+	if mj.VideoUrls != "" {
+		var videoUrls []dto.ImgUrls
+		if err := json.Unmarshal([]byte(mj.VideoUrls), &videoUrls); err == nil {
+			for _, videoUrl := range videoUrls {
+				if videoUrl.Url != mj.VideoUrl {
+					job.AddArtifact(dto.JobArtifactVideo, videoUrl.Url)
+				}
+			}
+		}
+	}
+	if mj.Action == constant.MjActionDescribe && job.Status == dto.JobStatusCompleted && mj.Prompt != "" {
+		job.Artifacts = append(job.Artifacts, dto.JobArtifact{Type: dto.JobArtifactText, Text: mj.Prompt})
+	}
+	return job
+}
+
+func task2Job(task *model.Task) *dto.Job {
+	job := dto.NewJob()
+	job.ID = task.TaskID
+	job.Platform = string(task.Platform)
+	job.Action = task.Action
+	job.Model = task.Properties.OriginModelName
+	job.Status = model.TaskJobStatus(task.Status)
+	job.RawStatus = string(task.Status)
+	job.Progress = parseJobProgress(task.Progress)
+	job.Cost = task.Quota
+	job.CreatedAt = task.SubmitTime
+	job.StartedAt = task.StartTime
+	job.CompletedAt = task.FinishTime
+
+	switch job.Status {
+	case dto.JobStatusFailed:
+		if task.FailReason != "" {
+			job.Error = &dto.JobError{Message: task.FailReason}
+		}
+	case dto.JobStatusCompleted:
+		if task.Platform == constant.TaskPlatformSuno {
+			addSunoJobArtifacts(job, task)
+		} else {
+			job.AddArtifact(dto.JobArtifactVideo, taskVideoArtifactUrl(task))
+		}
+	}
+	return job
+}
+
+// taskVideoArtifactUrl 需要上游鉴权才能下载的平台（OpenAI、Sora、Gemini）走代理地址，避免暴露密钥；
+// 其余平台的结果地址在任务完成时保存在 FailReason 中，直接返回，没有结果地址时不返回产物
+func taskVideoArtifactUrl(task *model.Task) string {
+	switch task.Platform {
+	case constant.TaskPlatform(strconv.Itoa(constant.ChannelTypeOpenAI)),
+		constant.TaskPlatform(strconv.Itoa(constant.ChannelTypeSora)),
+		constant.TaskPlatform(strconv.Itoa(constant.ChannelTypeGemini)):
+		return system_setting.ServerAddress + "/v1/videos/" + task.TaskID + "/content"
+	}
+	if strings.HasPrefix(task.FailReason, "http://") || strings.HasPrefix(task.FailReason, "https://") {
+		return task.FailReason
+	}
+	return ""
+}
+
+func addSunoJobArtifacts(job *dto.Job, task *model.Task) {
+	if len(task.Data) == 0 {
+		return
+	}
+	var songs []dto.SunoSong
+	if err := json.Unmarshal(task.Data, &songs); err == nil {
+		for _, song := range songs {
+			job.AddArtifact(dto.JobArtifactAudio, song.AudioURL)
+			job.AddArtifact(dto.JobArtifactVideo, song.VideoURL)
+			job.AddArtifact(dto.JobArtifactImage, song.ImageURL)
+		}
+		return
+	}
+	var lyrics dto.SunoLyrics
+	if err := json.Unmarshal(task.Data, &lyrics); err == nil && lyrics.Text != "" {
+		job.Artifacts = append(job.Artifacts, dto.JobArtifact{Type: dto.JobArtifactText, Text: lyrics.Text})
+	}
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func parseTagUsageQuery(c *gin.Context) model.TagUsageQuery {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	tokenId, _ := strconv.Atoi(c.Query("token_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	groupByModel, _ := strconv.ParseBool(c.Query("group_by_model"))
+	return model.TagUsageQuery{
+		TagKey:         c.Query("tag_key"),
+		UserId:         userId,
+		TokenId:        tokenId,
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		GroupByModel:   groupByModel,
+	}
+}
+
+func respondTagUsage(c *gin.Context, query model.TagUsageQuery) {
+	usages, err := model.SumUsedQuotaByTag(query)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if c.Query("format") != "csv" {
+		common.ApiSuccess(c, usages)
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=tag_usage_%s.csv", time.Now().Format("20060102150405")))
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"tag_key", "tag_value", "model_name", "requests", "quota", "amount", "prompt_tokens", "completion_tokens"})
+	for _, usage := range usages {
+		_ = writer.Write([]string{
+			usage.TagKey,
+			usage.TagValue,
+			usage.ModelName,
+			strconv.Itoa(usage.Count),
+			strconv.Itoa(usage.Quota),
+			strconv.FormatFloat(float64(usage.Quota)/common.QuotaPerUnit, 'f', 6, 64),
+			strconv.Itoa(usage.PromptTokens),
+			strconv.Itoa(usage.CompletionTokens),
+		})
+	}
+	writer.Flush()
+}
+
+// GetLogsTagStat 按成本归属标签聚合全部用户的用量，format=csv 时导出 CSV
+func GetLogsTagStat(c *gin.Context) {
+	respondTagUsage(c, parseTagUsageQuery(c))
+}
+
+// GetLogsSelfTagStat 按成本归属标签聚合当前用户的用量
+func GetLogsSelfTagStat(c *gin.Context) {
+	query := parseTagUsageQuery(c)
+	query.UserId = c.GetInt("id")
+	respondTagUsage(c, query)
+}
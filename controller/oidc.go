@@ -1,9 +1,11 @@
 package controller
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -33,6 +35,97 @@ type OidcUser struct {
 	Name              string `json:"name"`
 	PreferredUsername string `json:"preferred_username"`
 	Picture           string `json:"picture"`
+
+	// 合并 ID Token 与 UserInfo 的全部声明，用于组与角色映射
+	Claims map[string]any `json:"-"`
+}
+
+// decodeOidcIdTokenClaims 解析 ID Token 的载荷。ID Token 直接从令牌端点经 TLS 获取，按 OIDC 规范可不校验签名
+func decodeOidcIdTokenClaims(idToken string) map[string]any {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil
+	}
+	var claims map[string]any
+	if err := common.Unmarshal(payload, &claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+// isEmailVerified 邮箱是否经 OIDC 提供方验证，部分提供方以字符串返回 email_verified
+func (oidcUser *OidcUser) isEmailVerified() bool {
+	switch v := oidcUser.Claims["email_verified"].(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	default:
+		return false
+	}
+}
+
+// getOidcClaimValues 读取组或角色声明，支持以 . 分隔的嵌套路径，声明可以是字符串或字符串数组
+func getOidcClaimValues(claims map[string]any, path string) []string {
+	if path == "" {
+		return nil
+	}
+	var current any = claims
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	switch v := current.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				values = append(values, str)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// applyOidcAccess 按声明映射设置用户的分组、权限等级与自定义管理角色，超级管理员不受影响。
+// 没有映射命中时分组保持不变；配置了权限映射时未命中的用户回到普通用户
+func applyOidcAccess(user *model.User, oidcUser *OidcUser) bool {
+	if user.Role >= common.RoleRootUser {
+		return false
+	}
+	settings := system_setting.GetOIDCSettings()
+	access := settings.ResolveAccess(getOidcClaimValues(oidcUser.Claims, settings.GroupsClaim))
+	changed := false
+	if access.Group != "" && access.Group != user.Group {
+		user.Group = access.Group
+		changed = true
+	}
+	if settings.MapsRole() {
+		role := common.RoleCommonUser
+		if access.Role >= common.RoleAdminUser {
+			role = common.RoleAdminUser
+		}
+		if role != user.Role {
+			user.Role = role
+			changed = true
+		}
+	}
+	if settings.MapsRoleId() && access.RoleId != user.RoleId {
+		user.RoleId = access.RoleId
+		changed = true
+	}
+	return changed
 }
 
 func getOidcUserInfoByCode(code string) (*OidcUser, error) {
@@ -89,11 +182,24 @@ func getOidcUserInfoByCode(code string) (*OidcUser, error) {
 		return nil, errors.New("OIDC 获取用户信息失败！请检查设置！")
 	}
 
-	var oidcUser OidcUser
-	err = json.NewDecoder(res2.Body).Decode(&oidcUser)
+	body, err := io.ReadAll(res2.Body)
 	if err != nil {
 		return nil, err
 	}
+	var oidcUser OidcUser
+	if err = json.Unmarshal(body, &oidcUser); err != nil {
+		return nil, err
+	}
+	oidcUser.Claims = decodeOidcIdTokenClaims(oidcResponse.IDToken)
+	if oidcUser.Claims == nil {
+		oidcUser.Claims = make(map[string]any)
+	}
+	var userInfoClaims map[string]any
+	if err = json.Unmarshal(body, &userInfoClaims); err == nil {
+		for key, value := range userInfoClaims {
+			oidcUser.Claims[key] = value
+		}
+	}
 	if oidcUser.OpenID == "" || oidcUser.Email == "" {
 		common.SysLog("OIDC 获取用户信息为空！请检查设置！")
 		return nil, errors.New("OIDC 获取用户信息为空！请检查设置！")
@@ -132,6 +238,7 @@ func OidcAuth(c *gin.Context) {
 	user := model.User{
 		OidcId: oidcUser.OpenID,
 	}
+	settings := system_setting.GetOIDCSettings()
 	if model.IsOidcIdAlreadyTaken(user.OidcId) {
 		err := user.FillUserByOidcId()
 		if err != nil {
@@ -141,8 +248,38 @@ func OidcAuth(c *gin.Context) {
 			})
 			return
 		}
+		if settings.SyncOnLogin && user.Status == common.UserStatusEnabled && applyOidcAccess(&user, oidcUser) {
+			if err := model.UpdateUserAccess(user.Id, user.Group, user.Role, user.RoleId); err != nil {
+				common.ApiError(c, err)
+				return
+			}
+		}
 	} else {
 		if common.RegisterEnabled {
+			// 未验证的邮箱可由用户任意填写，配置了域名白名单时须先确认邮箱已验证
+			if len(settings.AllowedEmailDomains) > 0 && !oidcUser.isEmailVerified() {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "该邮箱未经 OIDC 提供方验证，不允许注册",
+				})
+				return
+			}
+			if !settings.IsEmailDomainAllowed(oidcUser.Email) {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "该邮箱域名不允许注册",
+				})
+				return
+			}
+			if settings.RequireClaimMatch && !settings.ResolveAccess(getOidcClaimValues(oidcUser.Claims, settings.GroupsClaim)).Matched {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": "该账户不在允许注册的组中",
+				})
+				return
+			}
+			user.Role = common.RoleCommonUser
+			applyOidcAccess(&user, oidcUser)
 			user.Email = oidcUser.Email
 			if oidcUser.PreferredUsername != "" {
 				user.Username = oidcUser.PreferredUsername
@@ -178,6 +315,13 @@ func OidcAuth(c *gin.Context) {
 		})
 		return
 	}
+	if settings.AutoCreateToken {
+		if count, err := model.CountUserTokens(user.Id); err == nil && count == 0 {
+			if err := createInitialToken(user.Id, user.Username); err != nil {
+				common.SysLog(fmt.Sprintf("failed to create initial token for oidc user %d: %s", user.Id, err.Error()))
+			}
+		}
+	}
 	setupLogin(&user, c)
 }
 
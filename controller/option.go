@@ -17,10 +17,35 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// pricingOptionKeys 倍率与价格相关的设置，由 pricing 权限管理，其余设置需要 options:write
+var pricingOptionKeys = map[string]bool{
+	"ModelRatio":           true,
+	"CompletionRatio":      true,
+	"GroupRatio":           true,
+	"GroupGroupRatio":      true,
+	"ModelPrice":           true,
+	"CacheRatio":           true,
+	"ImageRatio":           true,
+	"AudioRatio":           true,
+	"AudioCompletionRatio": true,
+	"ModelPriceTiers":      true,
+	"PricingWindows":       true,
+	"ExposeRatioEnabled":   true,
+}
+
+func isPricingOptionKey(key string) bool {
+	return pricingOptionKeys[key] || strings.HasPrefix(key, "group_ratio_setting.")
+}
+
+// GetOptions 只有 pricing 权限时仅返回倍率与价格相关的设置
 func GetOptions(c *gin.Context) {
 	var options []*model.Option
+	pricingOnly := !hasContextPermission(c, common.PermissionOptionsWrite)
 	common.OptionMapRWMutex.Lock()
 	for k, v := range common.OptionMap {
+		if pricingOnly && !isPricingOptionKey(k) {
+			continue
+		}
 		if strings.HasSuffix(k, "Token") ||
 			strings.HasSuffix(k, "Secret") ||
 			strings.HasSuffix(k, "Key") ||
@@ -57,6 +82,14 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	permission := common.PermissionOptionsWrite
+	if isPricingOptionKey(option.Key) {
+		permission = common.PermissionPricingWrite
+	}
+	if !hasContextPermission(c, permission) {
+		common.ApiErrorMsg(c, "无权修改该设置，缺少权限 "+permission)
+		return
+	}
 	switch option.Value.(type) {
 	case bool:
 		option.Value = common.Interface2String(option.Value.(bool))
@@ -169,6 +202,24 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "ModelPriceTiers":
+		err = ratio_setting.CheckModelPriceTiers(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "分档倍率设置失败: " + err.Error(),
+			})
+			return
+		}
+	case "PricingWindows":
+		err = ratio_setting.CheckPricingWindows(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "定时计费窗口设置失败: " + err.Error(),
+			})
+			return
+		}
 	case "ModelRequestRateLimitGroup":
 		err = setting.CheckModelRequestRateLimitGroup(option.Value.(string))
 		if err != nil {
@@ -232,6 +283,24 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "console_setting.status_page_models":
+		err = console_setting.ValidateConsoleSettings(option.Value.(string), "StatusPageModels")
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "console_setting.status_page_groups":
+		err = console_setting.ValidateConsoleSettings(option.Value.(string), "StatusPageGroups")
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	}
 	err = model.UpdateOption(option.Key, option.Value.(string))
 	if err != nil {
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func validatePriceOverride(override *model.PriceOverride) error {
+	if err := override.Validate(); err != nil {
+		return err
+	}
+	if _, err := model.GetUserById(override.UserId, false); err != nil {
+		return errors.New("用户不存在")
+	}
+	if override.TokenId != 0 {
+		if _, err := model.GetTokenByIds(override.TokenId, override.UserId); err != nil {
+			return errors.New("令牌不存在或不属于该用户")
+		}
+	}
+	return nil
+}
+
+func GetPriceOverrides(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	overrides, total, err := model.GetPriceOverrides(userId, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(overrides)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetSelfPriceOverrides 用户查看自己的协商价格
+func GetSelfPriceOverrides(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	overrides, total, err := model.GetPriceOverrides(c.GetInt("id"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	for _, override := range overrides {
+		override.Remark = ""
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(overrides)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func AddPriceOverride(c *gin.Context) {
+	override := model.PriceOverride{}
+	if err := c.ShouldBindJSON(&override); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	override.Id = 0
+	if err := validatePriceOverride(&override); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := override.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    override,
+	})
+}
+
+func UpdatePriceOverride(c *gin.Context) {
+	override := model.PriceOverride{}
+	if err := c.ShouldBindJSON(&override); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetPriceOverrideById(override.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validatePriceOverride(&override); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := override.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    override,
+	})
+}
+
+func DeletePriceOverride(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeletePriceOverrideById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
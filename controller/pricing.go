@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"time"
+
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
@@ -46,9 +48,37 @@ func GetPricing(c *gin.Context) {
 		"usable_group":       usableGroup,
 		"supported_endpoint": model.GetSupportedEndpointMap(),
 		"auto_groups":        service.GetUserAutoGroup(group),
+		"pricing_windows":    getUsablePricingWindows(usableGroup),
 	})
 }
 
+type pricingWindowInfo struct {
+	*ratio_setting.PricingWindow
+	Active bool `json:"active"`
+}
+
+// getUsablePricingWindows 返回对用户可用分组生效的定时计费窗口，便于客户端安排批量任务
+func getUsablePricingWindows(usableGroup map[string]string) []pricingWindowInfo {
+	now := time.Now()
+	windows := make([]pricingWindowInfo, 0)
+	for _, window := range ratio_setting.GetPricingWindows() {
+		usable := len(window.Groups) == 0
+		for _, g := range window.Groups {
+			if _, ok := usableGroup[g]; ok {
+				usable = true
+				break
+			}
+		}
+		if usable {
+			windows = append(windows, pricingWindowInfo{
+				PricingWindow: window,
+				Active:        window.ActiveAt(now),
+			})
+		}
+	}
+	return windows
+}
+
 func ResetModelRatio(c *gin.Context) {
 	defaultStr := ratio_setting.DefaultModelRatio2JSONString()
 	err := model.UpdateOption("ModelRatio", defaultStr)
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func parseQuotaLedgerQuery(c *gin.Context) model.QuotaLedgerQuery {
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	tokenId, _ := strconv.Atoi(c.Query("token_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return model.QuotaLedgerQuery{
+		Account:   c.Query("account"),
+		UserId:    userId,
+		TokenId:   tokenId,
+		Reason:    c.Query("reason"),
+		RefId:     c.Query("ref_id"),
+		StartTime: startTimestamp,
+		EndTime:   endTimestamp,
+	}
+}
+
+func GetQuotaLedgers(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	ledgers, total, err := model.GetQuotaLedgers(parseQuotaLedgerQuery(c), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(ledgers)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetSelfQuotaLedgers(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	query := parseQuotaLedgerQuery(c)
+	query.UserId = c.GetInt("id")
+	ledgers, total, err := model.GetQuotaLedgers(query, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(ledgers)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetQuotaLedgerDrifts(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	resolved, _ := strconv.ParseBool(c.Query("resolved"))
+	drifts, total, err := model.GetQuotaLedgerDrifts(resolved, pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(drifts)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// ReconcileQuotaLedger 立即执行一次台账对账
+func ReconcileQuotaLedger(c *gin.Context) {
+	drifts, err := service.RunQuotaLedgerReconcile()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, drifts)
+}
+
+// ResolveQuotaLedgerDrift 确认差异，以当前余额为准补记调整记录
+func ResolveQuotaLedgerDrift(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, errors.New("无效的差异ID"))
+		return
+	}
+	drift, err := model.ResolveQuotaLedgerDrift(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, drift)
+}
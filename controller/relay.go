@@ -104,6 +104,12 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}()
 
+	if relayFormat != types.RelayFormatOpenAIRealtime {
+		if newAPIError = applyInputGuardrails(c); newAPIError != nil {
+			return
+		}
+	}
+
 	request, err := helper.GetAndValidateRequest(c, relayFormat)
 	if err != nil {
 		// Map "request body too large" to 413 so clients can handle it correctly
@@ -120,12 +126,15 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
 		return
 	}
+	service.SetupRequestTags(c, request)
 
 	needSensitiveCheck := setting.ShouldCheckPromptSensitive()
 	needCountToken := constant.CountToken
+	// 实时会话无法预先估算，忽略 dry run
+	dryRun := relayFormat != types.RelayFormatOpenAIRealtime && common.IsRelayDryRun(c)
 	// Avoid building huge CombineText (strings.Join) when token counting and sensitive check are both disabled.
 	var meta *types.TokenCountMeta
-	if needSensitiveCheck || needCountToken {
+	if needSensitiveCheck || needCountToken || dryRun {
 		meta = request.GetTokenCountMeta()
 	} else {
 		meta = fastTokenCountMetaForPricing(request)
@@ -156,6 +165,11 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	// common.SetContextKey(c, constant.ContextKeyTokenCountMeta, meta)
 
+	if dryRun {
+		newAPIError = respondRelayEstimate(c, request, relayInfo, meta)
+		return
+	}
+
 	if priceData.FreeModel {
 		logger.LogInfo(c, fmt.Sprintf("模型 %s 免费，跳过预扣费", relayInfo.OriginModelName))
 	} else {
@@ -188,6 +202,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		if channelErr != nil {
 			logger.LogError(c, channelErr.Error())
 			newAPIError = channelErr
+			// 多Key渠道的key暂时全部限流时换其他渠道重试
+			if channelErr.GetErrorCode() == types.ErrorCodeMultiKeyExhausted && shouldRetry(c, channelErr, common.RetryTimes-retryParam.GetRetry()) {
+				continue
+			}
 			break
 		}
 
@@ -215,6 +233,8 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			newAPIError = relayHandler(c, relayInfo)
 		}
 
+		service.RecordChannelTrafficResult(channel.Id, relayInfo.OriginModelName, newAPIError)
+
 		if newAPIError == nil {
 			return
 		}
@@ -235,6 +255,27 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	}
 }
 
+// applyInputGuardrails 在解析请求前检查请求体，脱敏后的请求体替换缓存，后续解析与转发都使用脱敏后的内容
+func applyInputGuardrails(c *gin.Context) *types.NewAPIError {
+	rules := service.GetGuardrailRules(c, operation_setting.GuardrailStageInput)
+	if len(rules) == 0 || strings.HasPrefix(c.ContentType(), "multipart/") {
+		return nil
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		if common.IsRequestBodyTooLargeError(err) || errors.Is(err, common.ErrRequestBodyTooLarge) {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry())
+		}
+		return types.NewError(err, types.ErrorCodeInvalidRequest)
+	}
+	newBody, result := service.ApplyGuardrailsToJSON(c, rules, operation_setting.GuardrailStageInput, body)
+	if result.Blocked {
+		return service.NewGuardrailBlockedError(operation_setting.GuardrailStageInput, result)
+	}
+	c.Set(common.KeyRequestBody, newBody)
+	return nil
+}
+
 var upgrader = websocket.Upgrader{
 	Subprotocols: []string{"realtime"}, // WS 握手支持的协议，如果有使用 Sec-WebSocket-Protocol，则必须在此声明对应的 Protocol TODO add other protocol
 	CheckOrigin: func(r *http.Request) bool {
@@ -293,6 +334,9 @@ func getChannel(c *gin.Context, info *relaycommon.RelayInfo, retryParam *service
 
 	info.PriceData.GroupRatioInfo = helper.HandleGroupRatio(c, info)
 
+	if errors.Is(err, model.ErrNoCompliantChannel) {
+		return nil, types.NewErrorWithStatusCode(fmt.Errorf("分组 %s 下模型 %s 没有满足数据驻留策略的可用渠道（retry）", selectGroup, info.OriginModelName), types.ErrorCodeNoCompliantChannel, http.StatusForbidden, types.ErrOptionWithSkipRetry())
+	}
 	if err != nil {
 		return nil, types.NewError(fmt.Errorf("获取分组 %s 下模型 %s 的可用渠道失败（retry）: %s", selectGroup, info.OriginModelName, err.Error()), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
 	}
@@ -337,6 +381,7 @@ func processChannelError(c *gin.Context, channelError types.ChannelError, err *t
 	logger.LogError(c, fmt.Sprintf("channel error (channel #%d, status code: %d): %s", channelError.ChannelId, err.StatusCode, err.Error()))
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
+	service.CooldownMultiKeyIfRateLimited(channelError, common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex), err)
 	if service.ShouldDisableChannel(channelError.ChannelType, err) && channelError.AutoBan {
 		gopool.Go(func() {
 			service.DisableChannel(channelError, err.ErrorWithStatusCode())
@@ -386,6 +431,7 @@ func RelayMidjourney(c *gin.Context) {
 		})
 		return
 	}
+	service.SetupRequestTags(c, nil)
 
 	var mjErr *dto.MidjourneyResponse
 	switch relayInfo.RelayMode {
@@ -450,6 +496,7 @@ func RelayTask(c *gin.Context) {
 	if err != nil {
 		return
 	}
+	service.SetupRequestTags(c, nil)
 	taskErr := taskRelayHandler(c, relayInfo)
 	if taskErr == nil {
 		retryTimes = 0
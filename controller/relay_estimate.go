@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RelayEstimatePrice struct {
+	UsePrice             bool    `json:"use_price"`
+	ModelPrice           float64 `json:"model_price"`
+	ModelRatio           float64 `json:"model_ratio"`
+	CompletionRatio      float64 `json:"completion_ratio"`
+	CacheRatio           float64 `json:"cache_ratio"`
+	CacheCreationRatio   float64 `json:"cache_creation_ratio"`
+	ImageRatio           float64 `json:"image_ratio"`
+	AudioRatio           float64 `json:"audio_ratio"`
+	AudioCompletionRatio float64 `json:"audio_completion_ratio"`
+	GroupRatio           float64 `json:"group_ratio"`
+	UserGroupRatio       float64 `json:"user_group_ratio,omitempty"`
+	PricingWindow        string  `json:"pricing_window,omitempty"`
+	PriceTierThreshold   int     `json:"price_tier_threshold,omitempty"`
+	PriceOverrideId      int     `json:"price_override_id,omitempty"`
+}
+
+// RelayEstimateToolSurcharge 按调用次数额外计费的内置工具，实际调用次数由上游决定
+type RelayEstimateToolSurcharge struct {
+	Tool             string  `json:"tool"`
+	PricePerThousand float64 `json:"price_per_thousand"`
+	QuotaPerCall     int     `json:"quota_per_call"`
+}
+
+type RelayEstimateChannel struct {
+	Type     int   `json:"type"`
+	Priority int64 `json:"priority"`
+}
+
+type RelayEstimateResponse struct {
+	Object                string                       `json:"object"`
+	Model                 string                       `json:"model"`
+	UpstreamModel         string                       `json:"upstream_model"`
+	Group                 string                       `json:"group"`
+	EstimatedPromptTokens int                          `json:"estimated_prompt_tokens"`
+	MaxTokens             int                          `json:"max_tokens"`
+	FreeModel             bool                         `json:"free_model"`
+	QuotaToPreConsume     int                          `json:"quota_to_pre_consume"`
+	QuotaPerUnit          float64                      `json:"quota_per_unit"`
+	Price                 RelayEstimatePrice           `json:"price"`
+	ToolSurcharges        []RelayEstimateToolSurcharge `json:"tool_surcharges,omitempty"`
+	Channel               *RelayEstimateChannel        `json:"channel,omitempty"`
+}
+
+// EstimateRelay POST /v1/estimate，按 chat completions 请求体估算费用，需配合 middleware.RelayEstimate 使用
+func EstimateRelay(c *gin.Context) {
+	Relay(c, types.RelayFormatOpenAI)
+}
+
+// getEstimateToolSurcharges 列出请求中声明的按次计费工具及单次调用的额度，与结算时的计算方式一致
+func getEstimateToolSurcharges(request dto.Request, info *relaycommon.RelayInfo, groupRatio float64) []RelayEstimateToolSurcharge {
+	surcharges := make([]RelayEstimateToolSurcharge, 0)
+	add := func(tool string, pricePerThousand float64) {
+		surcharges = append(surcharges, RelayEstimateToolSurcharge{
+			Tool:             tool,
+			PricePerThousand: pricePerThousand,
+			QuotaPerCall:     int(pricePerThousand / 1000 * groupRatio * common.QuotaPerUnit),
+		})
+	}
+	modelName := info.OriginModelName
+	if info.ResponsesUsageInfo != nil {
+		if tool, ok := info.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolWebSearchPreview]; ok {
+			add(dto.BuildInToolWebSearchPreview, operation_setting.GetWebSearchPricePerThousand(modelName, tool.SearchContextSize))
+		}
+		if _, ok := info.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolFileSearch]; ok {
+			add(dto.BuildInToolFileSearch, operation_setting.GetFileSearchPricePerThousand())
+		}
+	} else if strings.HasSuffix(modelName, "search-preview") {
+		searchContextSize := "medium"
+		if textRequest, ok := request.(*dto.GeneralOpenAIRequest); ok && textRequest.WebSearchOptions != nil {
+			searchContextSize = textRequest.WebSearchOptions.SearchContextSize
+		}
+		add("web_search", operation_setting.GetWebSearchPricePerThousand(modelName, searchContextSize))
+	}
+	if claudeRequest, ok := request.(*dto.ClaudeRequest); ok {
+		for _, tool := range claudeRequest.GetTools() {
+			toolMap, ok := tool.(map[string]any)
+			if ok && strings.HasPrefix(common.Interface2String(toolMap["type"]), "web_search") {
+				add("claude_web_search", operation_setting.GetClaudeWebSearchPricePerThousand())
+				break
+			}
+		}
+	}
+	return surcharges
+}
+
+// respondRelayEstimate 在完成校验、模型映射、分组解析与价格计算后返回估算结果，不请求上游也不扣费
+func respondRelayEstimate(c *gin.Context, request dto.Request, info *relaycommon.RelayInfo, meta *types.TokenCountMeta) *types.NewAPIError {
+	info.InitChannelMeta(c)
+	if err := helper.ModelMappedHelper(c, info, request); err != nil {
+		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+	}
+	priceData := info.PriceData
+	groupRatioInfo := priceData.GroupRatioInfo
+	estimate := RelayEstimateResponse{
+		Object:                "estimate",
+		Model:                 info.OriginModelName,
+		UpstreamModel:         info.UpstreamModelName,
+		Group:                 info.UsingGroup,
+		EstimatedPromptTokens: info.GetEstimatePromptTokens(),
+		FreeModel:             priceData.FreeModel,
+		QuotaToPreConsume:     priceData.QuotaToPreConsume,
+		QuotaPerUnit:          common.QuotaPerUnit,
+		Price: RelayEstimatePrice{
+			UsePrice:             priceData.UsePrice,
+			ModelPrice:           priceData.ModelPrice,
+			ModelRatio:           priceData.ModelRatio,
+			CompletionRatio:      priceData.CompletionRatio,
+			CacheRatio:           priceData.CacheRatio,
+			CacheCreationRatio:   priceData.CacheCreationRatio,
+			ImageRatio:           priceData.ImageRatio,
+			AudioRatio:           priceData.AudioRatio,
+			AudioCompletionRatio: priceData.AudioCompletionRatio,
+			GroupRatio:           groupRatioInfo.GroupRatio,
+			PricingWindow:        groupRatioInfo.PricingWindow,
+			PriceOverrideId:      priceData.PriceOverrideId,
+		},
+		ToolSurcharges: getEstimateToolSurcharges(request, info, groupRatioInfo.GroupRatio),
+	}
+	if meta != nil {
+		estimate.MaxTokens = meta.MaxTokens
+	}
+	if groupRatioInfo.HasSpecialRatio {
+		estimate.Price.UserGroupRatio = groupRatioInfo.GroupSpecialRatio
+	}
+	if priceData.PriceTier != nil {
+		estimate.Price.PriceTierThreshold = priceData.PriceTier.Threshold
+	}
+	if channelId := common.GetContextKeyInt(c, constant.ContextKeyChannelId); channelId != 0 {
+		if channel, err := model.CacheGetChannel(channelId); err == nil {
+			estimate.Channel = &RelayEstimateChannel{
+				Type:     channel.Type,
+				Priority: channel.GetPriority(),
+			}
+		}
+	}
+	c.JSON(http.StatusOK, estimate)
+	return nil
+}
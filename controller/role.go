@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleRequest struct {
+	Id          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type AssignRoleRequest struct {
+	UserId int `json:"user_id"`
+	RoleId int `json:"role_id"` // 0 表示取消自定义角色
+}
+
+// hasContextPermission 读取 PermissionAuth 写入上下文的有效权限
+func hasContextPermission(c *gin.Context, permission string) bool {
+	value, ok := c.Get("permissions")
+	if !ok {
+		return false
+	}
+	permissions, _ := value.([]string)
+	return model.HasPermission(permissions, permission)
+}
+
+// checkGrantablePermissions 角色中的权限必须是当前用户自身拥有的，避免借助角色提升权限
+func checkGrantablePermissions(c *gin.Context, permissions []string) bool {
+	missing := make([]string, 0)
+	for _, permission := range permissions {
+		if !hasContextPermission(c, permission) {
+			missing = append(missing, permission)
+		}
+	}
+	if len(missing) > 0 {
+		common.ApiErrorMsg(c, "无权授予自身不具备的权限："+strings.Join(missing, ", "))
+		return false
+	}
+	return true
+}
+
+// GetRoles 返回内置预设角色与自定义角色
+func GetRoles(c *gin.Context) {
+	roles, err := model.GetAllRoles()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"builtin": model.GetBuiltinRoles(),
+		"custom":  roles,
+	})
+}
+
+func GetPermissions(c *gin.Context) {
+	common.ApiSuccess(c, common.AllPermissions)
+}
+
+func AddRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	role := &model.Role{
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if err := role.SetPermissions(req.Permissions); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !checkGrantablePermissions(c, role.PermissionList) {
+		return
+	}
+	if err := role.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("创建角色 %s，权限：%v", role.Name, role.PermissionList))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    role,
+	})
+}
+
+func UpdateRole(c *gin.Context) {
+	var req RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	role, err := model.GetRoleById(req.Id)
+	if err != nil {
+		common.ApiErrorMsg(c, "角色不存在")
+		return
+	}
+	// 修改前后的权限都不能超出自身权限
+	if !checkGrantablePermissions(c, role.PermissionList) {
+		return
+	}
+	role.Name = req.Name
+	role.Description = req.Description
+	if err := role.SetPermissions(req.Permissions); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !checkGrantablePermissions(c, role.PermissionList) {
+		return
+	}
+	if err := role.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, fmt.Sprintf("修改角色 %s，权限：%v", role.Name, role.PermissionList))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    role,
+	})
+}
+
+func DeleteRole(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteRoleById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// AssignRole 为用户分配自定义角色。超级管理员始终拥有全部权限，不需要分配；
+// 只能为权限等级低于自己的其他用户分配，且角色的权限不能超出自身权限
+func AssignRole(c *gin.Context) {
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	user, err := model.GetUserById(req.UserId, false)
+	if err != nil {
+		common.ApiErrorMsg(c, "用户不存在")
+		return
+	}
+	if user.Role >= common.RoleRootUser {
+		common.ApiErrorMsg(c, "超级管理员不需要分配角色")
+		return
+	}
+	if user.Id == c.GetInt("id") {
+		common.ApiErrorMsg(c, "无法为自己分配角色")
+		return
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		common.ApiErrorMsg(c, "无权为同权限等级或更高权限等级的用户分配角色")
+		return
+	}
+	if req.RoleId != 0 {
+		role, err := model.GetRoleById(req.RoleId)
+		if err != nil {
+			common.ApiErrorMsg(c, "角色不存在")
+			return
+		}
+		if !checkGrantablePermissions(c, role.PermissionList) {
+			return
+		}
+	}
+	if err := model.AssignUserRole(user.Id, req.RoleId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(user.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户角色设置为 %d", req.RoleId))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
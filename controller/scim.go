@@ -0,0 +1,723 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// scimFilterPattern 仅支持 IdP 常用的单条件等值过滤，如 userName eq "alice"
+var scimFilterPattern = regexp.MustCompile(`^\s*([A-Za-z.]+)\s+eq\s+"([^"]*)"\s*$`)
+
+// scimMemberPathPattern 匹配 members[value eq "12"] 形式的移除路径
+var scimMemberPathPattern = regexp.MustCompile(`^members\[\s*value\s+eq\s+"([^"]*)"\s*\]$`)
+
+// scimUserFilterFields SCIM 属性与用户查询字段的对应关系
+var scimUserFilterFields = map[string]string{
+	"username":     "username",
+	"emails":       "email",
+	"emails.value": "email",
+	"displayname":  "display_name",
+}
+
+// scimUserChange SCIM 请求对用户的修改，nil 表示不修改
+type scimUserChange struct {
+	UserName    *string
+	DisplayName *string
+	Email       *string
+	Active      *bool
+}
+
+func scimJSON(c *gin.Context, statusCode int, data any) {
+	c.Header("Content-Type", dto.ScimContentType)
+	c.JSON(statusCode, data)
+}
+
+func scimError(c *gin.Context, statusCode int, scimType string, detail string) {
+	scimJSON(c, statusCode, dto.NewScimError(statusCode, scimType, detail))
+}
+
+// scimPage 解析 SCIM 分页参数，startIndex 从 1 开始
+func scimPage(c *gin.Context) (startIndex int, count int) {
+	startIndex, _ = strconv.Atoi(c.Query("startIndex"))
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(c.Query("count"))
+	if err != nil || count < 0 {
+		count = dto.ScimDefaultPageSize
+	}
+	if count > dto.ScimMaxPageSize {
+		count = dto.ScimMaxPageSize
+	}
+	return startIndex, count
+}
+
+func parseScimFilter(filter string) (attr string, value string, err error) {
+	if strings.TrimSpace(filter) == "" {
+		return "", "", nil
+	}
+	matches := scimFilterPattern.FindStringSubmatch(filter)
+	if matches == nil {
+		return "", "", fmt.Errorf("unsupported filter: %s", filter)
+	}
+	return strings.ToLower(matches[1]), matches[2], nil
+}
+
+func newScimListResponse(total int64, startIndex int, resources []any) *dto.ScimListResponse {
+	return &dto.ScimListResponse{
+		Schemas:      []string{dto.ScimSchemaListResp},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}
+}
+
+func toScimUser(user *model.User) *dto.ScimUser {
+	active := user.Status == common.UserStatusEnabled
+	id := strconv.Itoa(user.Id)
+	scimUser := &dto.ScimUser{
+		Schemas:     []string{dto.ScimSchemaUser},
+		Id:          id,
+		UserName:    user.Username,
+		DisplayName: user.DisplayName,
+		Active:      &active,
+		Meta: &dto.ScimMeta{
+			ResourceType: "User",
+			Location:     "/scim/v2/Users/" + id,
+		},
+	}
+	if user.DisplayName != "" {
+		scimUser.Name = &dto.ScimName{Formatted: user.DisplayName}
+	}
+	if user.Email != "" {
+		scimUser.Emails = []dto.ScimEmail{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	if user.Group != "" {
+		scimUser.Groups = []dto.ScimGroupRef{{Value: user.Group, Display: user.Group}}
+	}
+	return scimUser
+}
+
+func toScimGroup(group string, users []*model.User) *dto.ScimGroup {
+	scimGroup := &dto.ScimGroup{
+		Schemas:     []string{dto.ScimSchemaGroup},
+		Id:          group,
+		DisplayName: group,
+		Meta: &dto.ScimMeta{
+			ResourceType: "Group",
+			Location:     "/scim/v2/Groups/" + group,
+		},
+	}
+	for _, user := range users {
+		scimGroup.Members = append(scimGroup.Members, dto.ScimMember{
+			Value:   strconv.Itoa(user.Id),
+			Display: user.Username,
+		})
+	}
+	return scimGroup
+}
+
+// truncateScimValue 按字符数截断，IdP 的显示名称可能超过用户表的长度限制
+func truncateScimValue(value string, maxLen int) string {
+	runes := []rune(value)
+	if len(runes) > maxLen {
+		return string(runes[:maxLen])
+	}
+	return value
+}
+
+// scimUserDisplayName 优先使用 displayName，其次 name.formatted，最后由名与姓拼接
+func scimUserDisplayName(scimUser *dto.ScimUser) string {
+	if scimUser.DisplayName != "" {
+		return scimUser.DisplayName
+	}
+	if scimUser.Name == nil {
+		return ""
+	}
+	if scimUser.Name.Formatted != "" {
+		return scimUser.Name.Formatted
+	}
+	return strings.TrimSpace(scimUser.Name.GivenName + " " + scimUser.Name.FamilyName)
+}
+
+// getScimUser 加载路由中的用户，超级管理员不允许通过 SCIM 修改
+func getScimUser(c *gin.Context, forWrite bool) (*model.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "user not found")
+		return nil, false
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			scimError(c, http.StatusNotFound, "", "user not found")
+		} else {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+		}
+		return nil, false
+	}
+	if forWrite && user.Role >= common.RoleRootUser {
+		scimError(c, http.StatusForbidden, dto.ScimErrorMutability, "root user cannot be managed by SCIM")
+		return nil, false
+	}
+	return user, true
+}
+
+// applyScimUserChange 写入资料修改，并处理停用与启用：停用时禁用用户的全部令牌，启用时令牌保持禁用，需用户自行启用
+func applyScimUserChange(c *gin.Context, user *model.User, change *scimUserChange) bool {
+	username, displayName, email := user.Username, user.DisplayName, user.Email
+	if change.UserName != nil {
+		username = strings.TrimSpace(*change.UserName)
+	}
+	if change.DisplayName != nil {
+		displayName = truncateScimValue(*change.DisplayName, 20)
+	}
+	if change.Email != nil {
+		email = *change.Email
+	}
+	if username == "" {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, "userName is required")
+		return false
+	}
+	if len(username) > 20 || len(email) > 50 {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, "userName must be at most 20 characters and email at most 50")
+		return false
+	}
+	if username != user.Username {
+		exist, err := model.CheckUserExistOrDeleted(username, "")
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return false
+		}
+		if exist {
+			scimError(c, http.StatusConflict, dto.ScimErrorUniqueness, "userName already exists")
+			return false
+		}
+	}
+	if username != user.Username || displayName != user.DisplayName || email != user.Email {
+		if err := model.UpdateUserProfile(user.Id, username, displayName, email); err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return false
+		}
+		user.Username, user.DisplayName, user.Email = username, displayName, email
+	}
+
+	if change.Active != nil {
+		status := common.UserStatusDisabled
+		if *change.Active {
+			status = common.UserStatusEnabled
+		}
+		if status != user.Status {
+			if err := model.SetUserStatus(user.Id, status); err != nil {
+				scimError(c, http.StatusInternalServerError, "", err.Error())
+				return false
+			}
+			user.Status = status
+			if status == common.UserStatusDisabled {
+				count, err := model.DisableUserTokens(user.Id)
+				if err != nil {
+					scimError(c, http.StatusInternalServerError, "", err.Error())
+					return false
+				}
+				model.RecordLog(user.Id, model.LogTypeManage, fmt.Sprintf("SCIM 停用用户，禁用令牌 %d 个", count))
+				revokeUserSessions(user.Id, "", "SCIM 停用用户")
+			} else {
+				model.RecordLog(user.Id, model.LogTypeManage, "SCIM 启用用户")
+			}
+		}
+	}
+	return true
+}
+
+func ScimServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, gin.H{
+		"schemas":        []string{dto.ScimSchemaSPConfig},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": dto.ScimMaxPageSize},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication using the SCIM bearer token configured in system settings",
+		}},
+	})
+}
+
+func ScimListUsers(c *gin.Context) {
+	attr, value, err := parseScimFilter(c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidFilter, err.Error())
+		return
+	}
+	field := ""
+	if attr != "" {
+		var ok bool
+		if field, ok = scimUserFilterFields[attr]; !ok {
+			scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidFilter, "unsupported filter attribute: "+attr)
+			return
+		}
+	}
+	startIndex, count := scimPage(c)
+	users, total, err := model.FindUsersByField(field, value, startIndex-1, count)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	resources := make([]any, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, toScimUser(user))
+	}
+	scimJSON(c, http.StatusOK, newScimListResponse(total, startIndex, resources))
+}
+
+func ScimGetUser(c *gin.Context) {
+	user, ok := getScimUser(c, false)
+	if !ok {
+		return
+	}
+	scimJSON(c, http.StatusOK, toScimUser(user))
+}
+
+// ScimCreateUser 创建普通用户，密码随机生成，用户通过单点登录使用
+func ScimCreateUser(c *gin.Context) {
+	var req dto.ScimUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, err.Error())
+		return
+	}
+	req.UserName = strings.TrimSpace(req.UserName)
+	if req.UserName == "" {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, "userName is required")
+		return
+	}
+	user := model.User{
+		Username:    req.UserName,
+		Password:    common.GetRandomString(16),
+		DisplayName: truncateScimValue(scimUserDisplayName(&req), 20),
+		Email:       req.PrimaryEmail(),
+		Role:        common.RoleCommonUser,
+		Status:      common.UserStatusEnabled,
+	}
+	if req.Active != nil && !*req.Active {
+		user.Status = common.UserStatusDisabled
+	}
+	if err := common.Validate.Struct(&user); err != nil {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, err.Error())
+		return
+	}
+	exist, err := model.CheckUserExistOrDeleted(user.Username, "")
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	if exist {
+		scimError(c, http.StatusConflict, dto.ScimErrorUniqueness, "userName already exists")
+		return
+	}
+	if err := user.Insert(0); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	model.RecordLog(user.Id, model.LogTypeManage, "SCIM 创建用户")
+	created, err := model.GetUserById(user.Id, false)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scimJSON(c, http.StatusCreated, toScimUser(created))
+}
+
+// ScimReplaceUser 全量替换用户资料，未提供的邮箱与显示名称会被清空
+func ScimReplaceUser(c *gin.Context) {
+	user, ok := getScimUser(c, true)
+	if !ok {
+		return
+	}
+	var req dto.ScimUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, err.Error())
+		return
+	}
+	displayName := scimUserDisplayName(&req)
+	email := req.PrimaryEmail()
+	change := &scimUserChange{
+		UserName:    &req.UserName,
+		DisplayName: &displayName,
+		Email:       &email,
+		Active:      req.Active,
+	}
+	if !applyScimUserChange(c, user, change) {
+		return
+	}
+	scimJSON(c, http.StatusOK, toScimUser(user))
+}
+
+// parseScimUserPatch 将 PATCH 操作转换为用户修改，支持带路径与不带路径（值为对象）两种形式
+func parseScimUserPatch(operations []dto.ScimPatchOperation) (*scimUserChange, error) {
+	change := &scimUserChange{}
+	for _, operation := range operations {
+		op := strings.ToLower(operation.Op)
+		if op != "add" && op != "replace" {
+			return nil, fmt.Errorf("unsupported patch operation: %s", operation.Op)
+		}
+		values := map[string]any{}
+		if operation.Path != "" {
+			values[operation.Path] = operation.Value
+		} else if m, ok := operation.Value.(map[string]any); ok {
+			values = m
+		} else {
+			return nil, errors.New("patch value must be an object when path is empty")
+		}
+		for path, value := range values {
+			if err := applyScimUserPatchValue(change, path, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return change, nil
+}
+
+func applyScimUserPatchValue(change *scimUserChange, path string, value any) error {
+	lowerPath := strings.ToLower(path)
+	switch {
+	case lowerPath == "active":
+		active, ok := value.(bool)
+		if !ok {
+			// 部分 IdP 以字符串形式发送布尔值
+			parsed, err := strconv.ParseBool(fmt.Sprintf("%v", value))
+			if err != nil {
+				return fmt.Errorf("invalid active value: %v", value)
+			}
+			active = parsed
+		}
+		change.Active = &active
+	case lowerPath == "username":
+		s := fmt.Sprintf("%v", value)
+		change.UserName = &s
+	case lowerPath == "displayname" || lowerPath == "name.formatted":
+		s := fmt.Sprintf("%v", value)
+		change.DisplayName = &s
+	case lowerPath == "name":
+		if m, ok := value.(map[string]any); ok {
+			if formatted, ok := m["formatted"].(string); ok {
+				change.DisplayName = &formatted
+			}
+		}
+	case strings.HasPrefix(lowerPath, "emails"):
+		email := ""
+		switch v := value.(type) {
+		case string:
+			email = v
+		case []any:
+			emails := make([]dto.ScimEmail, 0, len(v))
+			for _, item := range v {
+				if m, ok := item.(map[string]any); ok {
+					address, _ := m["value"].(string)
+					primary, _ := m["primary"].(bool)
+					emails = append(emails, dto.ScimEmail{Value: address, Primary: primary})
+				}
+			}
+			email = (&dto.ScimUser{Emails: emails}).PrimaryEmail()
+		}
+		change.Email = &email
+	}
+	// 其他属性（如 externalId、title）不保存，忽略
+	return nil
+}
+
+func ScimPatchUser(c *gin.Context) {
+	user, ok := getScimUser(c, true)
+	if !ok {
+		return
+	}
+	var req dto.ScimPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, err.Error())
+		return
+	}
+	change, err := parseScimUserPatch(req.Operations)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, err.Error())
+		return
+	}
+	if !applyScimUserChange(c, user, change) {
+		return
+	}
+	scimJSON(c, http.StatusOK, toScimUser(user))
+}
+
+// ScimDeleteUser 禁用用户的全部令牌后删除用户
+func ScimDeleteUser(c *gin.Context) {
+	user, ok := getScimUser(c, true)
+	if !ok {
+		return
+	}
+	count, err := model.DisableUserTokens(user.Id)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	if err := user.Delete(); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	model.RecordLog(user.Id, model.LogTypeManage, fmt.Sprintf("SCIM 删除用户，禁用令牌 %d 个", count))
+	revokeUserSessions(user.Id, "", "SCIM 删除用户")
+	c.Status(http.StatusNoContent)
+}
+
+// getScimGroupNames SCIM 分组即分组倍率中配置的分组，ID 与名称相同
+func getScimGroupNames() []string {
+	groups := make([]string, 0)
+	for group := range ratio_setting.GetGroupRatioCopy() {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+func getScimGroup(c *gin.Context) (string, bool) {
+	group := c.Param("id")
+	if !ratio_setting.ContainsGroupRatio(group) {
+		scimError(c, http.StatusNotFound, "", "group not found")
+		return "", false
+	}
+	return group, true
+}
+
+// ScimListGroups 列表不返回成员，成员通过单个分组查询获取
+func ScimListGroups(c *gin.Context) {
+	attr, value, err := parseScimFilter(c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidFilter, err.Error())
+		return
+	}
+	if attr != "" && attr != "displayname" && attr != "id" {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidFilter, "unsupported filter attribute: "+attr)
+		return
+	}
+	groups := getScimGroupNames()
+	if attr != "" {
+		groups = []string{}
+		if ratio_setting.ContainsGroupRatio(value) {
+			groups = append(groups, value)
+		}
+	}
+	startIndex, count := scimPage(c)
+	resources := make([]any, 0)
+	for i := startIndex - 1; i < len(groups) && len(resources) < count; i++ {
+		resources = append(resources, toScimGroup(groups[i], nil))
+	}
+	scimJSON(c, http.StatusOK, newScimListResponse(int64(len(groups)), startIndex, resources))
+}
+
+func ScimGetGroup(c *gin.Context) {
+	group, ok := getScimGroup(c)
+	if !ok {
+		return
+	}
+	users, err := model.GetUsersByGroup(group)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scimJSON(c, http.StatusOK, toScimGroup(group, users))
+}
+
+// ScimCreateGroup 分组由分组倍率配置决定，不能通过 SCIM 新建；已存在的分组直接返回，便于 IdP 推送分组
+func ScimCreateGroup(c *gin.Context) {
+	var req dto.ScimGroup
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, err.Error())
+		return
+	}
+	if !ratio_setting.ContainsGroupRatio(req.DisplayName) {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, "group must be configured in group ratio first: "+req.DisplayName)
+		return
+	}
+	if len(req.Members) > 0 {
+		if err := setScimGroupMembers(req.DisplayName, scimMemberIds(req.Members)); err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+	}
+	users, err := model.GetUsersByGroup(req.DisplayName)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	scimJSON(c, http.StatusCreated, toScimGroup(req.DisplayName, users))
+}
+
+func scimMemberIds(members []dto.ScimMember) []int {
+	ids := make([]int, 0, len(members))
+	for _, member := range members {
+		if id, err := strconv.Atoi(member.Value); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// parseScimMemberValue 解析 PATCH 中的成员列表，值为 [{"value": "12"}]
+func parseScimMemberValue(value any) []int {
+	items, ok := value.([]any)
+	if !ok {
+		items = []any{value}
+	}
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		m, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		if id, err := strconv.Atoi(fmt.Sprintf("%v", m["value"])); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// removeScimGroupMembers 移出分组的用户回到 default 分组，已不在该分组的用户不受影响
+func removeScimGroupMembers(group string, userIds []int) error {
+	users, err := model.GetUsersByGroup(group)
+	if err != nil {
+		return err
+	}
+	remove := make(map[int]bool, len(userIds))
+	for _, id := range userIds {
+		remove[id] = true
+	}
+	ids := make([]int, 0)
+	for _, user := range users {
+		if remove[user.Id] {
+			ids = append(ids, user.Id)
+		}
+	}
+	return model.UpdateUsersGroup(ids, "default")
+}
+
+// setScimGroupMembers 将分组成员替换为指定用户
+func setScimGroupMembers(group string, userIds []int) error {
+	users, err := model.GetUsersByGroup(group)
+	if err != nil {
+		return err
+	}
+	keep := make(map[int]bool, len(userIds))
+	for _, id := range userIds {
+		keep[id] = true
+	}
+	removed := make([]int, 0)
+	for _, user := range users {
+		if !keep[user.Id] {
+			removed = append(removed, user.Id)
+		}
+	}
+	if group != "default" {
+		if err := model.UpdateUsersGroup(removed, "default"); err != nil {
+			return err
+		}
+	}
+	return model.UpdateUsersGroup(userIds, group)
+}
+
+func ScimReplaceGroup(c *gin.Context) {
+	group, ok := getScimGroup(c)
+	if !ok {
+		return
+	}
+	var req dto.ScimGroup
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, err.Error())
+		return
+	}
+	if req.DisplayName != "" && req.DisplayName != group {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorMutability, "group cannot be renamed")
+		return
+	}
+	if err := setScimGroupMembers(group, scimMemberIds(req.Members)); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+	ScimGetGroup(c)
+}
+
+func ScimPatchGroup(c *gin.Context) {
+	group, ok := getScimGroup(c)
+	if !ok {
+		return
+	}
+	var req dto.ScimPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, err.Error())
+		return
+	}
+	for _, operation := range req.Operations {
+		op := strings.ToLower(operation.Op)
+		path := strings.TrimSpace(operation.Path)
+		var err error
+		switch {
+		case path == "" || strings.EqualFold(path, "members"):
+			value := operation.Value
+			if path == "" {
+				m, ok := value.(map[string]any)
+				if !ok {
+					scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, "patch value must be an object when path is empty")
+					return
+				}
+				if name, exists := m["displayName"]; exists && name != group {
+					scimError(c, http.StatusBadRequest, dto.ScimErrorMutability, "group cannot be renamed")
+					return
+				}
+				value = m["members"]
+				if value == nil {
+					continue
+				}
+			}
+			switch op {
+			case "add":
+				err = model.UpdateUsersGroup(parseScimMemberValue(value), group)
+			case "remove":
+				err = removeScimGroupMembers(group, parseScimMemberValue(value))
+			case "replace":
+				err = setScimGroupMembers(group, parseScimMemberValue(value))
+			default:
+				scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, "unsupported patch operation: "+operation.Op)
+				return
+			}
+		case scimMemberPathPattern.MatchString(path) && op == "remove":
+			id, _ := strconv.Atoi(scimMemberPathPattern.FindStringSubmatch(path)[1])
+			err = removeScimGroupMembers(group, []int{id})
+		case strings.EqualFold(path, "displayName"):
+			if operation.Value != group {
+				scimError(c, http.StatusBadRequest, dto.ScimErrorMutability, "group cannot be renamed")
+				return
+			}
+		default:
+			scimError(c, http.StatusBadRequest, dto.ScimErrorInvalidValue, "unsupported patch path: "+path)
+			return
+		}
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+	}
+	ScimGetGroup(c)
+}
@@ -0,0 +1,307 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GenerateStatementRequest struct {
+	Period string `json:"period"`
+	UserId int    `json:"user_id"` // 为 0 时为账期内所有有额度变动的用户生成
+	Force  bool   `json:"force"`   // 重新生成已有账单，日志已清理时会丢失明细
+}
+
+type invoiceLine struct {
+	Description string
+	Quantity    int
+	Amount      string
+}
+
+type invoiceView struct {
+	Setting        *operation_setting.StatementSetting
+	Statement      *model.Statement
+	InvoiceNo      string
+	IssueDate      string
+	PeriodStart    string
+	PeriodEnd      string
+	Lines          []invoiceLine
+	Subtotal       string
+	TaxAmount      string
+	Total          string
+	OpeningBalance string
+	TopUp          string
+	Redemption     string
+	Consume        string
+	Refund         string
+	Other          string
+	ClosingBalance string
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.InvoiceNo}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", "PingFang SC", sans-serif; color: #222; max-width: 800px; margin: 32px auto; padding: 0 16px; }
+h1 { font-size: 24px; margin-bottom: 4px; }
+table { width: 100%; border-collapse: collapse; margin: 16px 0; }
+th, td { padding: 6px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+td.num, th.num { text-align: right; }
+.header { display: flex; justify-content: space-between; }
+.muted { color: #666; font-size: 13px; }
+.total td { font-weight: bold; border-bottom: none; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<div class="header">
+  <div>
+    <h1>{{if .Setting.CompanyName}}{{.Setting.CompanyName}}{{else}}Invoice{{end}}</h1>
+    {{if .Setting.CompanyAddress}}<div class="muted">{{.Setting.CompanyAddress}}</div>{{end}}
+    {{if .Setting.CompanyEmail}}<div class="muted">{{.Setting.CompanyEmail}}</div>{{end}}
+    {{if .Setting.CompanyTaxId}}<div class="muted">Tax ID: {{.Setting.CompanyTaxId}}</div>{{end}}
+  </div>
+  <div>
+    <div><strong>Invoice No.</strong> {{.InvoiceNo}}</div>
+    <div><strong>Issue Date</strong> {{.IssueDate}}</div>
+    <div><strong>Period</strong> {{.PeriodStart}} ~ {{.PeriodEnd}}</div>
+    <div><strong>Bill To</strong> {{.Statement.Username}} (#{{.Statement.UserId}})</div>
+  </div>
+</div>
+
+<table>
+  <tr><th>Description</th><th class="num">Requests</th><th class="num">Amount</th></tr>
+  {{range .Lines}}<tr><td>{{.Description}}</td><td class="num">{{.Quantity}}</td><td class="num">{{.Amount}}</td></tr>
+  {{end}}
+  <tr class="total"><td colspan="2">Subtotal</td><td class="num">{{.Subtotal}}</td></tr>
+  {{if .Setting.TaxName}}<tr class="total"><td colspan="2">{{.Setting.TaxName}}</td><td class="num">{{.TaxAmount}}</td></tr>{{end}}
+  <tr class="total"><td colspan="2">Total</td><td class="num">{{.Total}}</td></tr>
+</table>
+
+<h3>Account Summary</h3>
+<table>
+  <tr><td>Opening Balance</td><td class="num">{{.OpeningBalance}}</td></tr>
+  <tr><td>Top-ups ({{.Statement.TopUpCount}})</td><td class="num">{{.TopUp}}</td></tr>
+  <tr><td>Redemptions</td><td class="num">{{.Redemption}}</td></tr>
+  <tr><td>Usage</td><td class="num">-{{.Consume}}</td></tr>
+  <tr><td>Refunds</td><td class="num">-{{.Refund}}</td></tr>
+  <tr><td>Other Adjustments</td><td class="num">{{.Other}}</td></tr>
+  <tr class="total"><td>Closing Balance</td><td class="num">{{.ClosingBalance}}</td></tr>
+</table>
+{{if .Setting.InvoiceFooter}}<p class="muted">{{.Setting.InvoiceFooter}}</p>{{end}}
+</body>
+</html>
+`))
+
+// getStatementCurrency 按额度展示类型换算金额，按 token 展示时以美元计
+func getStatementCurrency() (string, float64) {
+	switch operation_setting.GetQuotaDisplayType() {
+	case operation_setting.QuotaDisplayTypeCNY:
+		return "¥", operation_setting.USDExchangeRate
+	case operation_setting.QuotaDisplayTypeCustom:
+		symbol := operation_setting.GetGeneralSetting().CustomCurrencySymbol
+		if symbol == "" {
+			symbol = "¤"
+		}
+		rate := operation_setting.GetGeneralSetting().CustomCurrencyExchangeRate
+		if rate <= 0 {
+			rate = 1
+		}
+		return symbol, rate
+	default:
+		return "$", 1
+	}
+}
+
+func getStatementAmount(quota int, rate float64) float64 {
+	return float64(quota) / common.QuotaPerUnit * rate
+}
+
+func renderStatementInvoice(c *gin.Context, statement *model.Statement) {
+	setting := operation_setting.GetStatementSetting()
+	symbol, rate := getStatementCurrency()
+	format := func(quota int) string {
+		return fmt.Sprintf("%s%.2f", symbol, getStatementAmount(quota, rate))
+	}
+
+	view := &invoiceView{
+		Setting:        setting,
+		Statement:      statement,
+		InvoiceNo:      fmt.Sprintf("%s-%s-%06d", setting.InvoicePrefix, strings.ReplaceAll(statement.Period, "-", ""), statement.Id),
+		IssueDate:      time.Unix(statement.CreatedTime, 0).Format("2006-01-02"),
+		PeriodStart:    time.Unix(statement.StartTime, 0).Format("2006-01-02"),
+		PeriodEnd:      time.Unix(statement.EndTime-1, 0).Format("2006-01-02"),
+		OpeningBalance: format(statement.OpeningBalance),
+		TopUp:          format(statement.TopUpQuota),
+		Redemption:     format(statement.RedemptionQuota),
+		Consume:        format(statement.ConsumeQuota),
+		Refund:         format(statement.RefundQuota),
+		Other:          format(statement.OtherQuota),
+		ClosingBalance: format(statement.ClosingBalance),
+	}
+	for _, item := range statement.Models {
+		view.Lines = append(view.Lines, invoiceLine{
+			Description: item.Name,
+			Quantity:    item.RequestCount,
+			Amount:      format(item.Quota),
+		})
+	}
+	subtotal := getStatementAmount(statement.ConsumeQuota, rate)
+	tax := 0.0
+	if setting.TaxName != "" {
+		tax = subtotal * setting.TaxRate
+	}
+	view.Subtotal = fmt.Sprintf("%s%.2f", symbol, subtotal)
+	view.TaxAmount = fmt.Sprintf("%s%.2f", symbol, tax)
+	view.Total = fmt.Sprintf("%s%.2f", symbol, subtotal+tax)
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := invoiceTemplate.Execute(c.Writer, view); err != nil {
+		common.SysError("failed to render invoice: " + err.Error())
+	}
+}
+
+func writeStatementCSV(c *gin.Context, statement *model.Statement) {
+	_, rate := getStatementCurrency()
+	amount := func(quota int) string {
+		return strconv.FormatFloat(getStatementAmount(quota, rate), 'f', 6, 64)
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=statement_%d_%s.csv", statement.UserId, statement.Period))
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"section", "name", "requests", "prompt_tokens", "completion_tokens", "quota", "amount"})
+	summary := []struct {
+		name  string
+		quota int
+	}{
+		{"opening_balance", statement.OpeningBalance},
+		{"topup", statement.TopUpQuota},
+		{"redemption", statement.RedemptionQuota},
+		{"consume", statement.ConsumeQuota},
+		{"refund", statement.RefundQuota},
+		{"other", statement.OtherQuota},
+		{"closing_balance", statement.ClosingBalance},
+	}
+	for _, row := range summary {
+		_ = writer.Write([]string{"summary", row.name, "", "", "", strconv.Itoa(row.quota), amount(row.quota)})
+	}
+	writeItems := func(section string, items []*model.StatementItem) {
+		for _, item := range items {
+			_ = writer.Write([]string{
+				section,
+				item.Name,
+				strconv.Itoa(item.RequestCount),
+				strconv.Itoa(item.PromptTokens),
+				strconv.Itoa(item.CompletionTokens),
+				strconv.Itoa(item.Quota),
+				amount(item.Quota),
+			})
+		}
+	}
+	writeItems("model", statement.Models)
+	writeItems("token", statement.Tokens)
+	writer.Flush()
+}
+
+// respondStatement format=csv 导出 CSV，format=html 输出可打印为 PDF 的发票
+func respondStatement(c *gin.Context, statement *model.Statement) {
+	switch c.Query("format") {
+	case "csv":
+		writeStatementCSV(c, statement)
+	case "html":
+		renderStatementInvoice(c, statement)
+	default:
+		common.ApiSuccess(c, statement)
+	}
+}
+
+func GetSelfStatements(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	statements, total, err := model.GetStatements(c.GetInt("id"), c.Query("period"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(statements)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetSelfStatement(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	statement, err := model.GetStatementById(id, c.GetInt("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "账单不存在")
+		return
+	}
+	respondStatement(c, statement)
+}
+
+func GetAllStatements(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	statements, total, err := model.GetStatements(userId, c.Query("period"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(statements)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetStatement(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	statement, err := model.GetStatementById(id, 0)
+	if err != nil {
+		common.ApiErrorMsg(c, "账单不存在")
+		return
+	}
+	respondStatement(c, statement)
+}
+
+// GenerateStatements 管理员手动生成账单，默认为上一个自然月
+func GenerateStatements(c *gin.Context) {
+	var req GenerateStatementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if req.Period == "" {
+		req.Period = model.GetLastStatementPeriod()
+	}
+	if _, _, err := model.GetStatementPeriodRange(req.Period); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.UserId != 0 {
+		statement, err := model.GenerateStatement(req.UserId, req.Period, req.Force)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		common.ApiSuccess(c, statement)
+		return
+	}
+	count, err := model.GenerateStatements(req.Period)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{"generated": count})
+}
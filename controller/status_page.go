@@ -0,0 +1,188 @@
+package controller
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/console_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseStatusPageWindow 只接受固定的几个统计窗口，避免任意窗口各自触发一次日志聚合并占用缓存
+func parseStatusPageWindow(c *gin.Context) (time.Duration, error) {
+	windowStr := c.Query("window")
+	if windowStr == "" {
+		return service.StatusPageDefaultWindow, nil
+	}
+	window, ok := service.StatusPageWindows[windowStr]
+	if !ok {
+		return 0, fmt.Errorf("无效的统计窗口：%s，可选 24h、7d、30d", windowStr)
+	}
+	return window, nil
+}
+
+func getStatusPageReport(c *gin.Context) (*service.StatusPageReport, bool) {
+	if !console_setting.GetConsoleSetting().StatusPageEnabled {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "状态页未启用",
+		})
+		return nil, false
+	}
+	window, err := parseStatusPageWindow(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+	report, err := service.GetStatusPageReport(window)
+	if err != nil {
+		common.SysError("failed to build status page: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取状态页数据失败",
+		})
+		return nil, false
+	}
+	return report, true
+}
+
+// GetStatusPage 公开状态页：各模型（及公开分组）的可用率、延迟与故障
+func GetStatusPage(c *gin.Context) {
+	report, ok := getStatusPageReport(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    report,
+	})
+}
+
+func statusPageIncidentTitle(incident *service.StatusPageIncident) string {
+	state := "resolved"
+	if incident.Ongoing {
+		state = "ongoing"
+	}
+	return fmt.Sprintf("%s: %s (%s)", incident.ModelName, incident.Status, state)
+}
+
+func statusPageIncidentDescription(incident *service.StatusPageIncident) string {
+	return fmt.Sprintf("%s error rate %.2f%% from %s to %s",
+		incident.ModelName, incident.ErrorRate,
+		time.Unix(incident.StartTime, 0).UTC().Format(time.RFC3339),
+		time.Unix(incident.EndTime, 0).UTC().Format(time.RFC3339))
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	Guid        rssGuid `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// GetStatusPageRSS 以 RSS 2.0 格式输出故障信息
+func GetStatusPageRSS(c *gin.Context) {
+	report, ok := getStatusPageReport(c)
+	if !ok {
+		return
+	}
+	link := system_setting.ServerAddress + "/api/status_page"
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         common.SystemName + " Status",
+			Link:          link,
+			Description:   common.SystemName + " incidents",
+			LastBuildDate: time.Unix(report.UpdatedAt, 0).UTC().Format(time.RFC1123Z),
+			Items:         make([]rssItem, 0, len(report.Incidents)),
+		},
+	}
+	for _, incident := range report.Incidents {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       statusPageIncidentTitle(incident),
+			Link:        link,
+			Description: statusPageIncidentDescription(incident),
+			Guid:        rssGuid{Value: incident.Id},
+			PubDate:     time.Unix(incident.StartTime, 0).UTC().Format(time.RFC1123Z),
+		})
+	}
+	c.XML(http.StatusOK, feed)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	Id      string   `xml:"id"`
+	Link    atomLink `xml:"link"`
+	Updated string   `xml:"updated"`
+	Summary string   `xml:"summary"`
+}
+
+// GetStatusPageAtom 以 Atom 格式输出故障信息
+func GetStatusPageAtom(c *gin.Context) {
+	report, ok := getStatusPageReport(c)
+	if !ok {
+		return
+	}
+	link := system_setting.ServerAddress + "/api/status_page"
+	feed := atomFeed{
+		Title:   common.SystemName + " Status",
+		Id:      link,
+		Link:    atomLink{Href: link},
+		Updated: time.Unix(report.UpdatedAt, 0).UTC().Format(time.RFC3339),
+		Entries: make([]atomEntry, 0, len(report.Incidents)),
+	}
+	for _, incident := range report.Incidents {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   statusPageIncidentTitle(incident),
+			Id:      link + "#" + incident.Id,
+			Link:    atomLink{Href: link},
+			Updated: time.Unix(incident.EndTime, 0).UTC().Format(time.RFC3339),
+			Summary: statusPageIncidentDescription(incident),
+		})
+	}
+	c.Header("Content-Type", "application/atom+xml; charset=utf-8")
+	c.XML(http.StatusOK, feed)
+}
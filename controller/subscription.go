@@ -0,0 +1,436 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/payment"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/subscription"
+	"github.com/thanhpk/randstr"
+)
+
+// 结账与订阅元数据中携带本地订阅单号，用于在回调中关联订阅
+const subscriptionReferenceMetadataKey = "reference_id"
+
+type SubscriptionPayRequest struct {
+	PlanId        int    `json:"plan_id"`
+	PaymentMethod string `json:"payment_method"`
+}
+
+// GetSubscriptionPlans 用户可订阅的套餐
+func GetSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetSubscriptionPlans(true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plans)
+}
+
+func GetAllSubscriptionPlans(c *gin.Context) {
+	plans, err := model.GetSubscriptionPlans(false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plans)
+}
+
+func AddSubscriptionPlan(c *gin.Context) {
+	plan := model.SubscriptionPlan{}
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	plan.Id = 0
+	if err := plan.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := plan.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+}
+
+func UpdateSubscriptionPlan(c *gin.Context) {
+	plan := model.SubscriptionPlan{}
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := model.GetSubscriptionPlanById(plan.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := plan.Validate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := plan.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    plan,
+	})
+}
+
+func DeleteSubscriptionPlan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteSubscriptionPlanById(id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+func GetAllUserSubscriptions(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	subs, total, err := model.GetAllUserSubscriptions(userId, c.Query("status"), pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(subs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetSelfSubscriptions 用户的订阅记录及本周期剩余的订阅额度
+func GetSelfSubscriptions(c *gin.Context) {
+	subs, err := model.GetUserSubscriptions(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subs)
+}
+
+// RequestSubscriptionPay 创建待支付的订阅并返回支付平台的结账链接
+func RequestSubscriptionPay(c *gin.Context) {
+	var req SubscriptionPayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	plan, err := model.GetSubscriptionPlanById(req.PlanId)
+	if err != nil || !plan.Enabled {
+		common.ApiErrorMsg(c, "套餐不存在")
+		return
+	}
+	switch req.PaymentMethod {
+	case PaymentMethodStripe:
+		if plan.StripePriceId == "" {
+			common.ApiErrorMsg(c, "该套餐不支持 Stripe 订阅")
+			return
+		}
+	case PaymentMethodCreem:
+		if plan.CreemProductId == "" {
+			common.ApiErrorMsg(c, "该套餐不支持 Creem 订阅")
+			return
+		}
+	default:
+		common.ApiErrorMsg(c, "不支持的支付渠道")
+		return
+	}
+
+	id := c.GetInt("id")
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	reference := fmt.Sprintf("new-api-sub-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
+	referenceId := "sub_" + common.Sha1([]byte(reference))
+	if _, err := model.CreatePendingSubscription(id, plan, req.PaymentMethod, referenceId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	var payLink string
+	if req.PaymentMethod == PaymentMethodStripe {
+		payLink, err = genStripeSubscriptionLink(referenceId, user.StripeCustomer, user.Email, plan.StripePriceId)
+	} else {
+		var result *payment.CheckoutResult
+		result, err = payment.GetProvider(PaymentMethodCreem).CreateCheckout(&payment.CheckoutRequest{
+			TradeNo:     referenceId,
+			ProductId:   plan.CreemProductId,
+			ProductName: plan.Name,
+			Quota:       int64(plan.Quota),
+			Email:       user.Email,
+			Username:    user.Username,
+		})
+		if err == nil {
+			payLink = result.Url
+		}
+	}
+	if err != nil {
+		log.Printf("获取订阅支付链接失败: %v", err)
+		common.ApiErrorMsg(c, "拉起支付失败")
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"pay_link": payLink,
+		"order_id": referenceId,
+	})
+}
+
+// CancelSelfSubscription 取消自动续费，当前周期结束后订阅失效
+func CancelSelfSubscription(c *gin.Context) {
+	sub, err := model.GetLiveUserSubscription(c.GetInt("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "没有生效中的订阅")
+		return
+	}
+	if sub.CancelAtPeriodEnd || sub.Status == model.SubscriptionStatusCanceled {
+		common.ApiErrorMsg(c, "订阅已取消续费")
+		return
+	}
+	switch sub.PaymentMethod {
+	case PaymentMethodStripe:
+		err = cancelStripeSubscription(sub.ExternalId)
+	case PaymentMethodCreem:
+		err = cancelCreemSubscription(sub.ExternalId)
+	default:
+		err = errors.New("不支持的支付渠道")
+	}
+	if err != nil {
+		log.Printf("取消订阅失败: %v, 订阅单号: %s", err, sub.TradeNo)
+		common.ApiErrorMsg(c, "取消订阅失败")
+		return
+	}
+	if err := model.MarkSubscriptionCanceled(sub.PaymentMethod, sub.TradeNo, "", true); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func genStripeSubscriptionLink(referenceId string, customerId string, email string, priceId string) (string, error) {
+	if !strings.HasPrefix(setting.StripeApiSecret, "sk_") && !strings.HasPrefix(setting.StripeApiSecret, "rk_") {
+		return "", fmt.Errorf("无效的Stripe API密钥")
+	}
+
+	stripe.Key = setting.StripeApiSecret
+
+	params := &stripe.CheckoutSessionParams{
+		ClientReferenceID: stripe.String(referenceId),
+		SuccessURL:        stripe.String(system_setting.ServerAddress + "/console/topup"),
+		CancelURL:         stripe.String(system_setting.ServerAddress + "/console/topup"),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(priceId),
+				Quantity: stripe.Int64(1),
+			},
+		},
+		Mode: stripe.String(string(stripe.CheckoutSessionModeSubscription)),
+		SubscriptionData: &stripe.CheckoutSessionSubscriptionDataParams{
+			Metadata: map[string]string{subscriptionReferenceMetadataKey: referenceId},
+		},
+		AllowPromotionCodes: stripe.Bool(setting.StripePromotionCodesEnabled),
+	}
+	if customerId == "" {
+		if email != "" {
+			params.CustomerEmail = stripe.String(email)
+		}
+	} else {
+		params.Customer = stripe.String(customerId)
+	}
+
+	result, err := session.New(params)
+	if err != nil {
+		return "", err
+	}
+	return result.URL, nil
+}
+
+func cancelStripeSubscription(subscriptionId string) error {
+	if subscriptionId == "" {
+		return errors.New("订阅尚未关联Stripe订阅")
+	}
+	stripe.Key = setting.StripeApiSecret
+	_, err := subscription.Update(subscriptionId, &stripe.SubscriptionParams{
+		CancelAtPeriodEnd: stripe.Bool(true),
+	})
+	return err
+}
+
+func cancelCreemSubscription(subscriptionId string) error {
+	if subscriptionId == "" {
+		return errors.New("订阅尚未关联Creem订阅")
+	}
+	if setting.CreemApiKey == "" {
+		return errors.New("未配置Creem API密钥")
+	}
+	apiUrl := "https://api.creem.io/v1/subscriptions/" + subscriptionId + "/cancel"
+	if setting.CreemTestMode {
+		apiUrl = "https://test-api.creem.io/v1/subscriptions/" + subscriptionId + "/cancel"
+	}
+	req, err := http.NewRequest(http.MethodPost, apiUrl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("x-api-key", setting.CreemApiKey)
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Creem API http status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// stripeSubscriptionCheckoutCompleted 订阅结账完成，关联 Stripe 订阅 ID，额度在首期发票支付回调中发放
+func stripeSubscriptionCheckoutCompleted(event stripe.Event) error {
+	referenceId := event.GetObjectValue("client_reference_id")
+	subscriptionId := event.GetObjectValue("subscription")
+	customerId := event.GetObjectValue("customer")
+	if err := model.BindSubscriptionExternalId(PaymentMethodStripe, referenceId, subscriptionId, customerId); err != nil {
+		return fmt.Errorf("关联Stripe订阅失败 %s: %w", referenceId, err)
+	}
+	log.Printf("Stripe订阅结账完成：%s, %s", referenceId, subscriptionId)
+	return nil
+}
+
+func stripeSubscriptionCheckoutExpired(event stripe.Event) error {
+	referenceId := event.GetObjectValue("client_reference_id")
+	if err := model.MarkSubscriptionCanceled(PaymentMethodStripe, referenceId, "", false); err != nil {
+		return fmt.Errorf("过期订阅订单失败 %s: %w", referenceId, err)
+	}
+	log.Println("订阅订单已过期", referenceId)
+	return nil
+}
+
+// stripeInvoicePaid 订阅发票支付成功（首期或续费），发放新周期额度
+func stripeInvoicePaid(event stripe.Event) error {
+	var invoice stripe.Invoice
+	if err := common.Unmarshal(event.Data.Raw, &invoice); err != nil {
+		return fmt.Errorf("解析Stripe发票失败: %w", err)
+	}
+	if invoice.Subscription == nil || invoice.Subscription.ID == "" {
+		return nil
+	}
+	referenceId := ""
+	if invoice.SubscriptionDetails != nil {
+		referenceId = invoice.SubscriptionDetails.Metadata[subscriptionReferenceMetadataKey]
+	}
+	periodStart, periodEnd := invoice.PeriodStart, invoice.PeriodEnd
+	if invoice.Lines != nil {
+		for _, line := range invoice.Lines.Data {
+			if line.Period != nil && line.Period.End > periodEnd {
+				periodStart, periodEnd = line.Period.Start, line.Period.End
+			}
+		}
+	}
+	err := model.RenewSubscription(PaymentMethodStripe, referenceId, invoice.Subscription.ID, periodStart, periodEnd)
+	if err != nil {
+		return fmt.Errorf("Stripe订阅续费处理失败 %s: %w", invoice.Subscription.ID, err)
+	}
+	log.Printf("Stripe订阅续费成功：%s, %.2f(%s)", invoice.Subscription.ID, float64(invoice.AmountPaid)/100, strings.ToUpper(string(invoice.Currency)))
+	return nil
+}
+
+func stripeInvoicePaymentFailed(event stripe.Event) error {
+	subscriptionId := event.GetObjectValue("subscription")
+	if subscriptionId == "" {
+		return nil
+	}
+	if err := model.MarkSubscriptionPastDue(PaymentMethodStripe, "", subscriptionId); err != nil {
+		return fmt.Errorf("Stripe订阅扣款失败处理失败 %s: %w", subscriptionId, err)
+	}
+	log.Println("Stripe订阅扣款失败，进入宽限期", subscriptionId)
+	return nil
+}
+
+// stripeSubscriptionUpdated 同步用户在 Stripe 客户门户中取消或恢复自动续费
+func stripeSubscriptionUpdated(event stripe.Event) error {
+	subscriptionId := event.GetObjectValue("id")
+	var err error
+	if event.GetObjectValue("cancel_at_period_end") == "true" {
+		err = model.MarkSubscriptionCanceled(PaymentMethodStripe, "", subscriptionId, true)
+	} else {
+		err = model.ResumeSubscription(PaymentMethodStripe, subscriptionId)
+	}
+	if err != nil {
+		return fmt.Errorf("同步Stripe订阅状态失败 %s: %w", subscriptionId, err)
+	}
+	return nil
+}
+
+func stripeSubscriptionDeleted(event stripe.Event) error {
+	subscriptionId := event.GetObjectValue("id")
+	if err := model.MarkSubscriptionCanceled(PaymentMethodStripe, "", subscriptionId, false); err != nil {
+		return fmt.Errorf("Stripe订阅取消处理失败 %s: %w", subscriptionId, err)
+	}
+	log.Println("Stripe订阅已终止", subscriptionId)
+	return nil
+}
+
+// parseCreemTime 解析 Creem 回调中的 ISO 8601 时间
+func parseCreemTime(value string) int64 {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+// handleCreemSubscriptionEvent 处理 Creem 订阅回调，回调对象为订阅本身
+func handleCreemSubscriptionEvent(c *gin.Context, event *CreemSubscriptionWebhookEvent) {
+	subscriptionId := event.Object.Id
+	referenceId := event.Object.Metadata[subscriptionReferenceMetadataKey]
+	var err error
+	switch event.EventType {
+	case "subscription.paid":
+		err = model.RenewSubscription(PaymentMethodCreem, referenceId, subscriptionId,
+			parseCreemTime(event.Object.CurrentPeriodStartDate), parseCreemTime(event.Object.CurrentPeriodEndDate))
+	case "subscription.canceled":
+		err = model.MarkSubscriptionCanceled(PaymentMethodCreem, referenceId, subscriptionId, false)
+	case "subscription.expired":
+		// 周期结束仍未扣款成功，进入宽限期
+		err = model.MarkSubscriptionPastDue(PaymentMethodCreem, referenceId, subscriptionId)
+	default:
+		log.Printf("忽略Creem订阅回调事件类型: %s", event.EventType)
+		c.Status(http.StatusOK)
+		return
+	}
+	if err != nil {
+		log.Printf("Creem订阅回调处理失败: %s, 事件: %s, 订阅: %s", err.Error(), event.EventType, subscriptionId)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Creem订阅回调处理成功 - 事件: %s, 订阅: %s", event.EventType, subscriptionId)
+	c.Status(http.StatusOK)
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -113,6 +115,13 @@ func GetTokenUsage(c *gin.Context) {
 		})
 		return
 	}
+	if err := service.VerifyTokenSignature(c, token); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
 
 	expiredAt := token.ExpiredTime
 	if expiredAt == -1 {
@@ -168,6 +177,11 @@ func AddToken(c *gin.Context) {
 			return
 		}
 	}
+	token.CertIdentity = strings.TrimSpace(token.CertIdentity)
+	if err := validateTokenCertAuth(c, token.CertAuthMode, token.CertIdentity, nil); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -191,6 +205,9 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		AllowedTags:        token.AllowedTags,
+		CertAuthMode:       token.CertAuthMode,
+		CertIdentity:       token.CertIdentity,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -276,6 +293,11 @@ func UpdateToken(c *gin.Context) {
 	if statusOnly != "" {
 		cleanToken.Status = token.Status
 	} else {
+		token.CertIdentity = strings.TrimSpace(token.CertIdentity)
+		if err := validateTokenCertAuth(c, token.CertAuthMode, token.CertIdentity, cleanToken); err != nil {
+			common.ApiError(c, err)
+			return
+		}
 		// If you add more fields, please also update token.Update()
 		cleanToken.Name = token.Name
 		cleanToken.ExpiredTime = token.ExpiredTime
@@ -286,6 +308,9 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		cleanToken.AllowedTags = token.AllowedTags
+		cleanToken.CertAuthMode = token.CertAuthMode
+		cleanToken.CertIdentity = token.CertIdentity
 	}
 	err = cleanToken.Update()
 	if err != nil {
@@ -299,6 +324,70 @@ func UpdateToken(c *gin.Context) {
 	})
 }
 
+// validateTokenCertAuth 校验令牌的客户端证书认证策略。仅凭证书认证的身份只能由管理员绑定且不能重复，
+// 普通用户编辑令牌时可保留已由管理员绑定的身份。current 为修改前的令牌，新建时为 nil
+func validateTokenCertAuth(c *gin.Context, mode string, identity string, current *model.Token) error {
+	switch mode {
+	case common.TokenCertAuthNone:
+		return nil
+	case common.TokenCertAuthCertOnly, common.TokenCertAuthCertAndKey:
+	default:
+		return fmt.Errorf("不支持的证书认证策略：%s", mode)
+	}
+	if identity == "" {
+		return errors.New("开启证书认证时必须填写证书身份")
+	}
+	if len(identity) > 255 {
+		return errors.New("证书身份过长")
+	}
+	if mode != common.TokenCertAuthCertOnly {
+		return nil
+	}
+	tokenId := 0
+	if current != nil {
+		tokenId = current.Id
+		if current.CertAuthMode == mode && current.CertIdentity == identity {
+			return nil
+		}
+	}
+	if c.GetInt("role") < common.RoleAdminUser {
+		return errors.New("仅管理员可以为令牌绑定仅凭证书认证的身份")
+	}
+	if model.IsTokenCertIdentityTaken(identity, tokenId) {
+		return errors.New("该证书身份已绑定其他仅凭证书认证的令牌")
+	}
+	return nil
+}
+
+// EnableTokenSignature 开启令牌的请求签名模式并生成新的签名密钥，已开启时重新生成，旧密钥立即失效
+func EnableTokenSignature(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	secret, err := model.SetTokenSignature(id, c.GetInt("id"), true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"secret": secret,
+		},
+	})
+}
+
+func DisableTokenSignature(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if _, err := model.SetTokenSignature(id, c.GetInt("id"), false); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
 type TokenBatch struct {
 	Ids []int `json:"ids"`
 }
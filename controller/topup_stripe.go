@@ -1,29 +1,26 @@
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/payment"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
-	"github.com/QuantumNous/new-api/setting/system_setting"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stripe/stripe-go/v81"
-	"github.com/stripe/stripe-go/v81/checkout/session"
-	"github.com/stripe/stripe-go/v81/webhook"
 	"github.com/thanhpk/randstr"
 )
 
 const (
-	PaymentMethodStripe = "stripe"
+	PaymentMethodStripe = model.PaymentMethodStripe
 )
 
 var stripeAdaptor = &StripeAdaptor{}
@@ -76,7 +73,12 @@ func (*StripeAdaptor) RequestPay(c *gin.Context, req *StripePayRequest) {
 	reference := fmt.Sprintf("new-api-ref-%d-%d-%s", user.Id, time.Now().UnixMilli(), randstr.String(4))
 	referenceId := "ref_" + common.Sha1([]byte(reference))
 
-	payLink, err := genStripeLink(referenceId, user.StripeCustomer, user.Email, req.Amount)
+	result, err := payment.GetProvider(PaymentMethodStripe).CreateCheckout(&payment.CheckoutRequest{
+		TradeNo:        referenceId,
+		Amount:         req.Amount,
+		Email:          user.Email,
+		StripeCustomer: user.StripeCustomer,
+	})
 	if err != nil {
 		log.Println("获取Stripe Checkout支付链接失败", err)
 		c.JSON(200, gin.H{"message": "error", "data": "拉起支付失败"})
@@ -91,6 +93,7 @@ func (*StripeAdaptor) RequestPay(c *gin.Context, req *StripePayRequest) {
 		PaymentMethod: PaymentMethodStripe,
 		CreateTime:    time.Now().Unix(),
 		Status:        common.TopUpStatusPending,
+		ExternalId:    result.ExternalId,
 	}
 	err = topUp.Insert()
 	if err != nil {
@@ -100,7 +103,7 @@ func (*StripeAdaptor) RequestPay(c *gin.Context, req *StripePayRequest) {
 	c.JSON(200, gin.H{
 		"message": "success",
 		"data": gin.H{
-			"pay_link": payLink,
+			"pay_link": result.Url,
 		},
 	})
 }
@@ -126,127 +129,58 @@ func RequestStripePay(c *gin.Context) {
 }
 
 func StripeWebhook(c *gin.Context) {
-	payload, err := io.ReadAll(c.Request.Body)
+	provider := payment.GetProvider(PaymentMethodStripe)
+	notification, err := provider.VerifyWebhook(c)
 	if err != nil {
-		log.Printf("解析Stripe Webhook参数失败: %v\n", err)
-		c.AbortWithStatus(http.StatusServiceUnavailable)
+		log.Printf("Stripe Webhook验签失败: %v\n", err)
+		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
 
-	signature := c.GetHeader("Stripe-Signature")
-	endpointSecret := setting.StripeWebhookSecret
-	event, err := webhook.ConstructEventWithOptions(payload, signature, endpointSecret, webhook.ConstructEventOptions{
-		IgnoreAPIVersionMismatch: true,
-	})
+	// 一次性充值的结账事件
+	if notification.Type != payment.NotificationIgnored {
+		if err := payment.HandleNotification(provider, notification); err != nil {
+			log.Println(err.Error(), notification.TradeNo)
+		}
+		c.Status(http.StatusOK)
+		return
+	}
 
-	if err != nil {
-		log.Printf("Stripe Webhook验签失败: %v\n", err)
+	var event stripe.Event
+	if err := json.Unmarshal(notification.Payload, &event); err != nil {
+		log.Printf("解析Stripe Webhook参数失败: %v\n", err)
 		c.AbortWithStatus(http.StatusBadRequest)
 		return
 	}
-
+	isSubscriptionCheckout := event.GetObjectValue("mode") == string(stripe.CheckoutSessionModeSubscription)
 	switch event.Type {
 	case stripe.EventTypeCheckoutSessionCompleted:
-		sessionCompleted(event)
+		if isSubscriptionCheckout {
+			err = stripeSubscriptionCheckoutCompleted(event)
+		}
 	case stripe.EventTypeCheckoutSessionExpired:
-		sessionExpired(event)
+		if isSubscriptionCheckout {
+			err = stripeSubscriptionCheckoutExpired(event)
+		}
+	case stripe.EventTypeInvoicePaid:
+		err = stripeInvoicePaid(event)
+	case stripe.EventTypeInvoicePaymentFailed:
+		err = stripeInvoicePaymentFailed(event)
+	case stripe.EventTypeCustomerSubscriptionUpdated:
+		err = stripeSubscriptionUpdated(event)
+	case stripe.EventTypeCustomerSubscriptionDeleted:
+		err = stripeSubscriptionDeleted(event)
 	default:
 		log.Printf("不支持的Stripe Webhook事件类型: %s\n", event.Type)
 	}
-
-	c.Status(http.StatusOK)
-}
-
-func sessionCompleted(event stripe.Event) {
-	customerId := event.GetObjectValue("customer")
-	referenceId := event.GetObjectValue("client_reference_id")
-	status := event.GetObjectValue("status")
-	if "complete" != status {
-		log.Println("错误的Stripe Checkout完成状态:", status, ",", referenceId)
-		return
-	}
-
-	err := model.Recharge(referenceId, customerId)
-	if err != nil {
-		log.Println(err.Error(), referenceId)
-		return
-	}
-
-	total, _ := strconv.ParseFloat(event.GetObjectValue("amount_total"), 64)
-	currency := strings.ToUpper(event.GetObjectValue("currency"))
-	log.Printf("收到款项：%s, %.2f(%s)", referenceId, total/100, currency)
-}
-
-func sessionExpired(event stripe.Event) {
-	referenceId := event.GetObjectValue("client_reference_id")
-	status := event.GetObjectValue("status")
-	if "expired" != status {
-		log.Println("错误的Stripe Checkout过期状态:", status, ",", referenceId)
-		return
-	}
-
-	if len(referenceId) == 0 {
-		log.Println("未提供支付单号")
-		return
-	}
-
-	topUp := model.GetTopUpByTradeNo(referenceId)
-	if topUp == nil {
-		log.Println("充值订单不存在", referenceId)
-		return
-	}
-
-	if topUp.Status != common.TopUpStatusPending {
-		log.Println("充值订单状态错误", referenceId)
-	}
-
-	topUp.Status = common.TopUpStatusExpired
-	err := topUp.Update()
 	if err != nil {
-		log.Println("过期充值订单失败", referenceId, ", err:", err.Error())
+		// 返回 5xx 让 Stripe 稍后重试
+		log.Printf("Stripe订阅回调处理失败: %s, 事件: %s\n", err.Error(), event.Type)
+		c.AbortWithStatus(http.StatusInternalServerError)
 		return
 	}
 
-	log.Println("充值订单已过期", referenceId)
-}
-
-func genStripeLink(referenceId string, customerId string, email string, amount int64) (string, error) {
-	if !strings.HasPrefix(setting.StripeApiSecret, "sk_") && !strings.HasPrefix(setting.StripeApiSecret, "rk_") {
-		return "", fmt.Errorf("无效的Stripe API密钥")
-	}
-
-	stripe.Key = setting.StripeApiSecret
-
-	params := &stripe.CheckoutSessionParams{
-		ClientReferenceID: stripe.String(referenceId),
-		SuccessURL:        stripe.String(system_setting.ServerAddress + "/console/log"),
-		CancelURL:         stripe.String(system_setting.ServerAddress + "/console/topup"),
-		LineItems: []*stripe.CheckoutSessionLineItemParams{
-			{
-				Price:    stripe.String(setting.StripePriceId),
-				Quantity: stripe.Int64(amount),
-			},
-		},
-		Mode:                stripe.String(string(stripe.CheckoutSessionModePayment)),
-		AllowPromotionCodes: stripe.Bool(setting.StripePromotionCodesEnabled),
-	}
-
-	if "" == customerId {
-		if "" != email {
-			params.CustomerEmail = stripe.String(email)
-		}
-
-		params.CustomerCreation = stripe.String(string(stripe.CheckoutSessionCustomerCreationAlways))
-	} else {
-		params.Customer = stripe.String(customerId)
-	}
-
-	result, err := session.New(params)
-	if err != nil {
-		return "", err
-	}
-
-	return result.URL, nil
+	c.Status(http.StatusOK)
 }
 
 func GetChargedAmount(count float64, user model.User) float64 {
@@ -194,6 +194,7 @@ func Enable2FA(c *gin.Context) {
 
 	// 记录操作日志
 	model.RecordLog(userId, model.LogTypeSystem, "成功启用两步验证")
+	revokeUserSessions(userId, c.GetString("session_id"), "启用了两步验证")
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -266,6 +267,7 @@ func Disable2FA(c *gin.Context) {
 
 	// 记录操作日志
 	model.RecordLog(userId, model.LogTypeSystem, "禁用两步验证")
+	revokeUserSessions(userId, c.GetString("session_id"), "禁用了两步验证")
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -546,6 +548,7 @@ func AdminDisable2FA(c *gin.Context) {
 	adminId := c.GetInt("id")
 	model.RecordLog(userId, model.LogTypeManage,
 		fmt.Sprintf("管理员(ID:%d)强制禁用了用户的两步验证", adminId))
+	revokeUserSessions(userId, "", "两步验证被管理员禁用")
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
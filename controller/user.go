@@ -2,6 +2,7 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -96,13 +97,23 @@ func Login(c *gin.Context) {
 
 // setup session & cookies and then return user info
 func setupLogin(user *model.User, c *gin.Context) {
+	userSession, err := model.CreateUserSession(user.Id, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		common.SysLog("failed to create user session: " + err.Error())
+		c.JSON(http.StatusOK, gin.H{
+			"message": "无法保存会话信息，请重试",
+			"success": false,
+		})
+		return
+	}
 	session := sessions.Default(c)
+	session.Set("sid", userSession.SessionId)
 	session.Set("id", user.Id)
 	session.Set("username", user.Username)
 	session.Set("role", user.Role)
 	session.Set("status", user.Status)
 	session.Set("group", user.Group)
-	err := session.Save()
+	err = session.Save()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "无法保存会话信息，请重试",
@@ -126,6 +137,11 @@ func setupLogin(user *model.User, c *gin.Context) {
 
 func Logout(c *gin.Context) {
 	session := sessions.Default(c)
+	if sessionId, ok := session.Get("sid").(string); ok {
+		if err := model.RevokeUserSessionBySessionId(sessionId); err != nil {
+			common.SysLog("failed to revoke user session: " + err.Error())
+		}
+	}
 	session.Clear()
 	err := session.Save()
 	if err != nil {
@@ -232,34 +248,10 @@ func Register(c *gin.Context) {
 	}
 	// 生成默认令牌
 	if constant.GenerateDefaultToken {
-		key, err := common.GenerateKey()
-		if err != nil {
+		if err := createInitialToken(insertedUser.Id, cleanUser.Username); err != nil {
 			c.JSON(http.StatusOK, gin.H{
 				"success": false,
-				"message": "生成默认令牌失败",
-			})
-			common.SysLog("failed to generate token key: " + err.Error())
-			return
-		}
-		// 生成默认令牌
-		token := model.Token{
-			UserId:             insertedUser.Id, // 使用插入后的用户ID
-			Name:               cleanUser.Username + "的初始令牌",
-			Key:                key,
-			CreatedTime:        common.GetTimestamp(),
-			AccessedTime:       common.GetTimestamp(),
-			ExpiredTime:        -1,     // 永不过期
-			RemainQuota:        500000, // 示例额度
-			UnlimitedQuota:     true,
-			ModelLimitsEnabled: false,
-		}
-		if setting.DefaultUseAutoGroup {
-			token.Group = "auto"
-		}
-		if err := token.Insert(); err != nil {
-			c.JSON(http.StatusOK, gin.H{
-				"success": false,
-				"message": "创建默认令牌失败",
+				"message": err.Error(),
 			})
 			return
 		}
@@ -272,6 +264,33 @@ func Register(c *gin.Context) {
 	return
 }
 
+// createInitialToken 为新用户创建默认令牌
+func createInitialToken(userId int, username string) error {
+	key, err := common.GenerateKey()
+	if err != nil {
+		common.SysLog("failed to generate token key: " + err.Error())
+		return errors.New("生成默认令牌失败")
+	}
+	token := model.Token{
+		UserId:             userId,
+		Name:               username + "的初始令牌",
+		Key:                key,
+		CreatedTime:        common.GetTimestamp(),
+		AccessedTime:       common.GetTimestamp(),
+		ExpiredTime:        -1,     // 永不过期
+		RemainQuota:        500000, // 示例额度
+		UnlimitedQuota:     true,
+		ModelLimitsEnabled: false,
+	}
+	if setting.DefaultUseAutoGroup {
+		token.Group = "auto"
+	}
+	if err := token.Insert(); err != nil {
+		return errors.New("创建默认令牌失败")
+	}
+	return nil
+}
+
 func GetAllUsers(c *gin.Context) {
 	pageInfo := common.GetPageQuery(c)
 	users, total, err := model.GetAllUsers(pageInfo)
@@ -330,43 +349,23 @@ func GetUser(c *gin.Context) {
 	return
 }
 
+// GenerateAccessToken 兼容旧版单一访问令牌：重新生成名为 default 的令牌，其他具名令牌不受影响
 func GenerateAccessToken(c *gin.Context) {
 	id := c.GetInt("id")
-	user, err := model.GetUserById(id, true)
-	if err != nil {
-		common.ApiError(c, err)
-		return
-	}
-	// get rand int 28-32
-	randI := common.GetRandomInt(4)
-	key, err := common.GenerateRandomKey(29 + randI)
+	_, key, err := model.ReplaceUserAccessToken(id, model.UserAccessTokenDefaultName)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "生成失败",
 		})
-		common.SysLog("failed to generate key: " + err.Error())
-		return
-	}
-	user.SetAccessToken(key)
-
-	if model.DB.Where("access_token = ?", user.AccessToken).First(user).RowsAffected != 0 {
-		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"message": "请重试，系统生成的 UUID 竟然重复了！",
-		})
-		return
-	}
-
-	if err := user.Update(false); err != nil {
-		common.ApiError(c, err)
+		common.SysLog("failed to generate access token: " + err.Error())
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
-		"data":    user.AccessToken,
+		"data":    key,
 	})
 	return
 }
@@ -439,6 +438,11 @@ func GetSelf(c *gin.Context) {
 
 	// 计算用户权限信息
 	permissions := calculateUserPermissions(userRole)
+	adminPermissions, err := model.GetUserPermissions(id, userRole)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
 
 	// 获取用户设置并提取sidebar_modules
 	userSetting := user.GetSetting()
@@ -470,6 +474,8 @@ func GetSelf(c *gin.Context) {
 		"stripe_customer":   user.StripeCustomer,
 		"sidebar_modules":   userSetting.SidebarModules, // 正确提取sidebar_modules字段
 		"permissions":       permissions,                // 新增权限字段
+		"role_id":           user.RoleId,
+		"admin_permissions": adminPermissions, // 管理接口的有效权限
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -637,6 +643,10 @@ func UpdateUser(c *gin.Context) {
 		})
 		return
 	}
+	if updatedUser.Quota != originUser.Quota && !hasContextPermission(c, common.PermissionUsersQuota) {
+		common.ApiErrorMsg(c, "无权修改用户额度")
+		return
+	}
 	if updatedUser.Password == "$I_LOVE_U" {
 		updatedUser.Password = "" // rollback to what it should be
 	}
@@ -645,6 +655,9 @@ func UpdateUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if updatePassword {
+		revokeUserCredentials(originUser.Id, "", "管理员重置了密码")
+	}
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", logger.LogQuota(originUser.Quota), logger.LogQuota(updatedUser.Quota)))
 	}
@@ -655,6 +668,43 @@ func UpdateUser(c *gin.Context) {
 	return
 }
 
+type UpdateUserQuotaRequest struct {
+	Quota int `json:"quota"`
+}
+
+// UpdateUserQuota 仅修改用户额度，供只有 users:quota 权限的角色使用
+func UpdateUserQuota(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req UpdateUserQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		common.ApiErrorMsg(c, "无权更新同权限等级或更高权限等级的用户信息")
+		return
+	}
+	oldQuota, err := model.SetUserQuota(user.Id, req.Quota)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if oldQuota != req.Quota {
+		model.RecordLog(user.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", logger.LogQuota(oldQuota), logger.LogQuota(req.Quota)))
+	}
+	common.ApiSuccess(c, gin.H{"quota": req.Quota})
+}
+
 func UpdateSelf(c *gin.Context) {
 	var requestData map[string]interface{}
 	err := json.NewDecoder(c.Request.Body).Decode(&requestData)
@@ -749,6 +799,9 @@ func UpdateSelf(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if updatePassword {
+		revokeUserCredentials(cleanUser.Id, c.GetString("session_id"), "修改了密码")
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -823,6 +876,7 @@ func DeleteSelf(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	revokeUserSessions(id, "", "注销了账户")
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -980,6 +1034,9 @@ func ManageUser(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if req.Action == "disable" || req.Action == "delete" {
+		revokeUserSessions(user.Id, "", "账户被管理员禁用或删除")
+	}
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
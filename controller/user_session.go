@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateAccessTokenRequest struct {
+	Name        string `json:"name"`
+	ExpiredTime int64  `json:"expired_time"` // -1 表示永不过期
+}
+
+// revokeUserSessions 强制用户下线，exceptSessionId 不为空时保留当前会话
+func revokeUserSessions(userId int, exceptSessionId string, reason string) {
+	count, err := model.RevokeUserSessions(userId, exceptSessionId)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to revoke sessions of user %d: %s", userId, err.Error()))
+		return
+	}
+	if count > 0 {
+		model.RecordLog(userId, model.LogTypeSystem, fmt.Sprintf("%s，已注销 %d 个登录会话", reason, count))
+	}
+}
+
+// revokeUserCredentials 修改密码后强制用户下线并删除全部访问令牌，exceptSessionId 不为空时保留当前会话
+func revokeUserCredentials(userId int, exceptSessionId string, reason string) {
+	revokeUserSessions(userId, exceptSessionId, reason)
+	count, err := model.RevokeUserAccessTokens(userId)
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to revoke access tokens of user %d: %s", userId, err.Error()))
+		return
+	}
+	if count > 0 {
+		model.RecordLog(userId, model.LogTypeSystem, fmt.Sprintf("%s，已删除 %d 个访问令牌", reason, count))
+	}
+}
+
+// canManageUserSessions 管理员只能管理比自己权限等级低的用户的会话与访问令牌
+func canManageUserSessions(c *gin.Context, userId int) (bool, error) {
+	if userId == c.GetInt("id") {
+		return true, nil
+	}
+	user, err := model.GetUserById(userId, false)
+	if err != nil {
+		return false, err
+	}
+	return c.GetInt("role") > user.Role, nil
+}
+
+func listUserSessions(c *gin.Context, userId int) {
+	userSessions, err := model.GetUserSessions(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	currentSessionId := c.GetString("session_id")
+	for _, userSession := range userSessions {
+		userSession.Current = currentSessionId != "" && userSession.SessionId == currentSessionId
+	}
+	common.ApiSuccess(c, userSessions)
+}
+
+// GetSelfSessions 当前用户的登录会话
+func GetSelfSessions(c *gin.Context) {
+	listUserSessions(c, c.GetInt("id"))
+}
+
+func RevokeSelfSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.RevokeUserSession(c.GetInt("id"), id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// RevokeOtherSelfSessions 注销当前会话以外的全部会话
+func RevokeOtherSelfSessions(c *gin.Context) {
+	count, err := model.RevokeUserSessions(c.GetInt("id"), c.GetString("session_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{"count": count})
+}
+
+func GetUserSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	listUserSessions(c, id)
+}
+
+// RevokeUserSession 管理员注销用户的指定会话，session_id 为 0 时注销全部会话
+func RevokeUserSession(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	allowed, err := canManageUserSessions(c, id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !allowed {
+		common.ApiErrorMsg(c, "无权管理同权限等级或更高权限等级用户的会话")
+		return
+	}
+	sessionId, _ := strconv.Atoi(c.Param("session_id"))
+	if sessionId == 0 {
+		count, err := model.RevokeUserSessions(id, "")
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		model.RecordLog(id, model.LogTypeManage, fmt.Sprintf("管理员注销了用户的全部登录会话（%d 个）", count))
+		common.ApiSuccess(c, gin.H{"count": count})
+		return
+	}
+	if err := model.RevokeUserSession(id, sessionId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(id, model.LogTypeManage, "管理员注销了用户的一个登录会话")
+	common.ApiSuccess(c, nil)
+}
+
+func GetSelfAccessTokens(c *gin.Context) {
+	tokens, err := model.GetUserAccessTokens(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, tokens)
+}
+
+// CreateSelfAccessToken 创建具名的系统访问令牌，明文只在创建时返回一次
+func CreateSelfAccessToken(c *gin.Context) {
+	var req CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.ExpiredTime == 0 {
+		req.ExpiredTime = -1
+	}
+	token, key, err := model.CreateUserAccessToken(c.GetInt("id"), req.Name, req.ExpiredTime)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"token": token,
+			"key":   key,
+		},
+	})
+}
+
+func DeleteSelfAccessToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteUserAccessToken(c.GetInt("id"), id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetUserAccessTokens(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	tokens, err := model.GetUserAccessTokens(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, tokens)
+}
+
+// RevokeUserAccessToken 管理员吊销用户的系统访问令牌
+func RevokeUserAccessToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	allowed, err := canManageUserSessions(c, id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !allowed {
+		common.ApiErrorMsg(c, "无权管理同权限等级或更高权限等级用户的访问令牌")
+		return
+	}
+	tokenId, _ := strconv.Atoi(c.Param("token_id"))
+	if err := model.DeleteUserAccessToken(id, tokenId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(id, model.LogTypeManage, "管理员吊销了用户的一个系统访问令牌")
+	common.ApiSuccess(c, nil)
+}
@@ -1,5 +1,7 @@
 package dto
 
+import "errors"
+
 type ChannelSettings struct {
 	ForceFormat            bool   `json:"force_format,omitempty"`
 	ThinkingToContent      bool   `json:"thinking_to_content,omitempty"`
@@ -7,6 +9,12 @@ type ChannelSettings struct {
 	PassThroughBodyEnabled bool   `json:"pass_through_body_enabled,omitempty"`
 	SystemPrompt           string `json:"system_prompt,omitempty"`
 	SystemPromptOverride   bool   `json:"system_prompt_override,omitempty"`
+
+	// 数据合规属性，按令牌与分组的数据驻留策略筛选渠道
+	Provider          string `json:"provider,omitempty"`            // 上游提供方，如 openai、anthropic、azure
+	Region            string `json:"region,omitempty"`              // 数据处理地区，如 us、eu、cn
+	NoRetention       bool   `json:"no_retention,omitempty"`        // 上游不保留请求数据用于训练
+	ZeroDataRetention bool   `json:"zero_data_retention,omitempty"` // 上游零数据保留（ZDR）
 }
 
 type VertexKeyType string
@@ -24,13 +32,50 @@ const (
 )
 
 type ChannelOtherSettings struct {
-	AzureResponsesVersion string        `json:"azure_responses_version,omitempty"`
-	VertexKeyType         VertexKeyType `json:"vertex_key_type,omitempty"` // "json" or "api_key"
-	OpenRouterEnterprise  *bool         `json:"openrouter_enterprise,omitempty"`
-	AllowServiceTier      bool          `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
-	DisableStore          bool          `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
-	AllowSafetyIdentifier bool          `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
-	AwsKeyType            AwsKeyType    `json:"aws_key_type,omitempty"`
+	AzureResponsesVersion string              `json:"azure_responses_version,omitempty"`
+	VertexKeyType         VertexKeyType       `json:"vertex_key_type,omitempty"` // "json" or "api_key"
+	OpenRouterEnterprise  *bool               `json:"openrouter_enterprise,omitempty"`
+	AllowServiceTier      bool                `json:"allow_service_tier,omitempty"`      // 是否允许 service_tier 透传（默认过滤以避免额外计费）
+	DisableStore          bool                `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
+	AllowSafetyIdentifier bool                `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
+	AwsKeyType            AwsKeyType          `json:"aws_key_type,omitempty"`
+	CostProfile           *ChannelCostProfile `json:"cost_profile,omitempty"` // 上游成本，用于毛利统计与低成本渠道优先
+}
+
+// ChannelCostProfile 渠道的上游成本。ModelCosts 按模型指定成本（按量计费模型为倍率，按次计费模型为美元/次），
+// 未指定的模型按系统模型倍率或价格乘以 CostMultiplier 计算
+type ChannelCostProfile struct {
+	CostMultiplier float64            `json:"cost_multiplier,omitempty"`
+	ModelCosts     map[string]float64 `json:"model_costs,omitempty"`
+}
+
+func (p *ChannelCostProfile) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if p.CostMultiplier < 0 {
+		return errors.New("成本倍数不能小于0")
+	}
+	for _, cost := range p.ModelCosts {
+		if cost < 0 {
+			return errors.New("模型成本不能小于0")
+		}
+	}
+	return nil
+}
+
+// GetCostUnit 返回模型的成本倍率（或按次价格），listUnit 为系统配置的倍率或价格，未设置倍数时按原价计算
+func (p *ChannelCostProfile) GetCostUnit(modelName string, listUnit float64) float64 {
+	if p == nil {
+		return listUnit
+	}
+	if cost, ok := p.ModelCosts[modelName]; ok {
+		return cost
+	}
+	if p.CostMultiplier > 0 {
+		return listUnit * p.CostMultiplier
+	}
+	return listUnit
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
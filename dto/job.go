@@ -0,0 +1,65 @@
+package dto
+
+const (
+	JobStatusUnknown    = "unknown"
+	JobStatusQueued     = "queued"
+	JobStatusInProgress = "in_progress"
+	JobStatusCompleted  = "completed"
+	JobStatusFailed     = "failed"
+)
+
+const (
+	JobArtifactImage = "image"
+	JobArtifactVideo = "video"
+	JobArtifactAudio = "audio"
+	JobArtifactText  = "text"
+)
+
+// Job 统一的异步任务视图，屏蔽 Midjourney 与 Task（Suno、视频等）之间的差异
+type Job struct {
+	ID          string        `json:"id"`
+	Object      string        `json:"object"`
+	Platform    string        `json:"platform"`
+	Action      string        `json:"action"`
+	Model       string        `json:"model,omitempty"`
+	Status      string        `json:"status"` // Should use JobStatus constants
+	RawStatus   string        `json:"raw_status"`
+	Progress    int           `json:"progress"`
+	Artifacts   []JobArtifact `json:"artifacts"`
+	Cost        int           `json:"cost"` // 消耗额度
+	Error       *JobError     `json:"error,omitempty"`
+	CreatedAt   int64         `json:"created_at"`
+	StartedAt   int64         `json:"started_at,omitempty"`
+	CompletedAt int64         `json:"completed_at,omitempty"`
+}
+
+type JobArtifact struct {
+	Type string `json:"type"` // Should use JobArtifact constants
+	Url  string `json:"url,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+type JobError struct {
+	Message string `json:"message"`
+}
+
+type JobList struct {
+	Object     string `json:"object"`
+	Data       []*Job `json:"data"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func NewJob() *Job {
+	return &Job{
+		Object:    "job",
+		Artifacts: make([]JobArtifact, 0),
+	}
+}
+
+func (j *Job) AddArtifact(artifactType string, url string) {
+	if url == "" {
+		return
+	}
+	j.Artifacts = append(j.Artifacts, JobArtifact{Type: artifactType, Url: url})
+}
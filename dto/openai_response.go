@@ -331,6 +331,7 @@ func (o *OpenAIResponsesResponse) GetSize() string {
 
 type IncompleteDetails struct {
 	Reasoning string `json:"reasoning"`
+	Reason    string `json:"reason,omitempty"` // max_output_tokens 或 content_filter
 }
 
 type ResponsesOutput struct {
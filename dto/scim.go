@@ -0,0 +1,120 @@
+package dto
+
+import "strconv"
+
+const (
+	ScimSchemaUser     = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimSchemaGroup    = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimSchemaSPConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	ScimSchemaListResp = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimSchemaPatchOp  = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimSchemaError    = "urn:ietf:params:scim:api:messages:2.0:Error"
+
+	ScimContentType     = "application/scim+json"
+	ScimDefaultPageSize = 100
+	ScimMaxPageSize     = 1000
+)
+
+// SCIM 错误类型，见 RFC 7644 3.12
+const (
+	ScimErrorInvalidValue  = "invalidValue"
+	ScimErrorInvalidFilter = "invalidFilter"
+	ScimErrorUniqueness    = "uniqueness"
+	ScimErrorMutability    = "mutability"
+)
+
+type ScimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Location     string `json:"location,omitempty"`
+}
+
+type ScimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type ScimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type ScimGroupRef struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type ScimUser struct {
+	Schemas     []string       `json:"schemas"`
+	Id          string         `json:"id,omitempty"`
+	ExternalId  string         `json:"externalId,omitempty"`
+	UserName    string         `json:"userName"`
+	Name        *ScimName      `json:"name,omitempty"`
+	DisplayName string         `json:"displayName,omitempty"`
+	Emails      []ScimEmail    `json:"emails,omitempty"`
+	Active      *bool          `json:"active,omitempty"`
+	Groups      []ScimGroupRef `json:"groups,omitempty"`
+	Meta        *ScimMeta      `json:"meta,omitempty"`
+}
+
+// PrimaryEmail 返回标记为 primary 的邮箱，没有时返回第一个
+func (u *ScimUser) PrimaryEmail() string {
+	for _, email := range u.Emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(u.Emails) > 0 {
+		return u.Emails[0].Value
+	}
+	return ""
+}
+
+type ScimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type ScimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	Id          string       `json:"id"`
+	DisplayName string       `json:"displayName"`
+	Members     []ScimMember `json:"members,omitempty"`
+	Meta        *ScimMeta    `json:"meta,omitempty"`
+}
+
+type ScimListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+type ScimPatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path,omitempty"`
+	Value any    `json:"value,omitempty"`
+}
+
+type ScimPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+type ScimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+func NewScimError(status int, scimType string, detail string) *ScimError {
+	return &ScimError{
+		Schemas:  []string{ScimSchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
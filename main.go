@@ -19,6 +19,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/router"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/service/payment"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 
 	"github.com/bytedance/gopkg/util/gopool"
@@ -84,6 +85,11 @@ func main() {
 		}()
 
 		go model.SyncChannelCache(common.SyncFrequency)
+
+		model.InitPriceOverrideCache()
+		go model.SyncPriceOverrideCache(common.SyncFrequency)
+		model.InitSubscriptionCache()
+		go model.SyncSubscriptionCache(common.SyncFrequency)
 	}
 
 	// 热更新配置
@@ -102,9 +108,22 @@ func main() {
 
 	go controller.AutomaticallyTestChannels()
 
+	go controller.AutomaticallyRunChannelTestPlans()
+
 	// Codex credential auto-refresh check every 10 minutes, refresh when expires within 1 day
 	service.StartCodexCredentialAutoRefreshTask()
 
+	// 多Key渠道的key用量落库与限流冷却恢复
+	service.StartMultiKeySyncTask()
+
+	// 渠道健康统计落库与过期数据清理
+	service.StartChannelHealthTask()
+	service.StartQuotaLedgerReconcileTask()
+	service.StartSubscriptionExpireTask()
+	service.StartStatementTask()
+	service.StartAuditLogCleanupTask()
+	payment.StartReconcileTask()
+
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateMidjourneyTaskBulk()
@@ -151,7 +170,7 @@ func main() {
 	store := cookie.NewStore([]byte(common.SessionSecret))
 	store.Options(sessions.Options{
 		Path:     "/",
-		MaxAge:   2592000, // 30 days
+		MaxAge:   common.SessionMaxAge,
 		HttpOnly: true,
 		Secure:   false,
 		SameSite: http.SameSiteStrictMode,
@@ -168,6 +187,10 @@ func main() {
 		port = strconv.Itoa(*common.Port)
 	}
 
+	if common.MTLSPort != "" {
+		startMTLSServer(server)
+	}
+
 	// Log startup success message
 	common.LogStartupSuccess(startTime, port)
 
@@ -177,6 +200,26 @@ func main() {
 	}
 }
 
+// startMTLSServer 启动要求客户端证书的 HTTPS 监听，与主端口共用路由，证书身份在令牌认证中间件中匹配令牌
+func startMTLSServer(handler http.Handler) {
+	tlsConfig, err := common.LoadMTLSConfig()
+	if err != nil {
+		common.FatalLog("failed to load mTLS config: " + err.Error())
+	}
+	mtlsServer := &http.Server{
+		Addr:      ":" + common.MTLSPort,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	gopool.Go(func() {
+		common.SysLog("mTLS server listening on port " + common.MTLSPort)
+		// 证书已在 TLSConfig 中加载，这里无需再次指定文件
+		if err := mtlsServer.ListenAndServeTLS("", ""); err != nil {
+			common.FatalLog("failed to start mTLS server: " + err.Error())
+		}
+	})
+}
+
 func InjectUmamiAnalytics() {
 	analyticsInjectBuilder := &strings.Builder{}
 	if os.Getenv("UMAMI_WEBSITE_ID") != "" {
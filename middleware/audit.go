@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	auditMaxBodyBytes     = 1 << 20
+	auditMaxResponseBytes = 64 << 10
+)
+
+// auditTargetPrefixes 路由前缀与审计目标类型的对应关系，按顺序匹配，未命中时取 /api 后的第一段
+var auditTargetPrefixes = []struct {
+	prefix     string
+	targetType string
+}{
+	{"/api/user/topup", "topup"},
+	{"/api/role/assign", "user"},
+	{"/api/subscription/plan", "subscription_plan"},
+	{"/api/channel/test_plan", "channel_test_plan"},
+}
+
+// auditTargetIdFields 请求体中表示目标 ID 的字段，路由参数 :id 优先
+var auditTargetIdFields = map[string][]string{
+	"option": {"key"},
+	"topup":  {"trade_no"},
+	"user":   {"id", "user_id"},
+}
+
+// auditResponseWriter 保留响应的前一部分，用于判断操作是否成功
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditResponseWriter) capture(data []byte) {
+	if remain := auditMaxResponseBytes - w.body.Len(); remain > 0 {
+		if len(data) > remain {
+			data = data[:remain]
+		}
+		w.body.Write(data)
+	}
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func getAuditTargetType(path string) string {
+	for _, item := range auditTargetPrefixes {
+		if strings.HasPrefix(path, item.prefix) {
+			return item.targetType
+		}
+	}
+	segments := strings.Split(strings.TrimPrefix(path, "/api/"), "/")
+	return segments[0]
+}
+
+func getAuditTargetId(c *gin.Context, targetType string, body map[string]any) string {
+	if id := c.Param("id"); id != "" {
+		return id
+	}
+	fields, ok := auditTargetIdFields[targetType]
+	if !ok {
+		fields = []string{"id"}
+	}
+	for _, field := range fields {
+		if value, exists := body[field]; exists && value != nil {
+			return fmt.Sprintf("%v", value)
+		}
+	}
+	return ""
+}
+
+// readAuditBody 读取 JSON 请求体并放回，非 JSON 或过大的请求体不解析。
+// 未声明长度的请求体超过上限时，已读取的部分与原请求体中的剩余部分拼接放回，不影响后续处理
+func readAuditBody(c *gin.Context) map[string]any {
+	if c.Request.Body == nil || !strings.HasPrefix(c.ContentType(), gin.MIMEJSON) || c.Request.ContentLength > auditMaxBodyBytes {
+		return nil
+	}
+	origBody := c.Request.Body
+	data, err := io.ReadAll(io.LimitReader(origBody, auditMaxBodyBytes+1))
+	c.Request.Body = &readCloser{
+		Reader:  io.MultiReader(bytes.NewReader(data), origBody),
+		closeFn: origBody.Close,
+	}
+	if err != nil || len(data) > auditMaxBodyBytes {
+		return nil
+	}
+	var body map[string]any
+	if err := common.Unmarshal(data, &body); err != nil {
+		return nil
+	}
+	return body
+}
+
+// auditNext 记录已登录用户对 /api 的写操作：操作人、路由、目标、修改前后差异（已脱敏）、IP 与 UA。
+// 由 authHelper 在鉴权通过后代替 c.Next() 调用，未登录的请求不会解析请求体或查询审计目标
+func auditNext(c *gin.Context) {
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions ||
+		!operation_setting.GetAuditSetting().Enabled {
+		c.Next()
+		return
+	}
+	path := c.FullPath()
+	if path == "" {
+		path = c.Request.URL.Path
+	}
+	targetType := getAuditTargetType(path)
+	body := readAuditBody(c)
+	targetId := getAuditTargetId(c, targetType, body)
+
+	var before, after map[string]any
+	if targetType == "option" {
+		// 系统设置以配置项名为字段，密钥类配置项按名称脱敏
+		if targetId != "" {
+			before = model.LoadAuditTarget(targetType, targetId)
+			after = map[string]any{targetId: body["value"]}
+		}
+	} else {
+		// 新建操作没有目标 ID，不加载修改前的数据
+		before = model.LoadAuditTarget(targetType, targetId)
+		if c.Request.Method != http.MethodDelete {
+			after = body
+		}
+	}
+
+	writer := &auditResponseWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+
+	statusCode := writer.Status()
+	log := &model.AuditLog{
+		UserId:     c.GetInt("id"),
+		Username:   c.GetString("username"),
+		Action:     c.Request.Method + " " + path,
+		TargetType: targetType,
+		TargetId:   targetId,
+		Success:    statusCode < http.StatusBadRequest && !bytes.Contains(writer.body.Bytes(), []byte(`"success":false`)),
+		StatusCode: statusCode,
+		Ip:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	gopool.Go(func() {
+		log.Diff = model.BuildAuditDiff(before, after)
+		model.RecordAuditLog(log)
+	})
+}
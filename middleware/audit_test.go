@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAuditBody(t *testing.T) {
+	large := `{"key":"` + strings.Repeat("x", auditMaxBodyBytes) + `"}`
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		chunked     bool // 不声明 Content-Length
+		wantKey     any
+	}{
+		{name: "json body", contentType: "application/json", body: `{"key":"ModelRatio"}`, wantKey: "ModelRatio"},
+		{name: "chunked json body", contentType: "application/json", body: `{"key":"ModelRatio"}`, chunked: true, wantKey: "ModelRatio"},
+		{name: "not json", contentType: "text/plain", body: `{"key":"ModelRatio"}`},
+		{name: "invalid json", contentType: "application/json", body: `{"key":`},
+		{name: "large body", contentType: "application/json", body: large},
+		{name: "large chunked body", contentType: "application/json", body: large, chunked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("POST", "/api/option/", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+			if tt.chunked {
+				c.Request.ContentLength = -1
+			}
+
+			body := readAuditBody(c)
+			if tt.wantKey == nil {
+				require.Nil(t, body)
+			} else {
+				require.Equal(t, tt.wantKey, body["key"])
+			}
+			// 后续处理仍能读到完整的请求体
+			data, err := io.ReadAll(c.Request.Body)
+			require.NoError(t, err)
+			require.Equal(t, tt.body, string(data))
+			require.NoError(t, c.Request.Body.Close())
+		})
+	}
+}
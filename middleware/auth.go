@@ -30,7 +30,9 @@ func validUserInfo(username string, role int) bool {
 	return true
 }
 
-func authHelper(c *gin.Context, minRole int) {
+// authHelper permission 不为空时额外校验用户的有效权限（自定义角色或权限等级预设）
+// authHelper permissions 非空时要求用户至少拥有其中一项权限
+func authHelper(c *gin.Context, minRole int, permissions ...string) {
 	session := sessions.Default(c)
 	username := session.Get("username")
 	role := session.Get("role")
@@ -48,7 +50,7 @@ func authHelper(c *gin.Context, minRole int) {
 			c.Abort()
 			return
 		}
-		user := model.ValidateAccessToken(accessToken)
+		user := model.ValidateAccessToken(accessToken, c.ClientIP())
 		if user != nil && user.Username != "" {
 			if !validUserInfo(user.Username, user.Role) {
 				c.JSON(http.StatusOK, gin.H{
@@ -73,6 +75,14 @@ func authHelper(c *gin.Context, minRole int) {
 			return
 		}
 	}
+	if !useAccessToken && !validateUserSession(c, session) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"success": false,
+			"message": "会话已失效，请重新登录",
+		})
+		c.Abort()
+		return
+	}
 	// get header New-Api-User
 	apiUserIdStr := c.Request.Header.Get("New-Api-User")
 	if apiUserIdStr == "" {
@@ -125,6 +135,33 @@ func authHelper(c *gin.Context, minRole int) {
 		c.Abort()
 		return
 	}
+	if len(permissions) > 0 {
+		userPermissions, err := model.GetUserPermissions(id.(int), role.(int))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权进行此操作，获取权限失败",
+			})
+			c.Abort()
+			return
+		}
+		allowed := false
+		for _, permission := range permissions {
+			if model.HasPermission(userPermissions, permission) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无权进行此操作，缺少权限 " + strings.Join(permissions, " 或 "),
+			})
+			c.Abort()
+			return
+		}
+		c.Set("permissions", userPermissions)
+	}
 	c.Set("username", username)
 	c.Set("role", role)
 	c.Set("id", id)
@@ -143,7 +180,7 @@ func authHelper(c *gin.Context, minRole int) {
 	//}
 	//userCache.WriteContext(c)
 
-	c.Next()
+	auditNext(c)
 }
 
 func TryUserAuth() func(c *gin.Context) {
@@ -175,6 +212,20 @@ func RootAuth() func(c *gin.Context) {
 	}
 }
 
+// PermissionAuth 按权限校验管理接口，取代按权限等级的 AdminAuth / RootAuth
+func PermissionAuth(permission string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleCommonUser, permission)
+	}
+}
+
+// AnyPermissionAuth 拥有其中任意一项权限即可访问，接口内再按请求内容细分权限
+func AnyPermissionAuth(permissions ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		authHelper(c, common.RoleCommonUser, permissions...)
+	}
+}
+
 func WssAuth(c *gin.Context) {
 
 }
@@ -235,6 +286,13 @@ func TokenAuth() func(c *gin.Context) {
 			parts = strings.Split(key, "-")
 			key = parts[0]
 		}
+		// mTLS 监听上未携带密钥时，按已验证的客户端证书身份查找仅凭证书认证的令牌
+		certIdentities := common.GetClientCertIdentities(c.Request.TLS)
+		if key == "" && len(certIdentities) > 0 {
+			if certKey, err := model.GetCertOnlyTokenKey(certIdentities); err == nil {
+				key = certKey
+			}
+		}
 		token, err := model.ValidateUserToken(key)
 		if token != nil {
 			id := c.GetInt("id")
@@ -263,6 +321,16 @@ func TokenAuth() func(c *gin.Context) {
 			logger.LogDebug(c, "Client IP %s passed the token IP restrictions check", clientIp)
 		}
 
+		if token.CertAuthMode != common.TokenCertAuthNone && !token.MatchCertIdentity(certIdentities) {
+			abortWithOpenAiMessage(c, http.StatusUnauthorized, "该令牌要求使用匹配的客户端证书访问", types.ErrorCodeAccessDenied)
+			return
+		}
+
+		if err := service.VerifyTokenSignature(c, token); err != nil {
+			abortWithOpenAiMessage(c, http.StatusUnauthorized, err.Error(), types.ErrorCodeAccessDenied)
+			return
+		}
+
 		userCache, err := model.GetUserCache(token.UserId)
 		if err != nil {
 			abortWithOpenAiMessage(c, http.StatusInternalServerError, err.Error())
@@ -323,6 +391,7 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 	}
 	common.SetContextKey(c, constant.ContextKeyTokenGroup, token.Group)
 	common.SetContextKey(c, constant.ContextKeyTokenCrossGroupRetry, token.CrossGroupRetry)
+	common.SetContextKey(c, constant.ContextKeyTokenAllowedTags, token.GetAllowedTags())
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
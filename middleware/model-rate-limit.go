@@ -167,7 +167,8 @@ func memoryRateLimitHandler(duration int64, totalMaxCount, successMaxCount int)
 func ModelRequestRateLimit() func(c *gin.Context) {
 	return func(c *gin.Context) {
 		// 在每个请求时检查是否启用限流
-		if !setting.ModelRequestRateLimitEnabled {
+		// 只估算费用的请求不请求上游，不计入限流
+		if !setting.ModelRequestRateLimitEnabled || common.IsRelayDryRun(c) {
 			c.Next()
 			return
 		}
@@ -112,6 +112,11 @@ func DownloadRateLimit() func(c *gin.Context) {
 	return rateLimitFactory(common.DownloadRateLimitNum, common.DownloadRateLimitDuration, "DW")
 }
 
+// StatusPageRateLimit 公开状态页与订阅源无需登录，单独限流
+func StatusPageRateLimit() func(c *gin.Context) {
+	return rateLimitFactory(common.StatusPageRateLimitNum, common.StatusPageRateLimitDuration, "SP")
+}
+
 func UploadRateLimit() func(c *gin.Context) {
 	return rateLimitFactory(common.UploadRateLimitNum, common.UploadRateLimitDuration, "UP")
 }
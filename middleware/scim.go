@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+func abortWithScimError(c *gin.Context, statusCode int, detail string) {
+	c.Header("Content-Type", dto.ScimContentType)
+	c.JSON(statusCode, dto.NewScimError(statusCode, "", detail))
+	c.Abort()
+}
+
+// SCIMAuth 校验 IdP 携带的 SCIM 专用 Bearer 令牌，与用户令牌、管理员访问令牌互不通用
+func SCIMAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		settings := system_setting.GetSCIMSettings()
+		if !settings.Enabled || settings.ApiKey == "" {
+			abortWithScimError(c, http.StatusNotFound, "SCIM is not enabled")
+			return
+		}
+		auth := c.Request.Header.Get("Authorization")
+		token, found := strings.CutPrefix(auth, "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(settings.ApiKey)) != 1 {
+			abortWithScimError(c, http.StatusUnauthorized, "invalid SCIM bearer token")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// validateUserSession 校验 cookie 会话对应的服务端记录，记录被撤销或过期时清除 cookie 中的登录状态。
+// 升级前创建的会话没有记录，需要重新登录。同一请求只校验一次
+func validateUserSession(c *gin.Context, session sessions.Session) bool {
+	if checked, ok := c.Get("session_checked"); ok {
+		return checked.(bool)
+	}
+	sessionId, _ := session.Get("sid").(string)
+	userSession, err := model.GetUserSessionBySessionId(sessionId)
+	valid := err == nil && userSession.UserId == session.Get("id")
+	c.Set("session_checked", valid)
+	if !valid {
+		session.Clear()
+		_ = session.Save()
+		return false
+	}
+	model.TouchUserSession(userSession, c.ClientIP())
+	c.Set("session_id", sessionId)
+	return true
+}
+
+// UserSessionCheck 对未经过鉴权中间件的接口（如第三方账号绑定、可选登录）同样校验会话是否已被撤销
+func UserSessionCheck() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		session := sessions.Default(c)
+		if session.Get("id") != nil {
+			validateUserSession(c, session)
+		}
+		c.Next()
+	}
+}
@@ -58,12 +58,20 @@ func GetAllEnableAbilities() []Ability {
 	return abilities
 }
 
-func getPriority(group string, model string, retry int) (int, error) {
+// enabledAbilityQuery 分组与模型下已启用的能力，channelIds 不为 nil 时只包含这些渠道
+func enabledAbilityQuery(group string, model string, channelIds []int) *gorm.DB {
+	query := DB.Model(&Ability{}).Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true)
+	if channelIds != nil {
+		query = query.Where("channel_id in ?", channelIds)
+	}
+	return query
+}
+
+func getPriority(group string, model string, retry int, channelIds []int) (int, error) {
 
 	var priorities []int
-	err := DB.Model(&Ability{}).
+	err := enabledAbilityQuery(group, model, channelIds).
 		Select("DISTINCT(priority)").
-		Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true).
 		Order("priority DESC").              // 按优先级降序排序
 		Pluck("priority", &priorities).Error // Pluck用于将查询的结果直接扫描到一个切片中
 
@@ -88,26 +96,35 @@ func getPriority(group string, model string, retry int) (int, error) {
 	return priorityToUse, nil
 }
 
-func getChannelQuery(group string, model string, retry int) (*gorm.DB, error) {
-	maxPrioritySubQuery := DB.Model(&Ability{}).Select("MAX(priority)").Where(commonGroupCol+" = ? and model = ? and enabled = ?", group, model, true)
-	channelQuery := DB.Where(commonGroupCol+" = ? and model = ? and enabled = ? and priority = (?)", group, model, true, maxPrioritySubQuery)
+func getChannelQuery(group string, model string, retry int, channelIds []int) (*gorm.DB, error) {
+	maxPrioritySubQuery := enabledAbilityQuery(group, model, channelIds).Select("MAX(priority)")
+	channelQuery := enabledAbilityQuery(group, model, channelIds).Where("priority = (?)", maxPrioritySubQuery)
 	if retry != 0 {
-		priority, err := getPriority(group, model, retry)
+		priority, err := getPriority(group, model, retry, channelIds)
 		if err != nil {
 			return nil, err
 		} else {
-			channelQuery = DB.Where(commonGroupCol+" = ? and model = ? and enabled = ? and priority = ?", group, model, true, priority)
+			channelQuery = enabledAbilityQuery(group, model, channelIds).Where("priority = ?", priority)
 		}
 	}
 
 	return channelQuery, nil
 }
 
-func GetChannel(group string, model string, retry int) (*Channel, error) {
+// GetChannel filter 不为空时先按筛选条件确定可选渠道，再在这些渠道的能力中按优先级与权重选择
+func GetChannel(group string, model string, retry int, filter ChannelFilter) (*Channel, error) {
+	var channelIds []int
+	if filter != nil {
+		var err error
+		channelIds, err = getFilteredChannelIds(group, model, filter)
+		if err != nil || len(channelIds) == 0 {
+			return nil, err
+		}
+	}
 	var abilities []Ability
 
 	var err error = nil
-	channelQuery, err := getChannelQuery(group, model, retry)
+	channelQuery, err := getChannelQuery(group, model, retry, channelIds)
 	if err != nil {
 		return nil, err
 	}
@@ -119,6 +136,7 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 	if err != nil {
 		return nil, err
 	}
+	abilities = skipExhaustedMultiKeyAbilities(abilities)
 	channel := Channel{}
 	if len(abilities) > 0 {
 		// Randomly choose one
@@ -143,7 +161,56 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 	return &channel, err
 }
 
+// getFilteredChannelIds 返回分组与模型下满足筛选条件的渠道。筛选条件依赖渠道设置，只加载 id 与 setting 字段；
+// 有可用渠道但都不满足时返回 ErrNoCompliantChannel
+func getFilteredChannelIds(group string, model string, filter ChannelFilter) ([]int, error) {
+	var channels []*Channel
+	err := DB.Select("id", "setting").
+		Where("id in (?)", enabledAbilityQuery(group, model, nil).Select("channel_id")).
+		Find(&channels).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, nil
+	}
+	channelIds := make([]int, 0, len(channels))
+	for _, channel := range channels {
+		if filter(channel) {
+			channelIds = append(channelIds, channel.Id)
+		}
+	}
+	if len(channelIds) == 0 {
+		return nil, ErrNoCompliantChannel
+	}
+	return channelIds, nil
+}
+
+func skipExhaustedMultiKeyAbilities(abilities []Ability) []Ability {
+	channelIds := make([]int, 0, len(abilities))
+	for _, ability := range abilities {
+		channelIds = append(channelIds, ability.ChannelId)
+	}
+	available := skipExhaustedMultiKeyChannels(channelIds)
+	if len(available) == len(abilities) {
+		return abilities
+	}
+	result := make([]Ability, 0, len(available))
+	for _, ability := range abilities {
+		if lo.Contains(available, ability.ChannelId) {
+			result = append(result, ability)
+		}
+	}
+	return result
+}
+
 func (channel *Channel) AddAbilities(tx *gorm.DB) error {
+	// choose DB or provided tx
+	useDB := DB
+	if tx != nil {
+		useDB = tx
+	}
+	disabledModels := getChannelDisabledModelSet(useDB, []int{channel.Id})[channel.Id]
 	models_ := strings.Split(channel.Models, ",")
 	groups_ := strings.Split(channel.Group, ",")
 	abilitySet := make(map[string]struct{})
@@ -159,7 +226,7 @@ func (channel *Channel) AddAbilities(tx *gorm.DB) error {
 				Group:     group,
 				Model:     model,
 				ChannelId: channel.Id,
-				Enabled:   channel.Status == common.ChannelStatusEnabled,
+				Enabled:   channel.Status == common.ChannelStatusEnabled && !disabledModels[model],
 				Priority:  channel.Priority,
 				Weight:    uint(channel.GetWeight()),
 				Tag:       channel.Tag,
@@ -170,11 +237,6 @@ func (channel *Channel) AddAbilities(tx *gorm.DB) error {
 	if len(abilities) == 0 {
 		return nil
 	}
-	// choose DB or provided tx
-	useDB := DB
-	if tx != nil {
-		useDB = tx
-	}
 	for _, chunk := range lo.Chunk(abilities, 50) {
 		err := useDB.Clauses(clause.OnConflict{DoNothing: true}).Create(&chunk).Error
 		if err != nil {
@@ -216,6 +278,7 @@ func (channel *Channel) UpdateAbilities(tx *gorm.DB) error {
 	}
 
 	// Then add new abilities
+	disabledModels := getChannelDisabledModelSet(tx, []int{channel.Id})[channel.Id]
 	models_ := strings.Split(channel.Models, ",")
 	groups_ := strings.Split(channel.Group, ",")
 	abilitySet := make(map[string]struct{})
@@ -231,7 +294,7 @@ func (channel *Channel) UpdateAbilities(tx *gorm.DB) error {
 				Group:     group,
 				Model:     model,
 				ChannelId: channel.Id,
-				Enabled:   channel.Status == common.ChannelStatusEnabled,
+				Enabled:   channel.Status == common.ChannelStatusEnabled && !disabledModels[model],
 				Priority:  channel.Priority,
 				Weight:    uint(channel.GetWeight()),
 				Tag:       channel.Tag,
@@ -261,11 +324,20 @@ func (channel *Channel) UpdateAbilities(tx *gorm.DB) error {
 }
 
 func UpdateAbilityStatus(channelId int, status bool) error {
-	return DB.Model(&Ability{}).Where("channel_id = ?", channelId).Select("enabled").Update("enabled", status).Error
+	return updateAbilityStatus(DB.Model(&Ability{}).Where("channel_id = ?", channelId), status)
 }
 
 func UpdateAbilityStatusByTag(tag string, status bool) error {
-	return DB.Model(&Ability{}).Where("tag = ?", tag).Select("enabled").Update("enabled", status).Error
+	return updateAbilityStatus(DB.Model(&Ability{}).Where("tag = ?", tag), status)
+}
+
+// updateAbilityStatus 在同一条语句中排除被单独禁用的模型，避免启用渠道时这些模型被短暂启用
+func updateAbilityStatus(query *gorm.DB, status bool) error {
+	if status {
+		query = query.Where("NOT EXISTS (?)", DB.Model(&ChannelDisabledModel{}).Select("1").
+			Where("channel_disabled_models.channel_id = abilities.channel_id and channel_disabled_models.model_name = abilities.model"))
+	}
+	return query.Select("enabled").Update("enabled", status).Error
 }
 
 func UpdateAbilityByTag(tag string, newTag *string, priority *int64, weight *uint) error {
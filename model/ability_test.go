@@ -0,0 +1,76 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createAbilityTestChannel(t *testing.T, id int, priority int64, region string) {
+	t.Helper()
+	setting := fmt.Sprintf(`{"region":%q}`, region)
+	require.NoError(t, DB.Create(&Channel{
+		Id:       id,
+		Name:     fmt.Sprintf("channel-%d", id),
+		Key:      "sk-test",
+		Status:   common.ChannelStatusEnabled,
+		Models:   "gpt-4o",
+		Group:    "default",
+		Priority: &priority,
+		Setting:  &setting,
+	}).Error)
+	require.NoError(t, DB.Create(&Ability{
+		Group:     "default",
+		Model:     "gpt-4o",
+		ChannelId: id,
+		Enabled:   true,
+		Priority:  &priority,
+	}).Error)
+}
+
+func TestGetChannelWithFilter(t *testing.T) {
+	setupTestDB(t, &Channel{}, &Ability{})
+	createAbilityTestChannel(t, 1, 10, "us")
+	createAbilityTestChannel(t, 2, 5, "eu")
+	createAbilityTestChannel(t, 3, 1, "eu")
+
+	regionFilter := func(region string) ChannelFilter {
+		return func(channel *Channel) bool {
+			return channel.GetSetting().Region == region
+		}
+	}
+	tests := []struct {
+		name    string
+		model   string
+		retry   int
+		filter  ChannelFilter
+		wantId  int // 0 表示没有可选渠道
+		wantErr error
+	}{
+		{name: "no filter picks highest priority", model: "gpt-4o", wantId: 1},
+		{name: "filter picks highest compliant priority", model: "gpt-4o", filter: regionFilter("eu"), wantId: 2},
+		{name: "retry moves to next compliant priority", model: "gpt-4o", retry: 1, filter: regionFilter("eu"), wantId: 3},
+		{name: "retry beyond priorities uses lowest", model: "gpt-4o", retry: 5, filter: regionFilter("eu"), wantId: 3},
+		{name: "no compliant channel", model: "gpt-4o", filter: regionFilter("ap"), wantErr: ErrNoCompliantChannel},
+		{name: "unknown model", model: "claude-3", filter: regionFilter("eu")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel, err := GetChannel("default", tt.model, tt.retry, tt.filter)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantId == 0 {
+				require.Nil(t, channel)
+				return
+			}
+			require.NotNil(t, channel)
+			require.Equal(t, tt.wantId, channel.Id)
+		})
+	}
+}
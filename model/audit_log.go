@@ -0,0 +1,262 @@
+package model
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// AuditLog 管理操作审计日志，由中间件在 /api 写操作完成后记录，写入日志库
+type AuditLog struct {
+	Id         int    `json:"id"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	Username   string `json:"username" gorm:"size:64;index;default:''"`
+	Action     string `json:"action" gorm:"size:255;index"` // 方法与路由，如 PUT /api/channel/
+	TargetType string `json:"target_type" gorm:"size:64;index"`
+	TargetId   string `json:"target_id" gorm:"size:128;index"`
+	Diff       string `json:"diff" gorm:"type:text"` // JSON，字段 -> {before, after}，敏感字段已脱敏
+	Success    bool   `json:"success"`
+	StatusCode int    `json:"status_code"`
+	Ip         string `json:"ip" gorm:"size:64;default:''"`
+	UserAgent  string `json:"user_agent" gorm:"size:512;default:''"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+type AuditChange struct {
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+}
+
+type AuditLogQuery struct {
+	UserId     int
+	Username   string
+	Action     string
+	TargetType string
+	TargetId   string
+	StartTime  int64
+	EndTime    int64
+}
+
+const (
+	auditRedacted      = "***"
+	auditMaxValueChars = 2000
+)
+
+// auditTargetLoaders 按目标类型加载修改前的数据，用于生成修改前后的差异
+var auditTargetLoaders = map[string]func(id string) (any, error){
+	"channel": func(id string) (any, error) {
+		return GetChannelById(auditAtoi(id), true)
+	},
+	"user": func(id string) (any, error) {
+		return GetUserById(auditAtoi(id), false)
+	},
+	"token": func(id string) (any, error) {
+		return GetTokenById(auditAtoi(id))
+	},
+	"redemption": func(id string) (any, error) {
+		return GetRedemptionById(auditAtoi(id))
+	},
+	"price_override": func(id string) (any, error) {
+		return GetPriceOverrideById(auditAtoi(id))
+	},
+	"subscription_plan": func(id string) (any, error) {
+		return GetSubscriptionPlanById(auditAtoi(id))
+	},
+	"role": func(id string) (any, error) {
+		return GetRoleById(auditAtoi(id))
+	},
+	"topup": func(id string) (any, error) {
+		return GetTopUpByTradeNo(id), nil
+	},
+	"option": func(id string) (any, error) {
+		common.OptionMapRWMutex.RLock()
+		defer common.OptionMapRWMutex.RUnlock()
+		return map[string]any{id: common.OptionMap[id]}, nil
+	},
+}
+
+func auditAtoi(id string) int {
+	value, _ := strconv.Atoi(id)
+	return value
+}
+
+// IsAuditSecretField 与系统设置接口隐藏密钥类配置项的规则一致，另外包含密码与访问令牌
+func IsAuditSecretField(name string) bool {
+	name = strings.ToLower(name)
+	return name == "key" ||
+		strings.HasSuffix(name, "token") ||
+		strings.HasSuffix(name, "secret") ||
+		strings.HasSuffix(name, "key") ||
+		strings.HasSuffix(name, "password")
+}
+
+// redactAuditSecret 密钥均为字符串，其他类型（如 is_multi_key）原样保留
+func redactAuditSecret(value any) any {
+	if v, ok := value.(string); ok && v != "" {
+		return auditRedacted
+	}
+	return value
+}
+
+// redactAuditValue 递归脱敏并截断过长的字符串
+func redactAuditValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			if IsAuditSecretField(key) {
+				result[key] = redactAuditSecret(item)
+				continue
+			}
+			result[key] = redactAuditValue(item)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = redactAuditValue(item)
+		}
+		return result
+	case string:
+		if len(v) > auditMaxValueChars {
+			return v[:auditMaxValueChars] + "...(truncated)"
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func toAuditMap(value any) map[string]any {
+	if value == nil {
+		return nil
+	}
+	if m, ok := value.(map[string]any); ok {
+		return m
+	}
+	data, err := common.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var m map[string]any
+	if err := common.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// LoadAuditTarget 加载目标修改前的数据，不支持的目标类型返回 nil
+func LoadAuditTarget(targetType string, targetId string) map[string]any {
+	loader, ok := auditTargetLoaders[targetType]
+	if !ok || targetId == "" {
+		return nil
+	}
+	value, err := loader(targetId)
+	if err != nil {
+		return nil
+	}
+	return toAuditMap(value)
+}
+
+// BuildAuditDiff 生成修改前后的差异：after 中与 before 不同的字段，after 为空（删除）时记录 before 全部字段。
+// 两者都为空时返回空字符串
+func BuildAuditDiff(before map[string]any, after map[string]any) string {
+	changes := make(map[string]*AuditChange)
+	if after == nil {
+		for key, value := range before {
+			changes[key] = &AuditChange{Before: value}
+		}
+	}
+	for key, value := range after {
+		old, exists := before[key]
+		if exists {
+			oldData, _ := common.Marshal(old)
+			newData, _ := common.Marshal(value)
+			if string(oldData) == string(newData) {
+				continue
+			}
+		}
+		changes[key] = &AuditChange{Before: old, After: value}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+	for key, change := range changes {
+		if IsAuditSecretField(key) {
+			// 只记录密钥是否变化，不记录内容
+			change.Before = redactAuditSecret(change.Before)
+			change.After = redactAuditSecret(change.After)
+			continue
+		}
+		change.Before = redactAuditValue(change.Before)
+		change.After = redactAuditValue(change.After)
+	}
+	data, err := common.Marshal(changes)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func RecordAuditLog(log *AuditLog) {
+	if log.CreatedAt == 0 {
+		log.CreatedAt = common.GetTimestamp()
+	}
+	if len(log.UserAgent) > 512 {
+		log.UserAgent = log.UserAgent[:512]
+	}
+	if err := LOG_DB.Create(log).Error; err != nil {
+		common.SysError("failed to record audit log: " + err.Error())
+	}
+}
+
+func GetAuditLogs(query *AuditLogQuery, pageInfo *common.PageInfo) (logs []*AuditLog, total int64, err error) {
+	tx := LOG_DB.Model(&AuditLog{})
+	if query.UserId != 0 {
+		tx = tx.Where("user_id = ?", query.UserId)
+	}
+	if query.Username != "" {
+		tx = tx.Where("username = ?", query.Username)
+	}
+	if query.Action != "" {
+		tx = tx.Where("action LIKE ?", "%"+query.Action+"%")
+	}
+	if query.TargetType != "" {
+		tx = tx.Where("target_type = ?", query.TargetType)
+	}
+	if query.TargetId != "" {
+		tx = tx.Where("target_id = ?", query.TargetId)
+	}
+	if query.StartTime != 0 {
+		tx = tx.Where("created_at >= ?", query.StartTime)
+	}
+	if query.EndTime != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTime)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&logs).Error
+	return logs, total, err
+}
+
+// DeleteOldAuditLogs 分批删除指定时间之前的审计日志
+func DeleteOldAuditLogs(ctx context.Context, targetTimestamp int64, limit int) (int64, error) {
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		result := LOG_DB.Where("created_at < ?", targetTimestamp).Limit(limit).Delete(&AuditLog{})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < int64(limit) {
+			break
+		}
+	}
+	return total, nil
+}
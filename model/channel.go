@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"strings"
 	"sync"
 
@@ -65,6 +66,11 @@ type ChannelInfo struct {
 	MultiKeyDisabledTime   map[int]int64         `json:"multi_key_disabled_time,omitempty"`   // key禁用时间列表，key index -> time
 	MultiKeyPollingIndex   int                   `json:"multi_key_polling_index"`             // 多Key模式下轮询的key索引
 	MultiKeyMode           constant.MultiKeyMode `json:"multi_key_mode"`
+
+	MultiKeyWeights           map[int]int   `json:"multi_key_weights,omitempty"`             // 加权模式下的key权重，key index -> weight，未设置视为1
+	MultiKeyDailyQuotaLimit   map[int]int64 `json:"multi_key_daily_quota_limit,omitempty"`   // key每日额度上限，key index -> quota，0或未设置表示不限，当日用量见 ChannelKeyUsage
+	MultiKeyAutoEnableTime    map[int]int64 `json:"multi_key_auto_enable_time,omitempty"`    // 因限流被自动禁用的key的恢复时间，key index -> time
+	MultiKeyRateLimitCooldown int           `json:"multi_key_rate_limit_cooldown,omitempty"` // key触发429后的冷却时间（秒），上游未返回重置时间时使用
 }
 
 // Value implements driver.Valuer interface
@@ -102,7 +108,7 @@ func (channel *Channel) GetKeys() []string {
 	return keys
 }
 
-func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
+func (channel *Channel) GetNextEnabledKey() (key string, keyIndex int, newAPIError *types.NewAPIError) {
 	// If not in multi-key mode, return the original key string directly.
 	if !channel.ChannelInfo.IsMultiKey {
 		return channel.Key, 0, nil
@@ -119,6 +125,7 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	lock.Lock()
 	defer lock.Unlock()
 
+	now := common.GetTimestamp()
 	statusList := channel.ChannelInfo.MultiKeyStatusList
 	// helper to get key status, default to enabled when missing
 	getStatus := func(idx int) int {
@@ -126,6 +133,10 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 			return common.ChannelStatusEnabled
 		}
 		if status, ok := statusList[idx]; ok {
+			// keys auto disabled by rate limits come back once their cooldown has passed
+			if status == common.ChannelStatusAutoDisabled && channel.ChannelInfo.isMultiKeyAutoEnableDue(idx, now) {
+				return common.ChannelStatusEnabled
+			}
 			return status
 		}
 		return common.ChannelStatusEnabled
@@ -145,11 +156,53 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
 
+	// Skip keys that are cooling down after a 429 or have reached their daily quota limit.
+	// This is temporary, so it must not be reported as a channel error (which would disable the channel),
+	// but it is retryable so the request can fall through to another channel.
+	runtimeState := getMultiKeyRuntimeState(channel.Id)
+	availableIdx := make([]int, 0, len(enabledIdx))
+	exhaustedUntil := int64(0)
+	for _, idx := range enabledIdx {
+		until := int64(0)
+		if runtimeState.isCoolingDown(idx, now) {
+			until = runtimeState.cooldownUntil[idx]
+		} else if channel.isMultiKeyOverDailyQuota(runtimeState, idx) {
+			until = multiKeyUsageDateEnd()
+		}
+		if until == 0 {
+			availableIdx = append(availableIdx, idx)
+			continue
+		}
+		if exhaustedUntil == 0 || until < exhaustedUntil {
+			exhaustedUntil = until
+		}
+	}
+	if len(availableIdx) == 0 {
+		markMultiKeyChannelExhausted(channel.Id, exhaustedUntil)
+		return "", 0, types.NewErrorWithStatusCode(errors.New("all enabled keys are rate limited or over daily quota"), types.ErrorCodeMultiKeyExhausted, http.StatusTooManyRequests)
+	}
+	clearMultiKeyChannelExhausted(channel.Id)
+	enabledIdx = availableIdx
+	isAvailable := func(idx int) bool {
+		return lo.Contains(enabledIdx, idx)
+	}
+	defer func() {
+		if newAPIError == nil {
+			runtimeState.markUsed(keyIndex)
+		}
+	}()
+
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
 		// Randomly pick one enabled key
 		selectedIdx := enabledIdx[rand.Intn(len(enabledIdx))]
 		return keys[selectedIdx], selectedIdx, nil
+	case constant.MultiKeyModeLeastUsed:
+		selectedIdx := runtimeState.leastRecentlyUsed(enabledIdx)
+		return keys[selectedIdx], selectedIdx, nil
+	case constant.MultiKeyModeWeighted:
+		selectedIdx := channel.ChannelInfo.pickWeightedKey(enabledIdx)
+		return keys[selectedIdx], selectedIdx, nil
 	case constant.MultiKeyModePolling:
 		// Use channel-specific lock to ensure thread-safe polling
 
@@ -175,7 +228,7 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		}
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+			if isAvailable(idx) {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
 				return keys[idx], idx, nil
@@ -587,6 +640,7 @@ func handlerMultiKeyUpdate(channel *Channel, usingKey string, status int, reason
 		}
 		if status == common.ChannelStatusEnabled {
 			delete(channel.ChannelInfo.MultiKeyStatusList, keyIndex)
+			delete(channel.ChannelInfo.MultiKeyAutoEnableTime, keyIndex)
 		} else {
 			channel.ChannelInfo.MultiKeyStatusList[keyIndex] = status
 			if channel.ChannelInfo.MultiKeyDisabledReason == nil {
@@ -597,6 +651,15 @@ func handlerMultiKeyUpdate(channel *Channel, usingKey string, status int, reason
 			}
 			channel.ChannelInfo.MultiKeyDisabledReason[keyIndex] = reason
 			channel.ChannelInfo.MultiKeyDisabledTime[keyIndex] = common.GetTimestamp()
+			// a key disabled while cooling down from a rate limit is re-enabled once the cooldown ends
+			if status == common.ChannelStatusAutoDisabled {
+				if until, ok := getMultiKeyRuntimeState(channel.Id).cooldownUntil[keyIndex]; ok && until > common.GetTimestamp() {
+					if channel.ChannelInfo.MultiKeyAutoEnableTime == nil {
+						channel.ChannelInfo.MultiKeyAutoEnableTime = make(map[int]int64)
+					}
+					channel.ChannelInfo.MultiKeyAutoEnableTime[keyIndex] = until
+				}
+			}
 		}
 		if len(channel.ChannelInfo.MultiKeyStatusList) >= channel.ChannelInfo.MultiKeySize {
 			channel.Status = common.ChannelStatusAutoDisabled
@@ -680,20 +743,26 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 }
 
 func EnableChannelByTag(tag string) error {
-	err := DB.Model(&Channel{}).Where("tag = ?", tag).Update("status", common.ChannelStatusEnabled).Error
-	if err != nil {
-		return err
-	}
-	err = UpdateAbilityStatusByTag(tag, true)
-	return err
+	return updateChannelStatusByTag(tag, common.ChannelStatusEnabled)
 }
 
 func DisableChannelByTag(tag string) error {
-	err := DB.Model(&Channel{}).Where("tag = ?", tag).Update("status", common.ChannelStatusManuallyDisabled).Error
+	return updateChannelStatusByTag(tag, common.ChannelStatusManuallyDisabled)
+}
+
+func updateChannelStatusByTag(tag string, status int) error {
+	var channels []Channel
+	if err := DB.Select("id", "status").Where("tag = ?", tag).Find(&channels).Error; err != nil {
+		return err
+	}
+	err := DB.Model(&Channel{}).Where("tag = ?", tag).Update("status", status).Error
 	if err != nil {
 		return err
 	}
-	err = UpdateAbilityStatusByTag(tag, false)
+	for _, channel := range channels {
+		RecordChannelManualStatusEvent(channel.Id, channel.Status, status)
+	}
+	err = UpdateAbilityStatusByTag(tag, status == common.ChannelStatusEnabled)
 	return err
 }
 
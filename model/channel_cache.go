@@ -38,6 +38,7 @@ func InitChannelCache() {
 	for group := range groups {
 		newGroup2model2channels[group] = make(map[string][]int)
 	}
+	disabledModels := getChannelDisabledModelSet(DB, nil)
 	for _, channel := range channels {
 		if channel.Status != common.ChannelStatusEnabled {
 			continue // skip disabled channels
@@ -46,6 +47,9 @@ func InitChannelCache() {
 		for _, group := range groups {
 			models := strings.Split(channel.Models, ",")
 			for _, model := range models {
+				if disabledModels[channel.Id][model] {
+					continue // skip auto disabled models
+				}
 				if _, ok := newGroup2model2channels[group][model]; !ok {
 					newGroup2model2channels[group][model] = make([]int, 0)
 				}
@@ -93,10 +97,17 @@ func SyncChannelCache(frequency int) {
 	}
 }
 
-func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
+// ChannelFilter 选择渠道时的额外条件，返回 false 的渠道不参与选择
+type ChannelFilter func(channel *Channel) bool
+
+// ErrNoCompliantChannel 分组下有该模型的可用渠道，但都不满足筛选条件
+var ErrNoCompliantChannel = errors.New("没有满足数据驻留策略的可用渠道")
+
+// GetRandomSatisfiedChannel filter 不为空时先筛选渠道，再按筛选后的优先级与权重选择
+func GetRandomSatisfiedChannel(group string, model string, retry int, filter ChannelFilter) (*Channel, error) {
 	// if memory cache is disabled, get channel directly from database
 	if !common.MemoryCacheEnabled {
-		return GetChannel(group, model, retry)
+		return GetChannel(group, model, retry, filter)
 	}
 
 	channelSyncLock.RLock()
@@ -115,6 +126,24 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		return nil, nil
 	}
 
+	if filter != nil {
+		compliant := make([]int, 0, len(channels))
+		for _, channelId := range channels {
+			channel, ok := channelsIDM[channelId]
+			if !ok {
+				return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
+			}
+			if filter(channel) {
+				compliant = append(compliant, channelId)
+			}
+		}
+		if len(compliant) == 0 {
+			return nil, ErrNoCompliantChannel
+		}
+		channels = compliant
+	}
+	channels = skipExhaustedMultiKeyChannels(channels)
+
 	if len(channels) == 1 {
 		if channel, ok := channelsIDM[channels[0]]; ok {
 			return channel, nil
@@ -159,6 +188,10 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
 	}
 
+	if common.PreferLowCostChannelEnabled && len(targetChannels) > 1 {
+		targetChannels, sumWeight = filterLowCostChannels(targetChannels, model)
+	}
+
 	// smoothing factor and adjustment
 	smoothingFactor := 1
 	smoothingAdjustment := 0
@@ -190,6 +223,27 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	return nil, errors.New("channel not found")
 }
 
+// filterLowCostChannels 保留对该模型成本最低的渠道，返回保留渠道及其权重之和
+func filterLowCostChannels(channels []*Channel, model string) ([]*Channel, int) {
+	minFactor := -1.0
+	var lowCostChannels []*Channel
+	for _, channel := range channels {
+		factor := channel.GetCostFactor(model)
+		if minFactor < 0 || factor < minFactor {
+			minFactor = factor
+			lowCostChannels = lowCostChannels[:0]
+		}
+		if factor == minFactor {
+			lowCostChannels = append(lowCostChannels, channel)
+		}
+	}
+	sumWeight := 0
+	for _, channel := range lowCostChannels {
+		sumWeight += channel.GetWeight()
+	}
+	return lowCostChannels, sumWeight
+}
+
 func CacheGetChannel(id int) (*Channel, error) {
 	if !common.MemoryCacheEnabled {
 		return GetChannelById(id, true)
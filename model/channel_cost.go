@@ -0,0 +1,190 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"gorm.io/gorm"
+)
+
+// ChannelCostStat 渠道的计费额度与上游成本，按小时聚合
+type ChannelCostStat struct {
+	Id           int    `json:"id"`
+	ChannelId    int    `json:"channel_id" gorm:"index:idx_ccs_channel_model_created,priority:1"`
+	ModelName    string `json:"model_name" gorm:"size:128;default:'';index:idx_ccs_channel_model_created,priority:2"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index:idx_ccs_channel_model_created,priority:3;index"`
+	RequestCount int    `json:"request_count" gorm:"default:0"`
+	Quota        int    `json:"quota" gorm:"default:0"`
+	UpstreamCost int    `json:"upstream_cost" gorm:"default:0"`
+}
+
+// ChannelMargin 按渠道、模型与日期汇总的毛利
+type ChannelMargin struct {
+	Day          string  `json:"day"`
+	ChannelId    int     `json:"channel_id"`
+	ChannelName  string  `json:"channel_name"`
+	ModelName    string  `json:"model_name"`
+	RequestCount int     `json:"request_count"`
+	Quota        int     `json:"quota"`
+	UpstreamCost int     `json:"upstream_cost"`
+	Margin       int     `json:"margin"`
+	MarginRate   float64 `json:"margin_rate"`
+}
+
+var channelCostStatCache = make(map[string]*ChannelCostStat)
+var channelCostStatLock = sync.Mutex{}
+
+// RecordChannelCost 记录一次计费的额度与上游成本，定时批量落库
+func RecordChannelCost(channelId int, modelName string, quota int, upstreamCost int) {
+	if channelId == 0 {
+		return
+	}
+	createdAt := common.GetTimestamp()
+	// 只精确到小时
+	createdAt = createdAt - (createdAt % 3600)
+	key := fmt.Sprintf("%d-%s-%d", channelId, modelName, createdAt)
+
+	channelCostStatLock.Lock()
+	defer channelCostStatLock.Unlock()
+	stat, ok := channelCostStatCache[key]
+	if !ok {
+		stat = &ChannelCostStat{
+			ChannelId: channelId,
+			ModelName: modelName,
+			CreatedAt: createdAt,
+		}
+		channelCostStatCache[key] = stat
+	}
+	stat.RequestCount++
+	stat.Quota += quota
+	stat.UpstreamCost += upstreamCost
+}
+
+// SaveChannelCostStatCache 将内存中的成本统计写入数据库
+func SaveChannelCostStatCache() {
+	channelCostStatLock.Lock()
+	stats := channelCostStatCache
+	channelCostStatCache = make(map[string]*ChannelCostStat)
+	channelCostStatLock.Unlock()
+
+	for _, stat := range stats {
+		result := DB.Model(&ChannelCostStat{}).
+			Where("channel_id = ? and model_name = ? and created_at = ?", stat.ChannelId, stat.ModelName, stat.CreatedAt).
+			Updates(map[string]interface{}{
+				"request_count": gorm.Expr("request_count + ?", stat.RequestCount),
+				"quota":         gorm.Expr("quota + ?", stat.Quota),
+				"upstream_cost": gorm.Expr("upstream_cost + ?", stat.UpstreamCost),
+			})
+		if result.Error == nil && result.RowsAffected > 0 {
+			continue
+		}
+		if err := DB.Create(stat).Error; err != nil {
+			common.SysLog(fmt.Sprintf("failed to save channel cost stat: channel_id=%d, error=%v", stat.ChannelId, err))
+		}
+	}
+}
+
+// GetChannelMargins 按渠道、模型与日期（服务器本地时区）汇总毛利，channelId 为 0 时统计全部渠道
+func GetChannelMargins(channelId int, modelName string, startTime int64, endTime int64) ([]*ChannelMargin, error) {
+	tx := DB.Model(&ChannelCostStat{})
+	if channelId != 0 {
+		tx = tx.Where("channel_id = ?", channelId)
+	}
+	if modelName != "" {
+		tx = tx.Where("model_name = ?", modelName)
+	}
+	if startTime != 0 {
+		tx = tx.Where("created_at >= ?", startTime)
+	}
+	if endTime != 0 {
+		tx = tx.Where("created_at <= ?", endTime)
+	}
+	var stats []*ChannelCostStat
+	if err := tx.Find(&stats).Error; err != nil {
+		return nil, err
+	}
+
+	marginMap := make(map[string]*ChannelMargin)
+	channelIds := make([]int, 0)
+	for _, stat := range stats {
+		day := time.Unix(stat.CreatedAt, 0).Format("2006-01-02")
+		key := fmt.Sprintf("%s-%d-%s", day, stat.ChannelId, stat.ModelName)
+		margin, ok := marginMap[key]
+		if !ok {
+			margin = &ChannelMargin{
+				Day:       day,
+				ChannelId: stat.ChannelId,
+				ModelName: stat.ModelName,
+			}
+			marginMap[key] = margin
+			channelIds = append(channelIds, stat.ChannelId)
+		}
+		margin.RequestCount += stat.RequestCount
+		margin.Quota += stat.Quota
+		margin.UpstreamCost += stat.UpstreamCost
+	}
+
+	channelNames := make(map[int]string)
+	if len(channelIds) > 0 {
+		var channels []*Channel
+		if err := DB.Select("id", "name").Where("id in ?", channelIds).Find(&channels).Error; err != nil {
+			return nil, err
+		}
+		for _, channel := range channels {
+			channelNames[channel.Id] = channel.Name
+		}
+	}
+
+	margins := make([]*ChannelMargin, 0, len(marginMap))
+	for _, margin := range marginMap {
+		margin.ChannelName = channelNames[margin.ChannelId]
+		margin.Margin = margin.Quota - margin.UpstreamCost
+		if margin.Quota > 0 {
+			margin.MarginRate = float64(margin.Margin) / float64(margin.Quota)
+		}
+		margins = append(margins, margin)
+	}
+	sort.Slice(margins, func(i, j int) bool {
+		a, b := margins[i], margins[j]
+		if a.Day != b.Day {
+			return a.Day > b.Day
+		}
+		if a.ChannelId != b.ChannelId {
+			return a.ChannelId < b.ChannelId
+		}
+		return a.ModelName < b.ModelName
+	})
+	return margins, nil
+}
+
+// GetModelListUnit 返回模型在系统中配置的价格（按次计费）或倍率（按量计费）
+func GetModelListUnit(modelName string, usePrice bool) float64 {
+	if usePrice {
+		price, ok := ratio_setting.GetModelPrice(modelName, false)
+		if !ok {
+			return 0
+		}
+		return price
+	}
+	ratio, _, _ := ratio_setting.GetModelRatio(modelName)
+	return ratio
+}
+
+// GetCostFactor 返回渠道对该模型的成本相对系统原价的比例，未配置成本的渠道视为原价
+func (channel *Channel) GetCostFactor(modelName string) float64 {
+	profile := channel.GetOtherSettings().CostProfile
+	if profile == nil {
+		return 1
+	}
+	_, usePrice := ratio_setting.GetModelPrice(modelName, false)
+	listUnit := GetModelListUnit(modelName, usePrice)
+	if listUnit <= 0 {
+		return profile.GetCostUnit(modelName, 1)
+	}
+	return profile.GetCostUnit(modelName, listUnit) / listUnit
+}
@@ -0,0 +1,294 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ChannelHealthEventTest    = "test"
+	ChannelHealthEventDisable = "disable"
+	ChannelHealthEventEnable  = "enable"
+)
+
+// 健康数据保留天数
+const ChannelHealthRetentionDays = 90
+
+// ChannelHealthEvent 渠道健康事件：测试结果、自动禁用与启用
+type ChannelHealthEvent struct {
+	Id            int    `json:"id"`
+	ChannelId     int    `json:"channel_id" gorm:"index:idx_che_channel_created,priority:1"`
+	EventType     string `json:"event_type" gorm:"size:16;index"`
+	ModelName     string `json:"model_name" gorm:"size:128;default:''"`
+	Success       bool   `json:"success"`
+	ResponseTime  int64  `json:"response_time"`  // in milliseconds
+	ChannelStatus int    `json:"channel_status"` // 事件发生后的渠道状态
+	Reason        string `json:"reason" gorm:"type:text"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint;index:idx_che_channel_created,priority:2;index"`
+}
+
+// ChannelHealthStat 实际流量的成功/失败次数，按小时聚合，每个渠道、模型每小时只有一条记录
+type ChannelHealthStat struct {
+	Id           int    `json:"id"`
+	ChannelId    int    `json:"channel_id" gorm:"uniqueIndex:idx_chs_channel_model_hour,priority:1"`
+	ModelName    string `json:"model_name" gorm:"size:128;default:'';uniqueIndex:idx_chs_channel_model_hour,priority:2"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;uniqueIndex:idx_chs_channel_model_hour,priority:3;index"`
+	SuccessCount int    `json:"success_count" gorm:"default:0"`
+	FailureCount int    `json:"failure_count" gorm:"default:0"`
+}
+
+func getChannelStatusForHealth(channelId int) int {
+	var status int
+	DB.Model(&Channel{}).Select("status").Where("id = ?", channelId).Scan(&status)
+	return status
+}
+
+// RecordChannelTestEvent 记录渠道测试结果
+func RecordChannelTestEvent(channelId int, modelName string, success bool, responseTime int64, reason string) {
+	event := &ChannelHealthEvent{
+		ChannelId:     channelId,
+		EventType:     ChannelHealthEventTest,
+		ModelName:     modelName,
+		Success:       success,
+		ResponseTime:  responseTime,
+		ChannelStatus: getChannelStatusForHealth(channelId),
+		Reason:        reason,
+		CreatedAt:     common.GetTimestamp(),
+	}
+	if err := DB.Create(event).Error; err != nil {
+		common.SysLog(fmt.Sprintf("failed to record channel test event: channel_id=%d, error=%v", channelId, err))
+	}
+}
+
+// RecordChannelStatusEvent 记录渠道（或多Key渠道中某个key）的禁用、启用事件
+func RecordChannelStatusEvent(channelId int, eventType string, reason string) {
+	event := &ChannelHealthEvent{
+		ChannelId:     channelId,
+		EventType:     eventType,
+		Success:       eventType == ChannelHealthEventEnable,
+		ChannelStatus: getChannelStatusForHealth(channelId),
+		Reason:        reason,
+		CreatedAt:     common.GetTimestamp(),
+	}
+	if err := DB.Create(event).Error; err != nil {
+		common.SysLog(fmt.Sprintf("failed to record channel status event: channel_id=%d, error=%v", channelId, err))
+	}
+}
+
+// RecordChannelManualStatusEvent 管理员手动启用、禁用渠道时记录事件，状态未变化时不记录。
+// 手动禁用已被自动禁用的渠道不会新增事件，故障仍从自动禁用时开始计算
+func RecordChannelManualStatusEvent(channelId int, oldStatus int, newStatus int) {
+	if newStatus == 0 || oldStatus == newStatus {
+		return
+	}
+	if newStatus == common.ChannelStatusEnabled {
+		RecordChannelStatusEvent(channelId, ChannelHealthEventEnable, "manually enabled")
+	} else if oldStatus == common.ChannelStatusEnabled {
+		RecordChannelStatusEvent(channelId, ChannelHealthEventDisable, "manually disabled")
+	}
+}
+
+var channelHealthStatCache = make(map[string]*ChannelHealthStat)
+var channelHealthStatLock = sync.Mutex{}
+
+// RecordChannelTraffic 记录一次实际请求的结果，定时批量落库
+func RecordChannelTraffic(channelId int, modelName string, success bool) {
+	createdAt := common.GetTimestamp()
+	// 只精确到小时
+	createdAt = createdAt - (createdAt % 3600)
+	key := fmt.Sprintf("%d-%s-%d", channelId, modelName, createdAt)
+
+	channelHealthStatLock.Lock()
+	defer channelHealthStatLock.Unlock()
+	stat, ok := channelHealthStatCache[key]
+	if !ok {
+		stat = &ChannelHealthStat{
+			ChannelId: channelId,
+			ModelName: modelName,
+			CreatedAt: createdAt,
+		}
+		channelHealthStatCache[key] = stat
+	}
+	if success {
+		stat.SuccessCount++
+	} else {
+		stat.FailureCount++
+	}
+}
+
+// SaveChannelHealthStatCache 将内存中的流量统计写入数据库
+func SaveChannelHealthStatCache() {
+	channelHealthStatLock.Lock()
+	stats := channelHealthStatCache
+	channelHealthStatCache = make(map[string]*ChannelHealthStat)
+	channelHealthStatLock.Unlock()
+
+	for _, stat := range stats {
+		// 多个节点可能同时写入同一小时的记录，依赖唯一索引合并计数
+		err := DB.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "channel_id"}, {Name: "model_name"}, {Name: "created_at"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"success_count": gorm.Expr("channel_health_stats.success_count + ?", stat.SuccessCount),
+				"failure_count": gorm.Expr("channel_health_stats.failure_count + ?", stat.FailureCount),
+			}),
+		}).Create(stat).Error
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to save channel health stat: channel_id=%d, error=%v", stat.ChannelId, err))
+		}
+	}
+}
+
+// DeleteChannelHealthBefore 清理过期的健康数据
+func DeleteChannelHealthBefore(timestamp int64) error {
+	if err := DB.Where("created_at < ?", timestamp).Delete(&ChannelHealthEvent{}).Error; err != nil {
+		return err
+	}
+	return DB.Where("created_at < ?", timestamp).Delete(&ChannelHealthStat{}).Error
+}
+
+func GetChannelHealthEvents(channelId int, startTime int64, endTime int64, eventType string, limit int) ([]*ChannelHealthEvent, error) {
+	var events []*ChannelHealthEvent
+	query := DB.Where("channel_id = ? and created_at >= ? and created_at <= ?", channelId, startTime, endTime)
+	if eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Order("created_at desc, id desc").Find(&events).Error
+	return events, err
+}
+
+// ChannelIncident 渠道不可用区间，EndTime 为 0 表示仍未恢复
+type ChannelIncident struct {
+	StartTime int64  `json:"start_time"`
+	EndTime   int64  `json:"end_time"`
+	Duration  int64  `json:"duration"`
+	Reason    string `json:"reason"`
+}
+
+type ChannelModelHealth struct {
+	ModelName    string  `json:"model_name"`
+	SuccessCount int     `json:"success_count"`
+	FailureCount int     `json:"failure_count"`
+	SuccessRate  float64 `json:"success_rate"`
+}
+
+type ChannelHealthSummary struct {
+	ChannelId    int                   `json:"channel_id"`
+	Uptime       float64               `json:"uptime"` // 百分比
+	SuccessCount int                   `json:"success_count"`
+	FailureCount int                   `json:"failure_count"`
+	SuccessRate  float64               `json:"success_rate"` // 百分比，无流量时为 100
+	Incidents    []ChannelIncident     `json:"incidents"`
+	Models       []*ChannelModelHealth `json:"models"`
+}
+
+func successRate(success int, failure int) float64 {
+	if success+failure == 0 {
+		return 100
+	}
+	return float64(success) * 100 / float64(success+failure)
+}
+
+// GetChannelHealthSummaries 计算指定时间窗口内渠道的可用率、故障时间线与各模型成功率
+func GetChannelHealthSummaries(channelIds []int, startTime int64, endTime int64) (map[int]*ChannelHealthSummary, error) {
+	summaries := make(map[int]*ChannelHealthSummary, len(channelIds))
+	if len(channelIds) == 0 {
+		return summaries, nil
+	}
+	for _, id := range channelIds {
+		summaries[id] = &ChannelHealthSummary{
+			ChannelId: id,
+			Incidents: make([]ChannelIncident, 0),
+			Models:    make([]*ChannelModelHealth, 0),
+		}
+	}
+
+	// 窗口开始前最后一次状态事件，用于确定初始状态
+	var lastEvents []*ChannelHealthEvent
+	err := DB.Where("id in (?)", DB.Model(&ChannelHealthEvent{}).Select("max(id)").
+		Where("channel_id in (?) and event_type in (?) and created_at < ?", channelIds, []string{ChannelHealthEventDisable, ChannelHealthEventEnable}, startTime).
+		Group("channel_id")).Find(&lastEvents).Error
+	if err != nil {
+		return nil, err
+	}
+	var events []*ChannelHealthEvent
+	err = DB.Where("channel_id in (?) and event_type in (?) and created_at >= ? and created_at <= ?",
+		channelIds, []string{ChannelHealthEventDisable, ChannelHealthEventEnable}, startTime, endTime).
+		Order("created_at asc, id asc").Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+
+	eventsByChannel := make(map[int][]*ChannelHealthEvent)
+	for _, event := range lastEvents {
+		eventsByChannel[event.ChannelId] = append(eventsByChannel[event.ChannelId], event)
+	}
+	for _, event := range events {
+		eventsByChannel[event.ChannelId] = append(eventsByChannel[event.ChannelId], event)
+	}
+	window := endTime - startTime
+	for channelId, summary := range summaries {
+		var downtime int64
+		var current *ChannelIncident
+		for _, event := range eventsByChannel[channelId] {
+			at := max(event.CreatedAt, startTime)
+			down := event.ChannelStatus != common.ChannelStatusEnabled
+			if down && current == nil {
+				current = &ChannelIncident{StartTime: at, Reason: event.Reason}
+			} else if !down && current != nil {
+				current.EndTime = at
+				current.Duration = at - current.StartTime
+				downtime += current.Duration
+				summary.Incidents = append(summary.Incidents, *current)
+				current = nil
+			}
+		}
+		if current != nil {
+			current.Duration = endTime - current.StartTime
+			downtime += current.Duration
+			summary.Incidents = append(summary.Incidents, *current)
+		}
+		summary.Uptime = 100
+		if window > 0 {
+			summary.Uptime = float64(window-downtime) * 100 / float64(window)
+		}
+	}
+
+	var stats []*ChannelHealthStat
+	err = DB.Model(&ChannelHealthStat{}).
+		Select("channel_id, model_name, sum(success_count) as success_count, sum(failure_count) as failure_count").
+		Where("channel_id in (?) and created_at >= ? and created_at <= ?", channelIds, startTime-(startTime%3600), endTime).
+		Group("channel_id, model_name").Find(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, stat := range stats {
+		summary, ok := summaries[stat.ChannelId]
+		if !ok {
+			continue
+		}
+		summary.SuccessCount += stat.SuccessCount
+		summary.FailureCount += stat.FailureCount
+		summary.Models = append(summary.Models, &ChannelModelHealth{
+			ModelName:    stat.ModelName,
+			SuccessCount: stat.SuccessCount,
+			FailureCount: stat.FailureCount,
+			SuccessRate:  successRate(stat.SuccessCount, stat.FailureCount),
+		})
+	}
+	for _, summary := range summaries {
+		summary.SuccessRate = successRate(summary.SuccessCount, summary.FailureCount)
+		sort.Slice(summary.Models, func(i, j int) bool {
+			return summary.Models[i].ModelName < summary.Models[j].ModelName
+		})
+	}
+	return summaries, nil
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveChannelHealthStatCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		rounds [][]ChannelHealthStat // 每一轮写入缓存后落库一次
+		want   []ChannelHealthStat
+	}{
+		{
+			name: "insert new hour",
+			rounds: [][]ChannelHealthStat{
+				{{ChannelId: 1, ModelName: "gpt-4o", CreatedAt: 3600, SuccessCount: 2, FailureCount: 1}},
+			},
+			want: []ChannelHealthStat{{ChannelId: 1, ModelName: "gpt-4o", CreatedAt: 3600, SuccessCount: 2, FailureCount: 1}},
+		},
+		{
+			name: "merge same hour across saves",
+			rounds: [][]ChannelHealthStat{
+				{{ChannelId: 1, ModelName: "gpt-4o", CreatedAt: 3600, SuccessCount: 2, FailureCount: 1}},
+				{{ChannelId: 1, ModelName: "gpt-4o", CreatedAt: 3600, SuccessCount: 3}},
+				{{ChannelId: 1, ModelName: "gpt-4o", CreatedAt: 3600, FailureCount: 4}},
+			},
+			want: []ChannelHealthStat{{ChannelId: 1, ModelName: "gpt-4o", CreatedAt: 3600, SuccessCount: 5, FailureCount: 5}},
+		},
+		{
+			name: "separate rows per channel model and hour",
+			rounds: [][]ChannelHealthStat{
+				{
+					{ChannelId: 1, ModelName: "gpt-4o", CreatedAt: 3600, SuccessCount: 1},
+					{ChannelId: 2, ModelName: "gpt-4o", CreatedAt: 3600, SuccessCount: 1},
+				},
+				{
+					{ChannelId: 1, ModelName: "gpt-4o-mini", CreatedAt: 3600, FailureCount: 1},
+					{ChannelId: 1, ModelName: "gpt-4o", CreatedAt: 7200, SuccessCount: 1},
+					{ChannelId: 2, ModelName: "gpt-4o", CreatedAt: 3600, FailureCount: 2},
+				},
+			},
+			want: []ChannelHealthStat{
+				{ChannelId: 1, ModelName: "gpt-4o", CreatedAt: 3600, SuccessCount: 1},
+				{ChannelId: 1, ModelName: "gpt-4o", CreatedAt: 7200, SuccessCount: 1},
+				{ChannelId: 1, ModelName: "gpt-4o-mini", CreatedAt: 3600, FailureCount: 1},
+				{ChannelId: 2, ModelName: "gpt-4o", CreatedAt: 3600, SuccessCount: 1, FailureCount: 2},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t, &ChannelHealthStat{})
+			for _, round := range tt.rounds {
+				channelHealthStatLock.Lock()
+				for i := range round {
+					stat := round[i]
+					channelHealthStatCache[fmt.Sprintf("%d-%s-%d", stat.ChannelId, stat.ModelName, stat.CreatedAt)] = &stat
+				}
+				channelHealthStatLock.Unlock()
+				SaveChannelHealthStatCache()
+			}
+
+			var stats []ChannelHealthStat
+			require.NoError(t, DB.Order("channel_id, model_name, created_at").Find(&stats).Error)
+			require.Len(t, stats, len(tt.want))
+			for i, stat := range stats {
+				stat.Id = 0
+				require.Equal(t, tt.want[i], stat)
+			}
+		})
+	}
+}
@@ -0,0 +1,485 @@
+package model
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"gorm.io/gorm"
+)
+
+// ChannelKeyUsage 多Key渠道中单个key的当日用量。各节点在内存中累计后以增量方式写入，
+// 避免读改写 channel_info 时互相覆盖
+type ChannelKeyUsage struct {
+	ChannelId int    `json:"channel_id" gorm:"primaryKey;autoIncrement:false"`
+	KeyIndex  int    `json:"key_index" gorm:"primaryKey;autoIncrement:false"`
+	UsageDate string `json:"usage_date" gorm:"type:varchar(10);primaryKey;index"`
+	UsedQuota int64  `json:"used_quota" gorm:"bigint;default:0"`
+}
+
+// multiKeyRuntimeState 多Key渠道在当前节点上的运行时状态，不落库。
+// 读写时需持有 GetChannelPollingLock(channelId)。
+type multiKeyRuntimeState struct {
+	lastUsed      map[int]int64 // key index -> 最近一次被选中的时间（纳秒）
+	cooldownUntil map[int]int64 // key index -> 限流冷却结束时间（秒）
+	pendingUsage  map[int]int64 // key index -> 尚未写入数据库的当日用量
+	pendingDate   string
+	usedQuota     map[int]int64 // key index -> 数据库中所有节点的当日用量，由 SyncMultiKeyState 刷新
+	usedDate      string
+}
+
+// multiKeyRuntimeStates channel id -> *multiKeyRuntimeState
+var multiKeyRuntimeStates sync.Map
+
+// multiKeyExhaustedUntil channel id -> 所有启用的key都在冷却或超出当日额度的截止时间（秒），
+// 选择渠道时据此跳过，不需要持有渠道锁
+var multiKeyExhaustedUntil sync.Map
+
+func getMultiKeyRuntimeState(channelId int) *multiKeyRuntimeState {
+	if state, ok := multiKeyRuntimeStates.Load(channelId); ok {
+		return state.(*multiKeyRuntimeState)
+	}
+	newState := &multiKeyRuntimeState{
+		lastUsed:      make(map[int]int64),
+		cooldownUntil: make(map[int]int64),
+		pendingUsage:  make(map[int]int64),
+	}
+	actual, _ := multiKeyRuntimeStates.LoadOrStore(channelId, newState)
+	return actual.(*multiKeyRuntimeState)
+}
+
+// ResetMultiKeyRuntimeState 清除渠道的运行时状态，key 列表被重新索引后需要调用，调用方需持有 GetChannelPollingLock
+func ResetMultiKeyRuntimeState(channelId int) {
+	multiKeyRuntimeStates.Delete(channelId)
+	clearMultiKeyChannelExhausted(channelId)
+}
+
+func markMultiKeyChannelExhausted(channelId int, until int64) {
+	multiKeyExhaustedUntil.Store(channelId, until)
+}
+
+func clearMultiKeyChannelExhausted(channelId int) {
+	multiKeyExhaustedUntil.Delete(channelId)
+}
+
+func isMultiKeyChannelExhausted(channelId int, now int64) bool {
+	until, ok := multiKeyExhaustedUntil.Load(channelId)
+	if !ok {
+		return false
+	}
+	if until.(int64) <= now {
+		multiKeyExhaustedUntil.Delete(channelId)
+		return false
+	}
+	return true
+}
+
+// skipExhaustedMultiKeyChannels 跳过所有key都已限流或超出当日额度的多Key渠道。
+// 全部耗尽时原样返回，由 GetNextEnabledKey 返回可重试的错误
+func skipExhaustedMultiKeyChannels(channelIds []int) []int {
+	now := common.GetTimestamp()
+	available := make([]int, 0, len(channelIds))
+	for _, channelId := range channelIds {
+		if !isMultiKeyChannelExhausted(channelId, now) {
+			available = append(available, channelId)
+		}
+	}
+	if len(available) == 0 {
+		return channelIds
+	}
+	return available
+}
+
+func (s *multiKeyRuntimeState) isCoolingDown(idx int, now int64) bool {
+	until, ok := s.cooldownUntil[idx]
+	if !ok {
+		return false
+	}
+	if until <= now {
+		delete(s.cooldownUntil, idx)
+		return false
+	}
+	return true
+}
+
+func (s *multiKeyRuntimeState) markUsed(idx int) {
+	s.lastUsed[idx] = time.Now().UnixNano()
+}
+
+func (s *multiKeyRuntimeState) leastRecentlyUsed(candidates []int) int {
+	selected := candidates[0]
+	for _, idx := range candidates[1:] {
+		if s.lastUsed[idx] < s.lastUsed[selected] {
+			selected = idx
+		}
+	}
+	return selected
+}
+
+func (s *multiKeyRuntimeState) dailyUsage(idx int, date string) int64 {
+	used := int64(0)
+	if s.usedDate == date {
+		used += s.usedQuota[idx]
+	}
+	if s.pendingDate == date {
+		used += s.pendingUsage[idx]
+	}
+	return used
+}
+
+func multiKeyUsageDate() string {
+	return time.Now().Format("2006-01-02")
+}
+
+// multiKeyUsageDateEnd 当日用量重置的时间
+func multiKeyUsageDateEnd() int64 {
+	now := time.Now()
+	year, month, day := now.Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, now.Location()).Unix()
+}
+
+func (info *ChannelInfo) pickWeightedKey(candidates []int) int {
+	totalWeight := 0
+	for _, idx := range candidates {
+		totalWeight += info.getMultiKeyWeight(idx)
+	}
+	if totalWeight <= 0 {
+		return candidates[rand.Intn(len(candidates))]
+	}
+	r := rand.Intn(totalWeight)
+	for _, idx := range candidates {
+		r -= info.getMultiKeyWeight(idx)
+		if r < 0 {
+			return idx
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+func (info *ChannelInfo) getMultiKeyWeight(idx int) int {
+	if info.MultiKeyWeights == nil {
+		return 1
+	}
+	weight, ok := info.MultiKeyWeights[idx]
+	if !ok {
+		return 1
+	}
+	return max(weight, 0)
+}
+
+func (info *ChannelInfo) isMultiKeyAutoEnableDue(idx int, now int64) bool {
+	if info.MultiKeyAutoEnableTime == nil {
+		return false
+	}
+	enableTime, ok := info.MultiKeyAutoEnableTime[idx]
+	return ok && enableTime <= now
+}
+
+// GetRateLimitCooldown 返回key触发429后的冷却时间（秒）
+func (info *ChannelInfo) GetRateLimitCooldown() int {
+	if info.MultiKeyRateLimitCooldown > 0 {
+		return info.MultiKeyRateLimitCooldown
+	}
+	return constant.MultiKeyDefaultRateLimitCooldown
+}
+
+func (channel *Channel) isMultiKeyOverDailyQuota(state *multiKeyRuntimeState, idx int) bool {
+	if channel.ChannelInfo.MultiKeyDailyQuotaLimit == nil {
+		return false
+	}
+	limit := channel.ChannelInfo.MultiKeyDailyQuotaLimit[idx]
+	if limit <= 0 {
+		return false
+	}
+	return state.dailyUsage(idx, multiKeyUsageDate()) >= limit
+}
+
+// RemapMultiKeyIndexes 删除key后按新的索引重排每个key的配置与用量，oldToNew 中不存在的索引会被丢弃
+func (info *ChannelInfo) RemapMultiKeyIndexes(oldToNew map[int]int) {
+	info.MultiKeyWeights = remapKeyIndexes(info.MultiKeyWeights, oldToNew)
+	info.MultiKeyDailyQuotaLimit = remapKeyIndexes(info.MultiKeyDailyQuotaLimit, oldToNew)
+	info.MultiKeyAutoEnableTime = remapKeyIndexes(info.MultiKeyAutoEnableTime, oldToNew)
+}
+
+func remapKeyIndexes[T any](m map[int]T, oldToNew map[int]int) map[int]T {
+	if m == nil {
+		return nil
+	}
+	remapped := make(map[int]T, len(m))
+	for oldIdx, v := range m {
+		if newIdx, ok := oldToNew[oldIdx]; ok {
+			remapped[newIdx] = v
+		}
+	}
+	return remapped
+}
+
+// GetMultiKeyRuntimeSnapshot 返回当前节点上各key的限流冷却结束时间与尚未落库的当日用量
+func GetMultiKeyRuntimeSnapshot(channelId int) (cooldownUntil map[int]int64, pendingUsage map[int]int64) {
+	lock := GetChannelPollingLock(channelId)
+	lock.Lock()
+	defer lock.Unlock()
+	state := getMultiKeyRuntimeState(channelId)
+	now := common.GetTimestamp()
+	cooldownUntil = make(map[int]int64)
+	for idx, until := range state.cooldownUntil {
+		if until > now {
+			cooldownUntil[idx] = until
+		}
+	}
+	pendingUsage = make(map[int]int64)
+	if state.pendingDate == multiKeyUsageDate() {
+		for idx, quota := range state.pendingUsage {
+			pendingUsage[idx] = quota
+		}
+	}
+	return cooldownUntil, pendingUsage
+}
+
+// CooldownMultiKey 使key在 until 之前不再被选中，通常在上游返回429后调用
+func CooldownMultiKey(channelId int, keyIndex int, until int64) {
+	lock := GetChannelPollingLock(channelId)
+	lock.Lock()
+	defer lock.Unlock()
+	state := getMultiKeyRuntimeState(channelId)
+	if until > state.cooldownUntil[keyIndex] {
+		state.cooldownUntil[keyIndex] = until
+	}
+}
+
+// UpdateMultiKeyUsedQuota 累计多Key渠道中单个key的当日用量，由 SyncMultiKeyState 定期落库
+func UpdateMultiKeyUsedQuota(channelId int, keyIndex int, quota int) {
+	if quota == 0 {
+		return
+	}
+	lock := GetChannelPollingLock(channelId)
+	lock.Lock()
+	defer lock.Unlock()
+	state := getMultiKeyRuntimeState(channelId)
+	date := multiKeyUsageDate()
+	if state.pendingDate != date {
+		state.pendingDate = date
+		state.pendingUsage = make(map[int]int64)
+	}
+	state.pendingUsage[keyIndex] += int64(quota)
+}
+
+// GetChannelKeyDailyUsage 返回渠道各key在数据库中的当日用量（所有节点已落库部分）
+func GetChannelKeyDailyUsage(channelId int) (map[int]int64, error) {
+	var usages []ChannelKeyUsage
+	err := DB.Where("channel_id = ? AND usage_date = ?", channelId, multiKeyUsageDate()).Find(&usages).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[int]int64, len(usages))
+	for _, usage := range usages {
+		result[usage.KeyIndex] = usage.UsedQuota
+	}
+	return result, nil
+}
+
+// RemapChannelKeyUsage 删除key后按新的索引重排当日用量，oldToNew 中不存在的索引会被丢弃
+func RemapChannelKeyUsage(channelId int, oldToNew map[int]int) error {
+	date := multiKeyUsageDate()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var usages []ChannelKeyUsage
+		if err := tx.Where("channel_id = ? AND usage_date = ?", channelId, date).Find(&usages).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("channel_id = ? AND usage_date = ?", channelId, date).Delete(&ChannelKeyUsage{}).Error; err != nil {
+			return err
+		}
+		remapped := make([]ChannelKeyUsage, 0, len(usages))
+		for _, usage := range usages {
+			if newIdx, ok := oldToNew[usage.KeyIndex]; ok {
+				usage.KeyIndex = newIdx
+				remapped = append(remapped, usage)
+			}
+		}
+		if len(remapped) == 0 {
+			return nil
+		}
+		return tx.Create(&remapped).Error
+	})
+}
+
+// addChannelKeyUsage 以列表达式累加用量，行不存在时插入；并发插入冲突时说明其他节点已插入，再累加一次
+func addChannelKeyUsage(channelId int, keyIndex int, date string, quota int64) error {
+	update := func() (int64, error) {
+		result := DB.Model(&ChannelKeyUsage{}).
+			Where("channel_id = ? AND key_index = ? AND usage_date = ?", channelId, keyIndex, date).
+			Update("used_quota", gorm.Expr("used_quota + ?", quota))
+		return result.RowsAffected, result.Error
+	}
+	affected, err := update()
+	if err != nil || affected > 0 {
+		return err
+	}
+	err = DB.Create(&ChannelKeyUsage{ChannelId: channelId, KeyIndex: keyIndex, UsageDate: date, UsedQuota: quota}).Error
+	if err == nil {
+		return nil
+	}
+	affected, err = update()
+	if err == nil && affected == 0 {
+		err = fmt.Errorf("channel key usage row not found")
+	}
+	return err
+}
+
+// SyncMultiKeyState 将key用量写入数据库并刷新所有节点的当日用量，恢复冷却时间已到的自动禁用key
+func SyncMultiKeyState() {
+	multiKeyRuntimeStates.Range(func(key, value any) bool {
+		flushMultiKeyUsage(key.(int))
+		return true
+	})
+	refreshMultiKeyDailyUsage()
+
+	var channels []*Channel
+	err := DB.Select("id", "channel_info").Where("status in (?)", []int{common.ChannelStatusEnabled, common.ChannelStatusAutoDisabled}).Find(&channels).Error
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to load multi-key channels: %v", err))
+		return
+	}
+	now := common.GetTimestamp()
+	for _, channel := range channels {
+		if !channel.ChannelInfo.IsMultiKey || len(channel.ChannelInfo.MultiKeyAutoEnableTime) == 0 {
+			continue
+		}
+		for idx := range channel.ChannelInfo.MultiKeyAutoEnableTime {
+			if channel.ChannelInfo.isMultiKeyAutoEnableDue(idx, now) {
+				recoverMultiKeys(channel.Id, now)
+				break
+			}
+		}
+	}
+}
+
+func flushMultiKeyUsage(channelId int) {
+	lock := GetChannelPollingLock(channelId)
+	lock.Lock()
+	state := getMultiKeyRuntimeState(channelId)
+	date := state.pendingDate
+	pending := make(map[int]int64, len(state.pendingUsage))
+	for idx, quota := range state.pendingUsage {
+		pending[idx] = quota
+	}
+	lock.Unlock()
+
+	for idx, quota := range pending {
+		if quota == 0 {
+			continue
+		}
+		if err := addChannelKeyUsage(channelId, idx, date, quota); err != nil {
+			common.SysLog(fmt.Sprintf("failed to flush multi-key usage: channel_id=%d, key_index=%d, error=%v", channelId, idx, err))
+			continue
+		}
+		// 只扣除已写入的部分，写入期间新增的用量留到下次同步
+		lock.Lock()
+		if state.pendingDate == date {
+			state.pendingUsage[idx] -= quota
+			if state.pendingUsage[idx] == 0 {
+				delete(state.pendingUsage, idx)
+			}
+		}
+		if state.usedDate != date || state.usedQuota == nil {
+			state.usedDate = date
+			state.usedQuota = make(map[int]int64)
+		}
+		state.usedQuota[idx] += quota
+		lock.Unlock()
+	}
+}
+
+// refreshMultiKeyDailyUsage 从数据库加载所有节点的当日用量，并清理以前的用量记录
+func refreshMultiKeyDailyUsage() {
+	date := multiKeyUsageDate()
+	var usages []ChannelKeyUsage
+	if err := DB.Where("usage_date = ?", date).Find(&usages).Error; err != nil {
+		common.SysLog(fmt.Sprintf("failed to load multi-key usage: %v", err))
+		return
+	}
+	usedByChannel := make(map[int]map[int]int64)
+	for _, usage := range usages {
+		if usedByChannel[usage.ChannelId] == nil {
+			usedByChannel[usage.ChannelId] = make(map[int]int64)
+		}
+		usedByChannel[usage.ChannelId][usage.KeyIndex] = usage.UsedQuota
+	}
+	for channelId, used := range usedByChannel {
+		lock := GetChannelPollingLock(channelId)
+		lock.Lock()
+		state := getMultiKeyRuntimeState(channelId)
+		state.usedDate = date
+		state.usedQuota = used
+		lock.Unlock()
+	}
+	if err := DB.Where("usage_date < ?", date).Delete(&ChannelKeyUsage{}).Error; err != nil {
+		common.SysLog(fmt.Sprintf("failed to clean up multi-key usage: %v", err))
+	}
+}
+
+// clearRecoveredKeys 清除冷却时间已到的自动禁用key状态，返回恢复的key数量
+func clearRecoveredKeys(info *ChannelInfo, now int64) int {
+	recovered := 0
+	for idx := range info.MultiKeyAutoEnableTime {
+		if !info.isMultiKeyAutoEnableDue(idx, now) {
+			continue
+		}
+		delete(info.MultiKeyAutoEnableTime, idx)
+		if info.MultiKeyStatusList[idx] != common.ChannelStatusAutoDisabled {
+			continue
+		}
+		delete(info.MultiKeyStatusList, idx)
+		delete(info.MultiKeyDisabledReason, idx)
+		delete(info.MultiKeyDisabledTime, idx)
+		recovered++
+	}
+	return recovered
+}
+
+func recoverMultiKeys(channelId int, now int64) {
+	lock := GetChannelPollingLock(channelId)
+	lock.Lock()
+
+	channel, err := GetChannelById(channelId, false)
+	if err != nil {
+		lock.Unlock()
+		return
+	}
+	recovered := clearRecoveredKeys(&channel.ChannelInfo, now)
+	channelEnabled := false
+	if recovered > 0 && channel.Status == common.ChannelStatusAutoDisabled && len(channel.ChannelInfo.MultiKeyStatusList) < channel.ChannelInfo.MultiKeySize {
+		channel.Status = common.ChannelStatusEnabled
+		info := channel.GetOtherInfo()
+		info["status_reason"] = ""
+		info["status_time"] = now
+		channel.SetOtherInfo(info)
+		channelEnabled = true
+	}
+	err = channel.SaveWithoutKey()
+	if err == nil && common.MemoryCacheEnabled && !channelEnabled {
+		if cached, cacheErr := CacheGetChannel(channelId); cacheErr == nil && cached != nil {
+			clearRecoveredKeys(&cached.ChannelInfo, now)
+		}
+	}
+	lock.Unlock()
+
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to recover multi-key channel: channel_id=%d, error=%v", channelId, err))
+		return
+	}
+	if recovered > 0 {
+		common.SysLog(fmt.Sprintf("channel #%d: %d rate limited keys re-enabled after cooldown", channelId, recovered))
+		RecordChannelStatusEvent(channelId, ChannelHealthEventEnable, "rate limit cooldown finished")
+	}
+	if channelEnabled {
+		if err = UpdateAbilityStatus(channelId, true); err != nil {
+			common.SysLog(fmt.Sprintf("failed to update ability status: channel_id=%d, error=%v", channelId, err))
+		}
+		InitChannelCache()
+	}
+}
@@ -0,0 +1,241 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ChannelTestPlanStatusEnabled  = 1
+	ChannelTestPlanStatusDisabled = 2
+)
+
+// ChannelTestPlan 渠道测试计划，作用于单个渠道或某个标签下的全部渠道
+type ChannelTestPlan struct {
+	Id              int    `json:"id"`
+	Name            string `json:"name" gorm:"size:128"`
+	ChannelId       int    `json:"channel_id" gorm:"index;default:0"`
+	Tag             string `json:"tag" gorm:"size:128;index;default:''"`
+	Models          string `json:"models" gorm:"type:text"`         // 逗号分隔，为空时测试渠道的全部模型
+	EndpointTypes   string `json:"endpoint_types" gorm:"type:text"` // 逗号分隔，为空时根据模型自动检测
+	StreamEnabled   bool   `json:"stream_enabled"`
+	TTFTThreshold   int    `json:"ttft_threshold" gorm:"default:0"` // 流式首字时间阈值（毫秒），0 表示不检查
+	IntervalMinutes int    `json:"interval_minutes" gorm:"default:60"`
+	AutoDisable     bool   `json:"auto_disable"` // 测试失败时禁用渠道下对应模型，而不是整个渠道
+	Status          int    `json:"status" gorm:"default:1"`
+	LastRunTime     int64  `json:"last_run_time" gorm:"bigint;default:0"`
+	CreatedTime     int64  `json:"created_time" gorm:"bigint"`
+}
+
+// ChannelModelTest 渠道下单个模型、端点与流式组合的最近一次测试结果
+type ChannelModelTest struct {
+	Id           int    `json:"id"`
+	ChannelId    int    `json:"channel_id" gorm:"uniqueIndex:idx_cmt_channel_model_endpoint,priority:1"`
+	ModelName    string `json:"model_name" gorm:"size:255;uniqueIndex:idx_cmt_channel_model_endpoint,priority:2"`
+	EndpointType string `json:"endpoint_type" gorm:"size:64;default:'';uniqueIndex:idx_cmt_channel_model_endpoint,priority:3"`
+	IsStream     bool   `json:"is_stream" gorm:"uniqueIndex:idx_cmt_channel_model_endpoint,priority:4"`
+	Success      bool   `json:"success"`
+	ResponseTime int64  `json:"response_time"` // in milliseconds
+	TTFT         int64  `json:"ttft"`          // in milliseconds
+	Message      string `json:"message" gorm:"type:text"`
+	TestTime     int64  `json:"test_time" gorm:"bigint"`
+}
+
+// ChannelDisabledModel 被单独禁用的渠道模型，对应的 ability 保持禁用。
+// 自动禁用的模型在测试通过后自动启用，手动禁用的模型只能手动启用
+type ChannelDisabledModel struct {
+	ChannelId    int    `json:"channel_id" gorm:"primaryKey;autoIncrement:false"`
+	ModelName    string `json:"model_name" gorm:"type:varchar(255);primaryKey"`
+	Reason       string `json:"reason" gorm:"type:text"`
+	Manual       bool   `json:"manual" gorm:"default:false"`
+	DisabledTime int64  `json:"disabled_time" gorm:"bigint"`
+}
+
+func splitPlanList(value string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (plan *ChannelTestPlan) GetModels() []string {
+	return splitPlanList(plan.Models)
+}
+
+func (plan *ChannelTestPlan) GetEndpointTypes() []string {
+	return splitPlanList(plan.EndpointTypes)
+}
+
+func (plan *ChannelTestPlan) Validate() error {
+	if (plan.ChannelId == 0) == (plan.Tag == "") {
+		return errors.New("渠道与标签必须且只能指定一个")
+	}
+	if plan.IntervalMinutes <= 0 {
+		return errors.New("测试间隔必须大于0")
+	}
+	if plan.TTFTThreshold < 0 {
+		return errors.New("首字时间阈值不能小于0")
+	}
+	if plan.Status != ChannelTestPlanStatusEnabled && plan.Status != ChannelTestPlanStatusDisabled {
+		return errors.New("无效的状态")
+	}
+	return nil
+}
+
+// IsDue 是否到了下次执行时间
+func (plan *ChannelTestPlan) IsDue(now int64) bool {
+	return plan.Status == ChannelTestPlanStatusEnabled && now-plan.LastRunTime >= int64(plan.IntervalMinutes)*60
+}
+
+func GetAllChannelTestPlans() ([]*ChannelTestPlan, error) {
+	var plans []*ChannelTestPlan
+	err := DB.Order("id desc").Find(&plans).Error
+	return plans, err
+}
+
+func GetChannelTestPlanById(id int) (*ChannelTestPlan, error) {
+	plan := &ChannelTestPlan{}
+	err := DB.First(plan, "id = ?", id).Error
+	return plan, err
+}
+
+func (plan *ChannelTestPlan) Insert() error {
+	plan.CreatedTime = common.GetTimestamp()
+	return DB.Create(plan).Error
+}
+
+func (plan *ChannelTestPlan) Update() error {
+	return DB.Model(plan).Select("name", "channel_id", "tag", "models", "endpoint_types", "stream_enabled",
+		"ttft_threshold", "interval_minutes", "auto_disable", "status").Updates(plan).Error
+}
+
+func (plan *ChannelTestPlan) UpdateLastRunTime(lastRunTime int64) error {
+	plan.LastRunTime = lastRunTime
+	return DB.Model(plan).Update("last_run_time", lastRunTime).Error
+}
+
+func DeleteChannelTestPlanById(id int) error {
+	return DB.Delete(&ChannelTestPlan{}, "id = ?", id).Error
+}
+
+// SaveChannelModelTest 保存测试结果，同一渠道、模型、端点与流式组合只保留最近一次
+func SaveChannelModelTest(result *ChannelModelTest) error {
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "channel_id"}, {Name: "model_name"}, {Name: "endpoint_type"}, {Name: "is_stream"}},
+		DoUpdates: clause.AssignmentColumns([]string{"success", "response_time", "ttft", "message", "test_time"}),
+	}).Create(result).Error
+}
+
+func GetChannelModelTests(channelId int) ([]*ChannelModelTest, error) {
+	var results []*ChannelModelTest
+	err := DB.Where("channel_id = ?", channelId).Order("model_name asc, endpoint_type asc").Find(&results).Error
+	return results, err
+}
+
+func GetChannelDisabledModels(channelId int) ([]*ChannelDisabledModel, error) {
+	var disabledModels []*ChannelDisabledModel
+	err := DB.Where("channel_id = ?", channelId).Find(&disabledModels).Error
+	return disabledModels, err
+}
+
+// getChannelDisabledModelSet channel id -> 被禁用的模型集合
+func getChannelDisabledModelSet(db *gorm.DB, channelIds []int) map[int]map[string]bool {
+	var disabledModels []*ChannelDisabledModel
+	query := db.Model(&ChannelDisabledModel{})
+	if channelIds != nil {
+		query = query.Where("channel_id in (?)", channelIds)
+	}
+	if err := query.Find(&disabledModels).Error; err != nil {
+		common.SysLog(fmt.Sprintf("failed to load disabled channel models: %v", err))
+	}
+	result := make(map[int]map[string]bool)
+	for _, disabledModel := range disabledModels {
+		if result[disabledModel.ChannelId] == nil {
+			result[disabledModel.ChannelId] = make(map[string]bool)
+		}
+		result[disabledModel.ChannelId][disabledModel.ModelName] = true
+	}
+	return result
+}
+
+// DisableChannelModel 自动禁用渠道下的单个模型，返回是否为新禁用，已被禁用（包括手动禁用）的模型保持原状
+func DisableChannelModel(channelId int, modelName string, reason string) (bool, error) {
+	return disableChannelModel(channelId, modelName, reason, false)
+}
+
+// DisableChannelModelManually 手动禁用渠道下的单个模型，已被自动禁用的模型改为手动禁用
+func DisableChannelModelManually(channelId int, modelName string) error {
+	_, err := disableChannelModel(channelId, modelName, "手动禁用", true)
+	return err
+}
+
+func disableChannelModel(channelId int, modelName string, reason string, manual bool) (bool, error) {
+	onConflict := clause.OnConflict{DoNothing: true}
+	if manual {
+		onConflict = clause.OnConflict{
+			Columns:   []clause.Column{{Name: "channel_id"}, {Name: "model_name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"reason", "manual", "disabled_time"}),
+		}
+	}
+	result := DB.Clauses(onConflict).Create(&ChannelDisabledModel{
+		ChannelId:    channelId,
+		ModelName:    modelName,
+		Reason:       reason,
+		Manual:       manual,
+		DisabledTime: common.GetTimestamp(),
+	})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	err := DB.Model(&Ability{}).Where("channel_id = ? and model = ?", channelId, modelName).
+		Select("enabled").Update("enabled", false).Error
+	if err != nil {
+		return true, err
+	}
+	InitChannelCache()
+	return true, nil
+}
+
+// EnableChannelModel 手动解除渠道下单个模型的禁用，返回是否确实解除了禁用
+func EnableChannelModel(channelId int, modelName string) (bool, error) {
+	return enableChannelModel(channelId, modelName, true)
+}
+
+// AutoEnableChannelModel 测试通过后解除渠道下单个模型的自动禁用，手动禁用的模型保持禁用
+func AutoEnableChannelModel(channelId int, modelName string) (bool, error) {
+	return enableChannelModel(channelId, modelName, false)
+}
+
+func enableChannelModel(channelId int, modelName string, manual bool) (bool, error) {
+	query := DB.Where("channel_id = ? and model_name = ?", channelId, modelName)
+	if !manual {
+		query = query.Where("manual = ?", false)
+	}
+	result := query.Delete(&ChannelDisabledModel{})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	var status int
+	if err := DB.Model(&Channel{}).Select("status").Where("id = ?", channelId).Scan(&status).Error; err != nil {
+		return true, err
+	}
+	if status == common.ChannelStatusEnabled {
+		err := DB.Model(&Ability{}).Where("channel_id = ? and model = ?", channelId, modelName).
+			Select("enabled").Update("enabled", true).Error
+		if err != nil {
+			return true, err
+		}
+	}
+	InitChannelCache()
+	return true, nil
+}
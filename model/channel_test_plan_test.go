@@ -0,0 +1,94 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelModelDisableAndEnable(t *testing.T) {
+	type step struct {
+		action      string // auto_disable, manual_disable, auto_enable, manual_enable
+		wantChanged bool
+	}
+	tests := []struct {
+		name        string
+		steps       []step
+		wantEnabled bool
+		wantManual  bool // 仍被禁用时记录是否为手动禁用
+	}{
+		{
+			name:        "auto enable undoes auto disable",
+			steps:       []step{{"auto_disable", true}, {"auto_enable", true}},
+			wantEnabled: true,
+		},
+		{
+			name:       "auto enable keeps manual disable",
+			steps:      []step{{"manual_disable", true}, {"auto_enable", false}},
+			wantManual: true,
+		},
+		{
+			name:       "manual disable takes over auto disable",
+			steps:      []step{{"auto_disable", true}, {"manual_disable", true}, {"auto_enable", false}},
+			wantManual: true,
+		},
+		{
+			name:       "auto disable keeps manual disable",
+			steps:      []step{{"manual_disable", true}, {"auto_disable", false}, {"auto_enable", false}},
+			wantManual: true,
+		},
+		{
+			name:        "manual enable undoes manual disable",
+			steps:       []step{{"manual_disable", true}, {"manual_enable", true}},
+			wantEnabled: true,
+		},
+		{
+			name:        "manual enable undoes auto disable",
+			steps:       []step{{"auto_disable", true}, {"manual_enable", true}},
+			wantEnabled: true,
+		},
+		{
+			name:        "enable without disable",
+			steps:       []step{{"auto_enable", false}, {"manual_enable", false}},
+			wantEnabled: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t, &Channel{}, &Ability{}, &ChannelDisabledModel{})
+			require.NoError(t, DB.Create(&Channel{Id: 1, Name: "channel", Key: "sk-test", Status: common.ChannelStatusEnabled, Models: "gpt-4o", Group: "default"}).Error)
+			require.NoError(t, DB.Create(&Ability{Group: "default", Model: "gpt-4o", ChannelId: 1, Enabled: true}).Error)
+
+			for _, s := range tt.steps {
+				var changed bool
+				var err error
+				switch s.action {
+				case "auto_disable":
+					changed, err = DisableChannelModel(1, "gpt-4o", "test failed")
+				case "manual_disable":
+					changed, err = true, DisableChannelModelManually(1, "gpt-4o")
+				case "auto_enable":
+					changed, err = AutoEnableChannelModel(1, "gpt-4o")
+				case "manual_enable":
+					changed, err = EnableChannelModel(1, "gpt-4o")
+				}
+				require.NoError(t, err)
+				require.Equal(t, s.wantChanged, changed, s.action)
+			}
+
+			var ability Ability
+			require.NoError(t, DB.Where("channel_id = ? and model = ?", 1, "gpt-4o").First(&ability).Error)
+			require.Equal(t, tt.wantEnabled, ability.Enabled)
+			disabledModels, err := GetChannelDisabledModels(1)
+			require.NoError(t, err)
+			if tt.wantEnabled {
+				require.Empty(t, disabledModels)
+				return
+			}
+			require.Len(t, disabledModels, 1)
+			require.Equal(t, tt.wantManual, disabledModels[0].Manual)
+		})
+	}
+}
@@ -101,8 +101,8 @@ func userCheckinWithTransaction(checkin *Checkin, userId int, quotaAwarded int)
 		}
 
 		// 步骤2: 在事务中增加用户额度
-		if err := tx.Model(&User{}).Where("id = ?", userId).
-			Update("quota", gorm.Expr("quota + ?", quotaAwarded)).Error; err != nil {
+		ref := NewQuotaLedgerRef(QuotaLedgerReasonCheckin, QuotaLedgerRefCheckin, checkin.Id)
+		if err := applyUserQuotaDelta(tx, userId, quotaAwarded, ref); err != nil {
 			return errors.New("签到失败：更新额度出错")
 		}
 
@@ -131,7 +131,8 @@ func userCheckinWithoutTransaction(checkin *Checkin, userId int, quotaAwarded in
 
 	// 步骤2: 增加用户额度
 	// 使用 db=true 强制直接写入数据库，不使用批量更新
-	if err := IncreaseUserQuota(userId, quotaAwarded, true); err != nil {
+	ref := NewQuotaLedgerRef(QuotaLedgerReasonCheckin, QuotaLedgerRefCheckin, checkin.Id)
+	if err := IncreaseUserQuota(userId, quotaAwarded, true, ref); err != nil {
 		// 如果增加额度失败，需要回滚签到记录
 		DB.Delete(checkin)
 		return nil, errors.New("签到失败：更新额度出错")
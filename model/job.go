@@ -0,0 +1,231 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+
+	"gorm.io/gorm"
+)
+
+// 统一异步任务（jobs）同时来自 midjourneys 与 tasks 两张表，
+// 按 submit_time desc, source rank desc, id desc 的顺序合并分页。
+const (
+	JobSourceMidjourney = constant.TaskPlatformMidjourney
+	JobSourceTask       = "task"
+)
+
+var jobSourceRank = map[string]int{
+	JobSourceMidjourney: 0,
+	JobSourceTask:       1,
+}
+
+// JobRecord 合并后的单条记录，Midjourney 与 Task 二选一
+type JobRecord struct {
+	Source     string
+	Id         int64
+	SubmitTime int64
+	Midjourney *Midjourney
+	Task       *Task
+}
+
+// JobCursor 游标，指向上一页最后一条记录
+type JobCursor struct {
+	SubmitTime int64
+	Source     string
+	Id         int64
+}
+
+func (c *JobCursor) Encode() string {
+	raw := fmt.Sprintf("%d:%s:%d", c.SubmitTime, c.Source, c.Id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func ParseJobCursor(cursor string) (*JobCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 3 {
+		return nil, errors.New("invalid cursor")
+	}
+	submitTime, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	if _, ok := jobSourceRank[parts[1]]; !ok {
+		return nil, errors.New("invalid cursor")
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &JobCursor{SubmitTime: submitTime, Source: parts[1], Id: id}, nil
+}
+
+type JobQueryParams struct {
+	Platform string
+	Status   string // 统一后的状态，见 dto.JobStatus*
+	Cursor   *JobCursor
+}
+
+var midjourneyJobStatuses = map[string][]string{
+	dto.JobStatusQueued:     {"NOT_START", "SUBMITTED"},
+	dto.JobStatusInProgress: {"IN_PROGRESS", "MODAL"},
+	dto.JobStatusCompleted:  {"SUCCESS"},
+	dto.JobStatusFailed:     {"FAILURE"},
+}
+
+var taskJobStatuses = map[string][]string{
+	dto.JobStatusQueued:     {string(TaskStatusNotStart), TaskStatusSubmitted, TaskStatusQueued},
+	dto.JobStatusInProgress: {TaskStatusInProgress},
+	dto.JobStatusCompleted:  {TaskStatusSuccess},
+	dto.JobStatusFailed:     {TaskStatusFailure},
+}
+
+func IsValidJobStatus(status string) bool {
+	if status == dto.JobStatusUnknown {
+		return true
+	}
+	_, ok := taskJobStatuses[status]
+	return ok
+}
+
+// MidjourneyJobStatus 将 Midjourney 的状态转换为统一状态
+func MidjourneyJobStatus(status string) string {
+	return lookupJobStatus(midjourneyJobStatuses, status)
+}
+
+// TaskJobStatus 将 Task 的状态转换为统一状态
+func TaskJobStatus(status TaskStatus) string {
+	return lookupJobStatus(taskJobStatuses, string(status))
+}
+
+func lookupJobStatus(statusMap map[string][]string, status string) string {
+	for jobStatus, rawStatuses := range statusMap {
+		for _, rawStatus := range rawStatuses {
+			if rawStatus == status {
+				return jobStatus
+			}
+		}
+	}
+	return dto.JobStatusUnknown
+}
+
+func applyJobStatusFilter(query *gorm.DB, statusMap map[string][]string, status string) *gorm.DB {
+	if status == "" {
+		return query
+	}
+	if status == dto.JobStatusUnknown {
+		known := make([]string, 0)
+		for _, rawStatuses := range statusMap {
+			known = append(known, rawStatuses...)
+		}
+		return query.Where("status not in (?)", known)
+	}
+	return query.Where("status in (?)", statusMap[status])
+}
+
+func applyJobCursor(query *gorm.DB, source string, cursor *JobCursor) *gorm.DB {
+	if cursor == nil {
+		return query
+	}
+	rank, cursorRank := jobSourceRank[source], jobSourceRank[cursor.Source]
+	switch {
+	case rank > cursorRank:
+		return query.Where("submit_time < ?", cursor.SubmitTime)
+	case rank < cursorRank:
+		return query.Where("submit_time <= ?", cursor.SubmitTime)
+	default:
+		return query.Where("submit_time < ? or (submit_time = ? and id < ?)", cursor.SubmitTime, cursor.SubmitTime, cursor.Id)
+	}
+}
+
+// GetUserJobs 按游标获取用户的异步任务，返回记录、下一页游标
+func GetUserJobs(userId int, limit int, queryParams JobQueryParams) ([]*JobRecord, *JobCursor, error) {
+	records := make([]*JobRecord, 0, limit*2+2)
+
+	if queryParams.Platform == "" || queryParams.Platform == JobSourceMidjourney {
+		var mjs []*Midjourney
+		query := DB.Where("user_id = ?", userId)
+		query = applyJobStatusFilter(query, midjourneyJobStatuses, queryParams.Status)
+		query = applyJobCursor(query, JobSourceMidjourney, queryParams.Cursor)
+		err := query.Order("submit_time desc, id desc").Limit(limit + 1).Find(&mjs).Error
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, mj := range mjs {
+			records = append(records, &JobRecord{
+				Source:     JobSourceMidjourney,
+				Id:         int64(mj.Id),
+				SubmitTime: mj.SubmitTime,
+				Midjourney: mj,
+			})
+		}
+	}
+
+	if queryParams.Platform != JobSourceMidjourney {
+		var tasks []*Task
+		query := DB.Where("user_id = ?", userId)
+		if queryParams.Platform != "" {
+			query = query.Where("platform = ?", queryParams.Platform)
+		}
+		query = applyJobStatusFilter(query, taskJobStatuses, queryParams.Status)
+		query = applyJobCursor(query, JobSourceTask, queryParams.Cursor)
+		err := query.Omit("channel_id").Order("submit_time desc, id desc").Limit(limit + 1).Find(&tasks).Error
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, task := range tasks {
+			records = append(records, &JobRecord{
+				Source:     JobSourceTask,
+				Id:         task.ID,
+				SubmitTime: task.SubmitTime,
+				Task:       task,
+			})
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].SubmitTime != records[j].SubmitTime {
+			return records[i].SubmitTime > records[j].SubmitTime
+		}
+		if records[i].Source != records[j].Source {
+			return jobSourceRank[records[i].Source] > jobSourceRank[records[j].Source]
+		}
+		return records[i].Id > records[j].Id
+	})
+
+	if len(records) <= limit {
+		return records, nil, nil
+	}
+	records = records[:limit]
+	last := records[len(records)-1]
+	return records, &JobCursor{SubmitTime: last.SubmitTime, Source: last.Source, Id: last.Id}, nil
+}
+
+// GetUserJob 根据任务 ID 查找用户的异步任务，优先查找 tasks 表
+func GetUserJob(userId int, jobId string) (*JobRecord, bool, error) {
+	task, exist, err := GetByTaskId(userId, jobId)
+	if err != nil {
+		return nil, false, err
+	}
+	if exist {
+		return &JobRecord{Source: JobSourceTask, Id: task.ID, SubmitTime: task.SubmitTime, Task: task}, true, nil
+	}
+	mj := GetByMJId(userId, jobId)
+	if mj == nil {
+		return nil, false, nil
+	}
+	return &JobRecord{Source: JobSourceMidjourney, Id: int64(mj.Id), SubmitTime: mj.SubmitTime, Midjourney: mj}, true, nil
+}
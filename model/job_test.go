@@ -0,0 +1,121 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		midjourney string
+		task       TaskStatus
+		want       string
+	}{
+		{name: "not start", midjourney: "NOT_START", task: TaskStatusNotStart, want: dto.JobStatusQueued},
+		{name: "submitted", midjourney: "SUBMITTED", task: TaskStatusSubmitted, want: dto.JobStatusQueued},
+		{name: "queued", midjourney: "SUBMITTED", task: TaskStatusQueued, want: dto.JobStatusQueued},
+		{name: "in progress", midjourney: "IN_PROGRESS", task: TaskStatusInProgress, want: dto.JobStatusInProgress},
+		{name: "modal", midjourney: "MODAL", task: TaskStatusInProgress, want: dto.JobStatusInProgress},
+		{name: "success", midjourney: "SUCCESS", task: TaskStatusSuccess, want: dto.JobStatusCompleted},
+		{name: "failure", midjourney: "FAILURE", task: TaskStatusFailure, want: dto.JobStatusFailed},
+		{name: "unknown", midjourney: "CANCEL", task: TaskStatusUnknown, want: dto.JobStatusUnknown},
+		{name: "empty", want: dto.JobStatusUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, MidjourneyJobStatus(tt.midjourney))
+			require.Equal(t, tt.want, TaskJobStatus(tt.task))
+		})
+	}
+}
+
+func TestGetUserJobs(t *testing.T) {
+	setupTestDB(t, &Midjourney{}, &Task{})
+	for _, mj := range []*Midjourney{
+		{Id: 1, UserId: 1, MjId: "mj-1", SubmitTime: 100, Status: "SUCCESS"},
+		{Id: 2, UserId: 1, MjId: "mj-2", SubmitTime: 200, Status: "FAILURE"},
+		{Id: 3, UserId: 1, MjId: "mj-3", SubmitTime: 200, Status: "IN_PROGRESS"},
+		{Id: 4, UserId: 2, MjId: "mj-4", SubmitTime: 300, Status: "SUCCESS"},
+	} {
+		require.NoError(t, DB.Create(mj).Error)
+	}
+	for _, task := range []*Task{
+		{ID: 1, UserId: 1, TaskID: "task-1", Platform: "suno", SubmitTime: 200, Status: TaskStatusSuccess},
+		{ID: 2, UserId: 1, TaskID: "task-2", Platform: "55", SubmitTime: 300, Status: TaskStatusQueued},
+		{ID: 3, UserId: 1, TaskID: "task-3", Platform: "55", SubmitTime: 100, Status: TaskStatusSuccess},
+		{ID: 4, UserId: 1, TaskID: "task-4", Platform: "suno", SubmitTime: 200, Status: TaskStatusFailure},
+		{ID: 5, UserId: 2, TaskID: "task-5", Platform: "55", SubmitTime: 300, Status: TaskStatusSuccess},
+	} {
+		require.NoError(t, DB.Create(task).Error)
+	}
+
+	all := []string{"task:2", "task:4", "task:1", "mj:3", "mj:2", "task:3", "mj:1"}
+	tests := []struct {
+		name   string
+		limit  int
+		params JobQueryParams
+		want   []string
+	}{
+		{name: "single page", limit: 20, want: all},
+		{name: "page size one", limit: 1, want: all},
+		{name: "page size two", limit: 2, want: all},
+		{name: "page size three", limit: 3, want: all},
+		{name: "midjourney only", limit: 1, params: JobQueryParams{Platform: JobSourceMidjourney}, want: []string{"mj:3", "mj:2", "mj:1"}},
+		{name: "task platform", limit: 1, params: JobQueryParams{Platform: "suno"}, want: []string{"task:4", "task:1"}},
+		{name: "completed status", limit: 1, params: JobQueryParams{Status: dto.JobStatusCompleted}, want: []string{"task:1", "task:3", "mj:1"}},
+		{name: "failed status", limit: 2, params: JobQueryParams{Status: dto.JobStatusFailed}, want: []string{"task:4", "mj:2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]string, 0)
+			params := tt.params
+			for page := 0; page <= len(all); page++ {
+				records, next, err := GetUserJobs(1, tt.limit, params)
+				require.NoError(t, err)
+				require.LessOrEqual(t, len(records), tt.limit)
+				for _, record := range records {
+					got = append(got, fmt.Sprintf("%s:%d", record.Source, record.Id))
+				}
+				if next == nil {
+					break
+				}
+				// 游标经过编码与解析后应保持不变
+				params.Cursor, err = ParseJobCursor(next.Encode())
+				require.NoError(t, err)
+				require.Equal(t, next, params.Cursor)
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseJobCursor(t *testing.T) {
+	tests := []struct {
+		name    string
+		cursor  string
+		want    *JobCursor
+		wantErr bool
+	}{
+		{name: "empty", cursor: ""},
+		{name: "valid", cursor: (&JobCursor{SubmitTime: 100, Source: JobSourceTask, Id: 3}).Encode(), want: &JobCursor{SubmitTime: 100, Source: JobSourceTask, Id: 3}},
+		{name: "not base64", cursor: "!!!", wantErr: true},
+		{name: "unknown source", cursor: (&JobCursor{SubmitTime: 100, Source: "suno", Id: 3}).Encode(), wantErr: true},
+		{name: "missing parts", cursor: "MTAwOnRhc2s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := ParseJobCursor(tt.cursor)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, cursor)
+		})
+	}
+}
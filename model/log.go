@@ -18,25 +18,27 @@ import (
 )
 
 type Log struct {
-	Id               int    `json:"id" gorm:"index:idx_created_at_id,priority:1"`
-	UserId           int    `json:"user_id" gorm:"index"`
-	CreatedAt        int64  `json:"created_at" gorm:"bigint;index:idx_created_at_id,priority:2;index:idx_created_at_type"`
-	Type             int    `json:"type" gorm:"index:idx_created_at_type"`
-	Content          string `json:"content"`
-	Username         string `json:"username" gorm:"index;index:index_username_model_name,priority:2;default:''"`
-	TokenName        string `json:"token_name" gorm:"index;default:''"`
-	ModelName        string `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
-	Quota            int    `json:"quota" gorm:"default:0"`
-	PromptTokens     int    `json:"prompt_tokens" gorm:"default:0"`
-	CompletionTokens int    `json:"completion_tokens" gorm:"default:0"`
-	UseTime          int    `json:"use_time" gorm:"default:0"`
-	IsStream         bool   `json:"is_stream"`
-	ChannelId        int    `json:"channel" gorm:"index"`
-	ChannelName      string `json:"channel_name" gorm:"->"`
-	TokenId          int    `json:"token_id" gorm:"default:0;index"`
-	Group            string `json:"group" gorm:"index"`
-	Ip               string `json:"ip" gorm:"index;default:''"`
-	Other            string `json:"other"`
+	Id               int               `json:"id" gorm:"index:idx_created_at_id,priority:1"`
+	UserId           int               `json:"user_id" gorm:"index"`
+	CreatedAt        int64             `json:"created_at" gorm:"bigint;index:idx_created_at_id,priority:2;index:idx_created_at_type"`
+	Type             int               `json:"type" gorm:"index:idx_created_at_type"`
+	Content          string            `json:"content"`
+	Username         string            `json:"username" gorm:"index;index:index_username_model_name,priority:2;default:''"`
+	TokenName        string            `json:"token_name" gorm:"index;default:''"`
+	ModelName        string            `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
+	Quota            int               `json:"quota" gorm:"default:0"`
+	UpstreamCost     int               `json:"upstream_cost,omitempty" gorm:"default:0"`
+	PromptTokens     int               `json:"prompt_tokens" gorm:"default:0"`
+	CompletionTokens int               `json:"completion_tokens" gorm:"default:0"`
+	UseTime          int               `json:"use_time" gorm:"default:0"`
+	IsStream         bool              `json:"is_stream"`
+	ChannelId        int               `json:"channel" gorm:"index"`
+	ChannelName      string            `json:"channel_name" gorm:"->"`
+	TokenId          int               `json:"token_id" gorm:"default:0;index"`
+	Group            string            `json:"group" gorm:"index"`
+	Ip               string            `json:"ip" gorm:"index;default:''"`
+	Other            string            `json:"other"`
+	Tags             map[string]string `json:"tags,omitempty" gorm:"-"`
 }
 
 // don't use iota, avoid change log type value
@@ -53,6 +55,7 @@ const (
 func formatUserLogs(logs []*Log) {
 	for i := range logs {
 		logs[i].ChannelName = ""
+		logs[i].UpstreamCost = 0
 		var otherMap map[string]interface{}
 		otherMap, _ = common.StrToMap(logs[i].Other)
 		if otherMap != nil {
@@ -147,6 +150,7 @@ type RecordConsumeLogParams struct {
 	ModelName        string                 `json:"model_name"`
 	TokenName        string                 `json:"token_name"`
 	Quota            int                    `json:"quota"`
+	UpstreamCost     int                    `json:"upstream_cost"`
 	Content          string                 `json:"content"`
 	TokenId          int                    `json:"token_id"`
 	UseTimeSeconds   int                    `json:"use_time_seconds"`
@@ -180,6 +184,7 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 		TokenName:        params.TokenName,
 		ModelName:        params.ModelName,
 		Quota:            params.Quota,
+		UpstreamCost:     params.UpstreamCost,
 		ChannelId:        params.ChannelId,
 		TokenId:          params.TokenId,
 		UseTime:          params.UseTimeSeconds,
@@ -196,6 +201,8 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 	err := LOG_DB.Create(log).Error
 	if err != nil {
 		logger.LogError(c, "failed to record log: "+err.Error())
+	} else {
+		recordLogTags(c, log)
 	}
 	if common.DataExportEnabled {
 		gopool.Go(func() {
@@ -242,6 +249,10 @@ func GetAllLogs(logType int, startTimestamp int64, endTimestamp int64, modelName
 		return nil, 0, err
 	}
 
+	if err = fillLogTags(logs); err != nil {
+		return logs, total, err
+	}
+
 	channelIds := types.NewSet[int]()
 	for _, log := range logs {
 		if log.ChannelId != 0 {
@@ -301,6 +312,9 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 		return nil, 0, err
 	}
 
+	if err = fillLogTags(logs); err != nil {
+		return logs, total, err
+	}
 	formatUserLogs(logs)
 	return logs, total, err
 }
@@ -409,5 +423,8 @@ func DeleteOldLog(ctx context.Context, targetTimestamp int64, limit int) (int64,
 		}
 	}
 
+	if _, err := deleteOldLogTags(ctx, targetTimestamp, limit); err != nil {
+		return total, err
+	}
 	return total, nil
 }
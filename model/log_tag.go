@@ -0,0 +1,154 @@
+package model
+
+import (
+	"context"
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LogTag 消费日志的成本归属标签，每个标签一行，冗余了额度与 token 数以便按标签聚合时无需关联 logs 表
+type LogTag struct {
+	Id               int    `json:"id"`
+	LogId            int    `json:"log_id" gorm:"index"`
+	TagKey           string `json:"tag_key" gorm:"size:64;index:idx_log_tag_key_value,priority:1"`
+	TagValue         string `json:"tag_value" gorm:"size:128;index:idx_log_tag_key_value,priority:2"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"default:0"`
+	ModelName        string `json:"model_name" gorm:"default:''"`
+	Quota            int    `json:"quota" gorm:"default:0"`
+	PromptTokens     int    `json:"prompt_tokens" gorm:"default:0"`
+	CompletionTokens int    `json:"completion_tokens" gorm:"default:0"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// TagUsage 按标签值（可细分到模型）聚合的用量
+type TagUsage struct {
+	TagKey           string `json:"tag_key"`
+	TagValue         string `json:"tag_value"`
+	ModelName        string `json:"model_name,omitempty"`
+	Count            int    `json:"count"`
+	Quota            int    `json:"quota"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+}
+
+type TagUsageQuery struct {
+	TagKey         string
+	UserId         int
+	TokenId        int
+	StartTimestamp int64
+	EndTimestamp   int64
+	GroupByModel   bool
+}
+
+// recordLogTags 写入请求上下文中的标签，标签由 service.SetupRequestTags 按令牌白名单过滤
+func recordLogTags(c *gin.Context, log *Log) {
+	tags, ok := common.GetContextKeyType[map[string]string](c, constant.ContextKeyRequestTags)
+	if !ok || len(tags) == 0 {
+		return
+	}
+	logTags := make([]*LogTag, 0, len(tags))
+	for key, value := range tags {
+		logTags = append(logTags, &LogTag{
+			LogId:            log.Id,
+			TagKey:           key,
+			TagValue:         value,
+			UserId:           log.UserId,
+			TokenId:          log.TokenId,
+			ModelName:        log.ModelName,
+			Quota:            log.Quota,
+			PromptTokens:     log.PromptTokens,
+			CompletionTokens: log.CompletionTokens,
+			CreatedAt:        log.CreatedAt,
+		})
+	}
+	if err := LOG_DB.Create(&logTags).Error; err != nil {
+		common.SysError("failed to record log tags: " + err.Error())
+	}
+}
+
+// fillLogTags 为消费日志填充标签
+func fillLogTags(logs []*Log) error {
+	logIds := make([]int, 0, len(logs))
+	for _, log := range logs {
+		if log.Type == LogTypeConsume {
+			logIds = append(logIds, log.Id)
+		}
+	}
+	if len(logIds) == 0 {
+		return nil
+	}
+	var logTags []*LogTag
+	if err := LOG_DB.Where("log_id in ?", logIds).Find(&logTags).Error; err != nil {
+		return err
+	}
+	tagMap := make(map[int]map[string]string)
+	for _, tag := range logTags {
+		if tagMap[tag.LogId] == nil {
+			tagMap[tag.LogId] = make(map[string]string)
+		}
+		tagMap[tag.LogId][tag.TagKey] = tag.TagValue
+	}
+	for _, log := range logs {
+		log.Tags = tagMap[log.Id]
+	}
+	return nil
+}
+
+// SumUsedQuotaByTag 按标签值聚合消费额度与 token 数，tag_key 为空时按全部标签键聚合
+func SumUsedQuotaByTag(query TagUsageQuery) ([]*TagUsage, error) {
+	groupColumns := "tag_key, tag_value"
+	if query.GroupByModel {
+		groupColumns += ", model_name"
+	}
+	tx := LOG_DB.Model(&LogTag{}).Select(groupColumns + ", count(*) as count, sum(quota) as quota, " +
+		"sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens")
+	if query.TagKey != "" {
+		tx = tx.Where("tag_key = ?", query.TagKey)
+	}
+	if query.UserId != 0 {
+		tx = tx.Where("user_id = ?", query.UserId)
+	}
+	if query.TokenId != 0 {
+		tx = tx.Where("token_id = ?", query.TokenId)
+	}
+	if query.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", query.StartTimestamp)
+	}
+	if query.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTimestamp)
+	}
+	var usages []*TagUsage
+	if err := tx.Group(groupColumns).Scan(&usages).Error; err != nil {
+		return nil, err
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		if usages[i].TagKey != usages[j].TagKey {
+			return usages[i].TagKey < usages[j].TagKey
+		}
+		return usages[i].Quota > usages[j].Quota
+	})
+	return usages, nil
+}
+
+func deleteOldLogTags(ctx context.Context, targetTimestamp int64, limit int) (int64, error) {
+	var total int64 = 0
+	for {
+		if nil != ctx.Err() {
+			return total, ctx.Err()
+		}
+		result := LOG_DB.Where("created_at < ?", targetTimestamp).Limit(limit).Delete(&LogTag{})
+		if nil != result.Error {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < int64(limit) {
+			break
+		}
+	}
+	return total, nil
+}
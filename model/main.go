@@ -268,11 +268,33 @@ func migrateDB() error {
 		&TwoFA{},
 		&TwoFABackupCode{},
 		&Checkin{},
+		&ChannelHealthEvent{},
+		&ChannelHealthStat{},
+		&ChannelTestPlan{},
+		&ChannelModelTest{},
+		&ChannelDisabledModel{},
+		&ChannelKeyUsage{},
+		&QuotaLedger{},
+		&QuotaLedgerDrift{},
+		&QuotaLedgerSnapshot{},
+		&PriceOverride{},
+		&ChannelCostStat{},
+		&SubscriptionPlan{},
+		&UserSubscription{},
+		&Statement{},
+		&Role{},
+		&AuditLog{},
+		&LogTag{},
+		&UserSession{},
+		&UserAccessToken{},
 	)
 	if err != nil {
 		return err
 	}
-	return nil
+	if err := migrateTokenCertOnlyIdentities(); err != nil {
+		return err
+	}
+	return migrateLegacyAccessTokens()
 }
 
 func migrateDBFast() error {
@@ -302,6 +324,25 @@ func migrateDBFast() error {
 		{&TwoFA{}, "TwoFA"},
 		{&TwoFABackupCode{}, "TwoFABackupCode"},
 		{&Checkin{}, "Checkin"},
+		{&ChannelHealthEvent{}, "ChannelHealthEvent"},
+		{&ChannelHealthStat{}, "ChannelHealthStat"},
+		{&ChannelTestPlan{}, "ChannelTestPlan"},
+		{&ChannelModelTest{}, "ChannelModelTest"},
+		{&ChannelDisabledModel{}, "ChannelDisabledModel"},
+		{&ChannelKeyUsage{}, "ChannelKeyUsage"},
+		{&QuotaLedger{}, "QuotaLedger"},
+		{&QuotaLedgerDrift{}, "QuotaLedgerDrift"},
+		{&QuotaLedgerSnapshot{}, "QuotaLedgerSnapshot"},
+		{&PriceOverride{}, "PriceOverride"},
+		{&ChannelCostStat{}, "ChannelCostStat"},
+		{&SubscriptionPlan{}, "SubscriptionPlan"},
+		{&UserSubscription{}, "UserSubscription"},
+		{&Statement{}, "Statement"},
+		{&Role{}, "Role"},
+		{&AuditLog{}, "AuditLog"},
+		{&LogTag{}, "LogTag"},
+		{&UserSession{}, "UserSession"},
+		{&UserAccessToken{}, "UserAccessToken"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -326,13 +367,19 @@ func migrateDBFast() error {
 			return err
 		}
 	}
+	if err := migrateTokenCertOnlyIdentities(); err != nil {
+		return err
+	}
+	if err := migrateLegacyAccessTokens(); err != nil {
+		return err
+	}
 	common.SysLog("database migrated")
 	return nil
 }
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &LogTag{}, &AuditLog{}); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,29 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupTestDB 使用内存 SQLite 替换 DB 与 LOG_DB 并关闭 Redis，测试结束后恢复
+func setupTestDB(t *testing.T, models ...any) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(models...))
+	origDB, origLogDB, origSQLite, origRedis := DB, LOG_DB, common.UsingSQLite, common.RedisEnabled
+	DB, LOG_DB, common.UsingSQLite, common.RedisEnabled = db, db, true, false
+	initCol()
+	t.Cleanup(func() {
+		DB, LOG_DB, common.UsingSQLite, common.RedisEnabled = origDB, origLogDB, origSQLite, origRedis
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package model
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+// PriceOverride 针对单个用户（可细化到令牌）协商的模型价格，在生效时间内替代全局的模型倍率或价格，
+// 分组倍率仍然照常叠加。ModelPrice 与 ModelRatio 互斥，未设置的字段沿用全局配置
+type PriceOverride struct {
+	Id              int      `json:"id"`
+	UserId          int      `json:"user_id" gorm:"index"`
+	TokenId         int      `json:"token_id" gorm:"default:0"` // 0 表示对该用户的全部令牌生效
+	ModelName       string   `json:"model_name" gorm:"size:255;index"`
+	ModelRatio      *float64 `json:"model_ratio"`
+	CompletionRatio *float64 `json:"completion_ratio"`
+	ModelPrice      *float64 `json:"model_price"`
+	StartTime       int64    `json:"start_time" gorm:"bigint;default:0"` // 0 表示立即生效
+	EndTime         int64    `json:"end_time" gorm:"bigint;default:0"`   // 0 表示长期有效
+	Remark          string   `json:"remark" gorm:"type:text"`
+	CreatedTime     int64    `json:"created_time" gorm:"bigint"`
+}
+
+// priceOverrideCache 用户 ID -> 未过期的价格覆盖，仅在开启内存缓存时使用
+var priceOverrideCache = make(map[int][]*PriceOverride)
+var priceOverrideCacheLock sync.RWMutex
+
+func (o *PriceOverride) Validate() error {
+	if o.UserId <= 0 {
+		return errors.New("用户不能为空")
+	}
+	if o.TokenId < 0 {
+		return errors.New("无效的令牌")
+	}
+	if o.ModelName == "" {
+		return errors.New("模型名称不能为空")
+	}
+	if o.ModelRatio == nil && o.CompletionRatio == nil && o.ModelPrice == nil {
+		return errors.New("模型倍率、补全倍率与固定价格至少设置一项")
+	}
+	if o.ModelPrice != nil && (o.ModelRatio != nil || o.CompletionRatio != nil) {
+		return errors.New("固定价格不能与倍率同时设置")
+	}
+	for _, value := range []*float64{o.ModelRatio, o.CompletionRatio, o.ModelPrice} {
+		if value != nil && *value < 0 {
+			return errors.New("倍率与价格不能小于0")
+		}
+	}
+	if o.StartTime < 0 || o.EndTime < 0 || (o.EndTime != 0 && o.EndTime <= o.StartTime) {
+		return errors.New("无效的生效时间")
+	}
+	return nil
+}
+
+// ActiveAt 判断覆盖在指定时间是否生效
+func (o *PriceOverride) ActiveAt(now int64) bool {
+	return now >= o.StartTime && (o.EndTime == 0 || now < o.EndTime)
+}
+
+// Match 判断覆盖是否适用于该令牌与模型
+func (o *PriceOverride) Match(tokenId int, modelName string) bool {
+	if o.TokenId != 0 && o.TokenId != tokenId {
+		return false
+	}
+	return o.ModelName == modelName || o.ModelName == ratio_setting.FormatMatchingModelName(modelName)
+}
+
+func GetPriceOverrides(userId int, pageInfo *common.PageInfo) (overrides []*PriceOverride, total int64, err error) {
+	tx := DB.Model(&PriceOverride{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&overrides).Error
+	return overrides, total, err
+}
+
+func GetPriceOverrideById(id int) (*PriceOverride, error) {
+	override := &PriceOverride{}
+	err := DB.First(override, "id = ?", id).Error
+	return override, err
+}
+
+func (o *PriceOverride) Insert() error {
+	o.CreatedTime = common.GetTimestamp()
+	if err := DB.Create(o).Error; err != nil {
+		return err
+	}
+	InitPriceOverrideCache()
+	return nil
+}
+
+func (o *PriceOverride) Update() error {
+	err := DB.Model(o).Select("user_id", "token_id", "model_name", "model_ratio", "completion_ratio", "model_price",
+		"start_time", "end_time", "remark").Updates(o).Error
+	if err != nil {
+		return err
+	}
+	InitPriceOverrideCache()
+	return nil
+}
+
+func DeletePriceOverrideById(id int) error {
+	if err := DB.Delete(&PriceOverride{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	InitPriceOverrideCache()
+	return nil
+}
+
+func InitPriceOverrideCache() {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	var overrides []*PriceOverride
+	err := DB.Where("end_time = 0 or end_time > ?", common.GetTimestamp()).Find(&overrides).Error
+	if err != nil {
+		common.SysError("failed to load price overrides: " + err.Error())
+		return
+	}
+	newCache := make(map[int][]*PriceOverride)
+	for _, override := range overrides {
+		newCache[override.UserId] = append(newCache[override.UserId], override)
+	}
+	priceOverrideCacheLock.Lock()
+	priceOverrideCache = newCache
+	priceOverrideCacheLock.Unlock()
+}
+
+func SyncPriceOverrideCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		InitPriceOverrideCache()
+	}
+}
+
+func getUserPriceOverrides(userId int) []*PriceOverride {
+	if common.MemoryCacheEnabled {
+		priceOverrideCacheLock.RLock()
+		defer priceOverrideCacheLock.RUnlock()
+		return priceOverrideCache[userId]
+	}
+	var overrides []*PriceOverride
+	err := DB.Where("user_id = ? and (end_time = 0 or end_time > ?)", userId, common.GetTimestamp()).Find(&overrides).Error
+	if err != nil {
+		common.SysError("failed to query price overrides: " + err.Error())
+		return nil
+	}
+	return overrides
+}
+
+// GetActivePriceOverride 返回当前对该用户、令牌与模型生效的价格覆盖。
+// 指定令牌的覆盖优先于用户级覆盖，同一级别下取开始时间最晚的一条
+func GetActivePriceOverride(userId int, tokenId int, modelName string) *PriceOverride {
+	if userId == 0 {
+		return nil
+	}
+	now := common.GetTimestamp()
+	candidates := make([]*PriceOverride, 0)
+	for _, override := range getUserPriceOverrides(userId) {
+		if override.Match(tokenId, modelName) && override.ActiveAt(now) {
+			candidates = append(candidates, override)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if (a.TokenId != 0) != (b.TokenId != 0) {
+			return a.TokenId != 0
+		}
+		if a.StartTime != b.StartTime {
+			return a.StartTime > b.StartTime
+		}
+		return a.Id > b.Id
+	})
+	return candidates[0]
+}
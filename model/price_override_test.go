@@ -0,0 +1,85 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func float64Ptr(v float64) *float64 {
+	return &v
+}
+
+func TestPriceOverrideValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		override PriceOverride
+		wantErr  bool
+	}{
+		{name: "ratio only", override: PriceOverride{UserId: 1, ModelName: "gpt-4o", ModelRatio: float64Ptr(1)}},
+		{name: "price only", override: PriceOverride{UserId: 1, ModelName: "gpt-4o", ModelPrice: float64Ptr(0.1)}},
+		{name: "missing user", override: PriceOverride{ModelName: "gpt-4o", ModelRatio: float64Ptr(1)}, wantErr: true},
+		{name: "missing model", override: PriceOverride{UserId: 1, ModelRatio: float64Ptr(1)}, wantErr: true},
+		{name: "nothing overridden", override: PriceOverride{UserId: 1, ModelName: "gpt-4o"}, wantErr: true},
+		{name: "price with ratio", override: PriceOverride{UserId: 1, ModelName: "gpt-4o", ModelPrice: float64Ptr(0.1), CompletionRatio: float64Ptr(2)}, wantErr: true},
+		{name: "negative ratio", override: PriceOverride{UserId: 1, ModelName: "gpt-4o", ModelRatio: float64Ptr(-1)}, wantErr: true},
+		{name: "end before start", override: PriceOverride{UserId: 1, ModelName: "gpt-4o", ModelRatio: float64Ptr(1), StartTime: 200, EndTime: 100}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.override.Validate()
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGetActivePriceOverride(t *testing.T) {
+	now := common.GetTimestamp()
+	overrides := []*PriceOverride{
+		{Id: 1, UserId: 1, ModelName: "gpt-4o", ModelRatio: float64Ptr(1)},
+		{Id: 2, UserId: 1, ModelName: "gpt-4o", ModelRatio: float64Ptr(2), StartTime: now - 100},
+		{Id: 3, UserId: 1, TokenId: 10, ModelName: "gpt-4o", ModelRatio: float64Ptr(3)},
+		{Id: 4, UserId: 1, ModelName: "gpt-4o-mini", ModelRatio: float64Ptr(4), StartTime: now + 3600},
+		{Id: 5, UserId: 1, ModelName: "claude-3", ModelRatio: float64Ptr(5), EndTime: now - 1},
+		{Id: 6, UserId: 1, ModelName: "claude-3", ModelRatio: float64Ptr(6), StartTime: now - 100},
+		{Id: 7, UserId: 1, ModelName: "claude-3", ModelRatio: float64Ptr(7), StartTime: now - 100},
+	}
+	origEnabled, origCache := common.MemoryCacheEnabled, priceOverrideCache
+	common.MemoryCacheEnabled = true
+	priceOverrideCache = map[int][]*PriceOverride{1: overrides}
+	t.Cleanup(func() {
+		common.MemoryCacheEnabled, priceOverrideCache = origEnabled, origCache
+	})
+
+	tests := []struct {
+		name      string
+		userId    int
+		tokenId   int
+		modelName string
+		wantId    int // 0 表示无生效覆盖
+	}{
+		{name: "latest start wins at user level", userId: 1, tokenId: 20, modelName: "gpt-4o", wantId: 2},
+		{name: "token override beats user override", userId: 1, tokenId: 10, modelName: "gpt-4o", wantId: 3},
+		{name: "not started yet", userId: 1, tokenId: 10, modelName: "gpt-4o-mini"},
+		{name: "expired skipped and higher id breaks tie", userId: 1, modelName: "claude-3", wantId: 7},
+		{name: "other user", userId: 2, modelName: "gpt-4o"},
+		{name: "anonymous", userId: 0, modelName: "gpt-4o"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			override := GetActivePriceOverride(tt.userId, tt.tokenId, tt.modelName)
+			if tt.wantId == 0 {
+				require.Nil(t, override)
+				return
+			}
+			require.NotNil(t, override)
+			require.Equal(t, tt.wantId, override.Id)
+		})
+	}
+}
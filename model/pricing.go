@@ -25,6 +25,8 @@ type Pricing struct {
 	ModelPrice             float64                 `json:"model_price"`
 	OwnerBy                string                  `json:"owner_by"`
 	CompletionRatio        float64                 `json:"completion_ratio"`
+	CacheRatio             *float64                `json:"cache_ratio,omitempty"`
+	PriceTiers             []types.PriceTier       `json:"price_tiers,omitempty"`
 	EnableGroup            []string                `json:"enable_groups"`
 	SupportedEndpointTypes []constant.EndpointType `json:"supported_endpoint_types"`
 }
@@ -289,6 +291,10 @@ func updatePricing() {
 			modelRatio, _, _ := ratio_setting.GetModelRatio(model)
 			pricing.ModelRatio = modelRatio
 			pricing.CompletionRatio = ratio_setting.GetCompletionRatio(model)
+			if cacheRatio, ok := ratio_setting.GetCacheRatio(model); ok {
+				pricing.CacheRatio = &cacheRatio
+			}
+			pricing.PriceTiers = ratio_setting.GetModelPriceTiers(model)
 			pricing.QuotaType = 0
 		}
 		pricingMap = append(pricingMap, pricing)
@@ -0,0 +1,517 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	QuotaLedgerAccountUser  = "user"
+	QuotaLedgerAccountToken = "token"
+)
+
+// 台账记录原因
+const (
+	QuotaLedgerReasonOpening           = "opening" // 台账启用前已有的余额
+	QuotaLedgerReasonRegister          = "register"
+	QuotaLedgerReasonTokenCreate       = "token_create"
+	QuotaLedgerReasonPreConsume        = "pre_consume"
+	QuotaLedgerReasonConsume           = "consume" // 结算时的补扣（预扣费不足）
+	QuotaLedgerReasonRefund            = "refund"  // 结算时返还多扣的预扣费、任务失败退款等
+	QuotaLedgerReasonTopUp             = "topup"
+	QuotaLedgerReasonTopUpRefund       = "topup_refund" // 充值订单退款扣回额度
+	QuotaLedgerReasonRedemption        = "redemption"
+	QuotaLedgerReasonCheckin           = "checkin"
+	QuotaLedgerReasonInvite            = "invite"
+	QuotaLedgerReasonAffTransfer       = "aff_transfer"
+	QuotaLedgerReasonAdmin             = "admin"
+	QuotaLedgerReasonTokenEdit         = "token_edit"
+	QuotaLedgerReasonAdjustment        = "adjustment"
+	QuotaLedgerReasonSubscription      = "subscription"       // 订阅周期发放的额度
+	QuotaLedgerReasonSubscriptionReset = "subscription_reset" // 周期结束时收回未用完的订阅额度
+)
+
+// 台账关联对象类型
+const (
+	QuotaLedgerRefRequest      = "request" // 请求 ID，与消费日志 other.request_id 对应
+	QuotaLedgerRefTopUp        = "topup"   // 充值订单号 trade_no
+	QuotaLedgerRefRedemption   = "redemption"
+	QuotaLedgerRefTask         = "task"
+	QuotaLedgerRefCheckin      = "checkin"
+	QuotaLedgerRefUser         = "user"
+	QuotaLedgerRefDrift        = "drift"
+	QuotaLedgerRefSubscription = "subscription"
+)
+
+// QuotaLedgerRef 额度变动的原因与关联对象
+type QuotaLedgerRef struct {
+	Reason  string
+	RefType string
+	RefId   string
+}
+
+func NewQuotaLedgerRef(reason string, refType string, refId any) QuotaLedgerRef {
+	ref := QuotaLedgerRef{Reason: reason, RefType: refType}
+	if refId != nil {
+		ref.RefId = fmt.Sprintf("%v", refId)
+	}
+	return ref
+}
+
+// QuotaLedger 只追加的额度台账，记录用户额度与令牌剩余额度的每一次增减。
+// 同一账户的 Delta 之和应当等于当前余额，由对账任务定期校验
+type QuotaLedger struct {
+	Id           int    `json:"id"`
+	Account      string `json:"account" gorm:"size:16;index:idx_quota_ledger_account,priority:1"`
+	UserId       int    `json:"user_id" gorm:"index:idx_quota_ledger_account,priority:2"`
+	TokenId      int    `json:"token_id" gorm:"index"`
+	Delta        int    `json:"delta"`
+	BalanceAfter int    `json:"balance_after"`
+	Reason       string `json:"reason" gorm:"size:32;index"`
+	RefType      string `json:"ref_type" gorm:"size:32;default:''"`
+	RefId        string `json:"ref_id" gorm:"size:128;index;default:''"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// quotaLedgerEntry 一次尚未写入台账的额度变动。开启批量更新时，变动先在内存中累积，
+// 落库时每次变动仍单独记一条台账，保留其关联的请求
+type quotaLedgerEntry struct {
+	Delta     int
+	Ref       QuotaLedgerRef
+	CreatedAt int64
+}
+
+func newQuotaLedgerEntry(delta int, ref QuotaLedgerRef) quotaLedgerEntry {
+	return quotaLedgerEntry{Delta: delta, Ref: ref, CreatedAt: common.GetTimestamp()}
+}
+
+func sumQuotaLedgerEntries(entries []quotaLedgerEntry) int {
+	sum := 0
+	for _, entry := range entries {
+		sum += entry.Delta
+	}
+	return sum
+}
+
+// applyUserQuotaDelta 在事务内增减用户额度并追加台账记录
+func applyUserQuotaDelta(tx *gorm.DB, userId int, delta int, ref QuotaLedgerRef) error {
+	return applyUserQuotaEntries(tx, userId, []quotaLedgerEntry{newQuotaLedgerEntry(delta, ref)})
+}
+
+// applyUserQuotaEntries 在事务内一次性增减用户额度，并为每次变动追加台账记录
+func applyUserQuotaEntries(tx *gorm.DB, userId int, entries []quotaLedgerEntry) error {
+	err := tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", sumQuotaLedgerEntries(entries))).Error
+	if err != nil {
+		return err
+	}
+	return recordUserQuotaLedgerEntries(tx, userId, entries)
+}
+
+// recordUserQuotaLedger 用户额度已在事务内更新后，追加对应的台账记录
+func recordUserQuotaLedger(tx *gorm.DB, userId int, delta int, ref QuotaLedgerRef) error {
+	return recordUserQuotaLedgerEntries(tx, userId, []quotaLedgerEntry{newQuotaLedgerEntry(delta, ref)})
+}
+
+func recordUserQuotaLedgerEntries(tx *gorm.DB, userId int, entries []quotaLedgerEntry) error {
+	var balance int
+	if err := tx.Model(&User{}).Where("id = ?", userId).Select("quota").Scan(&balance).Error; err != nil {
+		return err
+	}
+	return tx.Create(buildQuotaLedgers(QuotaLedgerAccountUser, userId, 0, balance, entries)).Error
+}
+
+// recordTokenQuotaLedger 令牌剩余额度已在事务内更新后，追加对应的台账记录
+func recordTokenQuotaLedger(tx *gorm.DB, tokenId int, delta int, ref QuotaLedgerRef) error {
+	return recordTokenQuotaLedgerEntries(tx, tokenId, []quotaLedgerEntry{newQuotaLedgerEntry(delta, ref)})
+}
+
+func recordTokenQuotaLedgerEntries(tx *gorm.DB, tokenId int, entries []quotaLedgerEntry) error {
+	var token Token
+	if err := tx.Select("id", "user_id", "remain_quota").Where("id = ?", tokenId).First(&token).Error; err != nil {
+		return err
+	}
+	return tx.Create(buildQuotaLedgers(QuotaLedgerAccountToken, token.UserId, tokenId, token.RemainQuota, entries)).Error
+}
+
+// buildQuotaLedgers 由更新后的余额倒推每次变动后的余额，生成按发生顺序排列的台账记录
+func buildQuotaLedgers(account string, userId int, tokenId int, balance int, entries []quotaLedgerEntry) []*QuotaLedger {
+	ledgers := make([]*QuotaLedger, len(entries))
+	balance -= sumQuotaLedgerEntries(entries)
+	for i, entry := range entries {
+		balance += entry.Delta
+		ledgers[i] = &QuotaLedger{
+			Account:      account,
+			UserId:       userId,
+			TokenId:      tokenId,
+			Delta:        entry.Delta,
+			BalanceAfter: balance,
+			Reason:       entry.Ref.Reason,
+			RefType:      entry.Ref.RefType,
+			RefId:        entry.Ref.RefId,
+			CreatedAt:    entry.CreatedAt,
+		}
+	}
+	return ledgers
+}
+
+// recordQuotaLedgerCorrection 追加一条记录，使账户的台账合计等于当前余额
+func recordQuotaLedgerCorrection(tx *gorm.DB, account string, id int, ref QuotaLedgerRef) error {
+	sum, err := getAccountLedgerBalance(tx, account, id)
+	if err != nil {
+		return err
+	}
+	var balance int
+	if account == QuotaLedgerAccountToken {
+		if err = tx.Model(&Token{}).Where("id = ?", id).Select("remain_quota").Scan(&balance).Error; err != nil {
+			return err
+		}
+		return recordTokenQuotaLedger(tx, id, balance-sum, ref)
+	}
+	if err = tx.Model(&User{}).Where("id = ?", id).Select("quota").Scan(&balance).Error; err != nil {
+		return err
+	}
+	return recordUserQuotaLedger(tx, id, balance-sum, ref)
+}
+
+type QuotaLedgerQuery struct {
+	Account   string
+	UserId    int
+	TokenId   int
+	Reason    string
+	RefId     string
+	StartTime int64
+	EndTime   int64
+}
+
+func GetQuotaLedgers(query QuotaLedgerQuery, pageInfo *common.PageInfo) (ledgers []*QuotaLedger, total int64, err error) {
+	tx := DB.Model(&QuotaLedger{})
+	if query.Account != "" {
+		tx = tx.Where("account = ?", query.Account)
+	}
+	if query.UserId != 0 {
+		tx = tx.Where("user_id = ?", query.UserId)
+	}
+	if query.TokenId != 0 {
+		tx = tx.Where("token_id = ?", query.TokenId)
+	}
+	if query.Reason != "" {
+		tx = tx.Where("reason = ?", query.Reason)
+	}
+	if query.RefId != "" {
+		tx = tx.Where("ref_id = ?", query.RefId)
+	}
+	if query.StartTime != 0 {
+		tx = tx.Where("created_at >= ?", query.StartTime)
+	}
+	if query.EndTime != 0 {
+		tx = tx.Where("created_at <= ?", query.EndTime)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&ledgers).Error
+	return ledgers, total, err
+}
+
+// QuotaLedgerDrift 对账发现的余额与台账合计不一致的账户
+type QuotaLedgerDrift struct {
+	Id            int    `json:"id"`
+	Account       string `json:"account" gorm:"size:16;index"`
+	UserId        int    `json:"user_id" gorm:"index"`
+	TokenId       int    `json:"token_id"`
+	LedgerBalance int    `json:"ledger_balance"` // 台账 Delta 合计
+	ActualBalance int    `json:"actual_balance"` // 当前余额
+	Diff          int    `json:"diff"`           // ActualBalance - LedgerBalance
+	DetectedAt    int64  `json:"detected_at" gorm:"bigint"`
+	Resolved      bool   `json:"resolved" gorm:"index"`
+	ResolvedAt    int64  `json:"resolved_at" gorm:"bigint;default:0"`
+}
+
+// QuotaLedgerSnapshot 账户截至某条台账记录的 Delta 合计。对账时只需汇总快照之后新增的记录，
+// 已计入快照的旧记录可以按保留期清理而不影响对账
+type QuotaLedgerSnapshot struct {
+	Id            int    `json:"id"`
+	Account       string `json:"account" gorm:"size:16;uniqueIndex:idx_quota_ledger_snapshot_account,priority:1"`
+	AccountId     int    `json:"account_id" gorm:"uniqueIndex:idx_quota_ledger_snapshot_account,priority:2"`
+	LedgerBalance int    `json:"ledger_balance"` // 截至 LedgerId（含）的 Delta 合计
+	LedgerId      int    `json:"ledger_id" gorm:"index"`
+	UpdatedAt     int64  `json:"updated_at" gorm:"bigint"`
+}
+
+const (
+	quotaLedgerSnapshotBatchSize = 10000
+	// 只把写入超过该时长的记录计入快照，避免遗漏 id 较小但提交较晚的事务
+	quotaLedgerSnapshotDelay = 60
+)
+
+type quotaLedgerBalance struct {
+	Id      int
+	Balance int
+}
+
+func accountIdColumn(account string) string {
+	if account == QuotaLedgerAccountToken {
+		return "token_id"
+	}
+	return "user_id"
+}
+
+// accountBalanceQuery 返回账户所在表的查询、表名与余额列
+func accountBalanceQuery(db *gorm.DB, account string) (*gorm.DB, string, string) {
+	if account == QuotaLedgerAccountToken {
+		return db.Model(&Token{}), "tokens", "tokens.remain_quota"
+	}
+	return db.Model(&User{}), "users", "users.quota"
+}
+
+// getAccountLedgerBalance 账户的台账合计：快照合计加上快照之后的记录
+func getAccountLedgerBalance(tx *gorm.DB, account string, id int) (int, error) {
+	var snapshot QuotaLedgerSnapshot
+	err := tx.Where("account = ? and account_id = ?", account, id).Limit(1).Find(&snapshot).Error
+	if err != nil {
+		return 0, err
+	}
+	var tail int
+	err = tx.Model(&QuotaLedger{}).Select("coalesce(sum(delta), 0)").
+		Where("account = ? and "+accountIdColumn(account)+" = ? and id > ?", account, id, snapshot.LedgerId).
+		Scan(&tail).Error
+	return snapshot.LedgerBalance + tail, err
+}
+
+// getAccountBalance 账户当前余额，账户不存在时 ok 为 false
+func getAccountBalance(account string, id int) (balance int, ok bool, err error) {
+	query, _, column := accountBalanceQuery(DB, account)
+	var rows []quotaLedgerBalance
+	err = query.Select(column+" as balance").Where("id = ?", id).Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return 0, false, err
+	}
+	return rows[0].Balance, true, nil
+}
+
+// AdvanceQuotaLedgerSnapshots 将上次快照之后的台账记录分批计入快照，返回最新的快照位置
+func AdvanceQuotaLedgerSnapshots() (int, error) {
+	var cursor int
+	if err := DB.Model(&QuotaLedgerSnapshot{}).Select("coalesce(max(ledger_id), 0)").Scan(&cursor).Error; err != nil {
+		return 0, err
+	}
+	var maxId int
+	err := DB.Model(&QuotaLedger{}).Select("coalesce(max(id), 0)").
+		Where("created_at < ?", common.GetTimestamp()-quotaLedgerSnapshotDelay).Scan(&maxId).Error
+	if err != nil {
+		return cursor, err
+	}
+	for cursor < maxId {
+		end := cursor + quotaLedgerSnapshotBatchSize
+		if end > maxId {
+			end = maxId
+		}
+		if err = advanceQuotaLedgerSnapshots(cursor, end); err != nil {
+			return cursor, err
+		}
+		cursor = end
+	}
+	return cursor, nil
+}
+
+func advanceQuotaLedgerSnapshots(start int, end int) error {
+	var rows []struct {
+		Account string
+		UserId  int
+		TokenId int
+		Delta   int
+	}
+	err := DB.Model(&QuotaLedger{}).Select("account, user_id, token_id, sum(delta) as delta").
+		Where("id > ? and id <= ?", start, end).Group("account, user_id, token_id").Scan(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return err
+	}
+	now := common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			accountId := row.UserId
+			if row.Account == QuotaLedgerAccountToken {
+				accountId = row.TokenId
+			}
+			result := tx.Model(&QuotaLedgerSnapshot{}).Where("account = ? and account_id = ?", row.Account, accountId).
+				Updates(map[string]interface{}{
+					"ledger_balance": gorm.Expr("ledger_balance + ?", row.Delta),
+					"ledger_id":      end,
+					"updated_at":     now,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				continue
+			}
+			err := tx.Create(&QuotaLedgerSnapshot{
+				Account:       row.Account,
+				AccountId:     accountId,
+				LedgerBalance: row.Delta,
+				LedgerId:      end,
+				UpdatedAt:     now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteOldQuotaLedgers 清理早于 targetTimestamp 且已计入快照的台账记录
+func DeleteOldQuotaLedgers(targetTimestamp int64, snapshotCursor int, limit int) (int64, error) {
+	var total int64
+	for {
+		var ids []int
+		err := DB.Model(&QuotaLedger{}).Where("created_at < ? and id <= ?", targetTimestamp, snapshotCursor).
+			Order("id").Limit(limit).Pluck("id", &ids).Error
+		if err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		result := DB.Where("id in (?)", ids).Delete(&QuotaLedger{})
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if len(ids) < limit {
+			return total, nil
+		}
+	}
+}
+
+// EnsureQuotaLedgerOpenings 为尚无期初记录的账户补记期初余额，使台账合计与当前余额一致
+func EnsureQuotaLedgerOpenings() (int, error) {
+	created := 0
+	openingReasons := []string{QuotaLedgerReasonOpening, QuotaLedgerReasonRegister, QuotaLedgerReasonTokenCreate}
+	for _, account := range []string{QuotaLedgerAccountUser, QuotaLedgerAccountToken} {
+		query, table, _ := accountBalanceQuery(DB, account)
+		var ids []int
+		err := query.Where("not exists (select 1 from quota_ledgers l where l.account = ? and l."+accountIdColumn(account)+" = "+table+".id and l.reason in (?))", account, openingReasons).
+			Where("not exists (select 1 from quota_ledger_snapshots s where s.account = ? and s.account_id = "+table+".id)", account).
+			Pluck(table+".id", &ids).Error
+		if err != nil {
+			return created, err
+		}
+		for _, id := range ids {
+			err = DB.Transaction(func(tx *gorm.DB) error {
+				return recordQuotaLedgerCorrection(tx, account, id, QuotaLedgerRef{Reason: QuotaLedgerReasonOpening})
+			})
+			if err != nil {
+				return created, err
+			}
+			created++
+		}
+	}
+	return created, nil
+}
+
+// ReconcileQuotaLedger 比对台账合计与用户额度、令牌剩余额度，记录不一致的账户。
+// 先在数据库中比对快照与余额找出可能不一致的账户（快照之后仍有变动的账户也会被选中），
+// 再逐个按快照加后续记录精确复查两次，避免把正在进行的扣费误判为差异
+func ReconcileQuotaLedger() ([]*QuotaLedgerDrift, error) {
+	drifts := make([]*QuotaLedgerDrift, 0)
+	for _, account := range []string{QuotaLedgerAccountUser, QuotaLedgerAccountToken} {
+		query, table, column := accountBalanceQuery(DB, account)
+		var suspects []int
+		err := query.Joins("join quota_ledger_snapshots s on s.account = ? and s.account_id = "+table+".id", account).
+			Where("s.ledger_balance <> "+column).Pluck(table+".id", &suspects).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range suspects {
+			ledgerBalance, balance, drifted, err := checkQuotaLedgerDrift(account, id)
+			if err == nil && drifted {
+				ledgerBalance, balance, drifted, err = checkQuotaLedgerDrift(account, id)
+			}
+			if err != nil {
+				return nil, err
+			}
+			if !drifted {
+				continue
+			}
+			drift, err := saveQuotaLedgerDrift(account, id, ledgerBalance, balance)
+			if err != nil {
+				return nil, err
+			}
+			drifts = append(drifts, drift)
+		}
+	}
+	return drifts, nil
+}
+
+func checkQuotaLedgerDrift(account string, id int) (ledgerBalance int, balance int, drifted bool, err error) {
+	balance, ok, err := getAccountBalance(account, id)
+	if err != nil || !ok {
+		return 0, 0, false, err
+	}
+	ledgerBalance, err = getAccountLedgerBalance(DB, account, id)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return ledgerBalance, balance, ledgerBalance != balance, nil
+}
+
+func saveQuotaLedgerDrift(account string, id int, ledgerBalance int, actualBalance int) (*QuotaLedgerDrift, error) {
+	drift := &QuotaLedgerDrift{}
+	err := DB.Where("account = ? and "+accountIdColumn(account)+" = ? and resolved = ?", account, id, false).Limit(1).Find(drift).Error
+	if err != nil {
+		return nil, err
+	}
+	drift.Account = account
+	if account == QuotaLedgerAccountToken {
+		drift.TokenId = id
+		if drift.UserId == 0 {
+			DB.Model(&Token{}).Where("id = ?", id).Select("user_id").Scan(&drift.UserId)
+		}
+	} else {
+		drift.UserId = id
+	}
+	drift.LedgerBalance = ledgerBalance
+	drift.ActualBalance = actualBalance
+	drift.Diff = actualBalance - ledgerBalance
+	drift.DetectedAt = common.GetTimestamp()
+	return drift, DB.Save(drift).Error
+}
+
+func GetQuotaLedgerDrifts(resolved bool, pageInfo *common.PageInfo) (drifts []*QuotaLedgerDrift, total int64, err error) {
+	tx := DB.Model(&QuotaLedgerDrift{}).Where("resolved = ?", resolved)
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&drifts).Error
+	return drifts, total, err
+}
+
+// ResolveQuotaLedgerDrift 确认差异：以当前余额为准追加一条调整记录
+func ResolveQuotaLedgerDrift(id int) (*QuotaLedgerDrift, error) {
+	drift := &QuotaLedgerDrift{}
+	if err := DB.First(drift, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if drift.Resolved {
+		return nil, errors.New("该差异已处理")
+	}
+	accountId := drift.UserId
+	if drift.Account == QuotaLedgerAccountToken {
+		accountId = drift.TokenId
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		ref := NewQuotaLedgerRef(QuotaLedgerReasonAdjustment, QuotaLedgerRefDrift, drift.Id)
+		if err := recordQuotaLedgerCorrection(tx, drift.Account, accountId, ref); err != nil {
+			return err
+		}
+		drift.Resolved = true
+		drift.ResolvedAt = common.GetTimestamp()
+		return tx.Save(drift).Error
+	})
+	return drift, err
+}
@@ -0,0 +1,162 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupQuotaLedgerTestDB(t *testing.T) {
+	setupTestDB(t, &User{}, &Token{}, &QuotaLedger{}, &QuotaLedgerDrift{}, &QuotaLedgerSnapshot{})
+}
+
+func createLedgerTestUser(t *testing.T, quota int) *User {
+	t.Helper()
+	user := &User{Username: fmt.Sprintf("ledger_%d", quota), Quota: quota, AffCode: common.GetRandomString(8)}
+	require.NoError(t, DB.Create(user).Error)
+	require.NoError(t, recordUserQuotaLedger(DB, user.Id, quota, QuotaLedgerRef{Reason: QuotaLedgerReasonRegister}))
+	return user
+}
+
+// backdateQuotaLedgers 让已有台账记录超过快照延迟，可以计入快照
+func backdateQuotaLedgers(t *testing.T, createdAt int64) {
+	t.Helper()
+	require.NoError(t, DB.Model(&QuotaLedger{}).Where("1 = 1").Update("created_at", createdAt).Error)
+}
+
+func TestBuildQuotaLedgers(t *testing.T) {
+	tests := []struct {
+		name     string
+		balance  int
+		entries  []quotaLedgerEntry
+		balances []int
+	}{
+		{
+			name:     "single entry",
+			balance:  90,
+			entries:  []quotaLedgerEntry{{Delta: -10}},
+			balances: []int{90},
+		},
+		{
+			name:    "entries keep order and running balance",
+			balance: 75,
+			entries: []quotaLedgerEntry{
+				{Delta: -10, Ref: NewQuotaLedgerRef(QuotaLedgerReasonPreConsume, QuotaLedgerRefRequest, "req-1")},
+				{Delta: -20, Ref: NewQuotaLedgerRef(QuotaLedgerReasonPreConsume, QuotaLedgerRefRequest, "req-2")},
+				{Delta: 5, Ref: NewQuotaLedgerRef(QuotaLedgerReasonRefund, QuotaLedgerRefRequest, "req-1")},
+			},
+			balances: []int{90, 70, 75},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledgers := buildQuotaLedgers(QuotaLedgerAccountToken, 1, 2, tt.balance, tt.entries)
+			require.Len(t, ledgers, len(tt.entries))
+			for i, ledger := range ledgers {
+				require.Equal(t, tt.balances[i], ledger.BalanceAfter)
+				require.Equal(t, tt.entries[i].Delta, ledger.Delta)
+				require.Equal(t, tt.entries[i].Ref.RefId, ledger.RefId)
+				require.Equal(t, 1, ledger.UserId)
+				require.Equal(t, 2, ledger.TokenId)
+			}
+		})
+	}
+}
+
+func TestBatchQuotaLedgerKeepsRefs(t *testing.T) {
+	setupQuotaLedgerTestDB(t)
+	user := createLedgerTestUser(t, 100)
+
+	entries := []quotaLedgerEntry{
+		newQuotaLedgerEntry(-30, NewQuotaLedgerRef(QuotaLedgerReasonPreConsume, QuotaLedgerRefRequest, "req-1")),
+		newQuotaLedgerEntry(10, NewQuotaLedgerRef(QuotaLedgerReasonRefund, QuotaLedgerRefRequest, "req-1")),
+	}
+	require.NoError(t, increaseUserQuotaEntries(user.Id, entries))
+
+	var ledgers []QuotaLedger
+	require.NoError(t, DB.Where("reason <> ?", QuotaLedgerReasonRegister).Order("id").Find(&ledgers).Error)
+	require.Len(t, ledgers, 2)
+	require.Equal(t, "req-1", ledgers[0].RefId)
+	require.Equal(t, 70, ledgers[0].BalanceAfter)
+	require.Equal(t, 80, ledgers[1].BalanceAfter)
+}
+
+func TestReconcileQuotaLedger(t *testing.T) {
+	tests := []struct {
+		name      string
+		change    func(t *testing.T, user *User)
+		wantDrift int
+	}{
+		{
+			name: "ledger matches balance",
+			change: func(t *testing.T, user *User) {
+				require.NoError(t, increaseUserQuota(user.Id, -40, QuotaLedgerRef{Reason: QuotaLedgerReasonConsume}))
+			},
+		},
+		{
+			name: "balance changed without ledger",
+			change: func(t *testing.T, user *User) {
+				require.NoError(t, DB.Model(&User{}).Where("id = ?", user.Id).Update("quota", gorm.Expr("quota + ?", 25)).Error)
+			},
+			wantDrift: 25,
+		},
+		{
+			name: "unsnapshotted records are counted",
+			change: func(t *testing.T, user *User) {
+				_, err := AdvanceQuotaLedgerSnapshots()
+				require.NoError(t, err)
+				require.NoError(t, increaseUserQuota(user.Id, 15, QuotaLedgerRef{Reason: QuotaLedgerReasonAdmin}))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupQuotaLedgerTestDB(t)
+			user := createLedgerTestUser(t, 100)
+			backdateQuotaLedgers(t, common.GetTimestamp()-3600)
+			tt.change(t, user)
+
+			_, err := AdvanceQuotaLedgerSnapshots()
+			require.NoError(t, err)
+			drifts, err := ReconcileQuotaLedger()
+			require.NoError(t, err)
+			if tt.wantDrift == 0 {
+				require.Empty(t, drifts)
+				return
+			}
+			require.Len(t, drifts, 1)
+			require.Equal(t, user.Id, drifts[0].UserId)
+			require.Equal(t, tt.wantDrift, drifts[0].Diff)
+		})
+	}
+}
+
+func TestDeleteOldQuotaLedgersKeepsSnapshotBalance(t *testing.T) {
+	setupQuotaLedgerTestDB(t)
+	user := createLedgerTestUser(t, 100)
+	require.NoError(t, increaseUserQuota(user.Id, -30, QuotaLedgerRef{Reason: QuotaLedgerReasonConsume}))
+	backdateQuotaLedgers(t, common.GetTimestamp()-3600)
+
+	cursor, err := AdvanceQuotaLedgerSnapshots()
+	require.NoError(t, err)
+	require.NoError(t, increaseUserQuota(user.Id, -5, QuotaLedgerRef{Reason: QuotaLedgerReasonConsume}))
+
+	deleted, err := DeleteOldQuotaLedgers(common.GetTimestamp(), cursor, 1)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, deleted)
+
+	ledgerBalance, err := getAccountLedgerBalance(DB, QuotaLedgerAccountUser, user.Id)
+	require.NoError(t, err)
+	require.Equal(t, 65, ledgerBalance)
+
+	opened, err := EnsureQuotaLedgerOpenings()
+	require.NoError(t, err)
+	require.Zero(t, opened)
+	drifts, err := ReconcileQuotaLedger()
+	require.NoError(t, err)
+	require.Empty(t, drifts)
+}
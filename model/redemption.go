@@ -137,7 +137,8 @@ func Redeem(key string, userId int) (quota int, err error) {
 		if redemption.ExpiredTime != 0 && redemption.ExpiredTime < common.GetTimestamp() {
 			return errors.New("该兑换码已过期")
 		}
-		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
+		ref := NewQuotaLedgerRef(QuotaLedgerReasonRedemption, QuotaLedgerRefRedemption, redemption.Id)
+		err = applyUserQuotaDelta(tx, userId, redemption.Quota, ref)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,257 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// Role 自定义管理角色。分配给用户后替代其权限等级对应的预设权限，
+// 权限等级（role 字段）仍决定用户管理中的上下级关系，超级管理员始终拥有全部权限
+type Role struct {
+	Id             int      `json:"id"`
+	Name           string   `json:"name" gorm:"size:64;uniqueIndex"`
+	Description    string   `json:"description" gorm:"type:text"`
+	Permissions    string   `json:"-" gorm:"type:text"` // JSON 数组
+	CreatedTime    int64    `json:"created_time" gorm:"bigint"`
+	UpdatedTime    int64    `json:"updated_time" gorm:"bigint"`
+	BuiltIn        bool     `json:"built_in" gorm:"-"`
+	Level          int      `json:"level,omitempty" gorm:"-"` // 内置角色对应的权限等级
+	UserCount      int64    `json:"user_count" gorm:"-"`
+	PermissionList []string `json:"permissions" gorm:"-"`
+}
+
+// GetBuiltinRoles 由权限等级构成的内置预设角色，不可修改
+func GetBuiltinRoles() []*Role {
+	presets := []struct {
+		name        string
+		description string
+		level       int
+	}{
+		{"common", "普通用户", common.RoleCommonUser},
+		{"admin", "管理员", common.RoleAdminUser},
+		{"root", "超级管理员", common.RoleRootUser},
+	}
+	roles := make([]*Role, 0, len(presets))
+	for _, preset := range presets {
+		roles = append(roles, &Role{
+			Name:           preset.name,
+			Description:    preset.description,
+			BuiltIn:        true,
+			Level:          preset.level,
+			PermissionList: common.GetRolePresetPermissions(preset.level),
+		})
+	}
+	return roles
+}
+
+func isBuiltinRoleName(name string) bool {
+	for _, role := range GetBuiltinRoles() {
+		if strings.EqualFold(role.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (role *Role) fillPermissions() {
+	role.PermissionList = make([]string, 0)
+	if role.Permissions != "" {
+		_ = common.UnmarshalJsonStr(role.Permissions, &role.PermissionList)
+	}
+}
+
+// SetPermissions 校验、去重并排序权限列表
+func (role *Role) SetPermissions(permissions []string) error {
+	seen := make(map[string]bool, len(permissions))
+	list := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		permission = strings.TrimSpace(permission)
+		if !common.IsValidPermission(permission) {
+			return fmt.Errorf("未知的权限: %s", permission)
+		}
+		if seen[permission] {
+			continue
+		}
+		seen[permission] = true
+		list = append(list, permission)
+	}
+	sort.Strings(list)
+	data, err := common.Marshal(list)
+	if err != nil {
+		return err
+	}
+	role.Permissions = string(data)
+	role.PermissionList = list
+	return nil
+}
+
+func (role *Role) Validate() error {
+	role.Name = strings.TrimSpace(role.Name)
+	if role.Name == "" {
+		return errors.New("角色名称不能为空")
+	}
+	if len(role.Name) > 64 {
+		return errors.New("角色名称过长")
+	}
+	if isBuiltinRoleName(role.Name) {
+		return errors.New("不能使用内置角色名称")
+	}
+	return nil
+}
+
+func GetAllRoles() ([]*Role, error) {
+	var roles []*Role
+	if err := DB.Order("id asc").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	type roleCount struct {
+		RoleId int
+		Count  int64
+	}
+	var counts []roleCount
+	err := DB.Model(&User{}).Select("role_id, count(*) as count").Where("role_id <> 0").Group("role_id").Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	countMap := make(map[int]int64, len(counts))
+	for _, count := range counts {
+		countMap[count.RoleId] = count.Count
+	}
+	for _, role := range roles {
+		role.fillPermissions()
+		role.UserCount = countMap[role.Id]
+	}
+	return roles, nil
+}
+
+func GetRoleById(id int) (*Role, error) {
+	var role Role
+	if err := DB.First(&role, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	role.fillPermissions()
+	return &role, nil
+}
+
+func (role *Role) Insert() error {
+	if err := role.Validate(); err != nil {
+		return err
+	}
+	role.CreatedTime = common.GetTimestamp()
+	role.UpdatedTime = role.CreatedTime
+	return DB.Create(role).Error
+}
+
+func (role *Role) Update() error {
+	if err := role.Validate(); err != nil {
+		return err
+	}
+	role.UpdatedTime = common.GetTimestamp()
+	err := DB.Model(role).Select("name", "description", "permissions", "updated_time").Updates(role).Error
+	if err != nil {
+		return err
+	}
+	return invalidateRoleUsersCache(role.Id)
+}
+
+// invalidateRoleUsersCache 清除使用该角色的用户的权限缓存
+func invalidateRoleUsersCache(roleId int) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	var userIds []int
+	if err := DB.Model(&User{}).Where("role_id = ?", roleId).Pluck("id", &userIds).Error; err != nil {
+		return err
+	}
+	for _, userId := range userIds {
+		if err := invalidateUserCache(userId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteRoleById 仍有用户使用的角色不能删除，避免这些用户回落到权限更大的预设
+func DeleteRoleById(id int) error {
+	var count int64
+	if err := DB.Model(&User{}).Where("role_id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("该角色仍分配给 %d 个用户，请先取消分配", count)
+	}
+	if err := DB.Delete(&Role{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	return invalidateRoleUsersCache(id)
+}
+
+// AssignUserRole roleId 为 0 时取消自定义角色，用户回到权限等级对应的预设
+func AssignUserRole(userId int, roleId int) error {
+	if roleId != 0 {
+		if _, err := GetRoleById(roleId); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("角色不存在")
+			}
+			return err
+		}
+	}
+	result := DB.Model(&User{}).Where("id = ?", userId).Update("role_id", roleId)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("用户不存在")
+	}
+	return invalidateUserCache(userId)
+}
+
+// GetUserPermissions 返回用户的有效权限，优先读取缓存。自定义角色不存在时按无权限处理
+func GetUserPermissions(userId int, userRole int) ([]string, error) {
+	if userRole >= common.RoleRootUser {
+		return common.GetRolePresetPermissions(userRole), nil
+	}
+	if permissions, ok := cacheGetUserPermissions(userId, userRole); ok {
+		return permissions, nil
+	}
+	permissions, err := getUserPermissionsFromDB(userId, userRole)
+	if err != nil {
+		return nil, err
+	}
+	cacheSetUserPermissions(userId, userRole, permissions)
+	return permissions, nil
+}
+
+func getUserPermissionsFromDB(userId int, userRole int) ([]string, error) {
+	var roleId int
+	err := DB.Model(&User{}).Where("id = ?", userId).Select("role_id").Scan(&roleId).Error
+	if err != nil {
+		return nil, err
+	}
+	if roleId == 0 {
+		return common.GetRolePresetPermissions(userRole), nil
+	}
+	role, err := GetRoleById(roleId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	return role.PermissionList, nil
+}
+
+func HasPermission(permissions []string, permission string) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUserPermissions(t *testing.T) {
+	setupTestDB(t, &User{}, &Role{})
+	role := &Role{Name: "billing"}
+	require.NoError(t, role.SetPermissions([]string{common.PermissionTopUpsRead, common.PermissionLogsRead}))
+	require.NoError(t, role.Insert())
+
+	tests := []struct {
+		name     string
+		userRole int
+		roleId   int
+		want     []string
+	}{
+		{name: "common preset", userRole: common.RoleCommonUser, want: []string{}},
+		{name: "admin preset", userRole: common.RoleAdminUser, want: common.GetRolePresetPermissions(common.RoleAdminUser)},
+		{name: "root ignores custom role", userRole: common.RoleRootUser, roleId: role.Id, want: common.AllPermissions},
+		{name: "custom role replaces preset", userRole: common.RoleAdminUser, roleId: role.Id, want: []string{common.PermissionLogsRead, common.PermissionTopUpsRead}},
+		{name: "missing custom role grants nothing", userRole: common.RoleAdminUser, roleId: role.Id + 1, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &User{Username: tt.name, Role: tt.userRole, AffCode: common.GetRandomString(8)}
+			require.NoError(t, DB.Create(user).Error)
+			require.NoError(t, DB.Model(user).Update("role_id", tt.roleId).Error)
+
+			permissions, err := GetUserPermissions(user.Id, tt.userRole)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, permissions)
+		})
+	}
+}
+
+func TestAssignUserRole(t *testing.T) {
+	setupTestDB(t, &User{}, &Role{})
+	role := &Role{Name: "support"}
+	require.NoError(t, role.SetPermissions([]string{common.PermissionUsersRead}))
+	require.NoError(t, role.Insert())
+	user := &User{Username: "assign", Role: common.RoleAdminUser, AffCode: common.GetRandomString(8)}
+	require.NoError(t, DB.Create(user).Error)
+
+	tests := []struct {
+		name    string
+		userId  int
+		roleId  int
+		wantErr string
+		want    []string
+	}{
+		{name: "assign custom role", userId: user.Id, roleId: role.Id, want: []string{common.PermissionUsersRead}},
+		{name: "unknown role", userId: user.Id, roleId: role.Id + 1, wantErr: "角色不存在", want: []string{common.PermissionUsersRead}},
+		{name: "unknown user", userId: user.Id + 1, roleId: role.Id, wantErr: "用户不存在", want: []string{common.PermissionUsersRead}},
+		{name: "back to preset", userId: user.Id, want: common.GetRolePresetPermissions(common.RoleAdminUser)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := AssignUserRole(tt.userId, tt.roleId)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			permissions, err := GetUserPermissions(user.Id, user.Role)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, permissions)
+		})
+	}
+}
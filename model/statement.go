@@ -0,0 +1,300 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+// Statement 用户月度账单。生成时保存汇总快照，日志清理后账单内容保持不变
+type Statement struct {
+	Id              int     `json:"id"`
+	UserId          int     `json:"user_id" gorm:"uniqueIndex:idx_statement_user_period,priority:1"`
+	Username        string  `json:"username" gorm:"size:64;default:''"`
+	Period          string  `json:"period" gorm:"size:7;uniqueIndex:idx_statement_user_period,priority:2;index"` // 2006-01
+	StartTime       int64   `json:"start_time" gorm:"bigint"`
+	EndTime         int64   `json:"end_time" gorm:"bigint"` // 不含
+	OpeningBalance  int     `json:"opening_balance"`
+	TopUpCount      int     `json:"topup_count"`
+	TopUpQuota      int     `json:"topup_quota"`
+	TopUpMoney      float64 `json:"topup_money"`
+	RedemptionQuota int     `json:"redemption_quota"`
+	RequestCount    int     `json:"request_count"`
+	ConsumeQuota    int     `json:"consume_quota"`
+	RefundQuota     int     `json:"refund_quota"` // 充值退款扣回的额度
+	RefundMoney     float64 `json:"refund_money"`
+	OtherQuota      int     `json:"other_quota"` // 签到、邀请、管理员调整等其他变动，由期末余额倒推
+	ClosingBalance  int     `json:"closing_balance"`
+	Detail          string  `json:"-" gorm:"type:text"`
+	CreatedTime     int64   `json:"created_time" gorm:"bigint"`
+
+	Models []*StatementItem `json:"models,omitempty" gorm:"-"`
+	Tokens []*StatementItem `json:"tokens,omitempty" gorm:"-"`
+}
+
+// StatementItem 按模型或令牌汇总的消费
+type StatementItem struct {
+	Name             string `json:"name"`
+	RequestCount     int    `json:"request_count"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Quota            int    `json:"quota"`
+}
+
+type statementDetail struct {
+	Models []*StatementItem `json:"models"`
+	Tokens []*StatementItem `json:"tokens"`
+}
+
+// GetStatementPeriodRange 返回账期（服务器本地时区的自然月）的起止时间，结束时间不含
+func GetStatementPeriodRange(period string) (int64, int64, error) {
+	start, err := time.ParseInLocation("2006-01", period, time.Local)
+	if err != nil {
+		return 0, 0, errors.New("账期格式错误，应为 YYYY-MM")
+	}
+	return start.Unix(), start.AddDate(0, 1, 0).Unix(), nil
+}
+
+// GetLastStatementPeriod 返回上一个自然月的账期
+func GetLastStatementPeriod() string {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).AddDate(0, -1, 0).Format("2006-01")
+}
+
+func (statement *Statement) fillDetail() {
+	var detail statementDetail
+	if statement.Detail != "" {
+		_ = json.Unmarshal([]byte(statement.Detail), &detail)
+	}
+	statement.Models = detail.Models
+	statement.Tokens = detail.Tokens
+}
+
+// getLedgerBalanceBefore 台账中用户在指定时间之前的最后余额
+func getLedgerBalanceBefore(userId int, timestamp int64) (int, error) {
+	var ledger QuotaLedger
+	err := DB.Where("account = ? and user_id = ? and created_at < ?", QuotaLedgerAccountUser, userId, timestamp).
+		Order("id desc").Limit(1).Find(&ledger).Error
+	return ledger.BalanceAfter, err
+}
+
+func sumLedgerDelta(userId int, reason string, startTime int64, endTime int64) (int, error) {
+	var sum int
+	err := DB.Model(&QuotaLedger{}).Select("COALESCE(SUM(delta), 0)").
+		Where("account = ? and user_id = ? and reason = ? and created_at >= ? and created_at < ?",
+			QuotaLedgerAccountUser, userId, reason, startTime, endTime).
+		Scan(&sum).Error
+	return sum, err
+}
+
+// getStatementConsumeItems 从消费日志按模型或令牌汇总
+func getStatementConsumeItems(userId int, column string, startTime int64, endTime int64) ([]*StatementItem, error) {
+	items := make([]*StatementItem, 0)
+	err := LOG_DB.Table("logs").
+		Select(column+" as name, count(*) as request_count, sum(prompt_tokens) as prompt_tokens, sum(completion_tokens) as completion_tokens, sum(quota) as quota").
+		Where("user_id = ? and type = ? and created_at >= ? and created_at < ?", userId, LogTypeConsume, startTime, endTime).
+		Group(column).Order("quota desc").
+		Scan(&items).Error
+	return items, err
+}
+
+// getStatementQuotaDataItems 未开启消费日志时，从数据看板的小时汇总按模型统计
+func getStatementQuotaDataItems(userId int, startTime int64, endTime int64) ([]*StatementItem, error) {
+	items := make([]*StatementItem, 0)
+	err := DB.Table("quota_data").
+		Select("model_name as name, sum(count) as request_count, sum(quota) as quota").
+		Where("user_id = ? and created_at >= ? and created_at < ?", userId, startTime, endTime).
+		Group("model_name").Order("quota desc").
+		Scan(&items).Error
+	return items, err
+}
+
+// buildStatement 汇总用户在账期内的充值、兑换、消费与退款，余额以额度台账为准
+func buildStatement(userId int, period string) (*Statement, error) {
+	startTime, endTime, err := GetStatementPeriodRange(period)
+	if err != nil {
+		return nil, err
+	}
+	if endTime > common.GetTimestamp() {
+		return nil, errors.New("账期尚未结束")
+	}
+	username, err := GetUsernameById(userId, true)
+	if err != nil {
+		return nil, err
+	}
+	statement := &Statement{
+		UserId:      userId,
+		Username:    username,
+		Period:      period,
+		StartTime:   startTime,
+		EndTime:     endTime,
+		CreatedTime: common.GetTimestamp(),
+	}
+
+	if statement.OpeningBalance, err = getLedgerBalanceBefore(userId, startTime); err != nil {
+		return nil, err
+	}
+	if statement.ClosingBalance, err = getLedgerBalanceBefore(userId, endTime); err != nil {
+		return nil, err
+	}
+
+	var topUps []*TopUp
+	err = DB.Where("user_id = ? and status in ? and complete_time >= ? and complete_time < ?", userId,
+		[]string{common.TopUpStatusSuccess, common.TopUpStatusRefunded}, startTime, endTime).Find(&topUps).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, topUp := range topUps {
+		statement.TopUpCount++
+		statement.TopUpQuota += topUp.getPaidQuota()
+		statement.TopUpMoney += topUp.Money
+	}
+	var refundedTopUps []*TopUp
+	err = DB.Where("user_id = ? and refund_time >= ? and refund_time < ?", userId, startTime, endTime).Find(&refundedTopUps).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, topUp := range refundedTopUps {
+		statement.RefundMoney += topUp.RefundMoney
+	}
+	refundDelta, err := sumLedgerDelta(userId, QuotaLedgerReasonTopUpRefund, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	statement.RefundQuota = -refundDelta
+	if statement.RedemptionQuota, err = sumLedgerDelta(userId, QuotaLedgerReasonRedemption, startTime, endTime); err != nil {
+		return nil, err
+	}
+
+	models, err := getStatementConsumeItems(userId, "model_name", startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := getStatementConsumeItems(userId, "token_name", startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	if len(models) == 0 {
+		if models, err = getStatementQuotaDataItems(userId, startTime, endTime); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range models {
+		statement.RequestCount += item.RequestCount
+		statement.ConsumeQuota += item.Quota
+	}
+	statement.OtherQuota = statement.ClosingBalance - statement.OpeningBalance -
+		statement.TopUpQuota - statement.RedemptionQuota + statement.ConsumeQuota + statement.RefundQuota
+
+	detail, err := json.Marshal(statementDetail{Models: models, Tokens: tokens})
+	if err != nil {
+		return nil, err
+	}
+	statement.Detail = string(detail)
+	statement.Models = models
+	statement.Tokens = tokens
+	return statement, nil
+}
+
+// GenerateStatement 生成用户账单，已存在时仅在 force 为 true 时重新生成
+func GenerateStatement(userId int, period string, force bool) (*Statement, error) {
+	var existing Statement
+	err := DB.Where("user_id = ? and period = ?", userId, period).First(&existing).Error
+	if err == nil && !force {
+		existing.fillDetail()
+		return &existing, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	statement, err := buildStatement(userId, period)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Id != 0 {
+		statement.Id = existing.Id
+		err = DB.Save(statement).Error
+	} else {
+		err = DB.Create(statement).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// GetStatementUserIds 账期内有额度变动的用户
+func GetStatementUserIds(period string) ([]int, error) {
+	startTime, endTime, err := GetStatementPeriodRange(period)
+	if err != nil {
+		return nil, err
+	}
+	var userIds []int
+	err = DB.Model(&QuotaLedger{}).Distinct("user_id").
+		Where("account = ? and reason <> ? and created_at >= ? and created_at < ?", QuotaLedgerAccountUser, QuotaLedgerReasonOpening, startTime, endTime).
+		Pluck("user_id", &userIds).Error
+	return userIds, err
+}
+
+// GenerateStatements 为账期内有额度变动且尚无账单的用户生成账单，返回新生成的数量
+func GenerateStatements(period string) (int, error) {
+	userIds, err := GetStatementUserIds(period)
+	if err != nil {
+		return 0, err
+	}
+	var existingIds []int
+	if err := DB.Model(&Statement{}).Where("period = ?", period).Pluck("user_id", &existingIds).Error; err != nil {
+		return 0, err
+	}
+	existing := make(map[int]bool, len(existingIds))
+	for _, id := range existingIds {
+		existing[id] = true
+	}
+	generated := 0
+	for _, userId := range userIds {
+		if existing[userId] {
+			continue
+		}
+		if _, err := GenerateStatement(userId, period, false); err != nil {
+			common.SysError(fmt.Sprintf("failed to generate statement: user_id=%d, period=%s, error=%v", userId, period, err))
+			continue
+		}
+		generated++
+	}
+	return generated, nil
+}
+
+func GetStatements(userId int, period string, pageInfo *common.PageInfo) (statements []*Statement, total int64, err error) {
+	tx := DB.Model(&Statement{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if period != "" {
+		tx = tx.Where("period = ?", period)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Omit("detail").Order("period desc, id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&statements).Error
+	return statements, total, err
+}
+
+// GetStatementById userId 不为 0 时只能获取该用户的账单
+func GetStatementById(id int, userId int) (*Statement, error) {
+	tx := DB.Where("id = ?", id)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	var statement Statement
+	if err := tx.First(&statement).Error; err != nil {
+		return nil, err
+	}
+	statement.fillDetail()
+	return &statement, nil
+}
@@ -0,0 +1,50 @@
+package model
+
+import "fmt"
+
+// StatusPageBucket 状态页按时间桶聚合的请求结果
+type StatusPageBucket struct {
+	ModelName string `json:"model_name"`
+	GroupName string `json:"group_name"`
+	Bucket    int64  `json:"bucket"`
+	Type      int    `json:"type"`
+	Count     int64  `json:"count"`
+}
+
+// StatusPageUseTime 状态页延迟统计使用的单条请求耗时
+type StatusPageUseTime struct {
+	ModelName string `json:"model_name"`
+	GroupName string `json:"group_name"`
+	UseTime   int    `json:"use_time"`
+}
+
+// GetStatusPageBuckets 按模型、分组与时间桶统计成功（消费日志）与失败（错误日志）次数
+func GetStatusPageBuckets(models []string, startTime int64, endTime int64, bucketSize int64) ([]*StatusPageBucket, error) {
+	var buckets []*StatusPageBucket
+	if len(models) == 0 {
+		return buckets, nil
+	}
+	err := LOG_DB.Table("logs").
+		Select(fmt.Sprintf("model_name, %s as group_name, created_at - created_at %% %d as bucket, type, count(*) as count", logGroupCol, bucketSize)).
+		Where("created_at >= ? and created_at <= ?", startTime, endTime).
+		Where("type in (?) and model_name in (?)", []int{LogTypeConsume, LogTypeError}, models).
+		Group("model_name, " + logGroupCol + ", bucket, type").
+		Scan(&buckets).Error
+	return buckets, err
+}
+
+// GetStatusPageUseTimes 获取最近成功请求的耗时，最多 limit 条
+func GetStatusPageUseTimes(models []string, startTime int64, endTime int64, limit int) ([]*StatusPageUseTime, error) {
+	var useTimes []*StatusPageUseTime
+	if len(models) == 0 {
+		return useTimes, nil
+	}
+	err := LOG_DB.Table("logs").
+		Select("model_name, "+logGroupCol+" as group_name, use_time").
+		Where("created_at >= ? and created_at <= ?", startTime, endTime).
+		Where("type = ? and model_name in (?)", LogTypeConsume, models).
+		Order("id desc").
+		Limit(limit).
+		Scan(&useTimes).Error
+	return useTimes, err
+}
@@ -0,0 +1,628 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SubscriptionStatusPending  = "pending"  // 已创建支付链接，等待首期扣款
+	SubscriptionStatusActive   = "active"   // 正常生效
+	SubscriptionStatusPastDue  = "past_due" // 续费失败，宽限期内仍保留权益
+	SubscriptionStatusCanceled = "canceled" // 已取消续费，当前周期结束后失效
+	SubscriptionStatusExpired  = "expired"
+)
+
+const (
+	SubscriptionOverageBalance = "balance" // 订阅额度用完后继续扣除用户购买的余额
+	SubscriptionOverageBlock   = "block"   // 订阅额度用完后拒绝请求，直到下个周期
+)
+
+// 未完成支付的订阅保留时间
+const subscriptionPendingTimeout = 24 * 60 * 60
+
+// SubscriptionPlan 订阅套餐，每个计费周期（按月）发放 Quota 额度，生效期间将用户切换到 Group 分组
+type SubscriptionPlan struct {
+	Id             int     `json:"id"`
+	Name           string  `json:"name" gorm:"size:64"`
+	Description    string  `json:"description" gorm:"type:text"`
+	Price          float64 `json:"price"` // 每月价格，仅用于展示，实际扣款金额以支付平台配置为准
+	Currency       string  `json:"currency" gorm:"size:8;default:'USD'"`
+	Quota          int     `json:"quota"`
+	Group          string  `json:"group" gorm:"size:64;default:''"` // 为空表示不调整分组
+	OverageMode    string  `json:"overage_mode" gorm:"size:16;default:'balance'"`
+	StripePriceId  string  `json:"stripe_price_id,omitempty" gorm:"size:128;default:''"`
+	CreemProductId string  `json:"creem_product_id,omitempty" gorm:"size:128;default:''"`
+	Enabled        bool    `json:"enabled"`
+	CreatedTime    int64   `json:"created_time" gorm:"bigint"`
+}
+
+// UserSubscription 用户的订阅。QuotaGranted 为本周期发放的额度，UsedQuotaSnapshot 为周期开始时用户的已用额度，
+// 两者用于计算周期结束时未用完、需要收回的订阅额度
+type UserSubscription struct {
+	Id                 int    `json:"id"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	PlanId             int    `json:"plan_id" gorm:"index"`
+	PaymentMethod      string `json:"payment_method" gorm:"size:32"`
+	TradeNo            string `json:"trade_no" gorm:"size:255;uniqueIndex"`
+	ExternalId         string `json:"external_id" gorm:"size:255;index;default:''"` // 支付平台的订阅 ID
+	Status             string `json:"status" gorm:"size:16;index"`
+	CancelAtPeriodEnd  bool   `json:"cancel_at_period_end"`
+	PreviousGroup      string `json:"previous_group" gorm:"size:64;default:''"`
+	QuotaGranted       int    `json:"quota_granted" gorm:"default:0"`
+	UsedQuotaSnapshot  int    `json:"-" gorm:"default:0"`
+	CurrentPeriodStart int64  `json:"current_period_start" gorm:"bigint;default:0"`
+	CurrentPeriodEnd   int64  `json:"current_period_end" gorm:"bigint;default:0"`
+	GraceUntil         int64  `json:"grace_until" gorm:"bigint;default:0"`
+	CreatedTime        int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime        int64  `json:"updated_time" gorm:"bigint"`
+
+	Plan        *SubscriptionPlan `json:"plan,omitempty" gorm:"-"`
+	RemainQuota int               `json:"remain_quota" gorm:"-"` // 本周期剩余的订阅额度
+}
+
+// subscriptionBlockCache 用户 ID -> 超额即拒绝的订阅，仅在开启内存缓存时使用
+var subscriptionBlockCache = make(map[int]*UserSubscription)
+var subscriptionBlockCacheLock sync.RWMutex
+
+var liveSubscriptionStatuses = []string{SubscriptionStatusActive, SubscriptionStatusPastDue, SubscriptionStatusCanceled}
+
+func (p *SubscriptionPlan) Validate() error {
+	if p.Name == "" {
+		return errors.New("套餐名称不能为空")
+	}
+	if p.Price < 0 || p.Quota < 0 {
+		return errors.New("价格与额度不能小于0")
+	}
+	if p.Group != "" && !ratio_setting.ContainsGroupRatio(p.Group) {
+		return fmt.Errorf("分组 %s 不存在", p.Group)
+	}
+	switch p.OverageMode {
+	case "":
+		p.OverageMode = SubscriptionOverageBalance
+	case SubscriptionOverageBalance, SubscriptionOverageBlock:
+	default:
+		return errors.New("无效的超额处理方式")
+	}
+	if p.StripePriceId == "" && p.CreemProductId == "" {
+		return errors.New("Stripe 价格 ID 与 Creem 产品 ID 至少设置一项")
+	}
+	return nil
+}
+
+func GetSubscriptionPlans(enabledOnly bool) (plans []*SubscriptionPlan, err error) {
+	tx := DB.Model(&SubscriptionPlan{})
+	if enabledOnly {
+		tx = tx.Where("enabled = ?", true)
+	}
+	err = tx.Order("price asc, id asc").Find(&plans).Error
+	return plans, err
+}
+
+func GetSubscriptionPlanById(id int) (*SubscriptionPlan, error) {
+	plan := &SubscriptionPlan{}
+	err := DB.First(plan, "id = ?", id).Error
+	return plan, err
+}
+
+func (p *SubscriptionPlan) Insert() error {
+	p.CreatedTime = common.GetTimestamp()
+	return DB.Create(p).Error
+}
+
+// Update 套餐调整在下一个计费周期生效
+func (p *SubscriptionPlan) Update() error {
+	err := DB.Model(p).Select("name", "description", "price", "currency", "quota", "group", "overage_mode",
+		"stripe_price_id", "creem_product_id", "enabled").Updates(p).Error
+	if err != nil {
+		return err
+	}
+	InitSubscriptionCache()
+	return nil
+}
+
+func DeleteSubscriptionPlanById(id int) error {
+	var count int64
+	err := DB.Model(&UserSubscription{}).Where("plan_id = ? and status in ?", id, liveSubscriptionStatuses).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("该套餐仍有生效中的订阅，请先停用")
+	}
+	return DB.Delete(&SubscriptionPlan{}, "id = ?", id).Error
+}
+
+// GetSubscriptionGraceSeconds 续费失败或续费回调延迟时的宽限时间
+func GetSubscriptionGraceSeconds() int64 {
+	return int64(max(setting.SubscriptionGraceDays, 0)) * 24 * 60 * 60
+}
+
+// subscriptionUnusedQuota 本周期发放但尚未用完的订阅额度，消费优先计入订阅额度
+func subscriptionUnusedQuota(sub *UserSubscription, usedQuota int) int {
+	used := max(usedQuota-sub.UsedQuotaSnapshot, 0)
+	return max(sub.QuotaGranted-used, 0)
+}
+
+// CreatePendingSubscription 在拉起支付前创建待支付的订阅，同一用户同时只能有一个生效中的订阅
+func CreatePendingSubscription(userId int, plan *SubscriptionPlan, paymentMethod string, tradeNo string) (*UserSubscription, error) {
+	var count int64
+	err := DB.Model(&UserSubscription{}).Where("user_id = ? and status in ?", userId, liveSubscriptionStatuses).Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, errors.New("已有生效中的订阅，请在当前订阅结束后再订阅")
+	}
+	now := common.GetTimestamp()
+	sub := &UserSubscription{
+		UserId:        userId,
+		PlanId:        plan.Id,
+		PaymentMethod: paymentMethod,
+		TradeNo:       tradeNo,
+		Status:        SubscriptionStatusPending,
+		CreatedTime:   now,
+		UpdatedTime:   now,
+	}
+	if err := DB.Create(sub).Error; err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// fillSubscriptions 填充套餐信息与本周期剩余的订阅额度
+func fillSubscriptions(subs []*UserSubscription) error {
+	if len(subs) == 0 {
+		return nil
+	}
+	planIds := make([]int, 0, len(subs))
+	userIds := make([]int, 0, len(subs))
+	for _, sub := range subs {
+		planIds = append(planIds, sub.PlanId)
+		userIds = append(userIds, sub.UserId)
+	}
+	var plans []*SubscriptionPlan
+	if err := DB.Where("id in ?", planIds).Find(&plans).Error; err != nil {
+		return err
+	}
+	planMap := make(map[int]*SubscriptionPlan)
+	for _, plan := range plans {
+		planMap[plan.Id] = plan
+	}
+	var users []*User
+	if err := DB.Select("id", "used_quota").Where("id in ?", userIds).Find(&users).Error; err != nil {
+		return err
+	}
+	usedQuotaMap := make(map[int]int)
+	for _, user := range users {
+		usedQuotaMap[user.Id] = user.UsedQuota
+	}
+	for _, sub := range subs {
+		sub.Plan = planMap[sub.PlanId]
+		if common.StringsContains(liveSubscriptionStatuses, sub.Status) {
+			sub.RemainQuota = subscriptionUnusedQuota(sub, usedQuotaMap[sub.UserId])
+		}
+	}
+	return nil
+}
+
+// GetUserSubscriptions 用户的订阅记录，不含未完成支付的订阅
+func GetUserSubscriptions(userId int) (subs []*UserSubscription, err error) {
+	err = DB.Where("user_id = ? and status <> ?", userId, SubscriptionStatusPending).Order("id desc").Limit(20).Find(&subs).Error
+	if err != nil {
+		return nil, err
+	}
+	return subs, fillSubscriptions(subs)
+}
+
+func GetAllUserSubscriptions(userId int, status string, pageInfo *common.PageInfo) (subs []*UserSubscription, total int64, err error) {
+	tx := DB.Model(&UserSubscription{})
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&subs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return subs, total, fillSubscriptions(subs)
+}
+
+// GetLiveUserSubscription 返回用户当前生效中的订阅
+func GetLiveUserSubscription(userId int) (*UserSubscription, error) {
+	sub := &UserSubscription{}
+	err := DB.Where("user_id = ? and status in ?", userId, liveSubscriptionStatuses).First(sub).Error
+	return sub, err
+}
+
+// findSubscriptionForUpdate 按订单号或支付平台的订阅 ID 查找并锁定订阅，订单号优先
+func findSubscriptionForUpdate(tx *gorm.DB, paymentMethod string, tradeNo string, externalId string) (*UserSubscription, error) {
+	sub := &UserSubscription{}
+	query := tx.Set("gorm:query_option", "FOR UPDATE")
+	var err error
+	if tradeNo != "" {
+		err = query.Where("trade_no = ?", tradeNo).First(sub).Error
+	} else if externalId != "" {
+		err = query.Where("payment_method = ? and external_id = ?", paymentMethod, externalId).Order("id desc").First(sub).Error
+	} else {
+		return nil, errors.New("未提供订阅单号")
+	}
+	if err != nil {
+		return nil, errors.New("订阅不存在")
+	}
+	if sub.PaymentMethod != paymentMethod {
+		return nil, errors.New("订阅支付方式不匹配")
+	}
+	return sub, nil
+}
+
+// BindSubscriptionExternalId 记录支付平台的订阅 ID，首期扣款回调可能早于或晚于结账完成回调
+func BindSubscriptionExternalId(paymentMethod string, tradeNo string, externalId string, customerId string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		sub, err := findSubscriptionForUpdate(tx, paymentMethod, tradeNo, "")
+		if err != nil {
+			return err
+		}
+		if customerId != "" {
+			if err := tx.Model(&User{}).Where("id = ?", sub.UserId).Update("stripe_customer", customerId).Error; err != nil {
+				return err
+			}
+		}
+		if sub.ExternalId == externalId {
+			return nil
+		}
+		return tx.Model(sub).Updates(map[string]interface{}{
+			"external_id":  externalId,
+			"updated_time": common.GetTimestamp(),
+		}).Error
+	})
+}
+
+// RenewSubscription 处理支付平台的扣款成功回调：收回上一周期未用完的订阅额度并发放新周期额度，
+// 首次生效时切换用户分组。重复回调（周期未前进）直接忽略
+func RenewSubscription(paymentMethod string, tradeNo string, externalId string, periodStart int64, periodEnd int64) error {
+	if periodEnd <= periodStart {
+		return errors.New("无效的订阅周期")
+	}
+	var sub *UserSubscription
+	var plan SubscriptionPlan
+	renewed := false
+	reclaimed := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		sub, err = findSubscriptionForUpdate(tx, paymentMethod, tradeNo, externalId)
+		if err != nil {
+			return err
+		}
+		if sub.Status != SubscriptionStatusPending && periodEnd <= sub.CurrentPeriodEnd {
+			return nil
+		}
+		if err := tx.First(&plan, "id = ?", sub.PlanId).Error; err != nil {
+			return errors.New("订阅套餐不存在")
+		}
+		var user User
+		if err := tx.First(&user, "id = ?", sub.UserId).Error; err != nil {
+			return err
+		}
+
+		reclaimed = min(subscriptionUnusedQuota(sub, user.UsedQuota), max(user.Quota, 0))
+		if reclaimed > 0 {
+			ref := NewQuotaLedgerRef(QuotaLedgerReasonSubscriptionReset, QuotaLedgerRefSubscription, sub.Id)
+			if err := applyUserQuotaDelta(tx, sub.UserId, -reclaimed, ref); err != nil {
+				return err
+			}
+		}
+		if plan.Quota > 0 {
+			ref := NewQuotaLedgerRef(QuotaLedgerReasonSubscription, QuotaLedgerRefSubscription, sub.Id)
+			if err := applyUserQuotaDelta(tx, sub.UserId, plan.Quota, ref); err != nil {
+				return err
+			}
+		}
+
+		if sub.Status == SubscriptionStatusPending || sub.Status == SubscriptionStatusExpired {
+			sub.PreviousGroup = user.Group
+			if plan.Group != "" && plan.Group != user.Group {
+				if err := tx.Model(&User{}).Where("id = ?", sub.UserId).Update("group", plan.Group).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if externalId != "" {
+			sub.ExternalId = externalId
+		}
+		if sub.Status != SubscriptionStatusCanceled {
+			sub.Status = SubscriptionStatusActive
+		}
+		sub.QuotaGranted = plan.Quota
+		sub.UsedQuotaSnapshot = user.UsedQuota
+		sub.CurrentPeriodStart = periodStart
+		sub.CurrentPeriodEnd = periodEnd
+		sub.GraceUntil = 0
+		sub.UpdatedTime = common.GetTimestamp()
+		renewed = true
+		return tx.Save(sub).Error
+	})
+	if err != nil {
+		return err
+	}
+	if !renewed {
+		return nil
+	}
+	if err := invalidateUserCache(sub.UserId); err != nil {
+		common.SysError("failed to invalidate user cache: " + err.Error())
+	}
+	InitSubscriptionCache()
+	content := fmt.Sprintf("订阅套餐 %s 生效，发放额度 %s，有效期至 %s", plan.Name, logger.FormatQuota(plan.Quota),
+		time.Unix(periodEnd, 0).Format("2006-01-02 15:04:05"))
+	if reclaimed > 0 {
+		content += fmt.Sprintf("，收回上一周期未用完的订阅额度 %s", logger.FormatQuota(reclaimed))
+	}
+	RecordLog(sub.UserId, LogTypeTopup, content)
+	return nil
+}
+
+// MarkSubscriptionPastDue 续费扣款失败，在宽限期内保留权益
+func MarkSubscriptionPastDue(paymentMethod string, tradeNo string, externalId string) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		sub, err := findSubscriptionForUpdate(tx, paymentMethod, tradeNo, externalId)
+		if err != nil {
+			return err
+		}
+		if sub.Status != SubscriptionStatusActive {
+			return nil
+		}
+		return tx.Model(sub).Updates(map[string]interface{}{
+			"status":       SubscriptionStatusPastDue,
+			"grace_until":  max(sub.CurrentPeriodEnd, common.GetTimestamp()) + GetSubscriptionGraceSeconds(),
+			"updated_time": common.GetTimestamp(),
+		}).Error
+	})
+	if err == nil {
+		InitSubscriptionCache()
+	}
+	return err
+}
+
+// MarkSubscriptionCanceled 订阅不再续费，当前周期结束后失效。atPeriodEnd 为 false 表示支付平台已终止订阅
+func MarkSubscriptionCanceled(paymentMethod string, tradeNo string, externalId string, atPeriodEnd bool) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		sub, err := findSubscriptionForUpdate(tx, paymentMethod, tradeNo, externalId)
+		if err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"cancel_at_period_end": true,
+			"updated_time":         common.GetTimestamp(),
+		}
+		switch sub.Status {
+		case SubscriptionStatusPending:
+			updates["status"] = SubscriptionStatusExpired
+		case SubscriptionStatusActive, SubscriptionStatusPastDue:
+			if !atPeriodEnd {
+				updates["status"] = SubscriptionStatusCanceled
+			}
+		default:
+			return nil
+		}
+		return tx.Model(sub).Updates(updates).Error
+	})
+	if err == nil {
+		InitSubscriptionCache()
+	}
+	return err
+}
+
+// ResumeSubscription 撤销周期结束时取消
+func ResumeSubscription(paymentMethod string, externalId string) error {
+	return DB.Model(&UserSubscription{}).
+		Where("payment_method = ? and external_id = ? and status in ?", paymentMethod, externalId,
+			[]string{SubscriptionStatusActive, SubscriptionStatusPastDue}).
+		Updates(map[string]interface{}{
+			"cancel_at_period_end": false,
+			"updated_time":         common.GetTimestamp(),
+		}).Error
+}
+
+// getSubscriptionExpireTime 订阅权益的截止时间
+func getSubscriptionExpireTime(sub *UserSubscription) int64 {
+	switch sub.Status {
+	case SubscriptionStatusPending:
+		return sub.CreatedTime + subscriptionPendingTimeout
+	case SubscriptionStatusPastDue:
+		return sub.GraceUntil
+	case SubscriptionStatusCanceled:
+		return sub.CurrentPeriodEnd
+	default:
+		if sub.CancelAtPeriodEnd {
+			return sub.CurrentPeriodEnd
+		}
+		// 续费回调可能延迟到达，周期结束后保留宽限期
+		return sub.CurrentPeriodEnd + GetSubscriptionGraceSeconds()
+	}
+}
+
+// expireSubscription 收回未用完的订阅额度，并在用户仍处于套餐分组时恢复原分组
+func expireSubscription(id int) error {
+	var sub UserSubscription
+	var plan SubscriptionPlan
+	reclaimed := 0
+	expired := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&sub, "id = ?", id).Error; err != nil {
+			return err
+		}
+		if sub.Status == SubscriptionStatusExpired || getSubscriptionExpireTime(&sub) > common.GetTimestamp() {
+			return nil
+		}
+		expired = true
+		if sub.Status != SubscriptionStatusPending {
+			_ = tx.First(&plan, "id = ?", sub.PlanId).Error
+			var user User
+			if err := tx.First(&user, "id = ?", sub.UserId).Error; err != nil {
+				return err
+			}
+			reclaimed = min(subscriptionUnusedQuota(&sub, user.UsedQuota), max(user.Quota, 0))
+			if reclaimed > 0 {
+				ref := NewQuotaLedgerRef(QuotaLedgerReasonSubscriptionReset, QuotaLedgerRefSubscription, sub.Id)
+				if err := applyUserQuotaDelta(tx, sub.UserId, -reclaimed, ref); err != nil {
+					return err
+				}
+			}
+			if plan.Group != "" && user.Group == plan.Group && sub.PreviousGroup != "" {
+				if err := tx.Model(&User{}).Where("id = ?", sub.UserId).Update("group", sub.PreviousGroup).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Model(&sub).Updates(map[string]interface{}{
+			"status":        SubscriptionStatusExpired,
+			"quota_granted": 0,
+			"updated_time":  common.GetTimestamp(),
+		}).Error
+	})
+	if err != nil || !expired || sub.Status == SubscriptionStatusPending {
+		return err
+	}
+	if err := invalidateUserCache(sub.UserId); err != nil {
+		common.SysError("failed to invalidate user cache: " + err.Error())
+	}
+	content := fmt.Sprintf("订阅套餐 %s 已到期", plan.Name)
+	if reclaimed > 0 {
+		content += fmt.Sprintf("，收回未用完的订阅额度 %s", logger.FormatQuota(reclaimed))
+	}
+	RecordLog(sub.UserId, LogTypeSystem, content)
+	return nil
+}
+
+// ExpireDueSubscriptions 使超过截止时间的订阅失效，返回处理的订阅数
+func ExpireDueSubscriptions() (int, error) {
+	var subs []*UserSubscription
+	statuses := append([]string{SubscriptionStatusPending}, liveSubscriptionStatuses...)
+	if err := DB.Where("status in ?", statuses).Find(&subs).Error; err != nil {
+		return 0, err
+	}
+	now := common.GetTimestamp()
+	count := 0
+	for _, sub := range subs {
+		if getSubscriptionExpireTime(sub) > now {
+			continue
+		}
+		if err := expireSubscription(sub.Id); err != nil {
+			common.SysError(fmt.Sprintf("failed to expire subscription %d: %s", sub.Id, err.Error()))
+			continue
+		}
+		count++
+	}
+	if count > 0 {
+		InitSubscriptionCache()
+	}
+	return count, nil
+}
+
+// blockSubscription 超额即拒绝的订阅及用户当前的已用额度
+type blockSubscription struct {
+	UserSubscription
+	UserUsedQuota int
+}
+
+func getBlockSubscriptions(userId int) ([]*UserSubscription, error) {
+	var rows []*blockSubscription
+	tx := DB.Model(&UserSubscription{}).
+		Joins("JOIN subscription_plans ON subscription_plans.id = user_subscriptions.plan_id").
+		Joins("JOIN users ON users.id = user_subscriptions.user_id").
+		Where("user_subscriptions.status in ? and subscription_plans.overage_mode = ?", liveSubscriptionStatuses, SubscriptionOverageBlock)
+	if userId != 0 {
+		tx = tx.Where("user_subscriptions.user_id = ?", userId)
+	}
+	err := tx.Select("user_subscriptions.*, users.used_quota as user_used_quota").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]*UserSubscription, len(rows))
+	for i, row := range rows {
+		sub := row.UserSubscription
+		// 开启批量更新时，本节点尚未落库的已用额度同样计入
+		sub.RemainQuota = subscriptionUnusedQuota(&sub, row.UserUsedQuota+getPendingUsedQuota(sub.UserId))
+		subs[i] = &sub
+	}
+	return subs, nil
+}
+
+func InitSubscriptionCache() {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	subs, err := getBlockSubscriptions(0)
+	if err != nil {
+		common.SysError("failed to load subscriptions: " + err.Error())
+		return
+	}
+	newCache := make(map[int]*UserSubscription)
+	for _, sub := range subs {
+		newCache[sub.UserId] = sub
+	}
+	subscriptionBlockCacheLock.Lock()
+	subscriptionBlockCache = newCache
+	subscriptionBlockCacheLock.Unlock()
+}
+
+// consumeSubscriptionQuota 结算后同步扣减缓存中的剩余订阅额度，无需等待已用额度落库
+func consumeSubscriptionQuota(userId int, quota int) {
+	if !common.MemoryCacheEnabled {
+		return
+	}
+	subscriptionBlockCacheLock.Lock()
+	defer subscriptionBlockCacheLock.Unlock()
+	if sub, ok := subscriptionBlockCache[userId]; ok {
+		sub.RemainQuota = max(sub.RemainQuota-quota, 0)
+	}
+}
+
+// IsSubscriptionQuotaInsufficient 用户订阅的超额处理方式为拒绝，且本周期剩余的订阅额度不足以支付 quota。
+// 开启内存缓存时只读取缓存，剩余额度随每次结算扣减
+func IsSubscriptionQuotaInsufficient(userId int, quota int) bool {
+	var remain int
+	if common.MemoryCacheEnabled {
+		subscriptionBlockCacheLock.RLock()
+		sub, ok := subscriptionBlockCache[userId]
+		if ok {
+			remain = sub.RemainQuota
+		}
+		subscriptionBlockCacheLock.RUnlock()
+		if !ok {
+			return false
+		}
+	} else {
+		subs, err := getBlockSubscriptions(userId)
+		if err != nil {
+			common.SysError("failed to query subscriptions: " + err.Error())
+			return false
+		}
+		if len(subs) == 0 {
+			return false
+		}
+		remain = subs[0].RemainQuota
+	}
+	return remain <= 0 || remain < quota
+}
+
+func SyncSubscriptionCache(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		InitSubscriptionCache()
+	}
+}
@@ -26,7 +26,13 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
-	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
+	CrossGroupRetry    bool           `json:"cross_group_retry"`                                       // 跨分组重试，仅auto分组有效
+	AllowedTags        string         `json:"allowed_tags" gorm:"type:varchar(1024);default:''"`       // 允许调用方携带的标签键，逗号分隔
+	SignatureRequired  bool           `json:"signature_required"`                                      // 开启后请求必须携带 HMAC 签名
+	SignatureSecret    string         `json:"-" gorm:"type:varchar(64);default:''"`                    // 签名密钥，只在生成时返回一次
+	CertAuthMode       string         `json:"cert_auth_mode" gorm:"type:varchar(16);default:''"`       // 客户端证书认证策略，见 common.TokenCertAuth*
+	CertIdentity       string         `json:"cert_identity" gorm:"type:varchar(255);default:'';index"` // 匹配的证书身份：URI SAN（如 SPIFFE ID）、DNS SAN、邮箱 SAN 或 Subject CN
+	CertOnlyIdentity   *string        `json:"-" gorm:"type:varchar(255);uniqueIndex"`                  // 仅凭证书认证且未删除的令牌的证书身份，其余为 NULL，由唯一索引保证身份只对应一个令牌
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -56,6 +62,18 @@ func (token *Token) GetIpLimits() []string {
 	return ipLimits
 }
 
+// GetAllowedTags 返回允许的标签键，为空时不接受任何标签
+func (token *Token) GetAllowedTags() []string {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(token.AllowedTags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
 func GetAllUserTokens(userId int, startIdx int, num int) ([]*Token, error) {
 	var tokens []*Token
 	var err error
@@ -172,9 +190,14 @@ func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 }
 
 func (token *Token) Insert() error {
-	var err error
-	err = DB.Create(token).Error
-	return err
+	token.syncCertOnlyIdentity()
+	// 创建时的剩余额度作为该令牌台账的期初记录
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(token).Error; err != nil {
+			return err
+		}
+		return recordTokenQuotaLedger(tx, token.Id, token.RemainQuota, QuotaLedgerRef{Reason: QuotaLedgerReasonTokenCreate})
+	})
 }
 
 // Update Make sure your token's fields is completed, because this will update non-zero values
@@ -189,8 +212,29 @@ func (token *Token) Update() (err error) {
 			})
 		}
 	}()
-	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+	token.syncCertOnlyIdentity()
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(token).Select("name", "status", "expired_time", "unlimited_quota",
+			"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "allowed_tags",
+			"cert_auth_mode", "cert_identity", "cert_only_identity").Updates(token).Error
+		if err != nil {
+			return err
+		}
+		// 剩余额度按与当前值的差值更新，并记录台账
+		var remainQuota int
+		if err = tx.Model(&Token{}).Where("id = ?", token.Id).Select("remain_quota").Scan(&remainQuota).Error; err != nil {
+			return err
+		}
+		delta := token.RemainQuota - remainQuota
+		if delta == 0 {
+			return nil
+		}
+		err = tx.Model(&Token{}).Where("id = ?", token.Id).Update("remain_quota", gorm.Expr("remain_quota + ?", delta)).Error
+		if err != nil {
+			return err
+		}
+		return recordTokenQuotaLedger(tx, token.Id, delta, QuotaLedgerRef{Reason: QuotaLedgerReasonTokenEdit})
+	})
 	return err
 }
 
@@ -220,7 +264,13 @@ func (token *Token) Delete() (err error) {
 			})
 		}
 	}()
-	err = DB.Delete(token).Error
+	// 软删除的令牌释放其证书身份，以便重新绑定
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(token).Update("cert_only_identity", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(token).Error
+	})
 	return err
 }
 
@@ -267,7 +317,7 @@ func DeleteTokenById(id int, userId int) (err error) {
 	return token.Delete()
 }
 
-func IncreaseTokenQuota(id int, key string, quota int) (err error) {
+func IncreaseTokenQuota(id int, key string, quota int, ref QuotaLedgerRef) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -280,24 +330,34 @@ func IncreaseTokenQuota(id int, key string, quota int) (err error) {
 		})
 	}
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeTokenQuota, id, quota)
+		addNewQuotaRecord(BatchUpdateTypeTokenQuota, id, quota, ref)
 		return nil
 	}
-	return increaseTokenQuota(id, quota)
+	return increaseTokenQuota(id, quota, ref)
 }
 
-func increaseTokenQuota(id int, quota int) (err error) {
-	err = DB.Model(&Token{}).Where("id = ?", id).Updates(
-		map[string]interface{}{
-			"remain_quota":  gorm.Expr("remain_quota + ?", quota),
-			"used_quota":    gorm.Expr("used_quota - ?", quota),
-			"accessed_time": common.GetTimestamp(),
-		},
-	).Error
-	return err
+func increaseTokenQuota(id int, quota int, ref QuotaLedgerRef) (err error) {
+	return increaseTokenQuotaEntries(id, []quotaLedgerEntry{newQuotaLedgerEntry(quota, ref)})
+}
+
+func increaseTokenQuotaEntries(id int, entries []quotaLedgerEntry) (err error) {
+	quota := sumQuotaLedgerEntries(entries)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Token{}).Where("id = ?", id).Updates(
+			map[string]interface{}{
+				"remain_quota":  gorm.Expr("remain_quota + ?", quota),
+				"used_quota":    gorm.Expr("used_quota - ?", quota),
+				"accessed_time": common.GetTimestamp(),
+			},
+		).Error
+		if err != nil {
+			return err
+		}
+		return recordTokenQuotaLedgerEntries(tx, id, entries)
+	})
 }
 
-func DecreaseTokenQuota(id int, key string, quota int) (err error) {
+func DecreaseTokenQuota(id int, key string, quota int, ref QuotaLedgerRef) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -310,21 +370,10 @@ func DecreaseTokenQuota(id int, key string, quota int) (err error) {
 		})
 	}
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeTokenQuota, id, -quota)
+		addNewQuotaRecord(BatchUpdateTypeTokenQuota, id, -quota, ref)
 		return nil
 	}
-	return decreaseTokenQuota(id, quota)
-}
-
-func decreaseTokenQuota(id int, quota int) (err error) {
-	err = DB.Model(&Token{}).Where("id = ?", id).Updates(
-		map[string]interface{}{
-			"remain_quota":  gorm.Expr("remain_quota - ?", quota),
-			"used_quota":    gorm.Expr("used_quota + ?", quota),
-			"accessed_time": common.GetTimestamp(),
-		},
-	).Error
-	return err
+	return increaseTokenQuota(id, -quota, ref)
 }
 
 // CountUserTokens returns total number of tokens for the given user, used for pagination
@@ -348,6 +397,10 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 		return 0, err
 	}
 
+	if err := tx.Model(&Token{}).Where("user_id = ? AND id IN (?)", userId, ids).Update("cert_only_identity", nil).Error; err != nil {
+		tx.Rollback()
+		return 0, err
+	}
 	if err := tx.Where("user_id = ? AND id IN (?)", userId, ids).Delete(&Token{}).Error; err != nil {
 		tx.Rollback()
 		return 0, err
@@ -367,3 +420,121 @@ func BatchDeleteTokens(ids []int, userId int) (int, error) {
 
 	return len(tokens), nil
 }
+
+// DisableUserTokens 禁用指定用户的全部已启用令牌，返回禁用数量
+func DisableUserTokens(userId int) (int, error) {
+	var tokens []Token
+	if err := DB.Where("user_id = ? AND status = ?", userId, common.TokenStatusEnabled).Find(&tokens).Error; err != nil {
+		return 0, err
+	}
+	if len(tokens) == 0 {
+		return 0, nil
+	}
+	err := DB.Model(&Token{}).Where("user_id = ? AND status = ?", userId, common.TokenStatusEnabled).
+		Update("status", common.TokenStatusDisabled).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			for _, t := range tokens {
+				_ = cacheDeleteToken(t.Key)
+			}
+		})
+	}
+
+	return len(tokens), nil
+}
+
+// SetTokenSignature 开启或关闭令牌的请求签名模式，开启时生成新的签名密钥并返回
+func SetTokenSignature(id int, userId int, enabled bool) (secret string, err error) {
+	token, err := GetTokenByIds(id, userId)
+	if err != nil {
+		return "", err
+	}
+	if enabled {
+		secret, err = common.GenerateRandomCharsKey(48)
+		if err != nil {
+			return "", err
+		}
+	}
+	token.SignatureRequired = enabled
+	token.SignatureSecret = secret
+	err = DB.Model(token).Select("signature_required", "signature_secret").Updates(token).Error
+	if err != nil {
+		return "", err
+	}
+	if common.RedisEnabled {
+		if err := cacheSetToken(*token); err != nil {
+			common.SysLog("failed to update token cache: " + err.Error())
+		}
+	}
+	return secret, nil
+}
+
+// MatchCertIdentity 客户端证书的身份中是否包含令牌绑定的身份
+func (token *Token) MatchCertIdentity(identities []string) bool {
+	if token.CertIdentity == "" {
+		return false
+	}
+	for _, identity := range identities {
+		if identity == token.CertIdentity {
+			return true
+		}
+	}
+	return false
+}
+
+// syncCertOnlyIdentity 按认证策略设置 CertOnlyIdentity，保存令牌前调用
+func (token *Token) syncCertOnlyIdentity() {
+	token.CertOnlyIdentity = nil
+	if token.CertAuthMode == common.TokenCertAuthCertOnly && token.CertIdentity != "" {
+		identity := token.CertIdentity
+		token.CertOnlyIdentity = &identity
+	}
+}
+
+// GetCertOnlyTokenKey 按客户端证书身份查找仅凭证书认证的令牌，返回其密钥。
+// 证书的多个身份分别匹配到不同令牌时无法确定调用方，拒绝认证
+func GetCertOnlyTokenKey(identities []string) (string, error) {
+	if len(identities) == 0 {
+		return "", errors.New("客户端证书没有可用的身份")
+	}
+	var tokens []Token
+	err := DB.Select("id", commonKeyCol).Where("cert_only_identity IN ?", identities).Limit(2).Find(&tokens).Error
+	if err != nil {
+		return "", err
+	}
+	switch len(tokens) {
+	case 0:
+		return "", errors.New("没有与客户端证书匹配的令牌")
+	case 1:
+		return tokens[0].Key, nil
+	default:
+		return "", errors.New("客户端证书匹配多个令牌")
+	}
+}
+
+// IsTokenCertIdentityTaken 仅凭证书认证的令牌按身份唯一匹配，同一身份不能绑定多个此类令牌
+func IsTokenCertIdentityTaken(identity string, excludeId int) bool {
+	var count int64
+	DB.Model(&Token{}).Where("cert_only_identity = ? AND id <> ?", identity, excludeId).Count(&count)
+	return count > 0
+}
+
+// migrateTokenCertOnlyIdentities 为升级前的仅凭证书认证令牌补齐 cert_only_identity，身份重复的令牌保持为空并记录日志
+func migrateTokenCertOnlyIdentities() error {
+	var tokens []Token
+	err := DB.Select("id", "cert_identity").Where("cert_auth_mode = ? AND cert_identity <> '' AND cert_only_identity IS NULL", common.TokenCertAuthCertOnly).
+		Order("id asc").Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err := DB.Model(&Token{}).Where("id = ?", token.Id).Update("cert_only_identity", token.CertIdentity).Error; err != nil {
+			common.SysError(fmt.Sprintf("token %d: cert identity %s is bound to another cert-only token, skipped: %v", token.Id, token.CertIdentity, err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createCertTestToken(t *testing.T, key string, mode string, identity string) (*Token, error) {
+	t.Helper()
+	token := &Token{
+		UserId:       1,
+		Key:          key,
+		Name:         key,
+		ExpiredTime:  -1,
+		CertAuthMode: mode,
+		CertIdentity: identity,
+	}
+	return token, token.Insert()
+}
+
+func TestCertOnlyIdentityUnique(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		identity string
+		wantErr  bool
+	}{
+		{name: "same identity with cert and key", mode: common.TokenCertAuthCertAndKey, identity: "spiffe://a"},
+		{name: "other cert only identity", mode: common.TokenCertAuthCertOnly, identity: "spiffe://b"},
+		{name: "same cert only identity", mode: common.TokenCertAuthCertOnly, identity: "spiffe://a", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t, &Token{}, &QuotaLedger{})
+			_, err := createCertTestToken(t, "existing", common.TokenCertAuthCertOnly, "spiffe://a")
+			require.NoError(t, err)
+
+			_, err = createCertTestToken(t, "new", tt.mode, tt.identity)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCertOnlyIdentityReleasedOnDelete(t *testing.T) {
+	setupTestDB(t, &Token{}, &QuotaLedger{})
+	token, err := createCertTestToken(t, "old", common.TokenCertAuthCertOnly, "spiffe://a")
+	require.NoError(t, err)
+	require.NoError(t, token.Delete())
+
+	require.False(t, IsTokenCertIdentityTaken("spiffe://a", 0))
+	_, err = createCertTestToken(t, "new", common.TokenCertAuthCertOnly, "spiffe://a")
+	require.NoError(t, err)
+}
+
+func TestGetCertOnlyTokenKey(t *testing.T) {
+	setupTestDB(t, &Token{}, &QuotaLedger{})
+	_, err := createCertTestToken(t, "key-a", common.TokenCertAuthCertOnly, "spiffe://a")
+	require.NoError(t, err)
+	_, err = createCertTestToken(t, "key-b", common.TokenCertAuthCertOnly, "spiffe://b")
+	require.NoError(t, err)
+	_, err = createCertTestToken(t, "key-c", common.TokenCertAuthCertAndKey, "spiffe://c")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		identities []string
+		wantKey    string
+		wantErr    bool
+	}{
+		{name: "single match", identities: []string{"spiffe://a", "example.com"}, wantKey: "key-a"},
+		{name: "identities match different tokens", identities: []string{"spiffe://a", "spiffe://b"}, wantErr: true},
+		{name: "cert and key token not matched", identities: []string{"spiffe://c"}, wantErr: true},
+		{name: "no identities", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := GetCertOnlyTokenKey(tt.identities)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantKey, key)
+		})
+	}
+}
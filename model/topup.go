@@ -3,6 +3,7 @@ package model
 import (
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
@@ -21,6 +22,39 @@ type TopUp struct {
 	CreateTime    int64   `json:"create_time"`
 	CompleteTime  int64   `json:"complete_time"`
 	Status        string  `json:"status"`
+	ExternalId    string  `json:"external_id" gorm:"type:varchar(255);index;default:''"` // 支付渠道侧的订单或交易号
+	Quota         int     `json:"quota"`                                                 // 实际到账额度
+	RefundMoney   float64 `json:"refund_money"`
+	RefundQuota   int     `json:"refund_quota"`
+	RefundTime    int64   `json:"refund_time"`
+	RefundPending float64 `json:"refund_pending"` // 已预留、等待支付渠道确认的退款金额
+	RefundSeq     int     `json:"refund_seq"`     // 已发起的渠道退款次数，用于生成幂等键
+}
+
+// 支付方式，易支付订单记录的是具体的支付类型（如 alipay、wxpay）
+const (
+	PaymentMethodStripe = "stripe"
+	PaymentMethodCreem  = "creem"
+)
+
+var (
+	ErrTopUpNotFound  = errors.New("充值订单不存在")
+	ErrTopUpCompleted = errors.New("充值订单已完成")
+	// ErrRefundRejected 支付渠道明确拒绝或未发出退款请求，可以释放预留的退款
+	ErrRefundRejected = errors.New("支付渠道未执行退款")
+)
+
+// topUpTransitions 订单状态机，key 为当前状态，value 为允许迁移到的状态
+var topUpTransitions = map[string][]string{
+	common.TopUpStatusPending: {common.TopUpStatusSuccess, common.TopUpStatusExpired},
+	common.TopUpStatusSuccess: {common.TopUpStatusRefunded},
+}
+
+// TopUpPayment 支付渠道确认到账时携带的附加信息
+type TopUpPayment struct {
+	ExternalId     string
+	StripeCustomer string
+	CustomerEmail  string // 用户尚未绑定邮箱时补全
 }
 
 func (topUp *TopUp) Insert() error {
@@ -55,52 +89,284 @@ func GetTopUpByTradeNo(tradeNo string) *TopUp {
 	return topUp
 }
 
-func Recharge(referenceId string, customerId string) (err error) {
-	if referenceId == "" {
-		return errors.New("未提供支付单号")
+// CanTransitionTo 判断订单能否迁移到目标状态
+func (topUp *TopUp) CanTransitionTo(status string) bool {
+	return slices.Contains(topUpTransitions[topUp.Status], status)
+}
+
+// GetQuotaToAdd 计算订单应充值的额度：
+// - Stripe 订单：Money 代表经分组倍率换算后的美元数量，直接 * QuotaPerUnit
+// - Creem 订单：Amount 即产品配置的充值额度（早期 Creem 订单未记录支付方式）
+// - 其他订单（如易支付）：Amount 为美元数量，* QuotaPerUnit
+func (topUp *TopUp) GetQuotaToAdd() int {
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	switch topUp.PaymentMethod {
+	case PaymentMethodStripe:
+		return int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
+	case PaymentMethodCreem, "":
+		return int(topUp.Amount)
+	default:
+		return int(decimal.NewFromInt(topUp.Amount).Mul(dQuotaPerUnit).IntPart())
 	}
+}
 
-	var quota float64
-	topUp := &TopUp{}
+// getPaidQuota 返回订单实际到账的额度，早期订单未记录时按支付方式重新计算
+func (topUp *TopUp) getPaidQuota() int {
+	if topUp.Quota > 0 {
+		return topUp.Quota
+	}
+	return topUp.GetQuotaToAdd()
+}
 
+// lockTopUpByTradeNo 在事务内按订单号加行锁读取订单
+func lockTopUpByTradeNo(tx *gorm.DB, tradeNo string) (*TopUp, error) {
 	refCol := "`trade_no`"
 	if common.UsingPostgreSQL {
 		refCol = `"trade_no"`
 	}
+	topUp := &TopUp{}
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", tradeNo).First(topUp).Error; err != nil {
+		return nil, ErrTopUpNotFound
+	}
+	return topUp, nil
+}
+
+// CompleteTopUp 将待支付订单迁移为已支付并为用户增加额度，订单已完成时返回 ErrTopUpCompleted
+func CompleteTopUp(tradeNo string, payment *TopUpPayment) (*TopUp, error) {
+	if tradeNo == "" {
+		return nil, errors.New("未提供支付单号")
+	}
 
-	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", referenceId).First(topUp).Error
+	var topUp *TopUp
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		topUp, err = lockTopUpByTradeNo(tx, tradeNo)
 		if err != nil {
-			return errors.New("充值订单不存在")
+			return err
 		}
-
-		if topUp.Status != common.TopUpStatusPending {
-			return errors.New("充值订单状态错误")
+		if topUp.Status == common.TopUpStatusSuccess {
+			return ErrTopUpCompleted
+		}
+		if !topUp.CanTransitionTo(common.TopUpStatusSuccess) {
+			return fmt.Errorf("充值订单状态错误: %s", topUp.Status)
 		}
 
+		quota := topUp.GetQuotaToAdd()
+		if quota <= 0 {
+			return errors.New("无效的充值额度")
+		}
+		topUp.Quota = quota
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
-		err = tx.Save(topUp).Error
+		if payment != nil && payment.ExternalId != "" {
+			topUp.ExternalId = payment.ExternalId
+		}
+		if err := tx.Save(topUp).Error; err != nil {
+			return err
+		}
+
+		if payment != nil {
+			if err := syncTopUpCustomer(tx, topUp.UserId, payment); err != nil {
+				return err
+			}
+		}
+		return applyUserQuotaDelta(tx, topUp.UserId, quota, NewQuotaLedgerRef(QuotaLedgerReasonTopUp, QuotaLedgerRefTopUp, topUp.TradeNo))
+	})
+	if err != nil {
+		return topUp, err
+	}
+	_ = invalidateUserCache(topUp.UserId)
+	return topUp, nil
+}
+
+// syncTopUpCustomer 记录支付渠道的客户信息，邮箱仅在用户未绑定时补全
+func syncTopUpCustomer(tx *gorm.DB, userId int, payment *TopUpPayment) error {
+	updateFields := map[string]interface{}{}
+	if payment.StripeCustomer != "" {
+		updateFields["stripe_customer"] = payment.StripeCustomer
+	}
+	if payment.CustomerEmail != "" {
+		var user User
+		if err := tx.Where("id = ?", userId).First(&user).Error; err != nil {
+			return err
+		}
+		if user.Email == "" {
+			updateFields["email"] = payment.CustomerEmail
+		}
+	}
+	if len(updateFields) == 0 {
+		return nil
+	}
+	return tx.Model(&User{}).Where("id = ?", userId).Updates(updateFields).Error
+}
+
+// ExpireTopUp 将待支付订单标记为过期
+func ExpireTopUp(tradeNo string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		topUp, err := lockTopUpByTradeNo(tx, tradeNo)
 		if err != nil {
 			return err
 		}
+		if !topUp.CanTransitionTo(common.TopUpStatusExpired) {
+			return fmt.Errorf("充值订单状态错误: %s", topUp.Status)
+		}
+		topUp.Status = common.TopUpStatusExpired
+		return tx.Save(topUp).Error
+	})
+}
+
+// RefundIdempotencyKey 当前预留退款的幂等键，重试同一笔预留退款时保持不变，避免支付渠道重复退款
+func (topUp *TopUp) RefundIdempotencyKey() string {
+	return fmt.Sprintf("refund_%s_%d", topUp.TradeNo, topUp.RefundSeq)
+}
+
+// RefundTopUp 对已支付订单退款，并按退款金额占支付金额的比例扣回额度，余额不足时允许扣为负数。
+// 原路退款分三步：先在事务内预留退款金额，再在事务外以幂等键调用 refund 请求支付渠道，成功后在第二个事务内扣回额度。
+// 渠道调用结果未确认时预留保持不变，以相同金额重试会沿用同一幂等键；返回 ErrRefundRejected 时释放预留。
+// 已在渠道后台线下退款时 refund 传 nil，直接扣回额度。全部退完后订单迁移为 refunded，返回本次扣回的额度
+func RefundTopUp(tradeNo string, money float64, refund func(topUp *TopUp, money float64, idempotencyKey string) error) (*TopUp, int, error) {
+	if tradeNo == "" {
+		return nil, 0, errors.New("未提供订单号")
+	}
+	if money <= 0 {
+		return nil, 0, errors.New("退款金额必须大于 0")
+	}
+	if refund == nil {
+		return finalizeTopUpRefund(tradeNo, money, true)
+	}
+
+	topUp, err := reserveTopUpRefund(tradeNo, money)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := refund(topUp, money, topUp.RefundIdempotencyKey()); err != nil {
+		if errors.Is(err, ErrRefundRejected) {
+			if releaseErr := releaseTopUpRefund(tradeNo, topUp.RefundSeq); releaseErr != nil {
+				common.SysError(fmt.Sprintf("failed to release refund reservation of top up %s: %s", tradeNo, releaseErr.Error()))
+			}
+			return nil, 0, err
+		}
+		return nil, 0, fmt.Errorf("退款结果未确认，请以相同金额重试: %w", err)
+	}
+	return finalizeTopUpRefund(tradeNo, money, false)
+}
 
-		quota = topUp.Money * common.QuotaPerUnit
-		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(map[string]interface{}{"stripe_customer": customerId, "quota": gorm.Expr("quota + ?", quota)}).Error
+// getRefundableMoney 订单剩余可退金额，不含已预留的退款
+func (topUp *TopUp) getRefundableMoney() decimal.Decimal {
+	return decimal.NewFromFloat(topUp.Money).Sub(decimal.NewFromFloat(topUp.RefundMoney))
+}
+
+// reserveTopUpRefund 预留退款金额。已有相同金额的预留时沿用原预留（重试），金额不同则拒绝
+func reserveTopUpRefund(tradeNo string, money float64) (*TopUp, error) {
+	var topUp *TopUp
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		topUp, err = lockTopUpByTradeNo(tx, tradeNo)
 		if err != nil {
 			return err
 		}
+		if topUp.Status != common.TopUpStatusSuccess {
+			return errors.New("仅已支付的订单可以退款")
+		}
+		dMoney := decimal.NewFromFloat(money)
+		if topUp.RefundPending > 0 {
+			if dMoney.Equal(decimal.NewFromFloat(topUp.RefundPending)) {
+				return nil
+			}
+			return fmt.Errorf("订单有一笔 %.2f 的退款待确认，请以相同金额重试", topUp.RefundPending)
+		}
+		if dRemain := topUp.getRefundableMoney(); dMoney.GreaterThan(dRemain) {
+			return fmt.Errorf("退款金额超过可退金额 %s", dRemain.StringFixed(2))
+		}
+		topUp.RefundPending = money
+		topUp.RefundSeq++
+		return tx.Save(topUp).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return topUp, nil
+}
 
-		return nil
+// releaseTopUpRefund 支付渠道未执行退款时释放预留，seq 用于确认释放的是同一笔预留
+func releaseTopUpRefund(tradeNo string, seq int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		topUp, err := lockTopUpByTradeNo(tx, tradeNo)
+		if err != nil {
+			return err
+		}
+		if topUp.RefundSeq != seq || topUp.RefundPending <= 0 {
+			return nil
+		}
+		topUp.RefundPending = 0
+		return tx.Save(topUp).Error
 	})
+}
+
+// finalizeTopUpRefund 记录退款并扣回额度。原路退款须存在相同金额的预留；
+// 线下退款存在相同金额的预留时视为该笔退款已在渠道后台完成
+func finalizeTopUpRefund(tradeNo string, money float64, offline bool) (*TopUp, int, error) {
+	var topUp *TopUp
+	var debit int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		topUp, err = lockTopUpByTradeNo(tx, tradeNo)
+		if err != nil {
+			return err
+		}
+		if topUp.Status != common.TopUpStatusSuccess {
+			return errors.New("仅已支付的订单可以退款")
+		}
 
+		dMoney := decimal.NewFromFloat(money)
+		pendingMatched := topUp.RefundPending > 0 && dMoney.Equal(decimal.NewFromFloat(topUp.RefundPending))
+		if !offline && !pendingMatched {
+			return errors.New("未找到对应的预留退款")
+		}
+		if offline && topUp.RefundPending > 0 && !pendingMatched {
+			return fmt.Errorf("订单有一笔 %.2f 的退款待确认，请以相同金额重试", topUp.RefundPending)
+		}
+		dRemain := topUp.getRefundableMoney()
+		if dMoney.GreaterThan(dRemain) {
+			return fmt.Errorf("退款金额超过可退金额 %s", dRemain.StringFixed(2))
+		}
+		paidQuota := topUp.getPaidQuota()
+		fullyRefunded := dMoney.Equal(dRemain)
+		if fullyRefunded {
+			// 最后一笔退款扣回剩余全部额度，避免按比例取整产生残留
+			debit = paidQuota - topUp.RefundQuota
+		} else {
+			debit = int(decimal.NewFromInt(int64(paidQuota)).Mul(dMoney).Div(decimal.NewFromFloat(topUp.Money)).IntPart())
+		}
+
+		topUp.RefundMoney = decimal.NewFromFloat(topUp.RefundMoney).Add(dMoney).InexactFloat64()
+		topUp.RefundQuota += debit
+		topUp.RefundPending = 0
+		topUp.RefundTime = common.GetTimestamp()
+		if fullyRefunded && topUp.CanTransitionTo(common.TopUpStatusRefunded) {
+			topUp.Status = common.TopUpStatusRefunded
+		}
+		if err := tx.Save(topUp).Error; err != nil {
+			return err
+		}
+		if debit <= 0 {
+			return nil
+		}
+		return applyUserQuotaDelta(tx, topUp.UserId, -debit, NewQuotaLedgerRef(QuotaLedgerReasonTopUpRefund, QuotaLedgerRefTopUp, topUp.TradeNo))
+	})
 	if err != nil {
-		return errors.New("充值失败，" + err.Error())
+		return nil, 0, err
 	}
+	_ = invalidateUserCache(topUp.UserId)
+	RecordLog(topUp.UserId, LogTypeManage, fmt.Sprintf("充值订单 %s 退款 %.2f，扣除额度: %v", topUp.TradeNo, money, logger.FormatQuota(debit)))
+	return topUp, debit, nil
+}
 
-	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", logger.FormatQuota(int(quota)), topUp.Amount))
-
-	return nil
+// GetPendingTopUps 按 id 分页获取 afterId 之后、创建时间不晚于 endTime 的待支付订单，供对账任务查询支付渠道
+func GetPendingTopUps(afterId int, endTime int64, limit int) (topUps []*TopUp, err error) {
+	err = DB.Where("status = ? and id > ? and create_time <= ?", common.TopUpStatusPending, afterId, endTime).
+		Order("id asc").Limit(limit).Find(&topUps).Error
+	return topUps, err
 }
 
 func GetUserTopUps(userId int, pageInfo *common.PageInfo) (topups []*TopUp, total int64, err error) {
@@ -236,141 +502,16 @@ func SearchAllTopUps(keyword string, pageInfo *common.PageInfo) (topups []*TopUp
 
 // ManualCompleteTopUp 管理员手动完成订单并给用户充值
 func ManualCompleteTopUp(tradeNo string) error {
-	if tradeNo == "" {
-		return errors.New("未提供订单号")
-	}
-
-	refCol := "`trade_no`"
-	if common.UsingPostgreSQL {
-		refCol = `"trade_no"`
-	}
-
-	var userId int
-	var quotaToAdd int
-	var payMoney float64
-
-	err := DB.Transaction(func(tx *gorm.DB) error {
-		topUp := &TopUp{}
-		// 行级锁，避免并发补单
-		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", tradeNo).First(topUp).Error; err != nil {
-			return errors.New("充值订单不存在")
-		}
-
-		// 幂等处理：已成功直接返回
-		if topUp.Status == common.TopUpStatusSuccess {
-			return nil
-		}
-
-		if topUp.Status != common.TopUpStatusPending {
-			return errors.New("订单状态不是待支付，无法补单")
-		}
-
-		// 计算应充值额度：
-		// - Stripe 订单：Money 代表经分组倍率换算后的美元数量，直接 * QuotaPerUnit
-		// - 其他订单（如易支付）：Amount 为美元数量，* QuotaPerUnit
-		if topUp.PaymentMethod == "stripe" {
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd = int(decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart())
-		} else {
-			dAmount := decimal.NewFromInt(topUp.Amount)
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd = int(dAmount.Mul(dQuotaPerUnit).IntPart())
-		}
-		if quotaToAdd <= 0 {
-			return errors.New("无效的充值额度")
-		}
-
-		// 标记完成
-		topUp.CompleteTime = common.GetTimestamp()
-		topUp.Status = common.TopUpStatusSuccess
-		if err := tx.Save(topUp).Error; err != nil {
-			return err
-		}
-
-		// 增加用户额度（立即写库，保持一致性）
-		if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota + ?", quotaToAdd)).Error; err != nil {
-			return err
-		}
-
-		userId = topUp.UserId
-		payMoney = topUp.Money
+	topUp, err := CompleteTopUp(tradeNo, nil)
+	// 幂等处理：已成功直接返回
+	if errors.Is(err, ErrTopUpCompleted) {
 		return nil
-	})
-
+	}
 	if err != nil {
 		return err
 	}
 
 	// 事务外记录日志，避免阻塞
-	RecordLog(userId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney))
-	return nil
-}
-func RechargeCreem(referenceId string, customerEmail string, customerName string) (err error) {
-	if referenceId == "" {
-		return errors.New("未提供支付单号")
-	}
-
-	var quota int64
-	topUp := &TopUp{}
-
-	refCol := "`trade_no`"
-	if common.UsingPostgreSQL {
-		refCol = `"trade_no"`
-	}
-
-	err = DB.Transaction(func(tx *gorm.DB) error {
-		err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", referenceId).First(topUp).Error
-		if err != nil {
-			return errors.New("充值订单不存在")
-		}
-
-		if topUp.Status != common.TopUpStatusPending {
-			return errors.New("充值订单状态错误")
-		}
-
-		topUp.CompleteTime = common.GetTimestamp()
-		topUp.Status = common.TopUpStatusSuccess
-		err = tx.Save(topUp).Error
-		if err != nil {
-			return err
-		}
-
-		// Creem 直接使用 Amount 作为充值额度（整数）
-		quota = topUp.Amount
-
-		// 构建更新字段，优先使用邮箱，如果邮箱为空则使用用户名
-		updateFields := map[string]interface{}{
-			"quota": gorm.Expr("quota + ?", quota),
-		}
-
-		// 如果有客户邮箱，尝试更新用户邮箱（仅当用户邮箱为空时）
-		if customerEmail != "" {
-			// 先检查用户当前邮箱是否为空
-			var user User
-			err = tx.Where("id = ?", topUp.UserId).First(&user).Error
-			if err != nil {
-				return err
-			}
-
-			// 如果用户邮箱为空，则更新为支付时使用的邮箱
-			if user.Email == "" {
-				updateFields["email"] = customerEmail
-			}
-		}
-
-		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(updateFields).Error
-		if err != nil {
-			return err
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		return errors.New("充值失败，" + err.Error())
-	}
-
-	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用Creem充值成功，充值额度: %v，支付金额：%.2f", quota, topUp.Money))
-
+	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(topUp.Quota), topUp.Money))
 	return nil
 }
@@ -0,0 +1,192 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/stretchr/testify/require"
+)
+
+type refundCall struct {
+	money          float64
+	idempotencyKey string
+}
+
+// refundRecorder 记录渠道退款调用，并依次返回预设的结果
+type refundRecorder struct {
+	results []error
+	calls   []refundCall
+}
+
+func (r *refundRecorder) refund(topUp *TopUp, money float64, idempotencyKey string) error {
+	r.calls = append(r.calls, refundCall{money: money, idempotencyKey: idempotencyKey})
+	if len(r.results) == 0 {
+		return nil
+	}
+	err := r.results[0]
+	r.results = r.results[1:]
+	return err
+}
+
+func createRefundTestTopUp(t *testing.T, status string) (*User, *TopUp) {
+	t.Helper()
+	user := &User{Username: "refund_user", Quota: 1000, AffCode: common.GetRandomString(8)}
+	require.NoError(t, DB.Create(user).Error)
+	topUp := &TopUp{
+		UserId:        user.Id,
+		Amount:        1000,
+		Money:         10,
+		Quota:         1000,
+		TradeNo:       "trade_refund",
+		PaymentMethod: PaymentMethodCreem,
+		Status:        status,
+	}
+	require.NoError(t, DB.Create(topUp).Error)
+	return user, topUp
+}
+
+func TestRefundTopUp(t *testing.T) {
+	errUnknown := errors.New("connection reset")
+	errRejected := errors.Join(ErrRefundRejected, errors.New("charge already refunded"))
+	tests := []struct {
+		name        string
+		status      string
+		results     []error   // 渠道依次返回的结果
+		refunds     []float64 // 依次发起的退款金额，最后一次的结果用于断言
+		offline     bool
+		wantErr     bool
+		wantKeys    []string // 渠道收到的幂等键
+		wantPending float64
+		wantMoney   float64
+		wantQuota   int // 用户剩余额度
+		wantStatus  string
+	}{
+		{
+			name:       "partial refund",
+			status:     common.TopUpStatusSuccess,
+			refunds:    []float64{4},
+			wantKeys:   []string{"refund_trade_refund_1"},
+			wantMoney:  4,
+			wantQuota:  600,
+			wantStatus: common.TopUpStatusSuccess,
+		},
+		{
+			name:       "full refund after partial",
+			status:     common.TopUpStatusSuccess,
+			refunds:    []float64{3, 7},
+			wantKeys:   []string{"refund_trade_refund_1", "refund_trade_refund_2"},
+			wantMoney:  10,
+			wantQuota:  0,
+			wantStatus: common.TopUpStatusRefunded,
+		},
+		{
+			name:       "rejected refund releases reservation",
+			status:     common.TopUpStatusSuccess,
+			results:    []error{errRejected},
+			refunds:    []float64{4},
+			wantErr:    true,
+			wantKeys:   []string{"refund_trade_refund_1"},
+			wantQuota:  1000,
+			wantStatus: common.TopUpStatusSuccess,
+		},
+		{
+			name:        "unconfirmed refund keeps reservation",
+			status:      common.TopUpStatusSuccess,
+			results:     []error{errUnknown},
+			refunds:     []float64{4},
+			wantErr:     true,
+			wantKeys:    []string{"refund_trade_refund_1"},
+			wantPending: 4,
+			wantQuota:   1000,
+			wantStatus:  common.TopUpStatusSuccess,
+		},
+		{
+			name:       "retry reuses idempotency key",
+			status:     common.TopUpStatusSuccess,
+			results:    []error{errUnknown, nil},
+			refunds:    []float64{4, 4},
+			wantKeys:   []string{"refund_trade_refund_1", "refund_trade_refund_1"},
+			wantMoney:  4,
+			wantQuota:  600,
+			wantStatus: common.TopUpStatusSuccess,
+		},
+		{
+			name:        "retry with different amount rejected",
+			status:      common.TopUpStatusSuccess,
+			results:     []error{errUnknown},
+			refunds:     []float64{4, 5},
+			wantErr:     true,
+			wantKeys:    []string{"refund_trade_refund_1"},
+			wantPending: 4,
+			wantQuota:   1000,
+			wantStatus:  common.TopUpStatusSuccess,
+		},
+		{
+			name:       "over refund rejected",
+			status:     common.TopUpStatusSuccess,
+			refunds:    []float64{11},
+			wantErr:    true,
+			wantQuota:  1000,
+			wantStatus: common.TopUpStatusSuccess,
+		},
+		{
+			name:       "unpaid order rejected",
+			status:     common.TopUpStatusPending,
+			refunds:    []float64{4},
+			wantErr:    true,
+			wantQuota:  1000,
+			wantStatus: common.TopUpStatusPending,
+		},
+		{
+			name:       "offline refund",
+			status:     common.TopUpStatusSuccess,
+			refunds:    []float64{10},
+			offline:    true,
+			wantMoney:  10,
+			wantQuota:  0,
+			wantStatus: common.TopUpStatusRefunded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDB(t, &User{}, &TopUp{}, &QuotaLedger{}, &Log{})
+			user, topUp := createRefundTestTopUp(t, tt.status)
+
+			recorder := &refundRecorder{results: tt.results}
+			refund := recorder.refund
+			if tt.offline {
+				refund = nil
+			}
+			var err error
+			for _, money := range tt.refunds {
+				_, _, err = RefundTopUp(topUp.TradeNo, money, refund)
+			}
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			keys := make([]string, 0, len(recorder.calls))
+			for _, call := range recorder.calls {
+				keys = append(keys, call.idempotencyKey)
+			}
+			require.Equal(t, len(tt.wantKeys), len(keys))
+			if len(tt.wantKeys) > 0 {
+				require.Equal(t, tt.wantKeys, keys)
+			}
+
+			got := GetTopUpByTradeNo(topUp.TradeNo)
+			require.NotNil(t, got)
+			require.Equal(t, tt.wantPending, got.RefundPending)
+			require.Equal(t, tt.wantMoney, got.RefundMoney)
+			require.Equal(t, tt.wantStatus, got.Status)
+
+			quota, err := GetUserQuota(user.Id, true)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantQuota, quota)
+		})
+	}
+}
@@ -23,8 +23,9 @@ type User struct {
 	Password         string         `json:"password" gorm:"not null;" validate:"min=8,max=20"`
 	OriginalPassword string         `json:"original_password" gorm:"-:all"` // this field is only for Password change verification, don't save it to database!
 	DisplayName      string         `json:"display_name" gorm:"index" validate:"max=20"`
-	Role             int            `json:"role" gorm:"type:int;default:1"`   // admin, common
-	Status           int            `json:"status" gorm:"type:int;default:1"` // enabled, disabled
+	Role             int            `json:"role" gorm:"type:int;default:1"`          // admin, common
+	RoleId           int            `json:"role_id" gorm:"type:int;default:0;index"` // 自定义管理角色，0 表示使用 role 对应的预设权限
+	Status           int            `json:"status" gorm:"type:int;default:1"`        // enabled, disabled
 	Email            string         `json:"email" gorm:"index" validate:"max=50"`
 	GitHubId         string         `json:"github_id" gorm:"column:github_id;index"`
 	DiscordId        string         `json:"discord_id" gorm:"column:discord_id;index"`
@@ -32,7 +33,7 @@ type User struct {
 	WeChatId         string         `json:"wechat_id" gorm:"column:wechat_id;index"`
 	TelegramId       string         `json:"telegram_id" gorm:"column:telegram_id;index"`
 	VerificationCode string         `json:"verification_code" gorm:"-:all"`                                    // this field is only for Email verification, don't save it to database!
-	AccessToken      *string        `json:"access_token" gorm:"type:char(32);column:access_token;uniqueIndex"` // this token is for system management
+	AccessToken      *string        `json:"access_token" gorm:"type:char(32);column:access_token;uniqueIndex"` // 旧版单一系统访问令牌，已迁移至 UserAccessToken
 	Quota            int            `json:"quota" gorm:"type:int;default:0"`
 	UsedQuota        int            `json:"used_quota" gorm:"type:int;default:0;column:used_quota"` // used quota
 	RequestCount     int            `json:"request_count" gorm:"type:int;default:0;"`               // request number
@@ -333,7 +334,7 @@ func inviteUser(inviterId int) (err error) {
 	user.AffCount++
 	user.AffQuota += common.QuotaForInviter
 	user.AffHistoryQuota += common.QuotaForInviter
-	return DB.Save(user).Error
+	return DB.Omit("quota").Save(user).Error
 }
 
 func (user *User) TransferAffQuotaToQuota(quota int) error {
@@ -362,12 +363,13 @@ func (user *User) TransferAffQuotaToQuota(quota int) error {
 
 	// 更新用户额度
 	user.AffQuota -= quota
-	user.Quota += quota
-
-	// 保存用户状态
-	if err := tx.Save(user).Error; err != nil {
+	if err := tx.Model(user).Update("aff_quota", user.AffQuota).Error; err != nil {
+		return err
+	}
+	if err := applyUserQuotaDelta(tx, user.Id, quota, QuotaLedgerRef{Reason: QuotaLedgerReasonAffTransfer}); err != nil {
 		return err
 	}
+	user.Quota += quota
 
 	// 提交事务
 	return tx.Commit().Error
@@ -392,9 +394,15 @@ func (user *User) Insert(inviterId int) error {
 		user.SetSetting(defaultSetting)
 	}
 
-	result := DB.Create(user)
-	if result.Error != nil {
-		return result.Error
+	// 注册赠送额度作为该用户台账的期初记录
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return recordUserQuotaLedger(tx, user.Id, user.Quota, QuotaLedgerRef{Reason: QuotaLedgerReasonRegister})
+	})
+	if err != nil {
+		return err
 	}
 
 	// 用户创建成功后，根据角色初始化边栏配置
@@ -417,7 +425,7 @@ func (user *User) Insert(inviterId int) error {
 	}
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true)
+			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true, NewQuotaLedgerRef(QuotaLedgerReasonInvite, QuotaLedgerRefUser, inviterId))
 			RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("使用邀请码赠送 %s", logger.LogQuota(common.QuotaForInvitee)))
 		}
 		if common.QuotaForInviter > 0 {
@@ -439,7 +447,8 @@ func (user *User) Update(updatePassword bool) error {
 	}
 	newUser := *user
 	DB.First(&user, user.Id)
-	if err = DB.Model(user).Updates(newUser).Error; err != nil {
+	// 额度只能通过记录台账的增减接口修改，避免用旧值覆盖
+	if err = DB.Model(user).Omit("quota").Updates(newUser).Error; err != nil {
 		return err
 	}
 
@@ -461,7 +470,6 @@ func (user *User) Edit(updatePassword bool) error {
 		"username":     newUser.Username,
 		"display_name": newUser.DisplayName,
 		"group":        newUser.Group,
-		"quota":        newUser.Quota,
 		"remark":       newUser.Remark,
 	}
 	if updatePassword {
@@ -469,7 +477,20 @@ func (user *User) Edit(updatePassword bool) error {
 	}
 
 	DB.First(&user, user.Id)
-	if err = DB.Model(user).Updates(updates).Error; err != nil {
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		// 管理员设置的是目标额度，按与当前值的差值更新并记录台账
+		if delta := newUser.Quota - user.Quota; delta != 0 {
+			if err := applyUserQuotaDelta(tx, user.Id, delta, QuotaLedgerRef{Reason: QuotaLedgerReasonAdmin}); err != nil {
+				return err
+			}
+			user.Quota += delta
+		}
+		return nil
+	})
+	if err != nil {
 		return err
 	}
 
@@ -477,6 +498,104 @@ func (user *User) Edit(updatePassword bool) error {
 	return updateUserCache(*user)
 }
 
+// UpdateUserAccess 更新用户的分组、权限等级与自定义管理角色，用于单点登录按目录同步
+func UpdateUserAccess(userId int, group string, role int, roleId int) error {
+	err := DB.Model(&User{}).Where("id = ?", userId).Updates(map[string]interface{}{
+		"group":   group,
+		"role":    role,
+		"role_id": roleId,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return invalidateUserCache(userId)
+}
+
+// findUserFields FindUsersByField 允许查询的列
+var findUserFields = map[string]string{
+	"username":     "username",
+	"email":        "email",
+	"display_name": "display_name",
+}
+
+// FindUsersByField 按单个属性精确查找用户，field 为空时返回全部用户，用于 SCIM 目录同步
+func FindUsersByField(field string, value string, startIdx int, num int) (users []*User, total int64, err error) {
+	query := DB.Model(&User{})
+	if field != "" {
+		column, ok := findUserFields[field]
+		if !ok {
+			return nil, 0, fmt.Errorf("unsupported filter field: %s", field)
+		}
+		query = query.Where(column+" = ?", value)
+	}
+	if err = query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = query.Omit("password").Order("id asc").Limit(num).Offset(startIdx).Find(&users).Error
+	return users, total, err
+}
+
+// GetUsersByGroup 返回指定分组下的全部用户
+func GetUsersByGroup(group string) (users []*User, err error) {
+	err = DB.Select("id", "username", "display_name", "role").Where(commonGroupCol+" = ?", group).Order("id asc").Find(&users).Error
+	return users, err
+}
+
+// UpdateUsersGroup 批量设置用户分组，超级管理员不受目录同步影响
+func UpdateUsersGroup(userIds []int, group string) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+	err := DB.Model(&User{}).Where("id IN ? AND role < ?", userIds, common.RoleRootUser).Update("group", group).Error
+	if err != nil {
+		return err
+	}
+	for _, id := range userIds {
+		_ = invalidateUserCache(id)
+	}
+	return nil
+}
+
+// UpdateUserProfile 更新用户名、显示名称与邮箱，可以写入空值
+func UpdateUserProfile(userId int, username string, displayName string, email string) error {
+	err := DB.Model(&User{}).Where("id = ?", userId).Updates(map[string]interface{}{
+		"username":     username,
+		"display_name": displayName,
+		"email":        email,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return invalidateUserCache(userId)
+}
+
+// SetUserStatus 启用或禁用用户
+func SetUserStatus(userId int, status int) error {
+	if err := DB.Model(&User{}).Where("id = ?", userId).Update("status", status).Error; err != nil {
+		return err
+	}
+	return invalidateUserCache(userId)
+}
+
+// SetUserQuota 管理员将用户额度设为目标值，按差值记录台账，返回修改前的额度
+func SetUserQuota(userId int, quota int) (int, error) {
+	var oldQuota int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", userId).Select("quota").Scan(&oldQuota).Error; err != nil {
+			return err
+		}
+		if delta := quota - oldQuota; delta != 0 {
+			return applyUserQuotaDelta(tx, userId, delta, QuotaLedgerRef{Reason: QuotaLedgerReasonAdmin})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	_ = invalidateUserCache(userId)
+	return oldQuota, nil
+}
+
 func (user *User) Delete() error {
 	if user.Id == 0 {
 		return errors.New("id 为空！")
@@ -599,16 +718,23 @@ func IsTelegramIdAlreadyTaken(telegramId string) bool {
 	return DB.Unscoped().Where("telegram_id = ?", telegramId).Find(&User{}).RowsAffected == 1
 }
 
-func ResetUserPasswordByEmail(email string, password string) error {
+// ResetUserPasswordByEmail 重置邮箱对应用户的密码，返回用户 ID，由调用方注销其登录会话与访问令牌
+func ResetUserPasswordByEmail(email string, password string) (int, error) {
 	if email == "" || password == "" {
-		return errors.New("邮箱地址或密码为空！")
+		return 0, errors.New("邮箱地址或密码为空！")
 	}
 	hashedPassword, err := common.Password2Hash(password)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	err = DB.Model(&User{}).Where("email = ?", email).Update("password", hashedPassword).Error
-	return err
+	user := &User{}
+	if err := DB.Where("email = ?", email).First(user).Error; err != nil {
+		return 0, err
+	}
+	if err := DB.Model(&User{}).Where("id = ?", user.Id).Update("password", hashedPassword).Error; err != nil {
+		return 0, err
+	}
+	return user.Id, nil
 }
 
 func IsAdmin(userId int) bool {
@@ -654,13 +780,18 @@ func IsAdmin(userId int) bool {
 //	return user.Status == common.UserStatusEnabled, nil
 //}
 
-func ValidateAccessToken(token string) (user *User) {
+// ValidateAccessToken 通过系统访问令牌获取用户，令牌无效、过期或用户不存在时返回 nil
+func ValidateAccessToken(token string, ip string) (user *User) {
 	if token == "" {
 		return nil
 	}
 	token = strings.Replace(token, "Bearer ", "", 1)
+	accessToken := ValidateUserAccessToken(token, ip)
+	if accessToken == nil {
+		return nil
+	}
 	user = &User{}
-	if DB.Where("access_token = ?", token).First(user).RowsAffected == 1 {
+	if DB.Where("id = ?", accessToken.UserId).First(user).RowsAffected == 1 {
 		return user
 	}
 	return nil
@@ -763,7 +894,7 @@ func GetUserSetting(id int, fromDB bool) (settingMap dto.UserSetting, err error)
 	return userBase.GetSetting(), nil
 }
 
-func IncreaseUserQuota(id int, quota int, db bool) (err error) {
+func IncreaseUserQuota(id int, quota int, db bool, ref QuotaLedgerRef) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -774,21 +905,23 @@ func IncreaseUserQuota(id int, quota int, db bool) (err error) {
 		}
 	})
 	if !db && common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, quota)
+		addNewQuotaRecord(BatchUpdateTypeUserQuota, id, quota, ref)
 		return nil
 	}
-	return increaseUserQuota(id, quota)
+	return increaseUserQuota(id, quota, ref)
 }
 
-func increaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
-	if err != nil {
-		return err
-	}
-	return err
+func increaseUserQuota(id int, quota int, ref QuotaLedgerRef) (err error) {
+	return increaseUserQuotaEntries(id, []quotaLedgerEntry{newQuotaLedgerEntry(quota, ref)})
 }
 
-func DecreaseUserQuota(id int, quota int) (err error) {
+func increaseUserQuotaEntries(id int, entries []quotaLedgerEntry) (err error) {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return applyUserQuotaEntries(tx, id, entries)
+	})
+}
+
+func DecreaseUserQuota(id int, quota int, ref QuotaLedgerRef) (err error) {
 	if quota < 0 {
 		return errors.New("quota 不能为负数！")
 	}
@@ -799,28 +932,20 @@ func DecreaseUserQuota(id int, quota int) (err error) {
 		}
 	})
 	if common.BatchUpdateEnabled {
-		addNewRecord(BatchUpdateTypeUserQuota, id, -quota)
+		addNewQuotaRecord(BatchUpdateTypeUserQuota, id, -quota, ref)
 		return nil
 	}
-	return decreaseUserQuota(id, quota)
-}
-
-func decreaseUserQuota(id int, quota int) (err error) {
-	err = DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota - ?", quota)).Error
-	if err != nil {
-		return err
-	}
-	return err
+	return increaseUserQuota(id, -quota, ref)
 }
 
-func DeltaUpdateUserQuota(id int, delta int) (err error) {
+func DeltaUpdateUserQuota(id int, delta int, ref QuotaLedgerRef) (err error) {
 	if delta == 0 {
 		return nil
 	}
 	if delta > 0 {
-		return IncreaseUserQuota(id, delta, false)
+		return IncreaseUserQuota(id, delta, false, ref)
 	} else {
-		return DecreaseUserQuota(id, -delta)
+		return DecreaseUserQuota(id, -delta, ref)
 	}
 }
 
@@ -835,6 +960,7 @@ func GetRootUser() (user *User) {
 }
 
 func UpdateUserUsedQuotaAndRequestCount(id int, quota int) {
+	consumeSubscriptionQuota(id, quota)
 	if common.BatchUpdateEnabled {
 		addNewRecord(BatchUpdateTypeUsedQuota, id, quota)
 		addNewRecord(BatchUpdateTypeRequestCount, id, 1)
@@ -0,0 +1,183 @@
+package model
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+const (
+	// UserAccessTokenDefaultName 旧版单一系统访问令牌迁移后以及旧接口生成的令牌名称
+	UserAccessTokenDefaultName = "default"
+	maxUserAccessTokens        = 20
+)
+
+// UserAccessToken 系统管理访问令牌，可为一个用户创建多个并设置过期时间，库中只保存哈希
+type UserAccessToken struct {
+	Id           int    `json:"id"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Name         string `json:"name" gorm:"size:64"`
+	TokenHash    string `json:"-" gorm:"type:char(64);uniqueIndex"`
+	MaskedToken  string `json:"masked_token" gorm:"size:32;default:''"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	ExpiredTime  int64  `json:"expired_time" gorm:"bigint;default:-1"` // -1 表示永不过期
+	LastUsedTime int64  `json:"last_used_time" gorm:"bigint;default:0"`
+	LastUsedIp   string `json:"last_used_ip" gorm:"size:64;default:''"`
+}
+
+func hashUserAccessToken(key string) string {
+	return hex.EncodeToString(common.Sha256Raw([]byte(key)))
+}
+
+func maskUserAccessToken(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
+
+func (token *UserAccessToken) IsExpired() bool {
+	return token.ExpiredTime != -1 && token.ExpiredTime < common.GetTimestamp()
+}
+
+func newUserAccessToken(userId int, name string, expiredTime int64, key string) *UserAccessToken {
+	return &UserAccessToken{
+		UserId:      userId,
+		Name:        name,
+		TokenHash:   hashUserAccessToken(key),
+		MaskedToken: maskUserAccessToken(key),
+		CreatedTime: common.GetTimestamp(),
+		ExpiredTime: expiredTime,
+	}
+}
+
+// CreateUserAccessToken 创建访问令牌，明文只在创建时返回一次
+func CreateUserAccessToken(userId int, name string, expiredTime int64) (*UserAccessToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return nil, "", errors.New("令牌名称不能为空且不能超过 64 个字符")
+	}
+	if expiredTime != -1 && expiredTime <= common.GetTimestamp() {
+		return nil, "", errors.New("过期时间不能早于当前时间")
+	}
+	var count int64
+	if err := DB.Model(&UserAccessToken{}).Where("user_id = ?", userId).Count(&count).Error; err != nil {
+		return nil, "", err
+	}
+	if count >= maxUserAccessTokens {
+		return nil, "", errors.New("访问令牌数量已达上限")
+	}
+	key, err := common.GenerateRandomKey(32)
+	if err != nil {
+		return nil, "", err
+	}
+	token := newUserAccessToken(userId, name, expiredTime, key)
+	if err := DB.Create(token).Error; err != nil {
+		return nil, "", err
+	}
+	return token, key, nil
+}
+
+// ReplaceUserAccessToken 删除用户同名的令牌后重新创建，用于兼容只有单一访问令牌的旧接口
+func ReplaceUserAccessToken(userId int, name string) (*UserAccessToken, string, error) {
+	key, err := common.GenerateRandomKey(32)
+	if err != nil {
+		return nil, "", err
+	}
+	token := newUserAccessToken(userId, name, -1, key)
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND name = ?", userId, name).Delete(&UserAccessToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return token, key, nil
+}
+
+func GetUserAccessTokens(userId int) (tokens []*UserAccessToken, err error) {
+	err = DB.Where("user_id = ?", userId).Order("id desc").Find(&tokens).Error
+	return tokens, err
+}
+
+func DeleteUserAccessToken(userId int, id int) error {
+	result := DB.Where("user_id = ? AND id = ?", userId, id).Delete(&UserAccessToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("访问令牌不存在")
+	}
+	return nil
+}
+
+// RevokeUserAccessTokens 删除用户的全部访问令牌，返回删除数量
+func RevokeUserAccessTokens(userId int) (int64, error) {
+	result := DB.Where("user_id = ?", userId).Delete(&UserAccessToken{})
+	return result.RowsAffected, result.Error
+}
+
+// ValidateUserAccessToken 校验访问令牌并记录最近使用时间与 IP，无效或已过期时返回 nil
+func ValidateUserAccessToken(key string, ip string) *UserAccessToken {
+	if key == "" {
+		return nil
+	}
+	var token UserAccessToken
+	if err := DB.Where("token_hash = ?", hashUserAccessToken(key)).First(&token).Error; err != nil {
+		return nil
+	}
+	if token.IsExpired() {
+		return nil
+	}
+	now := common.GetTimestamp()
+	if now-token.LastUsedTime >= userSessionTouchInterval || token.LastUsedIp != ip {
+		gopool.Go(func() {
+			err := DB.Model(&UserAccessToken{}).Where("id = ?", token.Id).Updates(map[string]interface{}{
+				"last_used_time": now,
+				"last_used_ip":   ip,
+			}).Error
+			if err != nil {
+				common.SysLog("failed to update access token usage: " + err.Error())
+			}
+		})
+	}
+	return &token
+}
+
+// migrateLegacyAccessTokens 将 users.access_token 中的旧版单一访问令牌迁移为具名令牌，并清空旧列
+func migrateLegacyAccessTokens() error {
+	var users []User
+	if err := DB.Select("id", "access_token").Where("access_token IS NOT NULL AND access_token <> ''").Find(&users).Error; err != nil {
+		return err
+	}
+	for _, user := range users {
+		key := user.GetAccessToken()
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			var count int64
+			if err := tx.Model(&UserAccessToken{}).Where("token_hash = ?", hashUserAccessToken(key)).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				if err := tx.Create(newUserAccessToken(user.Id, UserAccessTokenDefaultName, -1, key)).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&User{}).Where("id = ?", user.Id).Update("access_token", nil).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(users) > 0 {
+		common.SysLog(fmt.Sprintf("migrated %d legacy access tokens", len(users)))
+	}
+	return nil
+}
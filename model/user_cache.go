@@ -49,14 +49,58 @@ func getUserCacheKey(userId int) string {
 	return fmt.Sprintf("user:%d", userId)
 }
 
-// invalidateUserCache clears user cache
+// getUserPermissionsCacheKey returns the key for user permissions cache
+func getUserPermissionsCacheKey(userId int) string {
+	return fmt.Sprintf("user_permissions:%d", userId)
+}
+
+// invalidateUserCache clears user cache and user permissions cache
 func invalidateUserCache(userId int) error {
 	if !common.RedisEnabled {
 		return nil
 	}
+	if err := common.RedisDelKey(getUserPermissionsCacheKey(userId)); err != nil {
+		return err
+	}
 	return common.RedisDelKey(getUserCacheKey(userId))
 }
 
+// userPermissionsCache 缓存的有效权限，Role 为计算时的权限等级，等级变化后缓存失效
+type userPermissionsCache struct {
+	Role        int      `json:"role"`
+	Permissions []string `json:"permissions"`
+}
+
+func cacheGetUserPermissions(userId int, userRole int) ([]string, bool) {
+	if !common.RedisEnabled {
+		return nil, false
+	}
+	value, err := common.RedisGet(getUserPermissionsCacheKey(userId))
+	if err != nil {
+		return nil, false
+	}
+	var cache userPermissionsCache
+	if err := common.UnmarshalJsonStr(value, &cache); err != nil || cache.Role != userRole {
+		return nil, false
+	}
+	return cache.Permissions, true
+}
+
+func cacheSetUserPermissions(userId int, userRole int, permissions []string) {
+	if !common.RedisEnabled {
+		return
+	}
+	gopool.Go(func() {
+		data, err := common.Marshal(userPermissionsCache{Role: userRole, Permissions: permissions})
+		if err == nil {
+			err = common.RedisSet(getUserPermissionsCacheKey(userId), string(data), time.Duration(common.RedisKeyCacheSeconds())*time.Second)
+		}
+		if err != nil {
+			common.SysLog("failed to update user permissions cache: " + err.Error())
+		}
+	})
+}
+
 // updateUserCache updates all user cache fields using hash
 func updateUserCache(user User) error {
 	if !common.RedisEnabled {
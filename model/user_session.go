@@ -0,0 +1,179 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"gorm.io/gorm"
+)
+
+// userSessionTouchInterval 最近活跃时间的更新间隔（秒），避免每个请求都写库
+const userSessionTouchInterval = 60
+
+// UserSession 控制台登录会话的服务端记录，cookie 中只保存 SessionId，记录被删除后会话立即失效
+type UserSession struct {
+	Id           int    `json:"id"`
+	SessionId    string `json:"-" gorm:"type:char(32);uniqueIndex"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	Device       string `json:"device" gorm:"size:64;default:''"`
+	Ip           string `json:"ip" gorm:"size:64;default:''"`
+	UserAgent    string `json:"user_agent" gorm:"size:512;default:''"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	LastSeenTime int64  `json:"last_seen_time" gorm:"bigint;index"`
+	Current      bool   `json:"current" gorm:"-"` // 是否为发起请求的会话
+}
+
+// parseSessionDevice 从 User-Agent 粗略识别浏览器与操作系统，如 Chrome on Windows
+func parseSessionDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	browser := "Unknown"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	case strings.HasPrefix(ua, "curl/"):
+		browser = "curl"
+	}
+	platform := ""
+	switch {
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		platform = "iOS"
+	case strings.Contains(ua, "mac os"):
+		platform = "macOS"
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	}
+	if platform == "" {
+		return browser
+	}
+	return browser + " on " + platform
+}
+
+func userSessionExpireBefore() int64 {
+	return common.GetTimestamp() - int64(common.SessionMaxAge)
+}
+
+// CreateUserSession 登录时创建会话记录，并顺带清理该用户已过期的会话
+func CreateUserSession(userId int, ip string, userAgent string) (*UserSession, error) {
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+	now := common.GetTimestamp()
+	session := &UserSession{
+		SessionId:    common.GetUUID(),
+		UserId:       userId,
+		Device:       parseSessionDevice(userAgent),
+		Ip:           ip,
+		UserAgent:    userAgent,
+		CreatedTime:  now,
+		LastSeenTime: now,
+	}
+	if err := DB.Create(session).Error; err != nil {
+		return nil, err
+	}
+	DB.Where("user_id = ? AND last_seen_time < ?", userId, userSessionExpireBefore()).Delete(&UserSession{})
+	return session, nil
+}
+
+// GetUserSessionBySessionId 返回有效的会话，已撤销或过期时返回错误。启用 Redis 时优先读取缓存
+func GetUserSessionBySessionId(sessionId string) (*UserSession, error) {
+	if sessionId == "" {
+		return nil, errors.New("会话 ID 为空")
+	}
+	session, err := cacheGetUserSession(sessionId)
+	if err != nil {
+		session = &UserSession{}
+		if err := DB.Where("session_id = ?", sessionId).First(session).Error; err != nil {
+			return nil, err
+		}
+		if err := cacheSetUserSession(*session); err != nil {
+			common.SysLog("failed to update user session cache: " + err.Error())
+		}
+	}
+	if session.LastSeenTime < userSessionExpireBefore() {
+		return nil, errors.New("会话已过期")
+	}
+	return session, nil
+}
+
+// TouchUserSession 更新最近活跃时间与 IP，间隔不足时跳过
+func TouchUserSession(session *UserSession, ip string) {
+	now := common.GetTimestamp()
+	if now-session.LastSeenTime < userSessionTouchInterval && session.Ip == ip {
+		return
+	}
+	gopool.Go(func() {
+		err := DB.Model(&UserSession{}).Where("id = ?", session.Id).Updates(map[string]interface{}{
+			"last_seen_time": now,
+			"ip":             ip,
+		}).Error
+		if err != nil {
+			common.SysLog("failed to update user session: " + err.Error())
+			return
+		}
+		if err := cacheTouchUserSession(session.SessionId, now, ip); err != nil {
+			common.SysLog("failed to update user session cache: " + err.Error())
+		}
+	})
+}
+
+// GetUserSessions 返回用户未过期的会话，按最近活跃时间倒序
+func GetUserSessions(userId int) (sessions []*UserSession, err error) {
+	err = DB.Where("user_id = ? AND last_seen_time >= ?", userId, userSessionExpireBefore()).
+		Order("last_seen_time desc").Find(&sessions).Error
+	return sessions, err
+}
+
+// RevokeUserSession 撤销用户的指定会话
+func RevokeUserSession(userId int, id int) error {
+	count, err := revokeUserSessionsWhere(DB.Where("user_id = ? AND id = ?", userId, id))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("会话不存在")
+	}
+	return nil
+}
+
+func RevokeUserSessionBySessionId(sessionId string) error {
+	_, err := revokeUserSessionsWhere(DB.Where("session_id = ?", sessionId))
+	return err
+}
+
+// RevokeUserSessions 撤销用户的全部会话，exceptSessionId 不为空时保留该会话，返回撤销数量
+func RevokeUserSessions(userId int, exceptSessionId string) (int64, error) {
+	tx := DB.Where("user_id = ?", userId)
+	if exceptSessionId != "" {
+		tx = tx.Where("session_id <> ?", exceptSessionId)
+	}
+	return revokeUserSessionsWhere(tx)
+}
+
+// revokeUserSessionsWhere 删除匹配的会话记录及其缓存，返回撤销数量
+func revokeUserSessionsWhere(tx *gorm.DB) (int64, error) {
+	var sessionIds []string
+	if err := tx.Session(&gorm.Session{}).Model(&UserSession{}).Pluck("session_id", &sessionIds).Error; err != nil {
+		return 0, err
+	}
+	if len(sessionIds) == 0 {
+		return 0, nil
+	}
+	result := DB.Where("session_id IN ?", sessionIds).Delete(&UserSession{})
+	cacheDeleteUserSessions(sessionIds)
+	return result.RowsAffected, result.Error
+}
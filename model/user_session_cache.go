@@ -0,0 +1,54 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+func getUserSessionCacheKey(sessionId string) string {
+	return fmt.Sprintf("user_session:%s", sessionId)
+}
+
+func cacheSetUserSession(session UserSession) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	return common.RedisHSetObj(getUserSessionCacheKey(session.SessionId), &session, time.Duration(common.RedisKeyCacheSeconds())*time.Second)
+}
+
+func cacheGetUserSession(sessionId string) (*UserSession, error) {
+	if !common.RedisEnabled {
+		return nil, fmt.Errorf("redis is not enabled")
+	}
+	var session UserSession
+	if err := common.RedisHGetObj(getUserSessionCacheKey(sessionId), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// cacheTouchUserSession 同步最近活跃时间与 IP，缓存不存在时不处理
+func cacheTouchUserSession(sessionId string, lastSeenTime int64, ip string) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	key := getUserSessionCacheKey(sessionId)
+	if err := common.RedisHSetField(key, "LastSeenTime", lastSeenTime); err != nil {
+		return err
+	}
+	return common.RedisHSetField(key, "Ip", ip)
+}
+
+// cacheDeleteUserSessions 撤销会话后删除缓存，使会话在所有节点立即失效
+func cacheDeleteUserSessions(sessionIds []string) {
+	if !common.RedisEnabled {
+		return
+	}
+	for _, sessionId := range sessionIds {
+		if err := common.RedisDelKey(getUserSessionCacheKey(sessionId)); err != nil {
+			common.SysLog("failed to delete user session cache: " + err.Error())
+		}
+	}
+}
@@ -23,10 +23,14 @@ const (
 var batchUpdateStores []map[int]int
 var batchUpdateLocks []sync.Mutex
 
+// batchQuotaLedgerStores 用户额度与令牌额度的每次变动，落库时逐条写入台账，受对应类型的锁保护
+var batchQuotaLedgerStores []map[int][]quotaLedgerEntry
+
 func init() {
 	for i := 0; i < BatchUpdateTypeCount; i++ {
 		batchUpdateStores = append(batchUpdateStores, make(map[int]int))
 		batchUpdateLocks = append(batchUpdateLocks, sync.Mutex{})
+		batchQuotaLedgerStores = append(batchQuotaLedgerStores, make(map[int][]quotaLedgerEntry))
 	}
 }
 
@@ -49,6 +53,21 @@ func addNewRecord(type_ int, id int, value int) {
 	}
 }
 
+// addNewQuotaRecord 暂存一次额度变动及其台账关联信息
+func addNewQuotaRecord(type_ int, id int, value int, ref QuotaLedgerRef) {
+	batchUpdateLocks[type_].Lock()
+	defer batchUpdateLocks[type_].Unlock()
+	batchUpdateStores[type_][id] += value
+	batchQuotaLedgerStores[type_][id] = append(batchQuotaLedgerStores[type_][id], newQuotaLedgerEntry(value, ref))
+}
+
+// getPendingUsedQuota 本节点已累计但尚未落库的用户已用额度
+func getPendingUsedQuota(userId int) int {
+	batchUpdateLocks[BatchUpdateTypeUsedQuota].Lock()
+	defer batchUpdateLocks[BatchUpdateTypeUsedQuota].Unlock()
+	return batchUpdateStores[BatchUpdateTypeUsedQuota][userId]
+}
+
 func batchUpdate() {
 	// check if there's any data to update
 	hasData := false
@@ -71,17 +90,19 @@ func batchUpdate() {
 		batchUpdateLocks[i].Lock()
 		store := batchUpdateStores[i]
 		batchUpdateStores[i] = make(map[int]int)
+		ledgerStore := batchQuotaLedgerStores[i]
+		batchQuotaLedgerStores[i] = make(map[int][]quotaLedgerEntry)
 		batchUpdateLocks[i].Unlock()
 		// TODO: maybe we can combine updates with same key?
 		for key, value := range store {
 			switch i {
 			case BatchUpdateTypeUserQuota:
-				err := increaseUserQuota(key, value)
+				err := increaseUserQuotaEntries(key, ledgerStore[key])
 				if err != nil {
 					common.SysLog("failed to batch update user quota: " + err.Error())
 				}
 			case BatchUpdateTypeTokenQuota:
-				err := increaseTokenQuota(key, value)
+				err := increaseTokenQuotaEntries(key, ledgerStore[key])
 				if err != nil {
 					common.SysLog("failed to batch update token quota: " + err.Error())
 				}
@@ -116,6 +116,7 @@ type RelayInfo struct {
 	FinalPreConsumedQuota  int  // 最终预消耗的配额
 	IsClaudeBetaQuery      bool // /v1/messages?beta=true
 	IsChannelTest          bool // channel test request
+	RequestId              string
 
 	PriceData types.PriceData
 
@@ -401,7 +402,8 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 	// firstResponseTime = time.Now() - 1 second
 
 	info := &RelayInfo{
-		Request: request,
+		Request:   request,
+		RequestId: c.GetString(common.RequestIdKey),
 
 		UserId:     common.GetContextKeyInt(c, constant.ContextKeyUserId),
 		UsingGroup: common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
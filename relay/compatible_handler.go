@@ -240,6 +240,16 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 
 	modelName := relayInfo.OriginModelName
 
+	// 按实际提示词 token 数（含缓存）选择分档倍率
+	tierPromptTokens := promptTokens
+	if relayInfo.ChannelType == constant.ChannelTypeAnthropic {
+		tierPromptTokens += cacheTokens + cachedCreationTokens
+	}
+	priceTier := relayInfo.PriceData.ApplyPriceTier(tierPromptTokens)
+	if priceTier != nil {
+		extraContent = append(extraContent, fmt.Sprintf("提示词超过 %d tokens，使用分档倍率", priceTier.Threshold))
+	}
+
 	tokenName := ctx.GetString("token_name")
 	completionRatio := relayInfo.PriceData.CompletionRatio
 	cacheRatio := relayInfo.PriceData.CacheRatio
@@ -402,6 +412,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 
 	//var logContent string
 
+	upstreamCost := 0
 	// record all the consume log even if quota is 0
 	if totalTokens == 0 {
 		// in this case, must be some error happened
@@ -415,7 +426,8 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 			quota = 1
 		}
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
-		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+		upstreamCost = service.CalculateUpstreamCost(relayInfo, promptTokens, completionTokens)
+		service.UpdateChannelUsedQuota(relayInfo, quota, upstreamCost)
 	}
 
 	quotaDelta := quota - relayInfo.FinalPreConsumedQuota
@@ -457,6 +469,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 	if adminRejectReason != "" {
 		other["reject_reason"] = adminRejectReason
 	}
+	service.AppendPriceTierInfo(other, priceTier)
 	// For chat-based calls to the Claude model, tagging is required. Using Claude's rendering logs, the two approaches handle input rendering differently.
 	if isClaudeUsageSemantic {
 		other["claude"] = true
@@ -511,6 +524,7 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		ModelName:        logModel,
 		TokenName:        tokenName,
 		Quota:            quota,
+		UpstreamCost:     upstreamCost,
 		Content:          logContent,
 		TokenId:          relayInfo.TokenId,
 		UseTimeSeconds:   int(useTimeSeconds),
@@ -2,9 +2,11 @@ package helper
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
@@ -42,11 +44,33 @@ func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.
 		groupRatioInfo.GroupRatio = ratio_setting.GetGroupRatio(relayInfo.UsingGroup)
 	}
 
+	// 定时计费窗口（如夜间低峰折扣）直接乘入分组倍率，预扣费与结算使用同一倍率
+	if window, ok := ratio_setting.GetActivePricingWindow(relayInfo.OriginModelName, relayInfo.UsingGroup, time.Now()); ok {
+		groupRatioInfo.PricingWindow = window.Name
+		groupRatioInfo.PricingWindowRatio = window.Ratio
+		groupRatioInfo.GroupRatio *= window.Ratio
+		if groupRatioInfo.HasSpecialRatio {
+			groupRatioInfo.GroupSpecialRatio *= window.Ratio
+		}
+	}
+
 	return groupRatioInfo
 }
 
 func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens int, meta *types.TokenCountMeta) (types.PriceData, error) {
 	modelPrice, usePrice := ratio_setting.GetModelPrice(info.OriginModelName, false)
+	// 用户协商价格先于分组倍率解析，分组倍率仍然照常叠加
+	override := model.GetActivePriceOverride(info.UserId, info.TokenId, info.OriginModelName)
+	if override != nil {
+		if override.ModelPrice != nil {
+			modelPrice, usePrice = *override.ModelPrice, true
+		} else if override.ModelRatio != nil {
+			usePrice = false
+		} else if usePrice {
+			// 仅覆盖补全倍率时对按次计费的模型不生效
+			override = nil
+		}
+	}
 
 	groupRatioInfo := HandleGroupRatio(c, info)
 
@@ -60,6 +84,7 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 	var cacheCreationRatio1h float64
 	var audioRatio float64
 	var audioCompletionRatio float64
+	var priceTiers []types.PriceTier
 	var freeModel bool
 	if !usePrice {
 		preConsumedTokens := common.Max(promptTokens, common.PreConsumedQuota)
@@ -69,6 +94,9 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		var success bool
 		var matchName string
 		modelRatio, success, matchName = ratio_setting.GetModelRatio(info.OriginModelName)
+		if override != nil && override.ModelRatio != nil {
+			modelRatio, success = *override.ModelRatio, true
+		}
 		if !success {
 			acceptUnsetRatio := false
 			if info.UserSetting.AcceptUnsetRatioModel {
@@ -79,6 +107,9 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 			}
 		}
 		completionRatio = ratio_setting.GetCompletionRatio(info.OriginModelName)
+		if override != nil && override.CompletionRatio != nil {
+			completionRatio = *override.CompletionRatio
+		}
 		cacheRatio, _ = ratio_setting.GetCacheRatio(info.OriginModelName)
 		cacheCreationRatio, _ = ratio_setting.GetCreateCacheRatio(info.OriginModelName)
 		cacheCreationRatio5m = cacheCreationRatio
@@ -87,7 +118,15 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		imageRatio, _ = ratio_setting.GetImageRatio(info.OriginModelName)
 		audioRatio = ratio_setting.GetAudioRatio(info.OriginModelName)
 		audioCompletionRatio = ratio_setting.GetAudioCompletionRatio(info.OriginModelName)
-		ratio := modelRatio * groupRatioInfo.GroupRatio
+		// 预扣费按估算的提示词 token 数选择档位，结算时再按实际用量重新选择；协商价格不再分档
+		if override == nil {
+			priceTiers = ratio_setting.GetModelPriceTiers(info.OriginModelName)
+		}
+		preConsumedModelRatio := modelRatio
+		if tier := types.SelectPriceTier(priceTiers, promptTokens); tier != nil && tier.ModelRatio > 0 {
+			preConsumedModelRatio = tier.ModelRatio
+		}
+		ratio := preConsumedModelRatio * groupRatioInfo.GroupRatio
 		preConsumedQuota = int(float64(preConsumedTokens) * ratio)
 	} else {
 		if meta.ImagePriceRatio != 0 {
@@ -130,7 +169,12 @@ func ModelPriceHelper(c *gin.Context, info *relaycommon.RelayInfo, promptTokens
 		CacheCreation5mRatio: cacheCreationRatio5m,
 		CacheCreation1hRatio: cacheCreationRatio1h,
 		QuotaToPreConsume:    preConsumedQuota,
+		PriceTiers:           priceTiers,
 	}
+	if override != nil {
+		priceData.PriceOverrideId = override.Id
+	}
+	priceData.ApplyPriceTier(promptTokens)
 
 	if common.DebugEnabled {
 		println(fmt.Sprintf("model_price_helper result: %s", priceData.ToSetting()))
@@ -153,12 +197,21 @@ func ModelPriceHelperPerCall(c *gin.Context, info *relaycommon.RelayInfo) types.
 			modelPrice = defaultPrice
 		}
 	}
-	quota := int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
 	priceData := types.PerCallPriceData{
-		ModelPrice:     modelPrice,
-		Quota:          quota,
 		GroupRatioInfo: groupRatioInfo,
 	}
+	if override := model.GetActivePriceOverride(info.UserId, info.TokenId, info.OriginModelName); override != nil && override.ModelPrice != nil {
+		modelPrice = *override.ModelPrice
+		priceData.PriceOverrideId = override.Id
+	}
+	priceData.ModelPrice = modelPrice
+	priceData.Quota = int(modelPrice * common.QuotaPerUnit * groupRatioInfo.GroupRatio)
+	info.PriceData = types.PriceData{
+		ModelPrice:      modelPrice,
+		UsePrice:        true,
+		GroupRatioInfo:  groupRatioInfo,
+		PriceOverrideId: priceData.PriceOverrideId,
+	}
 	return priceData
 }
 
@@ -14,6 +14,7 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/bytedance/gopkg/util/gopool"
@@ -176,6 +177,69 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		})
 	}
 
+	// 输出敏感词检查与护栏规则需要先暂存上游数据块，检查通过后再交给 dataHandler
+	sensitive := service.NewSensitiveStream(c, info)
+	guardrail := service.NewGuardrailStream(c)
+
+	// handleChunks 依次交给 dataHandler 处理，返回 false 时停止读取
+	handleChunks := func(chunks []string) bool {
+		for _, chunk := range chunks {
+			// 使用超时机制防止写操作阻塞
+			done := make(chan bool, 1)
+			go func() {
+				writeMutex.Lock()
+				defer writeMutex.Unlock()
+				done <- dataHandler(chunk)
+			}()
+
+			select {
+			case success := <-done:
+				if !success {
+					return false
+				}
+			case <-time.After(10 * time.Second):
+				logger.LogError(c, "data handler timeout")
+				return false
+			case <-ctx.Done():
+				return false
+			case <-stopChan:
+				return false
+			}
+		}
+		return true
+	}
+
+	// releaseChunks 经过护栏检查后交给 dataHandler，final 为 true 时放行护栏暂存的全部数据块，返回 false 时停止读取
+	releaseChunks := func(chunks []string, final bool) bool {
+		if guardrail != nil {
+			ready := make([]string, 0, len(chunks))
+			for _, chunk := range chunks {
+				ready = append(ready, guardrail.Push(chunk)...)
+			}
+			if final {
+				ready = append(ready, guardrail.Flush()...)
+			}
+			chunks = ready
+		}
+		if !handleChunks(chunks) {
+			return false
+		}
+		if guardrail != nil && guardrail.Blocked {
+			writeGuardrailBlocked(c, &writeMutex, guardrail)
+			return false
+		}
+		return true
+	}
+
+	// flushPending 流结束时放行暂存的数据块
+	flushPending := func() {
+		var chunks []string
+		if sensitive != nil {
+			chunks = sensitive.Flush()
+		}
+		releaseChunks(chunks, true)
+	}
+
 	// Scanner goroutine with improved error handling
 	wg.Add(1)
 	common.RelayCtxGo(ctx, func() {
@@ -220,25 +284,14 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			if !strings.HasPrefix(data, "[DONE]") {
 				info.SetFirstResponseTime()
 
-				// 使用超时机制防止写操作阻塞
-				done := make(chan bool, 1)
-				go func() {
-					writeMutex.Lock()
-					defer writeMutex.Unlock()
-					done <- dataHandler(data)
-				}()
-
-				select {
-				case success := <-done:
-					if !success {
-						return
-					}
-				case <-time.After(10 * time.Second):
-					logger.LogError(c, "data handler timeout")
-					return
-				case <-ctx.Done():
-					return
-				case <-stopChan:
+				chunks := []string{data}
+				stopped := false
+				if sensitive != nil {
+					chunks = sensitive.Push(data)
+					stopped = sensitive.Stopped
+				}
+				// 命中敏感词终止输出时，结束数据块已在 chunks 中，不再读取上游
+				if !releaseChunks(chunks, stopped) || stopped {
 					return
 				}
 			} else {
@@ -246,6 +299,7 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 				if common.DebugEnabled {
 					println("received [DONE], stopping scanner")
 				}
+				flushPending()
 				return
 			}
 		}
@@ -255,6 +309,7 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 				logger.LogError(c, "scanner error: "+err.Error())
 			}
 		}
+		flushPending()
 	})
 
 	// 主循环等待完成或超时
@@ -270,3 +325,13 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 		logger.LogInfo(c, "client disconnected")
 	}
 }
+
+// writeGuardrailBlocked 流式输出被护栏拦截时，向客户端发送错误事件
+func writeGuardrailBlocked(c *gin.Context, writeMutex *sync.Mutex, guardrail *service.GuardrailStream) {
+	apiErr := service.NewGuardrailBlockedError(operation_setting.GuardrailStageOutput, guardrail.Result)
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+	if err := ObjectData(c, gin.H{"error": apiErr.ToOpenAIError()}); err != nil {
+		logger.LogError(c, "failed to write guardrail error: "+err.Error())
+	}
+}
@@ -18,6 +18,10 @@ import (
 
 func GetAndValidateRequest(c *gin.Context, format types.RelayFormat) (request dto.Request, err error) {
 	relayMode := relayconstant.Path2RelayMode(c.Request.URL.Path)
+	if relayMode == relayconstant.RelayModeUnknown {
+		// 如 /v1/estimate 由中间件指定实际包装的接口
+		relayMode = c.GetInt("relay_mode")
+	}
 
 	switch format {
 	case types.RelayFormatOpenAI:
@@ -219,18 +219,20 @@ func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyR
 			tokenName := c.GetString("token_name")
 			logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s", priceData.ModelPrice, priceData.GroupRatioInfo.GroupRatio, constant.MjActionSwapFace)
 			other := service.GenerateMjOtherInfo(info, priceData)
+			upstreamCost := service.CalculateUpstreamCost(info, 0, 0)
 			model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
-				ChannelId: info.ChannelId,
-				ModelName: modelName,
-				TokenName: tokenName,
-				Quota:     priceData.Quota,
-				Content:   logContent,
-				TokenId:   info.TokenId,
-				Group:     info.UsingGroup,
-				Other:     other,
+				ChannelId:    info.ChannelId,
+				ModelName:    modelName,
+				TokenName:    tokenName,
+				Quota:        priceData.Quota,
+				UpstreamCost: upstreamCost,
+				Content:      logContent,
+				TokenId:      info.TokenId,
+				Group:        info.UsingGroup,
+				Other:        other,
 			})
 			model.UpdateUserUsedQuotaAndRequestCount(info.UserId, priceData.Quota)
-			model.UpdateChannelUsedQuota(info.ChannelId, priceData.Quota)
+			service.UpdateChannelUsedQuota(info, priceData.Quota, upstreamCost)
 		}
 	}()
 	midjResponse := &mjResp.Response
@@ -519,18 +521,20 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 			tokenName := c.GetString("token_name")
 			logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s，ID %s", priceData.ModelPrice, priceData.GroupRatioInfo.GroupRatio, midjRequest.Action, midjResponse.Result)
 			other := service.GenerateMjOtherInfo(relayInfo, priceData)
+			upstreamCost := service.CalculateUpstreamCost(relayInfo, 0, 0)
 			model.RecordConsumeLog(c, relayInfo.UserId, model.RecordConsumeLogParams{
-				ChannelId: relayInfo.ChannelId,
-				ModelName: modelName,
-				TokenName: tokenName,
-				Quota:     priceData.Quota,
-				Content:   logContent,
-				TokenId:   relayInfo.TokenId,
-				Group:     relayInfo.UsingGroup,
-				Other:     other,
+				ChannelId:    relayInfo.ChannelId,
+				ModelName:    modelName,
+				TokenName:    tokenName,
+				Quota:        priceData.Quota,
+				UpstreamCost: upstreamCost,
+				Content:      logContent,
+				TokenId:      relayInfo.TokenId,
+				Group:        relayInfo.UsingGroup,
+				Other:        other,
 			})
 			model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, priceData.Quota)
-			model.UpdateChannelUsedQuota(relayInfo.ChannelId, priceData.Quota)
+			service.UpdateChannelUsedQuota(relayInfo, priceData.Quota, upstreamCost)
 		}
 	}()
 
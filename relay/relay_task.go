@@ -177,6 +177,9 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 			}
 		}
 	}
+	// 记录计费参数，结算时据此计算上游成本
+	info.PriceData.UsePrice = true
+	info.PriceData.ModelPrice = modelPrice
 	println(fmt.Sprintf("model: %s, model_price: %.4f, group: %s, group_ratio: %.4f, final_ratio: %.4f", modelName, modelPrice, info.UsingGroup, groupRatio, ratio))
 	userQuota, err := model.GetUserQuota(info.UserId, false)
 	if err != nil {
@@ -248,18 +251,20 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 				if hasUserGroupRatio {
 					other["user_group_ratio"] = userGroupRatio
 				}
+				upstreamCost := service.CalculateUpstreamCost(info, 0, 0)
 				model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
-					ChannelId: info.ChannelId,
-					ModelName: modelName,
-					TokenName: tokenName,
-					Quota:     quota,
-					Content:   logContent,
-					TokenId:   info.TokenId,
-					Group:     info.UsingGroup,
-					Other:     other,
+					ChannelId:    info.ChannelId,
+					ModelName:    modelName,
+					TokenName:    tokenName,
+					Quota:        quota,
+					UpstreamCost: upstreamCost,
+					Content:      logContent,
+					TokenId:      info.TokenId,
+					Group:        info.UsingGroup,
+					Other:        other,
 				})
 				model.UpdateUserUsedQuotaAndRequestCount(info.UserId, quota)
-				model.UpdateChannelUsedQuota(info.ChannelId, quota)
+				service.UpdateChannelUsedQuota(info, quota, upstreamCost)
 			}
 		}
 	}()
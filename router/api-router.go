@@ -1,6 +1,7 @@
 package router
 
 import (
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/controller"
 	"github.com/QuantumNous/new-api/middleware"
 
@@ -12,13 +13,17 @@ func SetApiRouter(router *gin.Engine) {
 	apiRouter := router.Group("/api")
 	apiRouter.Use(gzip.Gzip(gzip.DefaultCompression))
 	apiRouter.Use(middleware.GlobalAPIRateLimit())
+	apiRouter.Use(middleware.UserSessionCheck())
 	{
 		apiRouter.GET("/setup", controller.GetSetup)
 		apiRouter.POST("/setup", controller.PostSetup)
 		apiRouter.GET("/status", controller.GetStatus)
 		apiRouter.GET("/uptime/status", controller.GetUptimeKumaStatus)
+		apiRouter.GET("/status_page", middleware.StatusPageRateLimit(), controller.GetStatusPage)
+		apiRouter.GET("/status_page/rss", middleware.StatusPageRateLimit(), controller.GetStatusPageRSS)
+		apiRouter.GET("/status_page/atom", middleware.StatusPageRateLimit(), controller.GetStatusPageAtom)
 		apiRouter.GET("/models", middleware.UserAuth(), controller.DashboardListModels)
-		apiRouter.GET("/status/test", middleware.AdminAuth(), controller.TestStatus)
+		apiRouter.GET("/status/test", middleware.PermissionAuth(common.PermissionSystemStatus), controller.TestStatus)
 		apiRouter.GET("/notice", controller.GetNotice)
 		apiRouter.GET("/user-agreement", controller.GetUserAgreement)
 		apiRouter.GET("/privacy-policy", controller.GetPrivacyPolicy)
@@ -69,6 +74,12 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.PUT("/self", controller.UpdateSelf)
 				selfRoute.DELETE("/self", controller.DeleteSelf)
 				selfRoute.GET("/token", controller.GenerateAccessToken)
+				selfRoute.GET("/sessions", controller.GetSelfSessions)
+				selfRoute.DELETE("/sessions", controller.RevokeOtherSelfSessions)
+				selfRoute.DELETE("/sessions/:id", controller.RevokeSelfSession)
+				selfRoute.GET("/access_tokens", controller.GetSelfAccessTokens)
+				selfRoute.POST("/access_tokens", controller.CreateSelfAccessToken)
+				selfRoute.DELETE("/access_tokens/:id", controller.DeleteSelfAccessToken)
 				selfRoute.GET("/passkey", controller.PasskeyStatus)
 				selfRoute.POST("/passkey/register/begin", controller.PasskeyRegisterBegin)
 				selfRoute.POST("/passkey/register/finish", controller.PasskeyRegisterFinish)
@@ -100,78 +111,103 @@ func SetApiRouter(router *gin.Engine) {
 			}
 
 			adminRoute := userRoute.Group("/")
-			adminRoute.Use(middleware.AdminAuth())
 			{
-				adminRoute.GET("/", controller.GetAllUsers)
-				adminRoute.GET("/topup", controller.GetAllTopUps)
-				adminRoute.POST("/topup/complete", controller.AdminCompleteTopUp)
-				adminRoute.GET("/search", controller.SearchUsers)
-				adminRoute.GET("/:id", controller.GetUser)
-				adminRoute.POST("/", controller.CreateUser)
-				adminRoute.POST("/manage", controller.ManageUser)
-				adminRoute.PUT("/", controller.UpdateUser)
-				adminRoute.DELETE("/:id", controller.DeleteUser)
-				adminRoute.DELETE("/:id/reset_passkey", controller.AdminResetPasskey)
+				adminRoute.GET("/", middleware.PermissionAuth(common.PermissionUsersRead), controller.GetAllUsers)
+				adminRoute.GET("/topup", middleware.PermissionAuth(common.PermissionTopUpsRead), controller.GetAllTopUps)
+				adminRoute.POST("/topup/complete", middleware.PermissionAuth(common.PermissionTopUpsWrite), controller.AdminCompleteTopUp)
+				adminRoute.POST("/topup/refund", middleware.PermissionAuth(common.PermissionTopUpsWrite), middleware.CriticalRateLimit(), controller.AdminRefundTopUp)
+				adminRoute.POST("/topup/reconcile", middleware.PermissionAuth(common.PermissionTopUpsWrite), controller.AdminReconcileTopUps)
+				adminRoute.GET("/topup/transactions", middleware.PermissionAuth(common.PermissionTopUpsRead), controller.GetPaymentTransactions)
+				adminRoute.GET("/search", middleware.PermissionAuth(common.PermissionUsersRead), controller.SearchUsers)
+				adminRoute.GET("/:id", middleware.PermissionAuth(common.PermissionUsersRead), controller.GetUser)
+				adminRoute.POST("/", middleware.PermissionAuth(common.PermissionUsersWrite), controller.CreateUser)
+				adminRoute.POST("/manage", middleware.PermissionAuth(common.PermissionUsersWrite), controller.ManageUser)
+				adminRoute.PUT("/", middleware.PermissionAuth(common.PermissionUsersWrite), controller.UpdateUser)
+				adminRoute.PUT("/:id/quota", middleware.PermissionAuth(common.PermissionUsersQuota), controller.UpdateUserQuota)
+				adminRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionUsersWrite), controller.DeleteUser)
+				adminRoute.DELETE("/:id/reset_passkey", middleware.PermissionAuth(common.PermissionUsersWrite), controller.AdminResetPasskey)
+				adminRoute.GET("/:id/sessions", middleware.PermissionAuth(common.PermissionUsersRead), controller.GetUserSessions)
+				adminRoute.DELETE("/:id/sessions", middleware.PermissionAuth(common.PermissionUsersWrite), controller.RevokeUserSession)
+				adminRoute.DELETE("/:id/sessions/:session_id", middleware.PermissionAuth(common.PermissionUsersWrite), controller.RevokeUserSession)
+				adminRoute.GET("/:id/access_tokens", middleware.PermissionAuth(common.PermissionUsersRead), controller.GetUserAccessTokens)
+				adminRoute.DELETE("/:id/access_tokens/:token_id", middleware.PermissionAuth(common.PermissionUsersWrite), controller.RevokeUserAccessToken)
 
 				// Admin 2FA routes
-				adminRoute.GET("/2fa/stats", controller.Admin2FAStats)
-				adminRoute.DELETE("/:id/2fa", controller.AdminDisable2FA)
+				adminRoute.GET("/2fa/stats", middleware.PermissionAuth(common.PermissionUsersRead), controller.Admin2FAStats)
+				adminRoute.DELETE("/:id/2fa", middleware.PermissionAuth(common.PermissionUsersWrite), controller.AdminDisable2FA)
 			}
 		}
+		roleRoute := apiRouter.Group("/role")
+		{
+			roleRoute.GET("/", middleware.PermissionAuth(common.PermissionRolesRead), controller.GetRoles)
+			roleRoute.GET("/permissions", middleware.PermissionAuth(common.PermissionRolesRead), controller.GetPermissions)
+			roleRoute.POST("/", middleware.PermissionAuth(common.PermissionRolesWrite), controller.AddRole)
+			roleRoute.PUT("/", middleware.PermissionAuth(common.PermissionRolesWrite), controller.UpdateRole)
+			roleRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionRolesWrite), controller.DeleteRole)
+			roleRoute.POST("/assign", middleware.PermissionAuth(common.PermissionRolesWrite), controller.AssignRole)
+		}
+		apiRouter.GET("/audit", middleware.PermissionAuth(common.PermissionAuditRead), controller.GetAuditLogs)
 		optionRoute := apiRouter.Group("/option")
-		optionRoute.Use(middleware.RootAuth())
 		{
-			optionRoute.GET("/", controller.GetOptions)
-			optionRoute.PUT("/", controller.UpdateOption)
-			optionRoute.GET("/channel_affinity_cache", controller.GetChannelAffinityCacheStats)
-			optionRoute.DELETE("/channel_affinity_cache", controller.ClearChannelAffinityCache)
-			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
-			optionRoute.POST("/migrate_console_setting", controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
+			optionRoute.GET("/", middleware.AnyPermissionAuth(common.PermissionOptionsWrite, common.PermissionPricingRead), controller.GetOptions)
+			optionRoute.PUT("/", middleware.AnyPermissionAuth(common.PermissionOptionsWrite, common.PermissionPricingWrite), controller.UpdateOption)
+			optionRoute.GET("/channel_affinity_cache", middleware.PermissionAuth(common.PermissionOptionsWrite), controller.GetChannelAffinityCacheStats)
+			optionRoute.DELETE("/channel_affinity_cache", middleware.PermissionAuth(common.PermissionOptionsWrite), controller.ClearChannelAffinityCache)
+			optionRoute.POST("/rest_model_ratio", middleware.PermissionAuth(common.PermissionPricingWrite), controller.ResetModelRatio)
+			optionRoute.POST("/migrate_console_setting", middleware.PermissionAuth(common.PermissionOptionsWrite), controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
 		}
 		ratioSyncRoute := apiRouter.Group("/ratio_sync")
-		ratioSyncRoute.Use(middleware.RootAuth())
 		{
-			ratioSyncRoute.GET("/channels", controller.GetSyncableChannels)
-			ratioSyncRoute.POST("/fetch", controller.FetchUpstreamRatios)
+			ratioSyncRoute.GET("/channels", middleware.PermissionAuth(common.PermissionOptionsWrite), controller.GetSyncableChannels)
+			ratioSyncRoute.POST("/fetch", middleware.PermissionAuth(common.PermissionOptionsWrite), controller.FetchUpstreamRatios)
 		}
 		channelRoute := apiRouter.Group("/channel")
-		channelRoute.Use(middleware.AdminAuth())
 		{
-			channelRoute.GET("/", controller.GetAllChannels)
-			channelRoute.GET("/search", controller.SearchChannels)
-			channelRoute.GET("/models", controller.ChannelListModels)
-			channelRoute.GET("/models_enabled", controller.EnabledListModels)
-			channelRoute.GET("/:id", controller.GetChannel)
-			channelRoute.POST("/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
-			channelRoute.GET("/test", controller.TestAllChannels)
-			channelRoute.GET("/test/:id", controller.TestChannel)
-			channelRoute.GET("/update_balance", controller.UpdateAllChannelsBalance)
-			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
-			channelRoute.POST("/", controller.AddChannel)
-			channelRoute.PUT("/", controller.UpdateChannel)
-			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
-			channelRoute.POST("/tag/disabled", controller.DisableTagChannels)
-			channelRoute.POST("/tag/enabled", controller.EnableTagChannels)
-			channelRoute.PUT("/tag", controller.EditTagChannels)
-			channelRoute.DELETE("/:id", controller.DeleteChannel)
-			channelRoute.POST("/batch", controller.DeleteChannelBatch)
-			channelRoute.POST("/fix", controller.FixChannelsAbilities)
-			channelRoute.GET("/fetch_models/:id", controller.FetchUpstreamModels)
-			channelRoute.POST("/fetch_models", controller.FetchModels)
-			channelRoute.POST("/codex/oauth/start", controller.StartCodexOAuth)
-			channelRoute.POST("/codex/oauth/complete", controller.CompleteCodexOAuth)
-			channelRoute.POST("/:id/codex/oauth/start", controller.StartCodexOAuthForChannel)
-			channelRoute.POST("/:id/codex/oauth/complete", controller.CompleteCodexOAuthForChannel)
-			channelRoute.POST("/:id/codex/refresh", controller.RefreshCodexChannelCredential)
-			channelRoute.GET("/:id/codex/usage", controller.GetCodexChannelUsage)
-			channelRoute.POST("/ollama/pull", controller.OllamaPullModel)
-			channelRoute.POST("/ollama/pull/stream", controller.OllamaPullModelStream)
-			channelRoute.DELETE("/ollama/delete", controller.OllamaDeleteModel)
-			channelRoute.GET("/ollama/version/:id", controller.OllamaVersion)
-			channelRoute.POST("/batch/tag", controller.BatchSetChannelTag)
-			channelRoute.GET("/tag/models", controller.GetTagModels)
-			channelRoute.POST("/copy/:id", controller.CopyChannel)
-			channelRoute.POST("/multi_key/manage", controller.ManageMultiKeys)
+			channelRoute.GET("/", middleware.PermissionAuth(common.PermissionChannelsRead), controller.GetAllChannels)
+			channelRoute.GET("/search", middleware.PermissionAuth(common.PermissionChannelsRead), controller.SearchChannels)
+			channelRoute.GET("/models", middleware.PermissionAuth(common.PermissionChannelsRead), controller.ChannelListModels)
+			channelRoute.GET("/models_enabled", middleware.PermissionAuth(common.PermissionChannelsRead), controller.EnabledListModels)
+			channelRoute.GET("/health", middleware.PermissionAuth(common.PermissionChannelsRead), controller.GetChannelsHealth)
+			channelRoute.GET("/margin", middleware.PermissionAuth(common.PermissionChannelsRead), controller.GetChannelMargins)
+			channelRoute.GET("/:id", middleware.PermissionAuth(common.PermissionChannelsRead), controller.GetChannel)
+			channelRoute.POST("/:id/key", middleware.PermissionAuth(common.PermissionChannelsKeys), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
+			channelRoute.GET("/test", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.TestAllChannels)
+			channelRoute.GET("/test/:id", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.TestChannel)
+			channelRoute.GET("/update_balance", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.UpdateAllChannelsBalance)
+			channelRoute.GET("/update_balance/:id", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.UpdateChannelBalance)
+			channelRoute.POST("/", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.AddChannel)
+			channelRoute.PUT("/", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.UpdateChannel)
+			channelRoute.DELETE("/disabled", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.DeleteDisabledChannel)
+			channelRoute.POST("/tag/disabled", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.DisableTagChannels)
+			channelRoute.POST("/tag/enabled", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.EnableTagChannels)
+			channelRoute.PUT("/tag", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.EditTagChannels)
+			channelRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.DeleteChannel)
+			channelRoute.POST("/batch", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.DeleteChannelBatch)
+			channelRoute.POST("/fix", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.FixChannelsAbilities)
+			channelRoute.GET("/fetch_models/:id", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.FetchUpstreamModels)
+			channelRoute.POST("/fetch_models", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.FetchModels)
+			channelRoute.POST("/codex/oauth/start", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.StartCodexOAuth)
+			channelRoute.POST("/codex/oauth/complete", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.CompleteCodexOAuth)
+			channelRoute.POST("/:id/codex/oauth/start", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.StartCodexOAuthForChannel)
+			channelRoute.POST("/:id/codex/oauth/complete", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.CompleteCodexOAuthForChannel)
+			channelRoute.POST("/:id/codex/refresh", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.RefreshCodexChannelCredential)
+			channelRoute.GET("/:id/codex/usage", middleware.PermissionAuth(common.PermissionChannelsRead), controller.GetCodexChannelUsage)
+			channelRoute.GET("/:id/health", middleware.PermissionAuth(common.PermissionChannelsRead), controller.GetChannelHealth)
+			channelRoute.GET("/:id/model_tests", middleware.PermissionAuth(common.PermissionChannelsRead), controller.GetChannelModelTests)
+			channelRoute.POST("/:id/model_status", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.UpdateChannelModelStatus)
+			channelRoute.GET("/test_plan", middleware.PermissionAuth(common.PermissionChannelsRead), controller.GetChannelTestPlans)
+			channelRoute.POST("/test_plan", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.AddChannelTestPlan)
+			channelRoute.PUT("/test_plan", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.UpdateChannelTestPlan)
+			channelRoute.DELETE("/test_plan/:id", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.DeleteChannelTestPlan)
+			channelRoute.POST("/test_plan/:id/run", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.RunChannelTestPlan)
+			channelRoute.POST("/ollama/pull", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.OllamaPullModel)
+			channelRoute.POST("/ollama/pull/stream", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.OllamaPullModelStream)
+			channelRoute.DELETE("/ollama/delete", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.OllamaDeleteModel)
+			channelRoute.GET("/ollama/version/:id", middleware.PermissionAuth(common.PermissionChannelsRead), controller.OllamaVersion)
+			channelRoute.POST("/batch/tag", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.BatchSetChannelTag)
+			channelRoute.GET("/tag/models", middleware.PermissionAuth(common.PermissionChannelsRead), controller.GetTagModels)
+			channelRoute.POST("/copy/:id", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.CopyChannel)
+			channelRoute.POST("/multi_key/manage", middleware.PermissionAuth(common.PermissionChannelsWrite), controller.ManageMultiKeys)
 		}
 		tokenRoute := apiRouter.Group("/token")
 		tokenRoute.Use(middleware.UserAuth())
@@ -182,6 +218,8 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
+			tokenRoute.POST("/:id/signature", controller.EnableTokenSignature)
+			tokenRoute.DELETE("/:id/signature", controller.DisableTokenSignature)
 			tokenRoute.POST("/batch", controller.DeleteTokenBatch)
 		}
 
@@ -196,27 +234,60 @@ func SetApiRouter(router *gin.Engine) {
 		}
 
 		redemptionRoute := apiRouter.Group("/redemption")
-		redemptionRoute.Use(middleware.AdminAuth())
 		{
-			redemptionRoute.GET("/", controller.GetAllRedemptions)
-			redemptionRoute.GET("/search", controller.SearchRedemptions)
-			redemptionRoute.GET("/:id", controller.GetRedemption)
-			redemptionRoute.POST("/", controller.AddRedemption)
-			redemptionRoute.PUT("/", controller.UpdateRedemption)
-			redemptionRoute.DELETE("/invalid", controller.DeleteInvalidRedemption)
-			redemptionRoute.DELETE("/:id", controller.DeleteRedemption)
+			redemptionRoute.GET("/", middleware.PermissionAuth(common.PermissionRedemptionsRead), controller.GetAllRedemptions)
+			redemptionRoute.GET("/search", middleware.PermissionAuth(common.PermissionRedemptionsRead), controller.SearchRedemptions)
+			redemptionRoute.GET("/:id", middleware.PermissionAuth(common.PermissionRedemptionsRead), controller.GetRedemption)
+			redemptionRoute.POST("/", middleware.PermissionAuth(common.PermissionRedemptionsWrite), controller.AddRedemption)
+			redemptionRoute.PUT("/", middleware.PermissionAuth(common.PermissionRedemptionsWrite), controller.UpdateRedemption)
+			redemptionRoute.DELETE("/invalid", middleware.PermissionAuth(common.PermissionRedemptionsWrite), controller.DeleteInvalidRedemption)
+			redemptionRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionRedemptionsWrite), controller.DeleteRedemption)
 		}
 		logRoute := apiRouter.Group("/log")
-		logRoute.GET("/", middleware.AdminAuth(), controller.GetAllLogs)
-		logRoute.DELETE("/", middleware.AdminAuth(), controller.DeleteHistoryLogs)
-		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
+		logRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllLogs)
+		logRoute.DELETE("/", middleware.PermissionAuth(common.PermissionLogsWrite), controller.DeleteHistoryLogs)
+		logRoute.GET("/stat", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
-		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/tag/stat", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetLogsTagStat)
+		logRoute.GET("/self/tag/stat", middleware.UserAuth(), controller.GetLogsSelfTagStat)
+		logRoute.GET("/search", middleware.PermissionAuth(common.PermissionLogsRead), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
 
+		priceOverrideRoute := apiRouter.Group("/price_override")
+		priceOverrideRoute.GET("/self", middleware.UserAuth(), controller.GetSelfPriceOverrides)
+		priceOverrideRoute.GET("/", middleware.PermissionAuth(common.PermissionPricingRead), controller.GetPriceOverrides)
+		priceOverrideRoute.POST("/", middleware.PermissionAuth(common.PermissionPricingWrite), controller.AddPriceOverride)
+		priceOverrideRoute.PUT("/", middleware.PermissionAuth(common.PermissionPricingWrite), controller.UpdatePriceOverride)
+		priceOverrideRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionPricingWrite), controller.DeletePriceOverride)
+
+		subscriptionRoute := apiRouter.Group("/subscription")
+		subscriptionRoute.GET("/plans", middleware.UserAuth(), controller.GetSubscriptionPlans)
+		subscriptionRoute.GET("/self", middleware.UserAuth(), controller.GetSelfSubscriptions)
+		subscriptionRoute.POST("/pay", middleware.UserAuth(), middleware.CriticalRateLimit(), controller.RequestSubscriptionPay)
+		subscriptionRoute.POST("/self/cancel", middleware.UserAuth(), controller.CancelSelfSubscription)
+		subscriptionRoute.GET("/", middleware.PermissionAuth(common.PermissionSubscriptionsRead), controller.GetAllUserSubscriptions)
+		subscriptionRoute.GET("/plan", middleware.PermissionAuth(common.PermissionSubscriptionsRead), controller.GetAllSubscriptionPlans)
+		subscriptionRoute.POST("/plan", middleware.PermissionAuth(common.PermissionSubscriptionsWrite), controller.AddSubscriptionPlan)
+		subscriptionRoute.PUT("/plan", middleware.PermissionAuth(common.PermissionSubscriptionsWrite), controller.UpdateSubscriptionPlan)
+		subscriptionRoute.DELETE("/plan/:id", middleware.PermissionAuth(common.PermissionSubscriptionsWrite), controller.DeleteSubscriptionPlan)
+
+		statementRoute := apiRouter.Group("/statement")
+		statementRoute.GET("/self", middleware.UserAuth(), controller.GetSelfStatements)
+		statementRoute.GET("/self/:id", middleware.UserAuth(), controller.GetSelfStatement)
+		statementRoute.GET("/", middleware.PermissionAuth(common.PermissionStatementsRead), controller.GetAllStatements)
+		statementRoute.GET("/:id", middleware.PermissionAuth(common.PermissionStatementsRead), controller.GetStatement)
+		statementRoute.POST("/generate", middleware.PermissionAuth(common.PermissionStatementsWrite), controller.GenerateStatements)
+
+		ledgerRoute := apiRouter.Group("/ledger")
+		ledgerRoute.GET("/", middleware.PermissionAuth(common.PermissionLedgerRead), controller.GetQuotaLedgers)
+		ledgerRoute.GET("/self", middleware.UserAuth(), controller.GetSelfQuotaLedgers)
+		ledgerRoute.GET("/drift", middleware.PermissionAuth(common.PermissionLedgerRead), controller.GetQuotaLedgerDrifts)
+		ledgerRoute.POST("/reconcile", middleware.PermissionAuth(common.PermissionLedgerWrite), controller.ReconcileQuotaLedger)
+		ledgerRoute.POST("/drift/:id/resolve", middleware.PermissionAuth(common.PermissionLedgerWrite), controller.ResolveQuotaLedgerDrift)
+
 		dataRoute := apiRouter.Group("/data")
-		dataRoute.GET("/", middleware.AdminAuth(), controller.GetAllQuotaDates)
+		dataRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllQuotaDates)
 		dataRoute.GET("/self", middleware.UserAuth(), controller.GetUserQuotaDates)
 
 		logRoute.Use(middleware.CORS())
@@ -224,79 +295,81 @@ func SetApiRouter(router *gin.Engine) {
 			logRoute.GET("/token", controller.GetLogByKey)
 		}
 		groupRoute := apiRouter.Group("/group")
-		groupRoute.Use(middleware.AdminAuth())
 		{
-			groupRoute.GET("/", controller.GetGroups)
+			groupRoute.GET("/", middleware.PermissionAuth(common.PermissionGroupsRead), controller.GetGroups)
 		}
 
 		prefillGroupRoute := apiRouter.Group("/prefill_group")
-		prefillGroupRoute.Use(middleware.AdminAuth())
 		{
-			prefillGroupRoute.GET("/", controller.GetPrefillGroups)
-			prefillGroupRoute.POST("/", controller.CreatePrefillGroup)
-			prefillGroupRoute.PUT("/", controller.UpdatePrefillGroup)
-			prefillGroupRoute.DELETE("/:id", controller.DeletePrefillGroup)
+			prefillGroupRoute.GET("/", middleware.PermissionAuth(common.PermissionGroupsRead), controller.GetPrefillGroups)
+			prefillGroupRoute.POST("/", middleware.PermissionAuth(common.PermissionGroupsWrite), controller.CreatePrefillGroup)
+			prefillGroupRoute.PUT("/", middleware.PermissionAuth(common.PermissionGroupsWrite), controller.UpdatePrefillGroup)
+			prefillGroupRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionGroupsWrite), controller.DeletePrefillGroup)
 		}
 
 		mjRoute := apiRouter.Group("/mj")
 		mjRoute.GET("/self", middleware.UserAuth(), controller.GetUserMidjourney)
-		mjRoute.GET("/", middleware.AdminAuth(), controller.GetAllMidjourney)
+		mjRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllMidjourney)
 
 		taskRoute := apiRouter.Group("/task")
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
-			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+			taskRoute.GET("/", middleware.PermissionAuth(common.PermissionLogsRead), controller.GetAllTask)
+		}
+
+		jobRoute := apiRouter.Group("/job")
+		jobRoute.Use(middleware.UserAuth())
+		{
+			jobRoute.GET("/self", controller.ListJobs)
+			jobRoute.GET("/self/:id", controller.GetJob)
 		}
 
 		vendorRoute := apiRouter.Group("/vendors")
-		vendorRoute.Use(middleware.AdminAuth())
 		{
-			vendorRoute.GET("/", controller.GetAllVendors)
-			vendorRoute.GET("/search", controller.SearchVendors)
-			vendorRoute.GET("/:id", controller.GetVendorMeta)
-			vendorRoute.POST("/", controller.CreateVendorMeta)
-			vendorRoute.PUT("/", controller.UpdateVendorMeta)
-			vendorRoute.DELETE("/:id", controller.DeleteVendorMeta)
+			vendorRoute.GET("/", middleware.PermissionAuth(common.PermissionModelsRead), controller.GetAllVendors)
+			vendorRoute.GET("/search", middleware.PermissionAuth(common.PermissionModelsRead), controller.SearchVendors)
+			vendorRoute.GET("/:id", middleware.PermissionAuth(common.PermissionModelsRead), controller.GetVendorMeta)
+			vendorRoute.POST("/", middleware.PermissionAuth(common.PermissionModelsWrite), controller.CreateVendorMeta)
+			vendorRoute.PUT("/", middleware.PermissionAuth(common.PermissionModelsWrite), controller.UpdateVendorMeta)
+			vendorRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionModelsWrite), controller.DeleteVendorMeta)
 		}
 
 		modelsRoute := apiRouter.Group("/models")
-		modelsRoute.Use(middleware.AdminAuth())
 		{
-			modelsRoute.GET("/sync_upstream/preview", controller.SyncUpstreamPreview)
-			modelsRoute.POST("/sync_upstream", controller.SyncUpstreamModels)
-			modelsRoute.GET("/missing", controller.GetMissingModels)
-			modelsRoute.GET("/", controller.GetAllModelsMeta)
-			modelsRoute.GET("/search", controller.SearchModelsMeta)
-			modelsRoute.GET("/:id", controller.GetModelMeta)
-			modelsRoute.POST("/", controller.CreateModelMeta)
-			modelsRoute.PUT("/", controller.UpdateModelMeta)
-			modelsRoute.DELETE("/:id", controller.DeleteModelMeta)
+			modelsRoute.GET("/sync_upstream/preview", middleware.PermissionAuth(common.PermissionModelsRead), controller.SyncUpstreamPreview)
+			modelsRoute.POST("/sync_upstream", middleware.PermissionAuth(common.PermissionModelsWrite), controller.SyncUpstreamModels)
+			modelsRoute.GET("/missing", middleware.PermissionAuth(common.PermissionModelsRead), controller.GetMissingModels)
+			modelsRoute.GET("/", middleware.PermissionAuth(common.PermissionModelsRead), controller.GetAllModelsMeta)
+			modelsRoute.GET("/search", middleware.PermissionAuth(common.PermissionModelsRead), controller.SearchModelsMeta)
+			modelsRoute.GET("/:id", middleware.PermissionAuth(common.PermissionModelsRead), controller.GetModelMeta)
+			modelsRoute.POST("/", middleware.PermissionAuth(common.PermissionModelsWrite), controller.CreateModelMeta)
+			modelsRoute.PUT("/", middleware.PermissionAuth(common.PermissionModelsWrite), controller.UpdateModelMeta)
+			modelsRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionModelsWrite), controller.DeleteModelMeta)
 		}
 
 		// Deployments (model deployment management)
 		deploymentsRoute := apiRouter.Group("/deployments")
-		deploymentsRoute.Use(middleware.AdminAuth())
 		{
-			deploymentsRoute.GET("/settings", controller.GetModelDeploymentSettings)
-			deploymentsRoute.POST("/settings/test-connection", controller.TestIoNetConnection)
-			deploymentsRoute.GET("/", controller.GetAllDeployments)
-			deploymentsRoute.GET("/search", controller.SearchDeployments)
-			deploymentsRoute.POST("/test-connection", controller.TestIoNetConnection)
-			deploymentsRoute.GET("/hardware-types", controller.GetHardwareTypes)
-			deploymentsRoute.GET("/locations", controller.GetLocations)
-			deploymentsRoute.GET("/available-replicas", controller.GetAvailableReplicas)
-			deploymentsRoute.POST("/price-estimation", controller.GetPriceEstimation)
-			deploymentsRoute.GET("/check-name", controller.CheckClusterNameAvailability)
-			deploymentsRoute.POST("/", controller.CreateDeployment)
+			deploymentsRoute.GET("/settings", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.GetModelDeploymentSettings)
+			deploymentsRoute.POST("/settings/test-connection", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.TestIoNetConnection)
+			deploymentsRoute.GET("/", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.GetAllDeployments)
+			deploymentsRoute.GET("/search", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.SearchDeployments)
+			deploymentsRoute.POST("/test-connection", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.TestIoNetConnection)
+			deploymentsRoute.GET("/hardware-types", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.GetHardwareTypes)
+			deploymentsRoute.GET("/locations", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.GetLocations)
+			deploymentsRoute.GET("/available-replicas", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.GetAvailableReplicas)
+			deploymentsRoute.POST("/price-estimation", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.GetPriceEstimation)
+			deploymentsRoute.GET("/check-name", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.CheckClusterNameAvailability)
+			deploymentsRoute.POST("/", middleware.PermissionAuth(common.PermissionDeploymentsWrite), controller.CreateDeployment)
 
-			deploymentsRoute.GET("/:id", controller.GetDeployment)
-			deploymentsRoute.GET("/:id/logs", controller.GetDeploymentLogs)
-			deploymentsRoute.GET("/:id/containers", controller.ListDeploymentContainers)
-			deploymentsRoute.GET("/:id/containers/:container_id", controller.GetContainerDetails)
-			deploymentsRoute.PUT("/:id", controller.UpdateDeployment)
-			deploymentsRoute.PUT("/:id/name", controller.UpdateDeploymentName)
-			deploymentsRoute.POST("/:id/extend", controller.ExtendDeployment)
-			deploymentsRoute.DELETE("/:id", controller.DeleteDeployment)
+			deploymentsRoute.GET("/:id", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.GetDeployment)
+			deploymentsRoute.GET("/:id/logs", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.GetDeploymentLogs)
+			deploymentsRoute.GET("/:id/containers", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.ListDeploymentContainers)
+			deploymentsRoute.GET("/:id/containers/:container_id", middleware.PermissionAuth(common.PermissionDeploymentsRead), controller.GetContainerDetails)
+			deploymentsRoute.PUT("/:id", middleware.PermissionAuth(common.PermissionDeploymentsWrite), controller.UpdateDeployment)
+			deploymentsRoute.PUT("/:id/name", middleware.PermissionAuth(common.PermissionDeploymentsWrite), controller.UpdateDeploymentName)
+			deploymentsRoute.POST("/:id/extend", middleware.PermissionAuth(common.PermissionDeploymentsWrite), controller.ExtendDeployment)
+			deploymentsRoute.DELETE("/:id", middleware.PermissionAuth(common.PermissionDeploymentsWrite), controller.DeleteDeployment)
 		}
 	}
 }
@@ -55,11 +55,25 @@ func SetRelayRouter(router *gin.Engine) {
 		})
 	}
 
+	// 统一异步任务查询（Midjourney、Suno、视频）
+	jobsRouter := router.Group("/v1/jobs")
+	jobsRouter.Use(middleware.TokenAuth())
+	{
+		jobsRouter.GET("", controller.ListJobs)
+		jobsRouter.GET("/:id", controller.GetJob)
+	}
+
 	playgroundRouter := router.Group("/pg")
 	playgroundRouter.Use(middleware.UserAuth(), middleware.Distribute())
 	{
 		playgroundRouter.POST("/chat/completions", controller.Playground)
 	}
+	// 费用估算，不请求上游也不扣费，不计入模型请求限流
+	estimateRouter := router.Group("/v1")
+	estimateRouter.Use(middleware.TokenAuth(), middleware.RelayEstimate(), middleware.Distribute())
+	{
+		estimateRouter.POST("/estimate", controller.EstimateRelay)
+	}
 	relayV1Router := router.Group("/v1")
 	relayV1Router.Use(middleware.TokenAuth())
 	relayV1Router.Use(middleware.ModelRequestRateLimit())
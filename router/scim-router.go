@@ -0,0 +1,31 @@
+package router
+
+import (
+	"github.com/QuantumNous/new-api/controller"
+	"github.com/QuantumNous/new-api/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetScimRouter SCIM 2.0 目录同步接口，供 IdP 管理用户生命周期与分组
+func SetScimRouter(router *gin.Engine) {
+	scimRouter := router.Group("/scim/v2")
+	scimRouter.Use(middleware.GlobalAPIRateLimit())
+	scimRouter.Use(middleware.SCIMAuth())
+	{
+		scimRouter.GET("/ServiceProviderConfig", controller.ScimServiceProviderConfig)
+
+		scimRouter.GET("/Users", controller.ScimListUsers)
+		scimRouter.POST("/Users", controller.ScimCreateUser)
+		scimRouter.GET("/Users/:id", controller.ScimGetUser)
+		scimRouter.PUT("/Users/:id", controller.ScimReplaceUser)
+		scimRouter.PATCH("/Users/:id", controller.ScimPatchUser)
+		scimRouter.DELETE("/Users/:id", controller.ScimDeleteUser)
+
+		scimRouter.GET("/Groups", controller.ScimListGroups)
+		scimRouter.POST("/Groups", controller.ScimCreateGroup)
+		scimRouter.GET("/Groups/:id", controller.ScimGetGroup)
+		scimRouter.PUT("/Groups/:id", controller.ScimReplaceGroup)
+		scimRouter.PATCH("/Groups/:id", controller.ScimPatchGroup)
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	auditLogCleanupInterval  = 6 * time.Hour
+	auditLogCleanupBatchSize = 1000
+)
+
+var (
+	auditLogCleanupOnce    sync.Once
+	auditLogCleanupRunning atomic.Bool
+)
+
+// StartAuditLogCleanupTask 按保留天数清理审计日志，仅在主节点运行
+func StartAuditLogCleanupTask() {
+	auditLogCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("audit log cleanup task started: tick=%s", auditLogCleanupInterval))
+
+			runAuditLogCleanupOnce()
+			ticker := time.NewTicker(auditLogCleanupInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				runAuditLogCleanupOnce()
+			}
+		})
+	})
+}
+
+func runAuditLogCleanupOnce() {
+	retentionDays := operation_setting.GetAuditSetting().RetentionDays
+	if retentionDays <= 0 {
+		return
+	}
+	if !auditLogCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer auditLogCleanupRunning.Store(false)
+
+	before := time.Now().AddDate(0, 0, -retentionDays).Unix()
+	count, err := model.DeleteOldAuditLogs(context.Background(), before, auditLogCleanupBatchSize)
+	if err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("audit log cleanup failed: %v", err))
+		return
+	}
+	if count > 0 {
+		common.SysLog(fmt.Sprintf("audit log: deleted %d logs older than %d days", count, retentionDays))
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 )
 
@@ -29,6 +31,7 @@ func DisableChannel(channelError types.ChannelError, reason string) {
 
 	success := model.UpdateChannelStatus(channelError.ChannelId, channelError.UsingKey, common.ChannelStatusAutoDisabled, reason)
 	if success {
+		model.RecordChannelStatusEvent(channelError.ChannelId, model.ChannelHealthEventDisable, reason)
 		subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channelError.ChannelName, channelError.ChannelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被禁用，原因：%s", channelError.ChannelName, channelError.ChannelId, reason)
 		NotifyRootUser(formatNotifyType(channelError.ChannelId, common.ChannelStatusAutoDisabled), subject, content)
@@ -38,12 +41,91 @@ func DisableChannel(channelError types.ChannelError, reason string) {
 func EnableChannel(channelId int, usingKey string, channelName string) {
 	success := model.UpdateChannelStatus(channelId, usingKey, common.ChannelStatusEnabled, "")
 	if success {
+		model.RecordChannelStatusEvent(channelId, model.ChannelHealthEventEnable, "")
 		subject := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 		NotifyRootUser(formatNotifyType(channelId, common.ChannelStatusEnabled), subject, content)
 	}
 }
 
+// CooldownMultiKeyIfRateLimited 多Key渠道的key被上游限流时，在重置时间之前跳过该key
+func CooldownMultiKeyIfRateLimited(channelError types.ChannelError, keyIndex int, err *types.NewAPIError) {
+	if !channelError.IsMultiKey || err == nil {
+		return
+	}
+	if err.StatusCode != http.StatusTooManyRequests && err.RetryAfter <= 0 {
+		return
+	}
+	cooldown := err.RetryAfter
+	if cooldown <= 0 {
+		channelInfo, infoErr := model.CacheGetChannelInfo(channelError.ChannelId)
+		if infoErr != nil {
+			return
+		}
+		cooldown = int64(channelInfo.GetRateLimitCooldown())
+	}
+	model.CooldownMultiKey(channelError.ChannelId, keyIndex, common.GetTimestamp()+cooldown)
+}
+
+// UpdateChannelUsedQuota 累计渠道已用额度（多Key渠道同时累计所用key的当日用量），并按小时记录计费额度与上游成本
+func UpdateChannelUsedQuota(relayInfo *relaycommon.RelayInfo, quota int, upstreamCost int) {
+	model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
+	if relayInfo.ChannelIsMultiKey {
+		model.UpdateMultiKeyUsedQuota(relayInfo.ChannelId, relayInfo.ChannelMultiKeyIndex, quota)
+	}
+	model.RecordChannelCost(relayInfo.ChannelId, relayInfo.OriginModelName, quota, upstreamCost)
+}
+
+func getChannelCostProfile(relayInfo *relaycommon.RelayInfo) *dto.ChannelCostProfile {
+	if relayInfo.ChannelMeta != nil {
+		return relayInfo.ChannelOtherSettings.CostProfile
+	}
+	channel, err := model.CacheGetChannel(relayInfo.ChannelId)
+	if err != nil {
+		return nil
+	}
+	return channel.GetOtherSettings().CostProfile
+}
+
+// CalculateUpstreamCost 按渠道成本与实际用量估算本次请求的上游成本（额度单位），未配置成本的渠道返回 0。
+// 成本只取决于用量与渠道成本价，与分组倍率、定时计费窗口及用户协商价格无关；按次计费模型按调用次数计算
+func CalculateUpstreamCost(relayInfo *relaycommon.RelayInfo, promptTokens int, completionTokens int) int {
+	if relayInfo.ChannelId == 0 {
+		return 0
+	}
+	profile := getChannelCostProfile(relayInfo)
+	if profile == nil {
+		return 0
+	}
+	modelName := relayInfo.OriginModelName
+	usePrice := relayInfo.PriceData.UsePrice
+	listUnit := model.GetModelListUnit(modelName, usePrice)
+	if listUnit <= 0 && usePrice {
+		// 系统未单独配置价格（如任务使用默认价格）时按本次计费使用的价格计算
+		listUnit = relayInfo.PriceData.ModelPrice
+	}
+	costUnit := profile.GetCostUnit(modelName, listUnit)
+	if costUnit <= 0 {
+		return 0
+	}
+	var cost float64
+	if usePrice {
+		cost = costUnit * common.QuotaPerUnit
+	} else {
+		if promptTokens+completionTokens <= 0 {
+			return 0
+		}
+		cost = (float64(promptTokens) + float64(completionTokens)*ratio_setting.GetCompletionRatio(modelName)) * costUnit
+	}
+	// 其他倍率（如视频时长、分辨率）属于用量，同样计入成本
+	if !common.StringsContains(constant.TaskPricePatches, modelName) {
+		for _, ra := range relayInfo.PriceData.OtherRatios {
+			cost *= ra
+		}
+	}
+	return int(cost)
+}
+
 func ShouldDisableChannel(channelType int, err *types.NewAPIError) bool {
 	if !common.AutomaticDisableChannelEnabled {
 		return false
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	channelHealthFlushInterval   = 1 * time.Minute
+	channelHealthCleanupInterval = 24 * time.Hour
+)
+
+var (
+	channelHealthTaskOnce    sync.Once
+	channelHealthTaskRunning atomic.Bool
+)
+
+// StartChannelHealthTask 定期将渠道流量与成本统计落库，并清理过期的健康数据。
+// 统计在每个节点内存中累计，因此所有节点都需要运行该任务，清理只在主节点进行。
+func StartChannelHealthTask() {
+	channelHealthTaskOnce.Do(func() {
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("channel health task started: tick=%s", channelHealthFlushInterval))
+
+			ticker := time.NewTicker(channelHealthFlushInterval)
+			defer ticker.Stop()
+
+			lastCleanup := time.Time{}
+			for range ticker.C {
+				runChannelHealthTaskOnce(&lastCleanup)
+			}
+		})
+	})
+}
+
+func runChannelHealthTaskOnce(lastCleanup *time.Time) {
+	if !channelHealthTaskRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer channelHealthTaskRunning.Store(false)
+
+	model.SaveChannelHealthStatCache()
+	model.SaveChannelCostStatCache()
+
+	if !common.IsMasterNode || time.Since(*lastCleanup) < channelHealthCleanupInterval {
+		return
+	}
+	*lastCleanup = time.Now()
+	before := time.Now().AddDate(0, 0, -model.ChannelHealthRetentionDays).Unix()
+	if err := model.DeleteChannelHealthBefore(before); err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("channel health cleanup failed: %v", err))
+	}
+}
+
+// RecordChannelTrafficResult 记录实际请求的结果，只统计能反映渠道健康度的错误
+func RecordChannelTrafficResult(channelId int, modelName string, err *types.NewAPIError) {
+	if channelId == 0 {
+		return
+	}
+	if err == nil {
+		model.RecordChannelTraffic(channelId, modelName, true)
+		return
+	}
+	if !isChannelHealthError(err) {
+		return
+	}
+	model.RecordChannelTraffic(channelId, modelName, false)
+}
+
+func isChannelHealthError(err *types.NewAPIError) bool {
+	if types.IsChannelError(err) {
+		return true
+	}
+	code := err.StatusCode
+	switch {
+	case code < 100 || code >= 500:
+		return true
+	case code == http.StatusUnauthorized, code == http.StatusForbidden,
+		code == http.StatusRequestTimeout, code == http.StatusTooManyRequests:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getDataResidencyPolicies 返回在分组 group 下选择渠道时需要同时满足的策略：令牌、用户分组与渠道分组
+func getDataResidencyPolicies(c *gin.Context, group string) []operation_setting.DataResidencyPolicy {
+	s := operation_setting.GetDataResidencySetting()
+	if !s.Enabled {
+		return nil
+	}
+	policies := make([]operation_setting.DataResidencyPolicy, 0, 3)
+	if tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId); tokenId > 0 {
+		if policy, ok := s.TokenPolicies[strconv.Itoa(tokenId)]; ok {
+			policies = append(policies, policy)
+		}
+	}
+	userGroup := common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+	if policy, ok := s.GroupPolicies[userGroup]; ok && userGroup != "" {
+		policies = append(policies, policy)
+	}
+	if policy, ok := s.GroupPolicies[group]; ok && group != "" && group != userGroup {
+		policies = append(policies, policy)
+	}
+	return policies
+}
+
+// GetChannelComplianceFilter 返回在分组 group 下选择渠道的数据驻留筛选条件，没有适用的策略时返回 nil
+func GetChannelComplianceFilter(c *gin.Context, group string) model.ChannelFilter {
+	policies := getDataResidencyPolicies(c, group)
+	if len(policies) == 0 {
+		return nil
+	}
+	return func(channel *model.Channel) bool {
+		settings := channel.GetSetting()
+		for _, policy := range policies {
+			if !dataResidencyPolicyAllows(policy, settings) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// IsChannelCompliant 渠道是否满足在分组 group 下的数据驻留策略，用于亲和性与指定渠道等不经过随机选择的场景
+func IsChannelCompliant(c *gin.Context, group string, channel *model.Channel) bool {
+	filter := GetChannelComplianceFilter(c, group)
+	return filter == nil || filter(channel)
+}
+
+func dataResidencyPolicyAllows(policy operation_setting.DataResidencyPolicy, settings dto.ChannelSettings) bool {
+	if policy.RequireNoRetention && !settings.NoRetention && !settings.ZeroDataRetention {
+		return false
+	}
+	if policy.RequireZeroDataRetention && !settings.ZeroDataRetention {
+		return false
+	}
+	if !dataResidencyListAllows(policy.AllowedProviders, policy.DeniedProviders, settings.Provider) {
+		return false
+	}
+	return dataResidencyListAllows(policy.AllowedRegions, policy.DeniedRegions, settings.Region)
+}
+
+// dataResidencyListAllows 允许列表不为空时值必须在列表中，未设置的属性视为不满足
+func dataResidencyListAllows(allowed []string, denied []string, value string) bool {
+	value = strings.TrimSpace(value)
+	for _, item := range denied {
+		if strings.EqualFold(strings.TrimSpace(item), value) && value != "" {
+			return false
+		}
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	if value == "" {
+		return false
+	}
+	for _, item := range allowed {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDataResidencyListAllows(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		denied  []string
+		value   string
+		want    bool
+	}{
+		{name: "no lists", value: "us", want: true},
+		{name: "no lists and unset value", want: true},
+		{name: "in allowed list", allowed: []string{"eu", "us"}, value: "us", want: true},
+		{name: "allowed list ignores case and spaces", allowed: []string{" EU "}, value: "eu", want: true},
+		{name: "not in allowed list", allowed: []string{"eu"}, value: "us"},
+		{name: "unset value with allowed list", allowed: []string{"eu"}},
+		{name: "in denied list", denied: []string{"cn"}, value: "CN"},
+		{name: "not in denied list", denied: []string{"cn"}, value: "us", want: true},
+		{name: "unset value with denied list", denied: []string{"cn"}, want: true},
+		{name: "denied wins over allowed", allowed: []string{"us"}, denied: []string{"us"}, value: "us"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, dataResidencyListAllows(tt.allowed, tt.denied, tt.value))
+		})
+	}
+}
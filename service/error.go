@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
@@ -83,6 +84,11 @@ func ClaudeErrorWrapperLocal(err error, code string, statusCode int) *dto.Claude
 
 func RelayErrorHandler(ctx context.Context, resp *http.Response, showBodyWhenFail bool) (newApiErr *types.NewAPIError) {
 	newApiErr = types.InitOpenAIError(types.ErrorCodeBadResponseStatusCode, resp.StatusCode)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		defer func() {
+			newApiErr.RetryAfter = ParseRateLimitReset(resp.Header, time.Now())
+		}()
+	}
 
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -126,6 +132,42 @@ func RelayErrorHandler(ctx context.Context, resp *http.Response, showBodyWhenFai
 	return
 }
 
+// ParseRateLimitReset 从上游响应头中解析限流重置等待时间（秒），支持 Retry-After、
+// OpenAI 的 x-ratelimit-reset-* 以及 Anthropic 的 anthropic-ratelimit-*-reset，解析失败返回 0
+func ParseRateLimitReset(header http.Header, now time.Time) int64 {
+	if header == nil {
+		return 0
+	}
+	var wait time.Duration
+	if v := header.Get("retry-after-ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil {
+			wait = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	if v := header.Get("Retry-After"); v != "" && wait == 0 {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+			wait = time.Duration(seconds * float64(time.Second))
+		} else if t, err := http.ParseTime(v); err == nil {
+			wait = t.Sub(now)
+		}
+	}
+	for _, name := range []string{"x-ratelimit-reset-requests", "x-ratelimit-reset-tokens"} {
+		if d, err := time.ParseDuration(header.Get(name)); err == nil && d > wait {
+			wait = d
+		}
+	}
+	for _, name := range []string{"anthropic-ratelimit-requests-reset", "anthropic-ratelimit-tokens-reset", "anthropic-ratelimit-input-tokens-reset", "anthropic-ratelimit-output-tokens-reset"} {
+		if t, err := time.Parse(time.RFC3339, header.Get(name)); err == nil && t.Sub(now) > wait {
+			wait = t.Sub(now)
+		}
+	}
+	if wait <= 0 {
+		return 0
+	}
+	// 向上取整到秒
+	return int64((wait + time.Second - 1) / time.Second)
+}
+
 func ResetStatusCode(newApiErr *types.NewAPIError, statusCodeMappingStr string) {
 	if statusCodeMappingStr == "" || statusCodeMappingStr == "{}" {
 		return
@@ -0,0 +1,490 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求与响应 JSON 中参与检查的文本字段，只检查直接挂在这些键下的字符串（或字符串数组），
+// 避免把 model、role、type、图片地址等字段当作文本处理
+var (
+	guardrailInputTextKeys = map[string]bool{
+		"content": true, "text": true, "input": true, "prompt": true,
+		"instructions": true, "system": true, "query": true, "documents": true,
+	}
+	guardrailOutputTextKeys = map[string]bool{
+		"content": true, "text": true, "delta": true, "output_text": true,
+		"reasoning_content": true, "refusal": true, "thinking": true,
+	}
+)
+
+var (
+	guardrailEmailRegex   = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`)
+	guardrailPhoneRegexes = []*regexp.Regexp{
+		regexp.MustCompile(`(?:\+?86[- ]?)?1[3-9]\d{9}`),      // 中国大陆手机号
+		regexp.MustCompile(`\+[1-9]\d{7,14}`),                 // E.164
+		regexp.MustCompile(`\(?\d{3}\)?[- .]\d{3}[- .]\d{4}`), // 北美格式
+	}
+	guardrailIdCardRegex   = regexp.MustCompile(`\d{17}[\dXx]`)
+	guardrailBankCardRegex = regexp.MustCompile(`\d(?:[ -]?\d){12,18}`)
+
+	guardrailRegexCache sync.Map // map[string]*regexp.Regexp，编译失败时缓存 nil
+)
+
+type guardrailSpan struct {
+	start int
+	end   int
+}
+
+// GuardrailResult 一次检查的结果，命中 block 规则时立即停止后续规则
+type GuardrailResult struct {
+	Blocked     bool
+	Rule        string // 拦截请求的规则
+	Reason      string
+	RedactRules []operation_setting.GuardrailRule // 命中的脱敏规则
+}
+
+func (r *GuardrailResult) NeedRedact() bool {
+	return r != nil && len(r.RedactRules) > 0
+}
+
+// GetGuardrailRules 按令牌、分组、默认的优先级取出当前请求在指定阶段生效的规则
+func GetGuardrailRules(c *gin.Context, stage string) []operation_setting.GuardrailRule {
+	setting := operation_setting.GetGuardrailSetting()
+	if !setting.Enabled || len(setting.Rules) == 0 {
+		return nil
+	}
+	names, ok := setting.TokenRules[strconv.Itoa(common.GetContextKeyInt(c, constant.ContextKeyTokenId))]
+	if !ok {
+		names, ok = setting.GroupRules[common.GetContextKeyString(c, constant.ContextKeyUsingGroup)]
+	}
+	if !ok {
+		names = setting.DefaultRules
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	enabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		enabled[name] = true
+	}
+	rules := make([]operation_setting.GuardrailRule, 0, len(names))
+	for _, rule := range setting.Rules {
+		if enabled[rule.Name] && guardrailRuleHasStage(rule, stage) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+func guardrailRuleHasStage(rule operation_setting.GuardrailRule, stage string) bool {
+	if len(rule.Stages) == 0 {
+		return true
+	}
+	for _, s := range rule.Stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckGuardrails 按顺序执行规则，log 与 redact 命中只记录日志，调用方根据 RedactRules 决定是否脱敏
+func CheckGuardrails(c *gin.Context, rules []operation_setting.GuardrailRule, stage string, text string) *GuardrailResult {
+	result := &GuardrailResult{}
+	if text == "" {
+		return result
+	}
+	for _, rule := range rules {
+		var (
+			hit    bool
+			reason string
+		)
+		if rule.Type == operation_setting.GuardrailRuleTypeHTTP {
+			hit, reason = callGuardrailClassifier(c, rule, stage, text)
+		} else {
+			labels := guardrailMatchLabels(rule, text)
+			hit = len(labels) > 0
+			reason = strings.Join(labels, ", ")
+		}
+		if !hit {
+			continue
+		}
+		logger.LogWarn(c, fmt.Sprintf("guardrail rule %s hit on %s (action: %s): %s", rule.Name, stage, rule.Action, reason))
+		switch rule.Action {
+		case operation_setting.GuardrailActionBlock:
+			result.Blocked = true
+			result.Rule = rule.Name
+			result.Reason = reason
+			return result
+		case operation_setting.GuardrailActionRedact:
+			// 外部分类器只返回是否命中，无法定位内容，脱敏按拦截处理
+			if rule.Type == operation_setting.GuardrailRuleTypeHTTP {
+				result.Blocked = true
+				result.Rule = rule.Name
+				result.Reason = reason
+				return result
+			}
+			result.RedactRules = append(result.RedactRules, rule)
+		}
+	}
+	return result
+}
+
+// RedactGuardrailText 用脱敏规则替换文本中命中的内容
+func RedactGuardrailText(rules []operation_setting.GuardrailRule, text string) string {
+	if text == "" || len(rules) == 0 {
+		return text
+	}
+	spans := make([]guardrailSpan, 0)
+	for _, rule := range rules {
+		spans = append(spans, findGuardrailSpans(rule, text)...)
+	}
+	if len(spans) == 0 {
+		return text
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+	replacement := operation_setting.GetGuardrailSetting().RedactText
+	var builder strings.Builder
+	builder.Grow(len(text))
+	last := 0
+	for _, span := range spans {
+		if span.end <= last {
+			continue
+		}
+		if span.start > last {
+			builder.WriteString(text[last:span.start])
+		}
+		builder.WriteString(replacement)
+		last = span.end
+	}
+	builder.WriteString(text[last:])
+	return builder.String()
+}
+
+// NewGuardrailBlockedError 被拦截时返回给客户端的错误，不重试其他渠道
+func NewGuardrailBlockedError(stage string, result *GuardrailResult) *types.NewAPIError {
+	message := fmt.Sprintf("请求内容被安全规则 %s 拦截", result.Rule)
+	if stage == operation_setting.GuardrailStageOutput {
+		message = fmt.Sprintf("响应内容被安全规则 %s 拦截", result.Rule)
+	}
+	return types.NewErrorWithStatusCode(errors.New(message), types.ErrorCodeGuardrailBlocked, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+}
+
+// ApplyGuardrailsToJSON 检查 JSON 请求体或响应体中的文本字段，需要脱敏时返回改写后的 JSON。
+// 不是 JSON 时原样返回
+func ApplyGuardrailsToJSON(c *gin.Context, rules []operation_setting.GuardrailRule, stage string, data []byte) ([]byte, *GuardrailResult) {
+	result := &GuardrailResult{}
+	if len(rules) == 0 || len(data) == 0 {
+		return data, result
+	}
+	root, err := decodeGuardrailJSON(data)
+	if err != nil {
+		return data, result
+	}
+	keys := guardrailTextKeys(stage)
+	texts := make([]string, 0)
+	walkGuardrailText(root, "", keys, func(s string) string {
+		texts = append(texts, s)
+		return s
+	})
+	result = CheckGuardrails(c, rules, stage, strings.Join(texts, "\n"))
+	if result.Blocked || !result.NeedRedact() {
+		return data, result
+	}
+	changed := false
+	root = walkGuardrailText(root, "", keys, func(s string) string {
+		redacted := RedactGuardrailText(result.RedactRules, s)
+		if redacted != s {
+			changed = true
+		}
+		return redacted
+	})
+	if !changed {
+		return data, result
+	}
+	newData, err := common.Marshal(root)
+	if err != nil {
+		return data, result
+	}
+	return newData, result
+}
+
+// ExtractGuardrailText 提取 JSON 中参与检查的文本
+func ExtractGuardrailText(stage string, data string) string {
+	root, err := decodeGuardrailJSON([]byte(data))
+	if err != nil {
+		return ""
+	}
+	texts := make([]string, 0)
+	walkGuardrailText(root, "", guardrailTextKeys(stage), func(s string) string {
+		texts = append(texts, s)
+		return s
+	})
+	return strings.Join(texts, "")
+}
+
+// decodeGuardrailJSON 解析时保留数字原样，避免改写后大整数丢失精度
+func decodeGuardrailJSON(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var root any
+	if err := decoder.Decode(&root); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func guardrailTextKeys(stage string) map[string]bool {
+	if stage == operation_setting.GuardrailStageOutput {
+		return guardrailOutputTextKeys
+	}
+	return guardrailInputTextKeys
+}
+
+// walkGuardrailText 对 key 属于 keys 的字符串调用 fn，返回替换后的值
+func walkGuardrailText(v any, key string, keys map[string]bool, fn func(string) string) any {
+	switch value := v.(type) {
+	case map[string]any:
+		// 按键排序遍历，保证多次遍历时文本字段的顺序一致
+		fields := make([]string, 0, len(value))
+		for k := range value {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		for _, k := range fields {
+			value[k] = walkGuardrailText(value[k], k, keys, fn)
+		}
+		return value
+	case []any:
+		for i, item := range value {
+			// 数组元素沿用数组的键，如 "input": ["..."]
+			value[i] = walkGuardrailText(item, key, keys, fn)
+		}
+		return value
+	case string:
+		if keys[key] && value != "" {
+			return fn(value)
+		}
+		return value
+	default:
+		return value
+	}
+}
+
+// guardrailMatchLabels 返回命中的检测器或关键词，用于日志；不返回命中的原文，避免 PII 写入日志
+func guardrailMatchLabels(rule operation_setting.GuardrailRule, text string) []string {
+	switch rule.Type {
+	case operation_setting.GuardrailRuleTypePII:
+		labels := make([]string, 0)
+		for _, detector := range guardrailPIIDetectors(rule) {
+			if len(findGuardrailPIISpans(detector, text)) > 0 {
+				labels = append(labels, detector)
+			}
+		}
+		return labels
+	case operation_setting.GuardrailRuleTypeKeyword:
+		re := getGuardrailKeywordRegex(rule.Keywords)
+		if re == nil {
+			return nil
+		}
+		matches := re.FindAllString(text, -1)
+		seen := make(map[string]bool, len(matches))
+		labels := make([]string, 0, len(matches))
+		for _, m := range matches {
+			m = strings.ToLower(m)
+			if !seen[m] {
+				seen[m] = true
+				labels = append(labels, m)
+			}
+		}
+		return labels
+	case operation_setting.GuardrailRuleTypeRegex:
+		labels := make([]string, 0)
+		for i, pattern := range rule.Patterns {
+			if re := getGuardrailRegex(pattern); re != nil && re.MatchString(text) {
+				labels = append(labels, fmt.Sprintf("pattern#%d", i+1))
+			}
+		}
+		return labels
+	}
+	return nil
+}
+
+func findGuardrailSpans(rule operation_setting.GuardrailRule, text string) []guardrailSpan {
+	spans := make([]guardrailSpan, 0)
+	switch rule.Type {
+	case operation_setting.GuardrailRuleTypePII:
+		for _, detector := range guardrailPIIDetectors(rule) {
+			spans = append(spans, findGuardrailPIISpans(detector, text)...)
+		}
+	case operation_setting.GuardrailRuleTypeKeyword:
+		if re := getGuardrailKeywordRegex(rule.Keywords); re != nil {
+			spans = append(spans, regexSpans(re, text)...)
+		}
+	case operation_setting.GuardrailRuleTypeRegex:
+		for _, pattern := range rule.Patterns {
+			if re := getGuardrailRegex(pattern); re != nil {
+				spans = append(spans, regexSpans(re, text)...)
+			}
+		}
+	}
+	return spans
+}
+
+func guardrailPIIDetectors(rule operation_setting.GuardrailRule) []string {
+	if len(rule.Detectors) > 0 {
+		return rule.Detectors
+	}
+	return []string{
+		operation_setting.GuardrailDetectorEmail,
+		operation_setting.GuardrailDetectorPhone,
+		operation_setting.GuardrailDetectorIdCard,
+		operation_setting.GuardrailDetectorBankCard,
+	}
+}
+
+func findGuardrailPIISpans(detector string, text string) []guardrailSpan {
+	switch detector {
+	case operation_setting.GuardrailDetectorEmail:
+		return regexSpans(guardrailEmailRegex, text)
+	case operation_setting.GuardrailDetectorPhone:
+		spans := make([]guardrailSpan, 0)
+		for _, re := range guardrailPhoneRegexes {
+			spans = append(spans, digitBoundedSpans(re, text, nil)...)
+		}
+		return spans
+	case operation_setting.GuardrailDetectorIdCard:
+		return digitBoundedSpans(guardrailIdCardRegex, text, isValidIdCardNumber)
+	case operation_setting.GuardrailDetectorBankCard:
+		return digitBoundedSpans(guardrailBankCardRegex, text, func(s string) bool {
+			return isValidLuhn(strings.NewReplacer(" ", "", "-", "").Replace(s))
+		})
+	}
+	return nil
+}
+
+func regexSpans(re *regexp.Regexp, text string) []guardrailSpan {
+	locs := re.FindAllStringIndex(text, -1)
+	spans := make([]guardrailSpan, 0, len(locs))
+	for _, loc := range locs {
+		spans = append(spans, guardrailSpan{start: loc[0], end: loc[1]})
+	}
+	return spans
+}
+
+// digitBoundedSpans 只保留前后不紧邻数字的匹配，避免从更长的数字串中截取出误报
+func digitBoundedSpans(re *regexp.Regexp, text string, validate func(string) bool) []guardrailSpan {
+	spans := make([]guardrailSpan, 0)
+	for _, loc := range re.FindAllStringIndex(text, -1) {
+		if loc[0] > 0 && isASCIIDigit(text[loc[0]-1]) {
+			continue
+		}
+		if loc[1] < len(text) && isASCIIDigit(text[loc[1]]) {
+			continue
+		}
+		if validate != nil && !validate(text[loc[0]:loc[1]]) {
+			continue
+		}
+		spans = append(spans, guardrailSpan{start: loc[0], end: loc[1]})
+	}
+	return spans
+}
+
+func isASCIIDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// isValidLuhn 银行卡号 Luhn 校验
+func isValidLuhn(number string) bool {
+	if len(number) < 13 || len(number) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		if !isASCIIDigit(number[i]) {
+			return false
+		}
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// isValidIdCardNumber 18 位居民身份证号校验码（GB 11643）
+func isValidIdCardNumber(number string) bool {
+	if len(number) != 18 {
+		return false
+	}
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	checkCodes := "10X98765432"
+	sum := 0
+	for i := 0; i < 17; i++ {
+		sum += int(number[i]-'0') * weights[i]
+	}
+	return strings.ToUpper(number[17:]) == string(checkCodes[sum%11])
+}
+
+func getGuardrailRegex(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+	if cached, ok := guardrailRegexCache.Load(pattern); ok {
+		re, _ := cached.(*regexp.Regexp)
+		return re
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		common.SysError(fmt.Sprintf("invalid guardrail pattern %q: %s", pattern, err.Error()))
+		guardrailRegexCache.Store(pattern, (*regexp.Regexp)(nil))
+		return nil
+	}
+	guardrailRegexCache.Store(pattern, re)
+	return re
+}
+
+// getGuardrailKeywordRegex 将关键词编译为不区分大小写的正则，较长的关键词优先匹配
+func getGuardrailKeywordRegex(keywords []string) *regexp.Regexp {
+	words := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			words = append(words, keyword)
+		}
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	sort.Slice(words, func(i, j int) bool {
+		return len(words[i]) > len(words[j])
+	})
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+	}
+	return getGuardrailRegex("(?i)(?:" + strings.Join(words, "|") + ")")
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultGuardrailClassifierTimeout = 3 * time.Second
+
+type guardrailClassifierRequest struct {
+	Stage   string `json:"stage"`
+	Text    string `json:"text"`
+	Model   string `json:"model"`
+	Group   string `json:"group"`
+	TokenId int    `json:"token_id"`
+}
+
+type guardrailClassifierResponse struct {
+	Flagged bool   `json:"flagged"`
+	Reason  string `json:"reason"`
+}
+
+// callGuardrailClassifier 调用外部 HTTP 分类器，返回是否命中与原因。
+// 分类器不可用时按规则的 FailClosed 决定放行或视为命中
+func callGuardrailClassifier(c *gin.Context, rule operation_setting.GuardrailRule, stage string, text string) (bool, string) {
+	flagged, reason, err := doGuardrailClassifierRequest(c, rule, stage, text)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("guardrail classifier %s failed: %s", rule.Name, err.Error()))
+		if rule.FailClosed {
+			return true, "classifier unavailable"
+		}
+		return false, ""
+	}
+	return flagged, reason
+}
+
+func doGuardrailClassifierRequest(c *gin.Context, rule operation_setting.GuardrailRule, stage string, text string) (bool, string, error) {
+	if rule.Endpoint == "" {
+		return false, "", fmt.Errorf("endpoint is empty")
+	}
+	fetchSetting := system_setting.GetFetchSetting()
+	if err := common.ValidateURLWithFetchSetting(rule.Endpoint, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+		return false, "", fmt.Errorf("request reject: %v", err)
+	}
+	payload, err := common.Marshal(guardrailClassifierRequest{
+		Stage:   stage,
+		Text:    text,
+		Model:   common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		Group:   common.GetContextKeyString(c, constant.ContextKeyUsingGroup),
+		TokenId: common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+	})
+	if err != nil {
+		return false, "", err
+	}
+	timeout := defaultGuardrailClassifierTimeout
+	if rule.TimeoutMs > 0 {
+		timeout = time.Duration(rule.TimeoutMs) * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rule.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return false, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if rule.Secret != "" {
+		req.Header.Set("Authorization", "Bearer "+rule.Secret)
+	}
+	resp, err := GetHttpClient().Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, "", fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return false, "", err
+	}
+	var result guardrailClassifierResponse
+	if err := common.Unmarshal(body, &result); err != nil {
+		return false, "", err
+	}
+	return result.Flagged, result.Reason, nil
+}
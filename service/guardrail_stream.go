@@ -0,0 +1,236 @@
+package service
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// guardrailStreamOverlapChars 放行时保留在窗口末尾的字符数，与下一批文本一起检查，用于发现跨批次的命中
+const guardrailStreamOverlapChars = 64
+
+type guardrailStreamChunk struct {
+	data     string
+	texts    []string // 数据块中按遍历顺序排列的文本字段
+	runes    int
+	modified bool
+}
+
+// GuardrailStream 流式输出的护栏检查：暂存上游数据块，攒够一定字符后将文本拼接成窗口统一检查再放行。
+// 拦截时丢弃暂存的数据块；脱敏在窗口上定位命中，再映射回各数据块的文本字段，跨数据块的命中同样会被替换。
+// 窗口末尾的数据块暂不放行，与下一批一起检查；命中位置落在已发送内容中无法脱敏时按拦截处理
+type GuardrailStream struct {
+	c           *gin.Context
+	rules       []operation_setting.GuardrailRule
+	bufferChars int
+
+	pending   []*guardrailStreamChunk
+	unchecked int
+	sent      string // 已发送文本的末尾，只作为检查的上下文
+
+	Blocked bool
+	Result  *GuardrailResult
+}
+
+// NewGuardrailStream 当前请求没有输出阶段的规则时返回 nil
+func NewGuardrailStream(c *gin.Context) *GuardrailStream {
+	rules := GetGuardrailRules(c, operation_setting.GuardrailStageOutput)
+	if len(rules) == 0 {
+		return nil
+	}
+	bufferChars := operation_setting.GetGuardrailSetting().StreamBufferChars
+	if bufferChars <= 0 {
+		bufferChars = 200
+	}
+	return &GuardrailStream{
+		c:           c,
+		rules:       rules,
+		bufferChars: bufferChars,
+	}
+}
+
+// Push 暂存一个数据块，返回检查通过、可以发送给客户端的数据块
+func (s *GuardrailStream) Push(data string) []string {
+	if s.Blocked {
+		return nil
+	}
+	chunk := &guardrailStreamChunk{data: data}
+	if root, err := decodeGuardrailJSON([]byte(data)); err == nil {
+		walkGuardrailText(root, "", guardrailOutputTextKeys, func(text string) string {
+			chunk.texts = append(chunk.texts, text)
+			chunk.runes += len([]rune(text))
+			return text
+		})
+	}
+	s.pending = append(s.pending, chunk)
+	s.unchecked += chunk.runes
+	if s.unchecked < s.bufferChars {
+		return nil
+	}
+	return s.check(false)
+}
+
+// Flush 流结束时检查并放行剩余的数据块
+func (s *GuardrailStream) Flush() []string {
+	if s.Blocked || len(s.pending) == 0 {
+		return nil
+	}
+	return s.check(true)
+}
+
+func (s *GuardrailStream) pendingText() string {
+	var builder strings.Builder
+	for _, chunk := range s.pending {
+		for _, text := range chunk.texts {
+			builder.WriteString(text)
+		}
+	}
+	return builder.String()
+}
+
+func (s *GuardrailStream) check(all bool) []string {
+	s.unchecked = 0
+	window := s.sent + s.pendingText()
+	result := CheckGuardrails(s.c, s.rules, operation_setting.GuardrailStageOutput, window)
+	s.Result = result
+	if !result.Blocked && result.NeedRedact() {
+		s.redact(result, window)
+	}
+	if result.Blocked {
+		s.Blocked = true
+		s.pending = nil
+		return nil
+	}
+	return s.release(all)
+}
+
+// redact 在窗口上定位脱敏规则的命中并改写暂存数据块，命中位置与已发送内容重叠时将结果改为拦截
+func (s *GuardrailStream) redact(result *GuardrailResult, window string) {
+	spans := make([]guardrailSpan, 0)
+	for _, rule := range result.RedactRules {
+		for _, span := range findGuardrailSpans(rule, window) {
+			if span.start < len(s.sent) {
+				result.Blocked = true
+				result.Rule = rule.Name
+				result.Reason = "命中内容已发送，无法脱敏"
+				return
+			}
+			spans = append(spans, guardrailSpan{start: span.start - len(s.sent), end: span.end - len(s.sent)})
+		}
+	}
+	s.rewrite(mergeGuardrailSpans(spans))
+}
+
+// mergeGuardrailSpans 按起始位置排序并合并重叠的命中
+func mergeGuardrailSpans(spans []guardrailSpan) []guardrailSpan {
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+	merged := make([]guardrailSpan, 0, len(spans))
+	for _, span := range spans {
+		if n := len(merged); n > 0 && span.start < merged[n-1].end {
+			if span.end > merged[n-1].end {
+				merged[n-1].end = span.end
+			}
+			continue
+		}
+		merged = append(merged, span)
+	}
+	return merged
+}
+
+// rewrite 将暂存文本中的命中替换为脱敏文本：替换文本写入命中起始位置所在的字段，命中的其余部分从所在字段中删除
+func (s *GuardrailStream) rewrite(spans []guardrailSpan) {
+	if len(spans) == 0 {
+		return
+	}
+	replacement := operation_setting.GetGuardrailSetting().RedactText
+	offset := 0
+	for _, chunk := range s.pending {
+		for j, text := range chunk.texts {
+			start, end := offset, offset+len(text)
+			offset = end
+			var builder strings.Builder
+			last := start
+			for _, span := range spans {
+				if span.end <= start || span.start >= end {
+					continue
+				}
+				if span.start > last {
+					builder.WriteString(text[last-start : span.start-start])
+				}
+				if span.start >= start {
+					builder.WriteString(replacement)
+				}
+				last = min(span.end, end)
+			}
+			if last == start && builder.Len() == 0 {
+				continue
+			}
+			builder.WriteString(text[last-start:])
+			chunk.texts[j] = builder.String()
+			chunk.modified = true
+		}
+		chunk.runes = 0
+		for _, text := range chunk.texts {
+			chunk.runes += len([]rune(text))
+		}
+	}
+}
+
+// release 放行窗口前部的数据块，保留的文本至少为 guardrailStreamOverlapChars 个字符，all 为 true 时全部放行
+func (s *GuardrailStream) release(all bool) []string {
+	ready := make([]string, 0, len(s.pending))
+	sent := s.sent
+	for len(s.pending) > 0 {
+		if !all {
+			rest := 0
+			for _, chunk := range s.pending[1:] {
+				rest += chunk.runes
+			}
+			if rest < guardrailStreamOverlapChars {
+				break
+			}
+		}
+		chunk := s.pending[0]
+		s.pending = s.pending[1:]
+		for _, text := range chunk.texts {
+			sent += text
+		}
+		ready = append(ready, chunk.encode())
+	}
+	if runes := []rune(sent); len(runes) > guardrailStreamOverlapChars {
+		sent = string(runes[len(runes)-guardrailStreamOverlapChars:])
+	}
+	s.sent = sent
+	return ready
+}
+
+// encode 将改写后的文本字段写回数据块
+func (chunk *guardrailStreamChunk) encode() string {
+	if !chunk.modified {
+		return chunk.data
+	}
+	root, err := decodeGuardrailJSON([]byte(chunk.data))
+	if err != nil {
+		return chunk.data
+	}
+	i := 0
+	root = walkGuardrailText(root, "", guardrailOutputTextKeys, func(text string) string {
+		if i >= len(chunk.texts) {
+			return text
+		}
+		text = chunk.texts[i]
+		i++
+		return text
+	})
+	data, err := common.Marshal(root)
+	if err != nil {
+		return chunk.data
+	}
+	return string(data)
+}
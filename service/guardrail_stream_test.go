@@ -0,0 +1,117 @@
+package service
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func openAIStreamChunk(t *testing.T, content string) string {
+	t.Helper()
+	data, err := common.Marshal(map[string]any{
+		"choices": []map[string]any{{"index": 0, "delta": map[string]any{"content": content}}},
+	})
+	require.NoError(t, err)
+	return string(data)
+}
+
+func newStreamTestContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	return c
+}
+
+func joinStreamText(chunks []string) string {
+	var builder strings.Builder
+	for _, chunk := range chunks {
+		builder.WriteString(ExtractGuardrailText(operation_setting.GuardrailStageOutput, chunk))
+	}
+	return builder.String()
+}
+
+func TestGuardrailStreamCrossChunk(t *testing.T) {
+	emailRule := operation_setting.GuardrailRule{
+		Name:      "pii",
+		Type:      operation_setting.GuardrailRuleTypePII,
+		Action:    operation_setting.GuardrailActionRedact,
+		Detectors: []string{operation_setting.GuardrailDetectorEmail},
+	}
+	longRule := operation_setting.GuardrailRule{
+		Name:     "long",
+		Type:     operation_setting.GuardrailRuleTypeRegex,
+		Action:   operation_setting.GuardrailActionRedact,
+		Patterns: []string{`BEGIN x+ END`},
+	}
+	keywordRule := operation_setting.GuardrailRule{
+		Name:     "keyword",
+		Type:     operation_setting.GuardrailRuleTypeKeyword,
+		Action:   operation_setting.GuardrailActionBlock,
+		Keywords: []string{"forbidden"},
+	}
+	tests := []struct {
+		name        string
+		rule        operation_setting.GuardrailRule
+		bufferChars int
+		contents    []string
+		wantText    string
+		wantBlocked bool
+	}{
+		{
+			name:        "redact email split in one batch",
+			rule:        emailRule,
+			bufferChars: 200,
+			contents:    []string{"mail alice@exa", "mple.com now"},
+			wantText:    "mail [REDACTED] now",
+		},
+		{
+			name:        "redact email split across batches",
+			rule:        emailRule,
+			bufferChars: 5,
+			contents:    []string{"mail alice@exa", "mple.com now"},
+			wantText:    "mail [REDACTED] now",
+		},
+		{
+			name:        "block keyword split across batches",
+			rule:        keywordRule,
+			bufferChars: 5,
+			contents:    []string{"this is forb", "idden text"},
+			wantBlocked: true,
+		},
+		{
+			name:        "match reaching into sent text blocks",
+			rule:        longRule,
+			bufferChars: 1,
+			contents:    []string{"BEGIN ", strings.Repeat("x", 70), " END"},
+			wantBlocked: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &GuardrailStream{
+				c:           newStreamTestContext(),
+				rules:       []operation_setting.GuardrailRule{tt.rule},
+				bufferChars: tt.bufferChars,
+			}
+			out := make([]string, 0)
+			for _, content := range tt.contents {
+				out = append(out, s.Push(openAIStreamChunk(t, content))...)
+			}
+			out = append(out, s.Flush()...)
+			require.Equal(t, tt.wantBlocked, s.Blocked)
+			if tt.wantBlocked {
+				require.True(t, s.Result.Blocked)
+				require.Equal(t, tt.rule.Name, s.Result.Rule)
+				return
+			}
+			require.Equal(t, tt.wantText, joinStreamText(out))
+			require.Len(t, out, len(tt.contents), fmt.Sprintf("chunks: %v", out))
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsValidLuhn(t *testing.T) {
+	tests := []struct {
+		name   string
+		number string
+		want   bool
+	}{
+		{name: "valid visa", number: "4111111111111111", want: true},
+		{name: "valid 19 digits", number: "6212345678901234569", want: true},
+		{name: "wrong check digit", number: "4111111111111112"},
+		{name: "too short", number: "411111111111"},
+		{name: "too long", number: "41111111111111111111"},
+		{name: "non digit", number: "41111111111111a1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, isValidLuhn(tt.number))
+		})
+	}
+}
+
+func TestIsValidIdCardNumber(t *testing.T) {
+	tests := []struct {
+		name   string
+		number string
+		want   bool
+	}{
+		{name: "valid with X check code", number: "11010519491231002X", want: true},
+		{name: "lowercase x accepted", number: "11010519491231002x", want: true},
+		{name: "valid digit check code", number: "110101199003074477", want: true},
+		{name: "wrong check code", number: "110105194912310021"},
+		{name: "too short", number: "11010519491231002"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, isValidIdCardNumber(tt.number))
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/gin-gonic/gin"
 )
@@ -27,6 +28,18 @@ func IOCopyBytesGracefully(c *gin.Context, src *http.Response, data []byte) {
 		return
 	}
 
+	if rules := GetGuardrailRules(c, operation_setting.GuardrailStageOutput); len(rules) > 0 {
+		var result *GuardrailResult
+		data, result = ApplyGuardrailsToJSON(c, rules, operation_setting.GuardrailStageOutput, data)
+		if result.Blocked {
+			apiErr := NewGuardrailBlockedError(operation_setting.GuardrailStageOutput, result)
+			c.JSON(apiErr.StatusCode, gin.H{
+				"error": apiErr.ToOpenAIError(),
+			})
+			return
+		}
+	}
+
 	body := io.NopCloser(bytes.NewBuffer(data))
 
 	// We shouldn't set the header before we parse the response body, because the parse part may fail.
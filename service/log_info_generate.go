@@ -41,6 +41,11 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	other["cache_ratio"] = cacheRatio
 	other["model_price"] = modelPrice
 	other["user_group_ratio"] = userGroupRatio
+	AppendPricingWindowInfo(other, relayInfo.PriceData.GroupRatioInfo)
+	AppendPriceOverrideInfo(other, relayInfo.PriceData.PriceOverrideId)
+	if relayInfo.RequestId != "" {
+		other["request_id"] = relayInfo.RequestId
+	}
 	other["frt"] = float64(relayInfo.FirstResponseTime.UnixMilli() - relayInfo.StartTime.UnixMilli())
 	if relayInfo.ReasoningEffort != "" {
 		other["reasoning_effort"] = relayInfo.ReasoningEffort
@@ -104,6 +109,32 @@ func appendRequestConversionChain(relayInfo *relaycommon.RelayInfo, other map[st
 	other["request_conversion"] = chain
 }
 
+// AppendPricingWindowInfo 记录命中的定时计费窗口，窗口倍率已包含在 group_ratio 中
+func AppendPricingWindowInfo(other map[string]interface{}, groupRatioInfo types.GroupRatioInfo) {
+	if groupRatioInfo.PricingWindow == "" {
+		return
+	}
+	other["pricing_window"] = groupRatioInfo.PricingWindow
+	other["pricing_window_ratio"] = groupRatioInfo.PricingWindowRatio
+}
+
+// AppendPriceOverrideInfo 记录命中的用户协商价格，便于审计；实际生效的倍率与价格见 model_ratio 等字段
+func AppendPriceOverrideInfo(other map[string]interface{}, overrideId int) {
+	if overrideId == 0 {
+		return
+	}
+	other["price_override_id"] = overrideId
+}
+
+// AppendPriceTierInfo 记录结算时命中的分档倍率
+func AppendPriceTierInfo(other map[string]interface{}, tier *types.PriceTier) {
+	if tier == nil {
+		return
+	}
+	other["price_tier"] = true
+	other["price_tier_threshold"] = tier.Threshold
+}
+
 func GenerateWssOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.RealtimeUsage, modelRatio, groupRatio, completionRatio, audioRatio, audioCompletionRatio, modelPrice, userGroupRatio float64) map[string]interface{} {
 	info := GenerateTextOtherInfo(ctx, relayInfo, modelRatio, groupRatio, completionRatio, 0, 0.0, modelPrice, userGroupRatio)
 	info["ws"] = true
@@ -156,6 +187,8 @@ func GenerateMjOtherInfo(relayInfo *relaycommon.RelayInfo, priceData types.PerCa
 	if priceData.GroupRatioInfo.HasSpecialRatio {
 		other["user_group_ratio"] = priceData.GroupRatioInfo.GroupSpecialRatio
 	}
+	AppendPricingWindowInfo(other, priceData.GroupRatioInfo)
+	AppendPriceOverrideInfo(other, priceData.PriceOverrideId)
 	appendRequestPath(nil, relayInfo, other)
 	return other
 }
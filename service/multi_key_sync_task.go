@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const multiKeySyncTickInterval = 30 * time.Second
+
+var (
+	multiKeySyncOnce    sync.Once
+	multiKeySyncRunning atomic.Bool
+)
+
+// StartMultiKeySyncTask 定期将多Key渠道的key用量落库，并恢复限流冷却结束的key。
+// key 用量在每个节点内存中累计，因此所有节点都需要运行该任务。
+func StartMultiKeySyncTask() {
+	multiKeySyncOnce.Do(func() {
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("multi-key sync task started: tick=%s", multiKeySyncTickInterval))
+
+			ticker := time.NewTicker(multiKeySyncTickInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				runMultiKeySyncOnce()
+			}
+		})
+	})
+}
+
+func runMultiKeySyncOnce() {
+	if !multiKeySyncRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer multiKeySyncRunning.Store(false)
+	model.SyncMultiKeyState()
+}
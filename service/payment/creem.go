@@ -0,0 +1,260 @@
+package payment
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const CreemSignatureHeader = "creem-signature"
+
+// CreemProvider 充值订单的 ExternalId 为 Creem Checkout ID
+type CreemProvider struct {
+}
+
+type creemCheckoutRequest struct {
+	ProductId string `json:"product_id"`
+	RequestId string `json:"request_id"`
+	Customer  struct {
+		Email string `json:"email"`
+	} `json:"customer"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type creemCheckout struct {
+	CheckoutUrl string `json:"checkout_url"`
+	Id          string `json:"id"`
+	Status      string `json:"status"`
+	RequestId   string `json:"request_id"`
+}
+
+// creemWebhookEvent 结账完成事件，只解析需要的字段
+type creemWebhookEvent struct {
+	Id        string `json:"id"`
+	EventType string `json:"eventType"`
+	Object    struct {
+		Id        string `json:"id"`
+		RequestId string `json:"request_id"`
+		Order     struct {
+			Id         string `json:"id"`
+			AmountPaid int    `json:"amount_paid"`
+			Currency   string `json:"currency"`
+			Status     string `json:"status"`
+			Type       string `json:"type"`
+		} `json:"order"`
+		Customer struct {
+			Email string `json:"email"`
+			Name  string `json:"name"`
+		} `json:"customer"`
+	} `json:"object"`
+}
+
+func (*CreemProvider) Name() string {
+	return model.PaymentMethodCreem
+}
+
+func (*CreemProvider) Enabled() bool {
+	return setting.CreemApiKey != ""
+}
+
+func getCreemApiBase() string {
+	// 根据测试模式选择 API 端点
+	if setting.CreemTestMode {
+		return "https://test-api.creem.io"
+	}
+	return "https://api.creem.io"
+}
+
+// 生成HMAC-SHA256签名
+func generateCreemSignature(payload string, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(payload))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 验证Creem webhook签名
+func verifyCreemSignature(payload string, signature string, secret string) bool {
+	if secret == "" {
+		log.Printf("Creem webhook secret not set")
+		if setting.CreemTestMode {
+			log.Printf("Skip Creem webhook sign verify in test mode")
+			return true
+		}
+		return false
+	}
+
+	expectedSignature := generateCreemSignature(payload, secret)
+	return hmac.Equal([]byte(signature), []byte(expectedSignature))
+}
+
+func doCreemRequest(method string, apiUrl string, body []byte) ([]byte, error) {
+	if setting.CreemApiKey == "" {
+		return nil, fmt.Errorf("未配置Creem API密钥")
+	}
+	req, err := http.NewRequest(method, apiUrl, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", setting.CreemApiKey)
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("发送HTTP请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %v", err)
+	}
+	log.Printf("Creem API resp - status code: %d, resp: %s", resp.StatusCode, string(respBody))
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("Creem API http status %d ", resp.StatusCode)
+	}
+	return respBody, nil
+}
+
+func (*CreemProvider) CreateCheckout(req *CheckoutRequest) (*CheckoutResult, error) {
+	requestData := creemCheckoutRequest{
+		ProductId: req.ProductId,
+		RequestId: req.TradeNo, // 这个作为订单ID传递给Creem
+		Metadata: map[string]string{
+			"username":     req.Username,
+			"reference_id": req.TradeNo,
+			"product_name": req.ProductName,
+			"quota":        fmt.Sprintf("%d", req.Quota),
+		},
+	}
+	// 用户邮箱会在支付页面预填充
+	requestData.Customer.Email = req.Email
+
+	jsonData, err := json.Marshal(requestData)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求数据失败: %v", err)
+	}
+
+	apiUrl := getCreemApiBase() + "/v1/checkouts"
+	log.Printf("发送Creem支付请求 - URL: %s, 产品ID: %s, 用户邮箱: %s, 订单号: %s",
+		apiUrl, req.ProductId, req.Email, req.TradeNo)
+	body, err := doCreemRequest(http.MethodPost, apiUrl, jsonData)
+	if err != nil {
+		return nil, err
+	}
+
+	var checkout creemCheckout
+	if err := json.Unmarshal(body, &checkout); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	if checkout.CheckoutUrl == "" {
+		return nil, fmt.Errorf("Creem API resp no checkout url ")
+	}
+
+	log.Printf("Creem 支付链接创建成功 - 订单号: %s, 支付链接: %s", req.TradeNo, checkout.CheckoutUrl)
+	return &CheckoutResult{Url: checkout.CheckoutUrl, ExternalId: checkout.Id}, nil
+}
+
+// VerifyWebhook 只解析一次性付款的结账完成事件，订阅相关事件原样交回调用方
+func (*CreemProvider) VerifyWebhook(c *gin.Context) (*Notification, error) {
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取Creem Webhook请求body失败: %v", err)
+	}
+
+	// 获取签名头
+	signature := c.GetHeader(CreemSignatureHeader)
+
+	// 打印关键信息（避免输出完整敏感payload）
+	log.Printf("Creem Webhook - URI: %s", c.Request.RequestURI)
+	if setting.CreemTestMode {
+		log.Printf("Creem Webhook - Signature: %s , Body: %s", signature, bodyBytes)
+	} else if signature == "" {
+		return nil, fmt.Errorf("%w: 缺少签名头", ErrInvalidSignature)
+	}
+	if !verifyCreemSignature(string(bodyBytes), signature, setting.CreemWebhookSecret) {
+		return nil, ErrInvalidSignature
+	}
+
+	notification := &Notification{Payload: bodyBytes}
+	var event creemWebhookEvent
+	if err := json.Unmarshal(bodyBytes, &event); err != nil || event.EventType != "checkout.completed" {
+		// 订阅事件的回调对象结构不同，由调用方单独解析
+		return notification, nil
+	}
+	log.Printf("Creem Webhook解析成功 - EventType: %s, EventId: %s", event.EventType, event.Id)
+
+	// 验证订单状态
+	if event.Object.Order.Status != "paid" {
+		log.Printf("订单状态不是已支付: %s, 跳过处理", event.Object.Order.Status)
+		return notification, nil
+	}
+	// 获取引用ID（这是我们创建订单时传递的request_id）
+	if event.Object.RequestId == "" {
+		return nil, fmt.Errorf("Creem Webhook缺少request_id字段")
+	}
+	// 验证订单类型，目前只处理一次性付款，订阅付款由订阅事件处理
+	if event.Object.Order.Type != "onetime" {
+		log.Printf("暂不支持的订单类型: %s, 跳过处理", event.Object.Order.Type)
+		return notification, nil
+	}
+
+	log.Printf("处理Creem支付完成 - 订单号: %s, Creem订单ID: %s, 支付金额: %d %s",
+		event.Object.RequestId, event.Object.Order.Id, event.Object.Order.AmountPaid, event.Object.Order.Currency)
+	if event.Object.Customer.Email == "" {
+		log.Printf("警告：Creem回调中客户邮箱为空 - 订单号: %s", event.Object.RequestId)
+	}
+
+	notification.Type = NotificationPaid
+	notification.TradeNo = event.Object.RequestId
+	notification.ExternalId = event.Object.Id
+	notification.CustomerEmail = event.Object.Customer.Email
+	return notification, nil
+}
+
+func (*CreemProvider) QueryOrder(topUp *model.TopUp) (*OrderResult, error) {
+	if topUp.ExternalId == "" {
+		return nil, ErrNoExternalId
+	}
+	apiUrl := getCreemApiBase() + "/v1/checkouts?checkout_id=" + url.QueryEscape(topUp.ExternalId)
+	body, err := doCreemRequest(http.MethodGet, apiUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	var checkout creemCheckout
+	if err := json.Unmarshal(body, &checkout); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	result := &OrderResult{Status: OrderStatusPending, ExternalId: checkout.Id}
+	switch checkout.Status {
+	case "completed":
+		result.Status = OrderStatusPaid
+	case "expired":
+		result.Status = OrderStatusExpired
+	}
+	return result, nil
+}
+
+// Refund Creem 未开放退款接口，需在 Creem 后台退款后以线下退款方式扣回额度
+func (*CreemProvider) Refund(topUp *model.TopUp, money float64, idempotencyKey string) error {
+	return fmt.Errorf("%w: %w: 请在 Creem 后台退款后使用线下退款", model.ErrRefundRejected, ErrNotSupported)
+}
+
+func (*CreemProvider) ListTransactions(startTime int64, endTime int64) ([]*Transaction, error) {
+	return nil, ErrNotSupported
+}
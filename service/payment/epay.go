@@ -0,0 +1,175 @@
+package payment
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/Calcium-Ion/go-epay/epay"
+	"github.com/gin-gonic/gin"
+)
+
+// EpayProvider 充值订单的 ExternalId 为易支付订单号，在支付回调时写入
+type EpayProvider struct {
+}
+
+func (*EpayProvider) Name() string {
+	return ProviderEpay
+}
+
+func (*EpayProvider) Enabled() bool {
+	return operation_setting.PayAddress != "" && operation_setting.EpayId != "" && operation_setting.EpayKey != ""
+}
+
+func GetEpayClient() *epay.Client {
+	if operation_setting.PayAddress == "" || operation_setting.EpayId == "" || operation_setting.EpayKey == "" {
+		return nil
+	}
+	withUrl, err := epay.NewClient(&epay.Config{
+		PartnerID: operation_setting.EpayId,
+		Key:       operation_setting.EpayKey,
+	}, operation_setting.PayAddress)
+	if err != nil {
+		return nil
+	}
+	return withUrl
+}
+
+func (*EpayProvider) CreateCheckout(req *CheckoutRequest) (*CheckoutResult, error) {
+	client := GetEpayClient()
+	if client == nil {
+		return nil, errors.New("当前管理员未配置支付信息")
+	}
+	callBackAddress := service.GetCallbackAddress()
+	returnUrl, _ := url.Parse(system_setting.ServerAddress + "/console/log")
+	notifyUrl, _ := url.Parse(callBackAddress + "/api/user/epay/notify")
+	uri, params, err := client.Purchase(&epay.PurchaseArgs{
+		Type:           req.PayType,
+		ServiceTradeNo: req.TradeNo,
+		Name:           fmt.Sprintf("TUC%d", req.Amount),
+		Money:          strconv.FormatFloat(req.Money, 'f', 2, 64),
+		Device:         epay.PC,
+		NotifyUrl:      notifyUrl,
+		ReturnUrl:      returnUrl,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CheckoutResult{Url: uri, Params: params}, nil
+}
+
+func (*EpayProvider) VerifyWebhook(c *gin.Context) (*Notification, error) {
+	query := c.Request.URL.Query()
+	params := make(map[string]string, len(query))
+	for key := range query {
+		params[key] = query.Get(key)
+	}
+	client := GetEpayClient()
+	if client == nil {
+		return nil, errors.New("未找到配置信息")
+	}
+	verifyInfo, err := client.Verify(params)
+	if err != nil {
+		return nil, err
+	}
+	if !verifyInfo.VerifyStatus {
+		return nil, ErrInvalidSignature
+	}
+
+	notification := &Notification{}
+	if verifyInfo.TradeStatus != epay.StatusTradeSuccess {
+		log.Printf("易支付异常回调: %v", verifyInfo)
+		return notification, nil
+	}
+	log.Println(verifyInfo)
+	notification.Type = NotificationPaid
+	notification.TradeNo = verifyInfo.ServiceTradeNo
+	notification.ExternalId = verifyInfo.TradeNo
+	return notification, nil
+}
+
+// callEpayApi 调用易支付商户 API（api.php），查询使用 GET、退款使用 POST。
+// 不同实现返回的字段类型不尽相同，统一按字符串读取
+func callEpayApi(method string, act string, form url.Values) (map[string]string, error) {
+	if GetEpayClient() == nil {
+		return nil, errors.New("当前管理员未配置支付信息")
+	}
+	form.Set("pid", operation_setting.EpayId)
+	form.Set("key", operation_setting.EpayKey)
+	apiUrl := strings.TrimSuffix(operation_setting.PayAddress, "/") + "/api.php?act=" + act
+
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	var resp *http.Response
+	var err error
+	if method == http.MethodGet {
+		resp, err = client.Get(apiUrl + "&" + form.Encode())
+	} else {
+		resp, err = client.PostForm(apiUrl, form)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("解析易支付响应失败: %s", string(body))
+	}
+	result := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if value != nil {
+			result[key] = fmt.Sprintf("%v", value)
+		}
+	}
+	return result, nil
+}
+
+func (*EpayProvider) QueryOrder(topUp *model.TopUp) (*OrderResult, error) {
+	result, err := callEpayApi(http.MethodGet, "order", url.Values{"out_trade_no": {topUp.TradeNo}})
+	if err != nil {
+		return nil, err
+	}
+	// 用户未打开支付页面时易支付侧没有该订单；易支付订单不会过期，未支付的订单保持待支付
+	order := &OrderResult{Status: OrderStatusPending, ExternalId: result["trade_no"]}
+	if result["code"] == "1" && result["status"] == "1" {
+		order.Status = OrderStatusPaid
+	}
+	return order, nil
+}
+
+// Refund 易支付退款接口不支持幂等键，重试前需确认上次退款未在易支付侧成功
+func (*EpayProvider) Refund(topUp *model.TopUp, money float64, idempotencyKey string) error {
+	result, err := callEpayApi(http.MethodPost, "refund", url.Values{
+		"out_trade_no": {topUp.TradeNo},
+		"money":        {strconv.FormatFloat(money, 'f', 2, 64)},
+	})
+	if err != nil {
+		return err
+	}
+	if result["code"] != "1" {
+		return fmt.Errorf("%w: 易支付退款失败: %s", model.ErrRefundRejected, result["msg"])
+	}
+	return nil
+}
+
+func (*EpayProvider) ListTransactions(startTime int64, endTime int64) ([]*Transaction, error) {
+	return nil, ErrNotSupported
+}
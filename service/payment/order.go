@@ -0,0 +1,101 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+)
+
+// HandleNotification 按回调通知推进充值订单状态，重复通知不会重复入账
+func HandleNotification(provider PaymentProvider, notification *Notification) error {
+	switch notification.Type {
+	case NotificationPaid:
+		payment := &model.TopUpPayment{
+			ExternalId:     notification.ExternalId,
+			StripeCustomer: notification.StripeCustomer,
+			CustomerEmail:  notification.CustomerEmail,
+		}
+		return completeOrder(provider, notification.TradeNo, payment, "使用在线充值成功")
+	case NotificationExpired:
+		LockOrder(notification.TradeNo)
+		defer UnlockOrder(notification.TradeNo)
+		return model.ExpireTopUp(notification.TradeNo)
+	}
+	return nil
+}
+
+// completeOrder 确认订单属于该渠道后入账
+func completeOrder(provider PaymentProvider, tradeNo string, payment *model.TopUpPayment, source string) error {
+	if tradeNo == "" {
+		return errors.New("未提供支付单号")
+	}
+	LockOrder(tradeNo)
+	defer UnlockOrder(tradeNo)
+
+	topUp := model.GetTopUpByTradeNo(tradeNo)
+	if topUp == nil {
+		return model.ErrTopUpNotFound
+	}
+	if GetOrderProvider(topUp).Name() != provider.Name() {
+		return fmt.Errorf("订单支付渠道不匹配: %s", topUp.PaymentMethod)
+	}
+	topUp, err := model.CompleteTopUp(tradeNo, payment)
+	if errors.Is(err, model.ErrTopUpCompleted) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	model.RecordLog(topUp.UserId, model.LogTypeTopup, fmt.Sprintf("%s，充值金额: %v，支付金额：%.2f", source, logger.LogQuota(topUp.Quota), topUp.Money))
+	return nil
+}
+
+// RefundOrder 原路退款并扣回额度，offline 表示已在渠道后台退款，仅扣回额度
+func RefundOrder(tradeNo string, money float64, offline bool) (*model.TopUp, int, error) {
+	LockOrder(tradeNo)
+	defer UnlockOrder(tradeNo)
+
+	var refund func(topUp *model.TopUp, money float64, idempotencyKey string) error
+	if !offline {
+		refund = func(topUp *model.TopUp, money float64, idempotencyKey string) error {
+			provider := GetOrderProvider(topUp)
+			if !provider.Enabled() {
+				return fmt.Errorf("%w: 支付渠道 %s 未配置", model.ErrRefundRejected, provider.Name())
+			}
+			return provider.Refund(topUp, money, idempotencyKey)
+		}
+	}
+	topUp, debit, err := model.RefundTopUp(tradeNo, money, refund)
+	if err != nil {
+		return nil, 0, err
+	}
+	common.SysLog(fmt.Sprintf("top up refunded: trade_no=%s, money=%.2f, quota=%d, offline=%t", tradeNo, money, debit, offline))
+	return topUp, debit, nil
+}
+
+// ListTransactions 列出渠道侧的已支付交易，并标注本地订单状态
+func ListTransactions(providerName string, startTime int64, endTime int64) ([]*Transaction, error) {
+	provider := GetProvider(providerName)
+	if provider == nil {
+		return nil, errors.New("支付渠道不存在")
+	}
+	if !provider.Enabled() {
+		return nil, fmt.Errorf("支付渠道 %s 未配置", provider.Name())
+	}
+	transactions, err := provider.ListTransactions(startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	for _, transaction := range transactions {
+		if transaction.TradeNo == "" {
+			continue
+		}
+		if topUp := model.GetTopUpByTradeNo(transaction.TradeNo); topUp != nil {
+			transaction.LocalStatus = topUp.Status
+		}
+	}
+	return transactions, nil
+}
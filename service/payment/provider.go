@@ -0,0 +1,149 @@
+package payment
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProviderEpay 易支付渠道标识，订单上记录的是具体的支付类型
+const ProviderEpay = "epay"
+
+var (
+	ErrNotSupported     = errors.New("支付渠道不支持该操作")
+	ErrInvalidSignature = errors.New("回调签名验证失败")
+	ErrNoExternalId     = errors.New("订单未关联支付渠道交易号")
+)
+
+// PaymentProvider 支付渠道适配器，新增支付渠道只需实现该接口并在 providers 中注册
+type PaymentProvider interface {
+	// Name 渠道标识
+	Name() string
+	// Enabled 渠道是否已完成配置
+	Enabled() bool
+	// CreateCheckout 为订单生成支付链接
+	CreateCheckout(req *CheckoutRequest) (*CheckoutResult, error)
+	// VerifyWebhook 校验回调签名并解析出充值订单通知，与充值无关的事件返回 NotificationIgnored
+	VerifyWebhook(c *gin.Context) (*Notification, error)
+	// QueryOrder 向渠道查询订单的支付状态
+	QueryOrder(topUp *model.TopUp) (*OrderResult, error)
+	// Refund 原路退款，money 与订单 Money 的单位一致。渠道支持时以 idempotencyKey 去重，
+	// 明确未执行退款（渠道拒绝或请求未发出）时返回的错误需包含 model.ErrRefundRejected
+	Refund(topUp *model.TopUp, money float64, idempotencyKey string) error
+	// ListTransactions 列出时间范围内渠道侧已支付的交易
+	ListTransactions(startTime int64, endTime int64) ([]*Transaction, error)
+}
+
+// CheckoutRequest 创建支付链接所需的信息，各渠道按需取用
+type CheckoutRequest struct {
+	TradeNo        string
+	Amount         int64   // 用户提交的充值数量
+	Money          float64 // 应付金额
+	PayType        string  // 易支付的支付类型，如 alipay、wxpay
+	ProductId      string  // Creem 产品 ID
+	ProductName    string
+	Quota          int64
+	Email          string
+	Username       string
+	StripeCustomer string
+}
+
+type CheckoutResult struct {
+	Url        string
+	Params     map[string]string // 需要以表单提交的参数（易支付）
+	ExternalId string
+}
+
+type NotificationType string
+
+const (
+	NotificationIgnored NotificationType = ""
+	NotificationPaid    NotificationType = "paid"
+	NotificationExpired NotificationType = "expired"
+)
+
+// Notification 已验签的渠道回调
+type Notification struct {
+	Type           NotificationType
+	TradeNo        string
+	ExternalId     string
+	StripeCustomer string
+	CustomerEmail  string
+	Payload        []byte // 原始回调数据，供订阅等其他事件继续处理
+}
+
+type OrderStatus string
+
+const (
+	OrderStatusPending OrderStatus = "pending"
+	OrderStatusPaid    OrderStatus = "paid"
+	OrderStatusExpired OrderStatus = "expired"
+)
+
+type OrderResult struct {
+	Status     OrderStatus
+	ExternalId string
+}
+
+// Transaction 渠道侧的一笔已支付交易
+type Transaction struct {
+	TradeNo     string  `json:"trade_no"`
+	ExternalId  string  `json:"external_id"`
+	Money       float64 `json:"money"`
+	Currency    string  `json:"currency"`
+	CreatedTime int64   `json:"created_time"`
+	LocalStatus string  `json:"local_status"` // 本地订单状态，为空表示本地不存在该订单
+}
+
+var providers = map[string]PaymentProvider{
+	ProviderEpay:              &EpayProvider{},
+	model.PaymentMethodStripe: &StripeProvider{},
+	model.PaymentMethodCreem:  &CreemProvider{},
+}
+
+// GetProvider 按渠道标识获取支付渠道，不存在时返回 nil
+func GetProvider(name string) PaymentProvider {
+	return providers[name]
+}
+
+// GetOrderProvider 获取订单所属的支付渠道，早期 Creem 订单未记录支付方式
+func GetOrderProvider(topUp *model.TopUp) PaymentProvider {
+	switch topUp.PaymentMethod {
+	case model.PaymentMethodStripe:
+		return providers[model.PaymentMethodStripe]
+	case model.PaymentMethodCreem, "":
+		return providers[model.PaymentMethodCreem]
+	default:
+		return providers[ProviderEpay]
+	}
+}
+
+// tradeNo lock
+var orderLocks sync.Map
+var createLock sync.Mutex
+
+// LockOrder 尝试对给定订单号加锁
+func LockOrder(tradeNo string) {
+	lock, ok := orderLocks.Load(tradeNo)
+	if !ok {
+		createLock.Lock()
+		defer createLock.Unlock()
+		lock, ok = orderLocks.Load(tradeNo)
+		if !ok {
+			lock = new(sync.Mutex)
+			orderLocks.Store(tradeNo, lock)
+		}
+	}
+	lock.(*sync.Mutex).Lock()
+}
+
+// UnlockOrder 释放给定订单号的锁
+func UnlockOrder(tradeNo string) {
+	lock, ok := orderLocks.Load(tradeNo)
+	if ok {
+		lock.(*sync.Mutex).Unlock()
+	}
+}
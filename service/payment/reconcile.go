@@ -0,0 +1,131 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	reconcileInterval  = 10 * time.Minute
+	reconcileWindow    = 3 * 24 * time.Hour // 创建超过 3 天仍未支付的订单在本地标记为过期
+	reconcileDelay     = 5 * time.Minute    // 给渠道回调留出时间，避免与回调并发处理
+	reconcileBatchSize = 200
+)
+
+var (
+	reconcileTaskOnce    sync.Once
+	reconcileTaskRunning atomic.Bool
+)
+
+// ReconcileResult 一次对账的结果
+type ReconcileResult struct {
+	Checked   int      `json:"checked"`
+	Completed []string `json:"completed"` // 渠道已支付但本地未入账，已补单
+	Expired   []string `json:"expired"`
+	Failed    []string `json:"failed"`
+}
+
+// StartReconcileTask 定期向支付渠道核对待支付订单，补单已支付但未入账的订单，仅在主节点运行
+func StartReconcileTask() {
+	reconcileTaskOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("payment reconcile task started: tick=%s", reconcileInterval))
+			ticker := time.NewTicker(reconcileInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if _, err := RunReconcile(); err != nil {
+					logger.LogWarn(context.Background(), fmt.Sprintf("payment reconcile failed: %v", err))
+				}
+			}
+		})
+	})
+}
+
+// RunReconcile 执行一次对账
+func RunReconcile() (*ReconcileResult, error) {
+	if !reconcileTaskRunning.CompareAndSwap(false, true) {
+		return nil, errors.New("对账正在进行中")
+	}
+	defer reconcileTaskRunning.Store(false)
+
+	now := time.Now()
+	expireBefore := now.Add(-reconcileWindow).Unix()
+	result := &ReconcileResult{
+		Completed: make([]string, 0),
+		Expired:   make([]string, 0),
+		Failed:    make([]string, 0),
+	}
+	afterId := 0
+	for {
+		topUps, err := model.GetPendingTopUps(afterId, now.Add(-reconcileDelay).Unix(), reconcileBatchSize)
+		if err != nil {
+			return result, err
+		}
+		for _, topUp := range topUps {
+			reconcileTopUp(topUp, expireBefore, result)
+		}
+		if len(topUps) < reconcileBatchSize {
+			return result, nil
+		}
+		afterId = topUps[len(topUps)-1].Id
+	}
+}
+
+// reconcileTopUp 向渠道核对单个待支付订单。渠道未确认支付且创建时间早于 expireBefore 的订单
+// （如易支付订单不会在渠道侧过期）直接在本地标记为过期
+func reconcileTopUp(topUp *model.TopUp, expireBefore int64, result *ReconcileResult) {
+	provider := GetOrderProvider(topUp)
+	status := OrderStatusPending
+	externalId := ""
+	if provider.Enabled() {
+		order, err := provider.QueryOrder(topUp)
+		switch {
+		case errors.Is(err, ErrNotSupported) || errors.Is(err, ErrNoExternalId):
+		case err != nil:
+			result.Checked++
+			common.SysError(fmt.Sprintf("payment reconcile: query order %s failed: %v", topUp.TradeNo, err))
+			result.Failed = append(result.Failed, topUp.TradeNo)
+			return
+		default:
+			result.Checked++
+			status, externalId = order.Status, order.ExternalId
+		}
+	}
+	if status == OrderStatusPending && topUp.CreateTime < expireBefore {
+		status = OrderStatusExpired
+	}
+
+	var err error
+	switch status {
+	case OrderStatusPaid:
+		err = completeOrder(provider, topUp.TradeNo, &model.TopUpPayment{ExternalId: externalId}, "对账补单成功")
+		if err == nil {
+			common.SysLog(fmt.Sprintf("payment reconcile: order %s paid but not credited, completed", topUp.TradeNo))
+			result.Completed = append(result.Completed, topUp.TradeNo)
+		}
+	case OrderStatusExpired:
+		LockOrder(topUp.TradeNo)
+		err = model.ExpireTopUp(topUp.TradeNo)
+		UnlockOrder(topUp.TradeNo)
+		if err == nil {
+			result.Expired = append(result.Expired, topUp.TradeNo)
+		}
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("payment reconcile: update order %s failed: %v", topUp.TradeNo, err))
+		result.Failed = append(result.Failed, topUp.TradeNo)
+	}
+}
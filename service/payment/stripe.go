@@ -0,0 +1,207 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/refund"
+	"github.com/stripe/stripe-go/v81/webhook"
+)
+
+// StripeProvider 充值订单的 ExternalId 为 Checkout Session ID
+type StripeProvider struct {
+}
+
+func (*StripeProvider) Name() string {
+	return model.PaymentMethodStripe
+}
+
+func (*StripeProvider) Enabled() bool {
+	return setting.StripeApiSecret != "" && setting.StripeWebhookSecret != "" && setting.StripePriceId != ""
+}
+
+func setupStripeKey() error {
+	if !strings.HasPrefix(setting.StripeApiSecret, "sk_") && !strings.HasPrefix(setting.StripeApiSecret, "rk_") {
+		return fmt.Errorf("无效的Stripe API密钥")
+	}
+	stripe.Key = setting.StripeApiSecret
+	return nil
+}
+
+func (*StripeProvider) CreateCheckout(req *CheckoutRequest) (*CheckoutResult, error) {
+	if err := setupStripeKey(); err != nil {
+		return nil, err
+	}
+
+	params := &stripe.CheckoutSessionParams{
+		ClientReferenceID: stripe.String(req.TradeNo),
+		SuccessURL:        stripe.String(system_setting.ServerAddress + "/console/log"),
+		CancelURL:         stripe.String(system_setting.ServerAddress + "/console/topup"),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{
+			{
+				Price:    stripe.String(setting.StripePriceId),
+				Quantity: stripe.Int64(req.Amount),
+			},
+		},
+		Mode:                stripe.String(string(stripe.CheckoutSessionModePayment)),
+		AllowPromotionCodes: stripe.Bool(setting.StripePromotionCodesEnabled),
+	}
+
+	if "" == req.StripeCustomer {
+		if "" != req.Email {
+			params.CustomerEmail = stripe.String(req.Email)
+		}
+
+		params.CustomerCreation = stripe.String(string(stripe.CheckoutSessionCustomerCreationAlways))
+	} else {
+		params.Customer = stripe.String(req.StripeCustomer)
+	}
+
+	result, err := session.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckoutResult{Url: result.URL, ExternalId: result.ID}, nil
+}
+
+// VerifyWebhook 只解析一次性付款的结账事件，订阅相关事件原样交回调用方
+func (*StripeProvider) VerifyWebhook(c *gin.Context) (*Notification, error) {
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := c.GetHeader("Stripe-Signature")
+	event, err := webhook.ConstructEventWithOptions(payload, signature, setting.StripeWebhookSecret, webhook.ConstructEventOptions{
+		IgnoreAPIVersionMismatch: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	notification := &Notification{Payload: payload}
+	if event.GetObjectValue("mode") != string(stripe.CheckoutSessionModePayment) {
+		return notification, nil
+	}
+	referenceId := event.GetObjectValue("client_reference_id")
+	status := event.GetObjectValue("status")
+	switch event.Type {
+	case stripe.EventTypeCheckoutSessionCompleted:
+		if "complete" != status {
+			log.Println("错误的Stripe Checkout完成状态:", status, ",", referenceId)
+			return notification, nil
+		}
+		notification.Type = NotificationPaid
+		notification.StripeCustomer = event.GetObjectValue("customer")
+		log.Printf("收到款项：%s, %s(%s)", referenceId, event.GetObjectValue("amount_total"), strings.ToUpper(event.GetObjectValue("currency")))
+	case stripe.EventTypeCheckoutSessionExpired:
+		if "expired" != status {
+			log.Println("错误的Stripe Checkout过期状态:", status, ",", referenceId)
+			return notification, nil
+		}
+		notification.Type = NotificationExpired
+	default:
+		return notification, nil
+	}
+	notification.TradeNo = referenceId
+	notification.ExternalId = event.GetObjectValue("id")
+	return notification, nil
+}
+
+func (*StripeProvider) QueryOrder(topUp *model.TopUp) (*OrderResult, error) {
+	if topUp.ExternalId == "" {
+		return nil, ErrNoExternalId
+	}
+	if err := setupStripeKey(); err != nil {
+		return nil, err
+	}
+	s, err := session.Get(topUp.ExternalId, nil)
+	if err != nil {
+		return nil, err
+	}
+	result := &OrderResult{Status: OrderStatusPending, ExternalId: s.ID}
+	if s.PaymentStatus == stripe.CheckoutSessionPaymentStatusPaid {
+		result.Status = OrderStatusPaid
+	} else if s.Status == stripe.CheckoutSessionStatusExpired {
+		result.Status = OrderStatusExpired
+	}
+	return result, nil
+}
+
+// Refund 订单 Money 不是实际扣款金额，按退款金额占 Money 的比例退还实付金额
+func (*StripeProvider) Refund(topUp *model.TopUp, money float64, idempotencyKey string) error {
+	if topUp.ExternalId == "" {
+		return fmt.Errorf("%w: %w", model.ErrRefundRejected, ErrNoExternalId)
+	}
+	if topUp.Money <= 0 {
+		return fmt.Errorf("%w: 订单支付金额为 0，无法退款", model.ErrRefundRejected)
+	}
+	if err := setupStripeKey(); err != nil {
+		return fmt.Errorf("%w: %w", model.ErrRefundRejected, err)
+	}
+	s, err := session.Get(topUp.ExternalId, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", model.ErrRefundRejected, err)
+	}
+	if s.PaymentIntent == nil {
+		return fmt.Errorf("%w: Stripe 订单没有关联的付款", model.ErrRefundRejected)
+	}
+	amount := decimal.NewFromInt(s.AmountTotal).Mul(decimal.NewFromFloat(money)).Div(decimal.NewFromFloat(topUp.Money)).Round(0).IntPart()
+	if amount <= 0 {
+		return fmt.Errorf("%w: 退款金额过低", model.ErrRefundRejected)
+	}
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(s.PaymentIntent.ID),
+		Amount:        stripe.Int64(amount),
+	}
+	params.SetIdempotencyKey(idempotencyKey)
+	_, err = refund.New(params)
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode >= 400 && stripeErr.HTTPStatusCode < 500 {
+		// 4xx 表示 Stripe 已拒绝该退款请求
+		return fmt.Errorf("%w: %w", model.ErrRefundRejected, err)
+	}
+	return err
+}
+
+func (*StripeProvider) ListTransactions(startTime int64, endTime int64) ([]*Transaction, error) {
+	if err := setupStripeKey(); err != nil {
+		return nil, err
+	}
+	params := &stripe.CheckoutSessionListParams{
+		CreatedRange: &stripe.RangeQueryParams{
+			GreaterThanOrEqual: startTime,
+			LesserThanOrEqual:  endTime,
+		},
+	}
+	transactions := make([]*Transaction, 0)
+	iter := session.List(params)
+	for iter.Next() {
+		s := iter.CheckoutSession()
+		if s.Mode != stripe.CheckoutSessionModePayment || s.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+			continue
+		}
+		transactions = append(transactions, &Transaction{
+			TradeNo:     s.ClientReferenceID,
+			ExternalId:  s.ID,
+			Money:       float64(s.AmountTotal) / 100,
+			Currency:    strings.ToUpper(string(s.Currency)),
+			CreatedTime: s.Created,
+		})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	quotaLedgerReconcileInterval = 1 * time.Hour
+	quotaLedgerCleanupBatchSize  = 1000
+)
+
+var (
+	quotaLedgerTaskOnce    sync.Once
+	quotaLedgerTaskRunning atomic.Bool
+)
+
+// StartQuotaLedgerReconcileTask 定期比对额度台账与实际余额，仅在主节点运行
+func StartQuotaLedgerReconcileTask() {
+	quotaLedgerTaskOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("quota ledger reconcile task started: tick=%s", quotaLedgerReconcileInterval))
+
+			if _, err := RunQuotaLedgerReconcile(); err != nil {
+				logger.LogWarn(context.Background(), fmt.Sprintf("quota ledger reconcile failed: %v", err))
+			}
+			ticker := time.NewTicker(quotaLedgerReconcileInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if _, err := RunQuotaLedgerReconcile(); err != nil {
+					logger.LogWarn(context.Background(), fmt.Sprintf("quota ledger reconcile failed: %v", err))
+				}
+			}
+		})
+	})
+}
+
+// RunQuotaLedgerReconcile 补记缺失的期初余额、推进台账快照后执行一次对账，返回本次发现的差异。
+// 对账完成后按保留期清理已计入快照的旧台账记录
+func RunQuotaLedgerReconcile() ([]*model.QuotaLedgerDrift, error) {
+	if !quotaLedgerTaskRunning.CompareAndSwap(false, true) {
+		return nil, fmt.Errorf("对账正在进行中")
+	}
+	defer quotaLedgerTaskRunning.Store(false)
+
+	opened, err := model.EnsureQuotaLedgerOpenings()
+	if err != nil {
+		return nil, err
+	}
+	if opened > 0 {
+		common.SysLog(fmt.Sprintf("quota ledger: recorded opening balance for %d accounts", opened))
+	}
+	cursor, err := model.AdvanceQuotaLedgerSnapshots()
+	if err != nil {
+		return nil, err
+	}
+	drifts, err := model.ReconcileQuotaLedger()
+	if err != nil {
+		return nil, err
+	}
+	for _, drift := range drifts {
+		common.SysError(fmt.Sprintf("quota ledger drift: account=%s user_id=%d token_id=%d ledger=%d actual=%d diff=%d",
+			drift.Account, drift.UserId, drift.TokenId, drift.LedgerBalance, drift.ActualBalance, drift.Diff))
+	}
+	cleanupQuotaLedgers(cursor)
+	return drifts, nil
+}
+
+func cleanupQuotaLedgers(snapshotCursor int) {
+	retentionDays := operation_setting.GetQuotaLedgerSetting().RetentionDays
+	if retentionDays <= 0 {
+		return
+	}
+	before := time.Now().AddDate(0, 0, -retentionDays).Unix()
+	count, err := model.DeleteOldQuotaLedgers(before, snapshotCursor, quotaLedgerCleanupBatchSize)
+	if err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("quota ledger cleanup failed: %v", err))
+		return
+	}
+	if count > 0 {
+		common.SysLog(fmt.Sprintf("quota ledger: deleted %d records older than %d days", count, retentionDays))
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestTagsHeader 调用方通过该请求头携带成本归属标签，例如 project=search,env=prod
+const RequestTagsHeader = "X-NewAPI-Tags"
+
+const (
+	requestTagMaxCount       = 10
+	requestTagMaxValueLength = 128
+)
+
+var requestTagKeyRegex = regexp.MustCompile(`^[A-Za-z0-9_.\-]{1,64}$`)
+
+func parseRequestTagsHeader(header string) map[string]string {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		tags[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return tags
+}
+
+// parseRequestTagsMetadata 读取 OpenAI 请求体 metadata 中的字符串字段
+func parseRequestTagsMetadata(request dto.Request) map[string]string {
+	var metadata json.RawMessage
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		metadata = r.Metadata
+	case *dto.OpenAIResponsesRequest:
+		metadata = r.Metadata
+	}
+	tags := make(map[string]string)
+	if len(metadata) == 0 {
+		return tags
+	}
+	var values map[string]any
+	if err := common.Unmarshal(metadata, &values); err != nil {
+		return tags
+	}
+	for key, value := range values {
+		if str, ok := value.(string); ok {
+			tags[key] = str
+		}
+	}
+	return tags
+}
+
+// SetupRequestTags 解析请求头与 metadata 中的标签（请求头优先），仅保留令牌白名单内的键
+func SetupRequestTags(c *gin.Context, request dto.Request) {
+	allowed := common.GetContextKeyStringSlice(c, constant.ContextKeyTokenAllowedTags)
+	if len(allowed) == 0 {
+		return
+	}
+	candidates := parseRequestTagsMetadata(request)
+	for key, value := range parseRequestTagsHeader(c.GetHeader(RequestTagsHeader)) {
+		candidates[key] = value
+	}
+	tags := make(map[string]string)
+	for key, value := range candidates {
+		if len(tags) >= requestTagMaxCount {
+			break
+		}
+		if !requestTagKeyRegex.MatchString(key) || !common.StringsContains(allowed, key) {
+			continue
+		}
+		if value == "" || len(value) > requestTagMaxValueLength {
+			continue
+		}
+		tags[key] = value
+	}
+	if len(tags) > 0 {
+		common.SetContextKey(c, constant.ContextKeyRequestTags, tags)
+	}
+}
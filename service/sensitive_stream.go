@@ -0,0 +1,412 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const sensitiveWordReplacement = "**###**"
+
+// 上游流式数据的格式，终止输出时按该格式构造结束数据块
+const (
+	sensitiveStreamFormatOpenAI    = "openai"
+	sensitiveStreamFormatClaude    = "claude"
+	sensitiveStreamFormatGemini    = "gemini"
+	sensitiveStreamFormatResponses = "responses"
+)
+
+type sensitiveStreamChunk struct {
+	data     string
+	texts    []string // 数据块中按遍历顺序排列的文本字段
+	runes    int
+	modified bool
+}
+
+// SensitiveStream 流式输出的敏感词检查。数据块的文本拼接成滑动窗口检查，窗口末尾不足最长敏感词长度的
+// 数据块先暂存，确保被拆分在两个数据块中的敏感词也能被发现。命中时按 StopOnSensitiveEnabled
+// 替换敏感词，或丢弃命中位置之后的内容并以 content_filter 结束输出，只按已发送的内容计费
+type SensitiveStream struct {
+	c          *gin.Context
+	info       *relaycommon.RelayInfo
+	words      []string
+	maxWordLen int
+
+	pending   []*sensitiveStreamChunk
+	delivered strings.Builder
+
+	format           string
+	lastData         string
+	claudeBlockIndex int64
+	claudeBlockOpen  bool
+
+	Stopped bool
+}
+
+// NewSensitiveStream 未开启输出检查或没有敏感词时返回 nil
+func NewSensitiveStream(c *gin.Context, info *relaycommon.RelayInfo) *SensitiveStream {
+	if !setting.ShouldCheckCompletionSensitive() || len(setting.SensitiveWords) == 0 {
+		return nil
+	}
+	words := setting.SensitiveWords
+	maxWordLen := 0
+	for _, word := range words {
+		if l := len([]rune(strings.TrimSpace(word))); l > maxWordLen {
+			maxWordLen = l
+		}
+	}
+	if maxWordLen == 0 {
+		return nil
+	}
+	return &SensitiveStream{
+		c:          c,
+		info:       info,
+		words:      words,
+		maxWordLen: maxWordLen,
+	}
+}
+
+// Push 加入一个上游数据块，返回可以发送的数据块。终止输出时返回值包含构造的结束数据块，并将 Stopped 置为 true
+func (s *SensitiveStream) Push(data string) []string {
+	if s.Stopped {
+		return nil
+	}
+	s.observe(data)
+	chunk := &sensitiveStreamChunk{data: data}
+	if root, err := decodeGuardrailJSON([]byte(data)); err == nil {
+		walkGuardrailText(root, "", guardrailOutputTextKeys, func(text string) string {
+			chunk.texts = append(chunk.texts, text)
+			chunk.runes += len([]rune(text))
+			return text
+		})
+	}
+	s.pending = append(s.pending, chunk)
+	if chunk.runes > 0 {
+		if stopped := s.check(); stopped {
+			return s.stop()
+		}
+	}
+	return s.release(false)
+}
+
+// Flush 流结束时放行所有暂存的数据块，暂存内容在加入时已经检查过
+func (s *SensitiveStream) Flush() []string {
+	if s.Stopped {
+		return nil
+	}
+	return s.release(true)
+}
+
+// windowRune 滑动窗口中的一个字符及其所属的数据块与文本字段
+type windowRune struct {
+	r     rune
+	chunk int
+	field int
+}
+
+func (s *SensitiveStream) buildWindow() []windowRune {
+	window := make([]windowRune, 0)
+	for i, chunk := range s.pending {
+		for j, text := range chunk.texts {
+			for _, r := range text {
+				window = append(window, windowRune{r: r, chunk: i, field: j})
+			}
+		}
+	}
+	return window
+}
+
+// check 检查暂存数据块组成的窗口，需要终止输出时返回 true；否则替换命中的敏感词
+func (s *SensitiveStream) check() bool {
+	window := s.buildWindow()
+	lowered := make([]rune, len(window))
+	for i, wr := range window {
+		lowered[i] = unicode.ToLower(wr.r)
+	}
+	m := getOrBuildAC(s.words)
+	if m == nil {
+		return false
+	}
+	hits := m.MultiPatternSearch(lowered, false)
+	if len(hits) == 0 {
+		return false
+	}
+	words := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		words = append(words, string(hit.Word))
+	}
+	logger.LogWarn(s.c, fmt.Sprintf("completion sensitive words detected: %s", strings.Join(words, ", ")))
+	common.SetContextKey(s.c, constant.ContextKeyAdminRejectReason, "completion_sensitive_words")
+
+	// keep 标记保留的字符，insert 标记在该字符前插入替换文本
+	keep := make([]bool, len(window))
+	insert := make([]bool, len(window))
+	for i := range keep {
+		keep[i] = true
+	}
+	cut := len(window)
+	for _, hit := range hits {
+		if hit.Pos < cut {
+			cut = hit.Pos
+		}
+		insert[hit.Pos] = true
+		for i := hit.Pos; i < hit.Pos+len(hit.Word) && i < len(window); i++ {
+			keep[i] = false
+		}
+	}
+	if setting.StopOnSensitiveEnabled {
+		// 只保留第一个命中位置之前的内容
+		for i := range keep {
+			keep[i] = i < cut
+			insert[i] = false
+		}
+	}
+	s.rewrite(window, keep, insert)
+	return setting.StopOnSensitiveEnabled
+}
+
+// rewrite 按标记重建暂存数据块的文本字段
+func (s *SensitiveStream) rewrite(window []windowRune, keep []bool, insert []bool) {
+	builders := make(map[[2]int]*strings.Builder)
+	for i, wr := range window {
+		key := [2]int{wr.chunk, wr.field}
+		b, ok := builders[key]
+		if !ok {
+			b = &strings.Builder{}
+			builders[key] = b
+		}
+		if insert[i] {
+			b.WriteString(sensitiveWordReplacement)
+		}
+		if keep[i] {
+			b.WriteRune(wr.r)
+		}
+	}
+	for i, chunk := range s.pending {
+		for j, text := range chunk.texts {
+			b, ok := builders[[2]int{i, j}]
+			if !ok || b.String() == text {
+				continue
+			}
+			chunk.texts[j] = b.String()
+			chunk.modified = true
+		}
+		chunk.runes = 0
+		for _, text := range chunk.texts {
+			chunk.runes += len([]rune(text))
+		}
+	}
+}
+
+// release 放行窗口前部的数据块，保留的文本至少为最长敏感词长度减一，all 为 true 时全部放行
+func (s *SensitiveStream) release(all bool) []string {
+	keepRunes := s.maxWordLen - 1
+	ready := make([]string, 0)
+	for len(s.pending) > 0 {
+		if !all {
+			rest := 0
+			for _, chunk := range s.pending[1:] {
+				rest += chunk.runes
+			}
+			if rest < keepRunes {
+				break
+			}
+		}
+		ready = append(ready, s.deliver(s.pending[0]))
+		s.pending = s.pending[1:]
+	}
+	return ready
+}
+
+func (s *SensitiveStream) deliver(chunk *sensitiveStreamChunk) string {
+	for _, text := range chunk.texts {
+		s.delivered.WriteString(text)
+	}
+	if !chunk.modified {
+		return chunk.data
+	}
+	root, err := decodeGuardrailJSON([]byte(chunk.data))
+	if err != nil {
+		return chunk.data
+	}
+	i := 0
+	root = walkGuardrailText(root, "", guardrailOutputTextKeys, func(text string) string {
+		if i >= len(chunk.texts) {
+			return text
+		}
+		text = chunk.texts[i]
+		i++
+		return text
+	})
+	data, err := common.Marshal(root)
+	if err != nil {
+		return chunk.data
+	}
+	return string(data)
+}
+
+// stop 放行命中位置之前的内容，并追加结束数据块
+func (s *SensitiveStream) stop() []string {
+	s.Stopped = true
+	ready := make([]string, 0, len(s.pending)+3)
+	for _, chunk := range s.pending {
+		// 命中位置之后的数据块文本已被清空，只放行仍有内容的数据块
+		if chunk.runes == 0 && len(chunk.texts) > 0 {
+			continue
+		}
+		ready = append(ready, s.deliver(chunk))
+	}
+	s.pending = nil
+	return append(ready, s.finishChunks()...)
+}
+
+// observe 记录上游格式与结束数据块需要的信息
+func (s *SensitiveStream) observe(data string) {
+	result := gjson.Parse(data)
+	switch {
+	case result.Get("choices").Exists():
+		s.format = sensitiveStreamFormatOpenAI
+		s.lastData = data
+	case result.Get("candidates").Exists() || result.Get("usageMetadata").Exists():
+		s.format = sensitiveStreamFormatGemini
+		s.lastData = data
+	case strings.HasPrefix(result.Get("type").String(), "response."):
+		s.format = sensitiveStreamFormatResponses
+		if result.Get("response.id").Exists() {
+			s.lastData = data
+		}
+	case result.Get("type").Exists():
+		switch result.Get("type").String() {
+		case "message_start", "message_delta", "message_stop", "ping":
+			s.format = sensitiveStreamFormatClaude
+		case "content_block_start":
+			s.format = sensitiveStreamFormatClaude
+			s.claudeBlockIndex = result.Get("index").Int()
+			s.claudeBlockOpen = true
+		case "content_block_delta":
+			s.format = sensitiveStreamFormatClaude
+		case "content_block_stop":
+			s.format = sensitiveStreamFormatClaude
+			s.claudeBlockOpen = false
+		}
+	}
+}
+
+// finishChunks 按上游格式构造结束数据块，由各渠道的流处理转换为客户端格式；usage 按已发送的内容计算。
+// 无法识别的格式不构造结束数据块，直接结束输出
+func (s *SensitiveStream) finishChunks() []string {
+	usage := ResponseText2Usage(s.c, s.delivered.String(), s.info.UpstreamModelName, s.info.GetEstimatePromptTokens())
+	chunks := make([]string, 0, 3)
+	switch s.format {
+	case sensitiveStreamFormatOpenAI:
+		last := gjson.Parse(s.lastData)
+		base := map[string]any{
+			"id":      last.Get("id").String(),
+			"object":  "chat.completion.chunk",
+			"created": last.Get("created").Int(),
+			"model":   last.Get("model").String(),
+		}
+		finish := copyMap(base)
+		finish["choices"] = []map[string]any{{
+			"index":         0,
+			"delta":         map[string]any{},
+			"finish_reason": constant.FinishReasonContentFilter,
+		}}
+		usageChunk := copyMap(base)
+		usageChunk["choices"] = []any{}
+		usageChunk["usage"] = usage
+		chunks = appendJSONChunk(chunks, finish)
+		chunks = appendJSONChunk(chunks, usageChunk)
+	case sensitiveStreamFormatClaude:
+		if s.claudeBlockOpen {
+			chunks = appendJSONChunk(chunks, map[string]any{
+				"type":  "content_block_stop",
+				"index": s.claudeBlockIndex,
+			})
+		}
+		chunks = appendJSONChunk(chunks, map[string]any{
+			"type": "message_delta",
+			"delta": map[string]any{
+				"stop_reason":   "refusal",
+				"stop_sequence": nil,
+			},
+			"usage": map[string]any{
+				"output_tokens": usage.CompletionTokens,
+			},
+		})
+		chunks = appendJSONChunk(chunks, map[string]any{
+			"type": "message_stop",
+		})
+	case sensitiveStreamFormatGemini:
+		last := gjson.Parse(s.lastData)
+		if promptTokens := last.Get("usageMetadata.promptTokenCount").Int(); promptTokens > 0 {
+			usage.PromptTokens = int(promptTokens)
+			usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		}
+		chunks = appendJSONChunk(chunks, map[string]any{
+			"candidates": []map[string]any{{
+				"content": map[string]any{
+					"role":  "model",
+					"parts": []any{},
+				},
+				"finishReason": "SAFETY",
+				"index":        0,
+			}},
+			"usageMetadata": dto.GeminiUsageMetadata{
+				PromptTokenCount:     usage.PromptTokens,
+				CandidatesTokenCount: usage.CompletionTokens,
+				TotalTokenCount:      usage.TotalTokens,
+			},
+			"modelVersion": last.Get("modelVersion").String(),
+		})
+	case sensitiveStreamFormatResponses:
+		last := gjson.Parse(s.lastData).Get("response")
+		chunks = appendJSONChunk(chunks, map[string]any{
+			"type": "response.incomplete",
+			"response": map[string]any{
+				"id":         last.Get("id").String(),
+				"object":     "response",
+				"created_at": last.Get("created_at").Int(),
+				"model":      last.Get("model").String(),
+				"status":     "incomplete",
+				"incomplete_details": map[string]any{
+					"reason": constant.FinishReasonContentFilter,
+				},
+				"output": []any{},
+				"usage": map[string]any{
+					"input_tokens":  usage.PromptTokens,
+					"output_tokens": usage.CompletionTokens,
+					"total_tokens":  usage.TotalTokens,
+				},
+			},
+		})
+	}
+	return chunks
+}
+
+func copyMap(m map[string]any) map[string]any {
+	result := make(map[string]any, len(m))
+	for k, v := range m {
+		result[k] = v
+	}
+	return result
+}
+
+func appendJSONChunk(chunks []string, v any) []string {
+	data, err := common.Marshal(v)
+	if err != nil {
+		common.SysError("failed to marshal stream finish chunk: " + err.Error())
+		return chunks
+	}
+	return append(chunks, string(data))
+}
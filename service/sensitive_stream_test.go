@@ -0,0 +1,82 @@
+package service
+
+import (
+	"testing"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestSensitiveStreamCrossChunk(t *testing.T) {
+	origStop := setting.StopOnSensitiveEnabled
+	setting.StopOnSensitiveEnabled = false
+	t.Cleanup(func() {
+		setting.StopOnSensitiveEnabled = origStop
+	})
+
+	tests := []struct {
+		name     string
+		contents []string
+		wantText string
+	}{
+		{name: "word inside one chunk", contents: []string{"a badword here"}, wantText: "a " + sensitiveWordReplacement + " here"},
+		{name: "word split across chunks", contents: []string{"a bad", "word here"}, wantText: "a " + sensitiveWordReplacement + " here"},
+		{name: "word split across three chunks", contents: []string{"a ba", "dw", "ord here"}, wantText: "a " + sensitiveWordReplacement + " here"},
+		{name: "case insensitive", contents: []string{"a BAD", "Word here"}, wantText: "a " + sensitiveWordReplacement + " here"},
+		{name: "no hit", contents: []string{"a bad", " word here"}, wantText: "a bad word here"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SensitiveStream{
+				c:          newStreamTestContext(),
+				words:      []string{"badword"},
+				maxWordLen: len("badword"),
+			}
+			out := make([]string, 0)
+			for _, content := range tt.contents {
+				out = append(out, s.Push(openAIStreamChunk(t, content))...)
+			}
+			out = append(out, s.Flush()...)
+			require.False(t, s.Stopped)
+			require.Equal(t, tt.wantText, joinStreamText(out))
+		})
+	}
+}
+
+func TestSensitiveStreamStopResponses(t *testing.T) {
+	origStop := setting.StopOnSensitiveEnabled
+	setting.StopOnSensitiveEnabled = true
+	t.Cleanup(func() {
+		setting.StopOnSensitiveEnabled = origStop
+	})
+
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "gpt-4o"}}
+	info.SetEstimatePromptTokens(12)
+	s := &SensitiveStream{
+		c:          newStreamTestContext(),
+		info:       info,
+		words:      []string{"badword"},
+		maxWordLen: len("badword"),
+	}
+	out := make([]string, 0)
+	for _, data := range []string{
+		`{"type":"response.created","response":{"id":"resp_1","object":"response","created_at":100,"model":"gpt-4o","status":"in_progress"}}`,
+		`{"type":"response.output_text.delta","item_id":"msg_1","output_index":0,"delta":"hello there "}`,
+		`{"type":"response.output_text.delta","item_id":"msg_1","output_index":0,"delta":"bad"}`,
+		`{"type":"response.output_text.delta","item_id":"msg_1","output_index":0,"delta":"word more"}`,
+	} {
+		out = append(out, s.Push(data)...)
+	}
+	require.True(t, s.Stopped)
+	require.Equal(t, "hello there ", joinStreamText(out[:len(out)-1]))
+
+	finish := gjson.Parse(out[len(out)-1])
+	require.Equal(t, "response.incomplete", finish.Get("type").String())
+	require.Equal(t, "resp_1", finish.Get("response.id").String())
+	require.Equal(t, "content_filter", finish.Get("response.incomplete_details.reason").String())
+	require.EqualValues(t, 12, finish.Get("response.usage.input_tokens").Int())
+	require.Positive(t, finish.Get("response.usage.output_tokens").Int())
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const statementTaskInterval = 1 * time.Hour
+
+var (
+	statementTaskOnce    sync.Once
+	statementTaskRunning atomic.Bool
+	// 本进程已生成完毕的账期，避免每小时重复扫描
+	statementGeneratedPeriod atomic.Value
+)
+
+// StartStatementTask 每月初为上月有额度变动的用户生成月度账单，仅在主节点运行
+func StartStatementTask() {
+	statementTaskOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("statement task started: tick=%s", statementTaskInterval))
+
+			runStatementTaskOnce()
+			ticker := time.NewTicker(statementTaskInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				runStatementTaskOnce()
+			}
+		})
+	})
+}
+
+func runStatementTaskOnce() {
+	if !operation_setting.GetStatementSetting().Enabled {
+		return
+	}
+	period := model.GetLastStatementPeriod()
+	if generated, _ := statementGeneratedPeriod.Load().(string); generated == period {
+		return
+	}
+	if !statementTaskRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer statementTaskRunning.Store(false)
+
+	count, err := model.GenerateStatements(period)
+	if err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("statement generate failed: period=%s, error=%v", period, err))
+		return
+	}
+	statementGeneratedPeriod.Store(period)
+	if count > 0 {
+		common.SysLog(fmt.Sprintf("statement: generated %d statements for %s", count, period))
+	}
+}
@@ -0,0 +1,357 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/console_setting"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	StatusPageOperational = "operational"
+	StatusPageDegraded    = "degraded"
+	StatusPageOutage      = "outage"
+	StatusPageNoData      = "no_data"
+)
+
+const (
+	statusPageBucketSize       = int64(15 * 60)
+	statusPageMinRequests      = 5   // 时间桶内请求数不足时不判定故障
+	statusPageDegradedRate     = 0.2 // 失败率达到该值视为性能下降
+	statusPageOutageRate       = 0.5 // 失败率达到该值视为服务中断
+	statusPageLatencySamples   = 50000
+	statusPageCacheTTL         = 60 * time.Second
+	StatusPageDefaultWindow    = 24 * time.Hour
+	statusPageOngoingThreshold = 2 * statusPageBucketSize
+)
+
+// StatusPageWindows 状态页可选的统计窗口
+var StatusPageWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// StatusPageMetrics 可用率与延迟，延迟单位为秒（与日志中的 use_time 一致）
+type StatusPageMetrics struct {
+	Status       string  `json:"status"`
+	Availability float64 `json:"availability"` // 百分比
+	Requests     int64   `json:"requests"`
+	Failures     int64   `json:"failures"`
+	LatencyP50   float64 `json:"latency_p50"`
+	LatencyP95   float64 `json:"latency_p95"`
+}
+
+type StatusPageGroup struct {
+	Group string `json:"group"`
+	StatusPageMetrics
+}
+
+type StatusPageModel struct {
+	ModelName string `json:"model_name"`
+	StatusPageMetrics
+	Groups []*StatusPageGroup `json:"groups"`
+}
+
+// StatusPageIncident 连续失败率超标的时间段，EndTime 为最后一个故障时间桶的结束时间
+type StatusPageIncident struct {
+	Id        string  `json:"id"`
+	ModelName string  `json:"model_name"`
+	Status    string  `json:"status"`
+	StartTime int64   `json:"start_time"`
+	EndTime   int64   `json:"end_time"`
+	ErrorRate float64 `json:"error_rate"` // 百分比
+	Ongoing   bool    `json:"ongoing"`
+}
+
+type StatusPageReport struct {
+	Status    string                `json:"status"`
+	StartTime int64                 `json:"start_time"`
+	EndTime   int64                 `json:"end_time"`
+	UpdatedAt int64                 `json:"updated_at"`
+	Models    []*StatusPageModel    `json:"models"`
+	Incidents []*StatusPageIncident `json:"incidents"`
+}
+
+type statusPageCacheEntry struct {
+	report    *StatusPageReport
+	expiresAt time.Time
+}
+
+var (
+	statusPageCache     = make(map[time.Duration]*statusPageCacheEntry)
+	statusPageCacheLock sync.Mutex
+	statusPageGroup     singleflight.Group // 同一窗口的缓存过期后只重建一次
+)
+
+type statusPageCounter struct {
+	success  int64
+	failure  int64
+	useTimes []int
+}
+
+func (c *statusPageCounter) metrics() StatusPageMetrics {
+	m := StatusPageMetrics{
+		Requests: c.success + c.failure,
+		Failures: c.failure,
+	}
+	if m.Requests == 0 {
+		m.Status = StatusPageNoData
+		m.Availability = 100
+	} else {
+		errorRate := float64(c.failure) / float64(m.Requests)
+		m.Status = statusByErrorRate(errorRate, m.Requests)
+		m.Availability = math.Round((1-errorRate)*10000) / 100
+	}
+	if len(c.useTimes) > 0 {
+		slices.Sort(c.useTimes)
+		m.LatencyP50 = percentile(c.useTimes, 0.5)
+		m.LatencyP95 = percentile(c.useTimes, 0.95)
+	}
+	return m
+}
+
+func percentile(sorted []int, p float64) float64 {
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	idx = max(0, min(idx, len(sorted)-1))
+	return float64(sorted[idx])
+}
+
+func statusByErrorRate(errorRate float64, requests int64) string {
+	if requests < statusPageMinRequests {
+		return StatusPageOperational
+	}
+	switch {
+	case errorRate >= statusPageOutageRate:
+		return StatusPageOutage
+	case errorRate >= statusPageDegradedRate:
+		return StatusPageDegraded
+	}
+	return StatusPageOperational
+}
+
+func statusSeverity(status string) int {
+	switch status {
+	case StatusPageOutage:
+		return 2
+	case StatusPageDegraded:
+		return 1
+	}
+	return 0
+}
+
+// GetStatusPageReport 根据日志计算公开状态页数据，结果缓存一分钟。
+// 成功请求来自消费日志，失败请求来自错误日志（需开启错误日志记录），重试产生的每次失败都会计入。
+func GetStatusPageReport(window time.Duration) (*StatusPageReport, error) {
+	if !isStatusPageWindow(window) {
+		return nil, fmt.Errorf("unsupported status page window: %s", window)
+	}
+
+	if report := getCachedStatusPageReport(window); report != nil {
+		return report, nil
+	}
+	result, err, _ := statusPageGroup.Do(window.String(), func() (interface{}, error) {
+		// 等待期间其他请求可能已经完成重建
+		if report := getCachedStatusPageReport(window); report != nil {
+			return report, nil
+		}
+		report, err := buildStatusPageReport(window)
+		if err != nil {
+			return nil, err
+		}
+		statusPageCacheLock.Lock()
+		statusPageCache[window] = &statusPageCacheEntry{
+			report:    report,
+			expiresAt: time.Now().Add(statusPageCacheTTL),
+		}
+		statusPageCacheLock.Unlock()
+		return report, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*StatusPageReport), nil
+}
+
+func getCachedStatusPageReport(window time.Duration) *StatusPageReport {
+	statusPageCacheLock.Lock()
+	defer statusPageCacheLock.Unlock()
+	if entry, ok := statusPageCache[window]; ok && time.Now().Before(entry.expiresAt) {
+		return entry.report
+	}
+	return nil
+}
+
+func isStatusPageWindow(window time.Duration) bool {
+	for _, w := range StatusPageWindows {
+		if w == window {
+			return true
+		}
+	}
+	return false
+}
+
+func buildStatusPageReport(window time.Duration) (*StatusPageReport, error) {
+	models := console_setting.GetStatusPageModels()
+	groups := console_setting.GetStatusPageGroups()
+	endTime := common.GetTimestamp()
+	startTime := endTime - int64(window.Seconds())
+
+	buckets, err := model.GetStatusPageBuckets(models, startTime, endTime, statusPageBucketSize)
+	if err != nil {
+		return nil, err
+	}
+	useTimes, err := model.GetStatusPageUseTimes(models, startTime, endTime, statusPageLatencySamples)
+	if err != nil {
+		return nil, err
+	}
+
+	modelCounters := make(map[string]*statusPageCounter)
+	groupCounters := make(map[string]map[string]*statusPageCounter)
+	timelines := make(map[string]map[int64]*statusPageCounter)
+	for _, name := range models {
+		modelCounters[name] = &statusPageCounter{}
+		groupCounters[name] = make(map[string]*statusPageCounter)
+		for _, group := range groups {
+			groupCounters[name][group] = &statusPageCounter{}
+		}
+		timelines[name] = make(map[int64]*statusPageCounter)
+	}
+
+	add := func(counter *statusPageCounter, logType int, count int64) {
+		if logType == model.LogTypeError {
+			counter.failure += count
+		} else {
+			counter.success += count
+		}
+	}
+	for _, bucket := range buckets {
+		modelCounter, ok := modelCounters[bucket.ModelName]
+		if !ok {
+			continue
+		}
+		add(modelCounter, bucket.Type, bucket.Count)
+		if groupCounter, ok := groupCounters[bucket.ModelName][bucket.GroupName]; ok {
+			add(groupCounter, bucket.Type, bucket.Count)
+		}
+		timeline := timelines[bucket.ModelName]
+		if timeline[bucket.Bucket] == nil {
+			timeline[bucket.Bucket] = &statusPageCounter{}
+		}
+		add(timeline[bucket.Bucket], bucket.Type, bucket.Count)
+	}
+	for _, useTime := range useTimes {
+		modelCounter, ok := modelCounters[useTime.ModelName]
+		if !ok {
+			continue
+		}
+		modelCounter.useTimes = append(modelCounter.useTimes, useTime.UseTime)
+		if groupCounter, ok := groupCounters[useTime.ModelName][useTime.GroupName]; ok {
+			groupCounter.useTimes = append(groupCounter.useTimes, useTime.UseTime)
+		}
+	}
+
+	report := &StatusPageReport{
+		Status:    StatusPageOperational,
+		StartTime: startTime,
+		EndTime:   endTime,
+		UpdatedAt: endTime,
+		Models:    make([]*StatusPageModel, 0, len(models)),
+		Incidents: make([]*StatusPageIncident, 0),
+	}
+	for _, name := range models {
+		item := &StatusPageModel{
+			ModelName:         name,
+			StatusPageMetrics: modelCounters[name].metrics(),
+			Groups:            make([]*StatusPageGroup, 0, len(groups)),
+		}
+		for _, group := range groups {
+			item.Groups = append(item.Groups, &StatusPageGroup{
+				Group:             group,
+				StatusPageMetrics: groupCounters[name][group].metrics(),
+			})
+		}
+
+		incidents := detectStatusPageIncidents(name, timelines[name], endTime)
+		// 模型的当前状态以进行中的故障为准，而不是整个窗口的平均值
+		if item.Status != StatusPageNoData {
+			item.Status = StatusPageOperational
+		}
+		for _, incident := range incidents {
+			if incident.Ongoing && statusSeverity(incident.Status) > statusSeverity(item.Status) {
+				item.Status = incident.Status
+			}
+		}
+		if statusSeverity(item.Status) > statusSeverity(report.Status) {
+			report.Status = item.Status
+		}
+		report.Models = append(report.Models, item)
+		report.Incidents = append(report.Incidents, incidents...)
+	}
+	sort.SliceStable(report.Incidents, func(i, j int) bool {
+		return report.Incidents[i].StartTime > report.Incidents[j].StartTime
+	})
+	return report, nil
+}
+
+// detectStatusPageIncidents 将连续的故障时间桶合并为一次故障
+func detectStatusPageIncidents(modelName string, timeline map[int64]*statusPageCounter, now int64) []*StatusPageIncident {
+	keys := make([]int64, 0, len(timeline))
+	for bucket := range timeline {
+		keys = append(keys, bucket)
+	}
+	slices.Sort(keys)
+
+	incidents := make([]*StatusPageIncident, 0)
+	var current *StatusPageIncident
+	var success, failure int64
+	closeIncident := func() {
+		if current == nil {
+			return
+		}
+		current.ErrorRate = math.Round(float64(failure)*10000/float64(success+failure)) / 100
+		current.Ongoing = now-current.EndTime < statusPageOngoingThreshold
+		incidents = append(incidents, current)
+		current = nil
+		success, failure = 0, 0
+	}
+	for _, bucket := range keys {
+		counter := timeline[bucket]
+		requests := counter.success + counter.failure
+		status := statusByErrorRate(float64(counter.failure)/float64(requests), requests)
+		if status == StatusPageOperational {
+			if requests >= statusPageMinRequests {
+				closeIncident()
+			}
+			continue
+		}
+		if current != nil && bucket > current.EndTime {
+			// 中间存在没有请求的时间桶，视为新的故障
+			closeIncident()
+		}
+		if current == nil {
+			current = &StatusPageIncident{
+				Id:        fmt.Sprintf("%s-%d", modelName, bucket),
+				ModelName: modelName,
+				Status:    status,
+				StartTime: bucket,
+			}
+		}
+		if statusSeverity(status) > statusSeverity(current.Status) {
+			current.Status = status
+		}
+		current.EndTime = bucket + statusPageBucketSize
+		success += counter.success
+		failure += counter.failure
+	}
+	closeIncident()
+	return incidents
+}
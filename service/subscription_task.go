@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const subscriptionExpireInterval = 10 * time.Minute
+
+var (
+	subscriptionTaskOnce    sync.Once
+	subscriptionTaskRunning atomic.Bool
+)
+
+// StartSubscriptionExpireTask 定期使到期、宽限期结束或超时未支付的订阅失效，仅在主节点运行
+func StartSubscriptionExpireTask() {
+	subscriptionTaskOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("subscription expire task started: tick=%s", subscriptionExpireInterval))
+
+			ticker := time.NewTicker(subscriptionExpireInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				runSubscriptionExpireOnce()
+			}
+		})
+	})
+}
+
+func runSubscriptionExpireOnce() {
+	if !subscriptionTaskRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer subscriptionTaskRunning.Store(false)
+
+	count, err := model.ExpireDueSubscriptions()
+	if err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("subscription expire failed: %v", err))
+		return
+	}
+	if count > 0 {
+		common.SysLog(fmt.Sprintf("subscription: expired %d subscriptions", count))
+	}
+}
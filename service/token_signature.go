@@ -0,0 +1,122 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 签名模式令牌需要携带的请求头。签名为以下内容以换行符连接后，用令牌签名密钥计算的 HMAC-SHA256（十六进制）：
+// 请求方法、请求路径（含查询参数）、时间戳（Unix 秒）、nonce、请求体的 SHA-256（十六进制）
+const (
+	TokenSignatureTimestampHeader = "X-Signature-Timestamp"
+	TokenSignatureNonceHeader     = "X-Signature-Nonce"
+	TokenSignatureHeader          = "X-Signature"
+)
+
+var (
+	tokenSignatureNonceMu    sync.Mutex
+	tokenSignatureNonces     = make(map[string]int64)
+	tokenSignatureNonceSweep int64
+)
+
+// BuildTokenSignaturePayload 生成待签名的字符串
+func BuildTokenSignaturePayload(method string, requestURI string, timestamp string, nonce string, body []byte) string {
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		requestURI,
+		timestamp,
+		nonce,
+		hex.EncodeToString(common.Sha256Raw(body)),
+	}, "\n")
+}
+
+// useTokenSignatureNonce 记录 nonce，窗口期内重复使用时返回 false。启用 Redis 时多节点共享，否则仅在本节点内存中去重
+func useTokenSignatureNonce(tokenId int, nonce string, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf("token_signature_nonce:%d:%s", tokenId, nonce)
+	if common.RedisEnabled {
+		return common.RedisSetNX(key, "1", ttl)
+	}
+	now := time.Now().Unix()
+	tokenSignatureNonceMu.Lock()
+	defer tokenSignatureNonceMu.Unlock()
+	if now-tokenSignatureNonceSweep >= 60 {
+		for k, expireAt := range tokenSignatureNonces {
+			if expireAt <= now {
+				delete(tokenSignatureNonces, k)
+			}
+		}
+		tokenSignatureNonceSweep = now
+	}
+	if expireAt, ok := tokenSignatureNonces[key]; ok && expireAt > now {
+		return false, nil
+	}
+	tokenSignatureNonces[key] = now + int64(ttl.Seconds())
+	return true, nil
+}
+
+// VerifyTokenSignature 校验签名模式令牌的请求签名，未开启签名模式的令牌直接通过
+func VerifyTokenSignature(c *gin.Context, token *model.Token) error {
+	if !token.SignatureRequired {
+		return nil
+	}
+	if token.SignatureSecret == "" {
+		return errors.New("令牌未配置签名密钥")
+	}
+	timestamp := c.Request.Header.Get(TokenSignatureTimestampHeader)
+	nonce := c.Request.Header.Get(TokenSignatureNonceHeader)
+	signature := c.Request.Header.Get(TokenSignatureHeader)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return fmt.Errorf("该令牌要求请求签名，请携带 %s、%s 与 %s 请求头",
+			TokenSignatureTimestampHeader, TokenSignatureNonceHeader, TokenSignatureHeader)
+	}
+	if len(nonce) < 8 || len(nonce) > 64 {
+		return errors.New("nonce 长度必须为 8 到 64 个字符")
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("签名时间戳格式错误")
+	}
+	window := int64(operation_setting.GetTokenSignatureSetting().WindowSeconds)
+	if window <= 0 {
+		window = 300
+	}
+	now := time.Now().Unix()
+	if ts < now-window || ts > now+window {
+		return errors.New("签名时间戳已过期")
+	}
+
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	payload := BuildTokenSignaturePayload(c.Request.Method, c.Request.URL.RequestURI(), timestamp, nonce, body)
+	expected := common.HmacSha256(payload, token.SignatureSecret)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return errors.New("请求签名无效")
+	}
+
+	// 签名通过后再记录 nonce，避免无效请求占用；窗口两侧都可能被使用，因此保留两倍窗口
+	ok, err := useTokenSignatureNonce(token.Id, nonce, time.Duration(window*2)*time.Second)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("nonce 已被使用，疑似重放请求")
+	}
+	return nil
+}
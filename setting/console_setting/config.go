@@ -11,6 +11,9 @@ type ConsoleSetting struct {
 	UptimeKumaEnabled    bool   `json:"uptime_kuma_enabled"`   // 是否启用 Uptime Kuma 面板
 	AnnouncementsEnabled bool   `json:"announcements_enabled"` // 是否启用系统公告面板
 	FAQEnabled           bool   `json:"faq_enabled"`           // 是否启用常见问答面板
+	StatusPageEnabled    bool   `json:"status_page_enabled"`   // 是否启用公开状态页
+	StatusPageModels     string `json:"status_page_models"`    // 状态页公开的模型 (JSON 数组字符串)
+	StatusPageGroups     string `json:"status_page_groups"`    // 状态页公开的分组 (JSON 数组字符串)
 }
 
 // 默认配置
@@ -23,6 +26,9 @@ var defaultConsoleSetting = ConsoleSetting{
 	UptimeKumaEnabled:    true,
 	AnnouncementsEnabled: true,
 	FAQEnabled:           true,
+	StatusPageEnabled:    false,
+	StatusPageModels:     "",
+	StatusPageGroups:     "",
 }
 
 // 全局实例
@@ -73,6 +73,10 @@ func ValidateConsoleSettings(settingsStr string, settingType string) error {
 		return validateFAQ(settingsStr)
 	case "UptimeKumaGroups":
 		return validateUptimeKumaGroups(settingsStr)
+	case "StatusPageModels":
+		return validateStringList(settingsStr, "状态页模型", 200)
+	case "StatusPageGroups":
+		return validateStringList(settingsStr, "状态页分组", 50)
 	default:
 		return fmt.Errorf("未知的设置类型：%s", settingType)
 	}
@@ -302,3 +306,44 @@ func validateUptimeKumaGroups(groupsStr string) error {
 func GetUptimeKumaGroups() []map[string]interface{} {
 	return getJSONList(GetConsoleSetting().UptimeKumaGroups)
 }
+
+func validateStringList(listStr string, typeName string, maxCount int) error {
+	var list []string
+	if err := json.Unmarshal([]byte(listStr), &list); err != nil {
+		return fmt.Errorf("%s格式错误：%s", typeName, err.Error())
+	}
+	if len(list) > maxCount {
+		return fmt.Errorf("%s数量不能超过%d个", typeName, maxCount)
+	}
+	nameSet := make(map[string]bool)
+	for i, name := range list {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("第%d个%s不能为空", i+1, typeName)
+		}
+		if len(name) > 128 {
+			return fmt.Errorf("第%d个%s长度不能超过128字符", i+1, typeName)
+		}
+		if nameSet[name] {
+			return fmt.Errorf("第%d个%s与其他项重复", i+1, typeName)
+		}
+		nameSet[name] = true
+	}
+	return nil
+}
+
+func getStringList(listStr string) []string {
+	if listStr == "" {
+		return []string{}
+	}
+	var list []string
+	json.Unmarshal([]byte(listStr), &list)
+	return list
+}
+
+func GetStatusPageModels() []string {
+	return getStringList(GetConsoleSetting().StatusPageModels)
+}
+
+func GetStatusPageGroups() []string {
+	return getStringList(GetConsoleSetting().StatusPageGroups)
+}
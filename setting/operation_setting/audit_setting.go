@@ -0,0 +1,24 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// AuditSetting 管理操作审计日志设置
+type AuditSetting struct {
+	Enabled       bool `json:"enabled"`        // 记录已登录用户对 /api 的所有写操作
+	RetentionDays int  `json:"retention_days"` // 审计日志保留天数，0 表示永久保留
+}
+
+// 默认配置
+var auditSetting = AuditSetting{
+	Enabled:       true,
+	RetentionDays: 180,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("audit_setting", &auditSetting)
+}
+
+func GetAuditSetting() *AuditSetting {
+	return &auditSetting
+}
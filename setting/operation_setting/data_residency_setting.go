@@ -0,0 +1,36 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// DataResidencyPolicy 数据驻留策略，按渠道设置中的提供方、地区与数据保留属性筛选渠道。
+// 允许列表不为空时，未设置对应属性的渠道视为不满足；提供方与地区不区分大小写
+type DataResidencyPolicy struct {
+	AllowedProviders         []string `json:"allowed_providers,omitempty"`
+	DeniedProviders          []string `json:"denied_providers,omitempty"`
+	AllowedRegions           []string `json:"allowed_regions,omitempty"`
+	DeniedRegions            []string `json:"denied_regions,omitempty"`
+	RequireNoRetention       bool     `json:"require_no_retention,omitempty"`
+	RequireZeroDataRetention bool     `json:"require_zero_data_retention,omitempty"`
+}
+
+type DataResidencySetting struct {
+	Enabled bool `json:"enabled"`
+
+	// 请求需要同时满足令牌、用户分组与渠道分组的策略
+	GroupPolicies map[string]DataResidencyPolicy `json:"group_policies"`
+	TokenPolicies map[string]DataResidencyPolicy `json:"token_policies"` // key 为令牌 ID
+}
+
+var dataResidencySetting = DataResidencySetting{
+	Enabled:       false,
+	GroupPolicies: map[string]DataResidencyPolicy{},
+	TokenPolicies: map[string]DataResidencyPolicy{},
+}
+
+func init() {
+	config.GlobalConfig.Register("data_residency_setting", &dataResidencySetting)
+}
+
+func GetDataResidencySetting() *DataResidencySetting {
+	return &dataResidencySetting
+}
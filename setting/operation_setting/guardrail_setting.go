@@ -0,0 +1,79 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// 护栏规则类型
+const (
+	GuardrailRuleTypePII     = "pii"     // 内置 PII 检测器
+	GuardrailRuleTypeKeyword = "keyword" // 关键词列表，不区分大小写
+	GuardrailRuleTypeRegex   = "regex"   // 自定义正则
+	GuardrailRuleTypeHTTP    = "http"    // 外部 HTTP 分类器
+)
+
+// 命中规则后的处理方式
+const (
+	GuardrailActionBlock  = "block"  // 拒绝请求或终止输出
+	GuardrailActionRedact = "redact" // 替换命中的内容后放行
+	GuardrailActionLog    = "log"    // 仅记录日志
+)
+
+// 规则作用的阶段，为空时同时作用于请求与响应
+const (
+	GuardrailStageInput  = "input"
+	GuardrailStageOutput = "output"
+)
+
+// 内置 PII 检测器，pii 规则未指定 detectors 时全部启用
+const (
+	GuardrailDetectorEmail    = "email"
+	GuardrailDetectorPhone    = "phone"
+	GuardrailDetectorIdCard   = "id_card"   // 18 位居民身份证号，校验末位校验码
+	GuardrailDetectorBankCard = "bank_card" // 13-19 位银行卡号，Luhn 校验
+)
+
+type GuardrailRule struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Action    string   `json:"action"`
+	Stages    []string `json:"stages,omitempty"`
+	Detectors []string `json:"detectors,omitempty"` // pii
+	Keywords  []string `json:"keywords,omitempty"`  // keyword
+	Patterns  []string `json:"patterns,omitempty"`  // regex
+
+	// http：POST {"stage","text","model","group","token_id"}，返回 {"flagged","reason","redacted_text"}
+	Endpoint   string `json:"endpoint,omitempty"`
+	Secret     string `json:"secret,omitempty"` // 不为空时以 Authorization: Bearer 发送
+	TimeoutMs  int    `json:"timeout_ms,omitempty"`
+	FailClosed bool   `json:"fail_closed,omitempty"` // 分类器不可用时按命中处理，默认放行
+}
+
+type GuardrailSetting struct {
+	Enabled bool            `json:"enabled"`
+	Rules   []GuardrailRule `json:"rules"` // 按顺序执行
+
+	// 规则按名称引用，优先级：令牌 > 分组 > 默认
+	DefaultRules []string            `json:"default_rules"`
+	GroupRules   map[string][]string `json:"group_rules"`
+	TokenRules   map[string][]string `json:"token_rules"` // key 为令牌 ID
+
+	RedactText        string `json:"redact_text"`
+	StreamBufferChars int    `json:"stream_buffer_chars"` // 流式输出攒够多少字符检查一次
+}
+
+var guardrailSetting = GuardrailSetting{
+	Enabled:           false,
+	Rules:             []GuardrailRule{},
+	DefaultRules:      []string{},
+	GroupRules:        map[string][]string{},
+	TokenRules:        map[string][]string{},
+	RedactText:        "[REDACTED]",
+	StreamBufferChars: 200,
+}
+
+func init() {
+	config.GlobalConfig.Register("guardrail_setting", &guardrailSetting)
+}
+
+func GetGuardrailSetting() *GuardrailSetting {
+	return &guardrailSetting
+}
@@ -0,0 +1,22 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// QuotaLedgerSetting 额度台账设置
+type QuotaLedgerSetting struct {
+	RetentionDays int `json:"retention_days"` // 台账明细保留天数，已计入对账快照的旧记录将被清理，0 表示永久保留
+}
+
+// 默认配置
+var quotaLedgerSetting = QuotaLedgerSetting{
+	RetentionDays: 365,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("quota_ledger_setting", &quotaLedgerSetting)
+}
+
+func GetQuotaLedgerSetting() *QuotaLedgerSetting {
+	return &quotaLedgerSetting
+}
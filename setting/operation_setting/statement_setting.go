@@ -0,0 +1,31 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// StatementSetting 月度账单与发票设置
+type StatementSetting struct {
+	Enabled        bool    `json:"enabled"` // 每月初自动为上月有额度变动的用户生成账单
+	CompanyName    string  `json:"company_name"`
+	CompanyAddress string  `json:"company_address"`
+	CompanyEmail   string  `json:"company_email"`
+	CompanyTaxId   string  `json:"company_tax_id"`
+	TaxName        string  `json:"tax_name"` // 如 VAT、GST，为空时发票不显示税额
+	TaxRate        float64 `json:"tax_rate"` // 0.06 表示 6%，税额在消费金额之外另计
+	InvoicePrefix  string  `json:"invoice_prefix"`
+	InvoiceFooter  string  `json:"invoice_footer"`
+}
+
+// 默认配置
+var statementSetting = StatementSetting{
+	Enabled:       false,
+	InvoicePrefix: "INV",
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("statement_setting", &statementSetting)
+}
+
+func GetStatementSetting() *StatementSetting {
+	return &statementSetting
+}
@@ -0,0 +1,22 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// TokenSignatureSetting 令牌请求签名（HMAC）设置，仅对开启签名模式的令牌生效
+type TokenSignatureSetting struct {
+	WindowSeconds int `json:"window_seconds"` // 允许的请求时间戳偏差（秒），同一 nonce 在该窗口内只能使用一次
+}
+
+// 默认配置
+var tokenSignatureSetting = TokenSignatureSetting{
+	WindowSeconds: 300,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("token_signature_setting", &tokenSignatureSetting)
+}
+
+func GetTokenSignatureSetting() *TokenSignatureSetting {
+	return &tokenSignatureSetting
+}
@@ -0,0 +1,4 @@
+package setting
+
+// SubscriptionGraceDays 订阅续费失败或续费回调延迟时，保留订阅权益的天数
+var SubscriptionGraceDays = 3
@@ -0,0 +1,103 @@
+package ratio_setting
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// modelPriceTiersMap 模型 -> 按提示词 token 数分档的倍率，例如超过 200k 上下文后单价上浮
+var modelPriceTiersMap = make(map[string][]types.PriceTier)
+var modelPriceTiersMapMutex sync.RWMutex
+
+func ModelPriceTiers2JSONString() string {
+	modelPriceTiersMapMutex.RLock()
+	defer modelPriceTiersMapMutex.RUnlock()
+	jsonBytes, err := common.Marshal(modelPriceTiersMap)
+	if err != nil {
+		common.SysError("error marshalling model price tiers: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func checkModelPriceTiers(tiersMap map[string][]types.PriceTier) error {
+	for name, tiers := range tiersMap {
+		if len(tiers) == 0 {
+			return fmt.Errorf("模型 %s 未配置任何档位", name)
+		}
+		seen := make(map[int]bool)
+		for _, tier := range tiers {
+			if tier.Threshold <= 0 {
+				return fmt.Errorf("模型 %s 的档位阈值必须大于0", name)
+			}
+			if seen[tier.Threshold] {
+				return fmt.Errorf("模型 %s 存在重复的档位阈值 %d", name, tier.Threshold)
+			}
+			seen[tier.Threshold] = true
+			if tier.ModelRatio < 0 || tier.CompletionRatio < 0 || tier.CacheRatio < 0 {
+				return fmt.Errorf("模型 %s 的档位倍率不能小于0", name)
+			}
+		}
+	}
+	return nil
+}
+
+// CheckModelPriceTiers 校验分档倍率配置
+func CheckModelPriceTiers(jsonStr string) error {
+	tiersMap := make(map[string][]types.PriceTier)
+	if err := common.Unmarshal([]byte(jsonStr), &tiersMap); err != nil {
+		return err
+	}
+	return checkModelPriceTiers(tiersMap)
+}
+
+func UpdateModelPriceTiersByJSONString(jsonStr string) error {
+	tiersMap := make(map[string][]types.PriceTier)
+	if err := common.Unmarshal([]byte(jsonStr), &tiersMap); err != nil {
+		return err
+	}
+	if err := checkModelPriceTiers(tiersMap); err != nil {
+		return err
+	}
+	for _, tiers := range tiersMap {
+		sort.Slice(tiers, func(i, j int) bool {
+			return tiers[i].Threshold < tiers[j].Threshold
+		})
+	}
+	modelPriceTiersMapMutex.Lock()
+	modelPriceTiersMap = tiersMap
+	modelPriceTiersMapMutex.Unlock()
+	InvalidateExposedDataCache()
+	return nil
+}
+
+// GetModelPriceTiers 返回模型的分档倍率（按阈值升序），未配置时返回 nil
+func GetModelPriceTiers(name string) []types.PriceTier {
+	modelPriceTiersMapMutex.RLock()
+	defer modelPriceTiersMapMutex.RUnlock()
+	tiers, ok := modelPriceTiersMap[FormatMatchingModelName(name)]
+	if !ok {
+		tiers, ok = modelPriceTiersMap[name]
+	}
+	if !ok {
+		return nil
+	}
+	copied := make([]types.PriceTier, len(tiers))
+	copy(copied, tiers)
+	return copied
+}
+
+func GetModelPriceTiersCopy() map[string][]types.PriceTier {
+	modelPriceTiersMapMutex.RLock()
+	defer modelPriceTiersMapMutex.RUnlock()
+	copyMap := make(map[string][]types.PriceTier, len(modelPriceTiersMap))
+	for k, v := range modelPriceTiersMap {
+		copied := make([]types.PriceTier, len(v))
+		copy(copied, v)
+		copyMap[k] = copied
+	}
+	return copyMap
+}
@@ -0,0 +1,165 @@
+package ratio_setting
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	_ "time/tzdata" // 精简镜像中可能没有时区数据
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// PricingWindow 定时计费窗口，在指定时区的时间段内对匹配的模型与分组额外乘以 Ratio，
+// 例如夜间低峰折扣。Start/End 格式为 HH:MM，End 小于等于 Start 时表示跨越零点
+type PricingWindow struct {
+	Name     string   `json:"name"`
+	Models   []string `json:"models,omitempty"` // 为空时匹配全部模型
+	Groups   []string `json:"groups,omitempty"` // 为空时匹配全部分组
+	Timezone string   `json:"timezone,omitempty"`
+	Weekdays []int    `json:"weekdays,omitempty"` // 0 为周日，为空时每天生效；跨零点的窗口以开始时间所在日为准
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Ratio    float64  `json:"ratio"`
+
+	location *time.Location
+	startMin int
+	endMin   int
+}
+
+var pricingWindows = make([]*PricingWindow, 0)
+var pricingWindowsMutex sync.RWMutex
+
+func parseClockMinutes(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("无效的时间 %s，格式应为 HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (w *PricingWindow) init() error {
+	if w.Name == "" {
+		return errors.New("计费窗口名称不能为空")
+	}
+	if w.Ratio < 0 {
+		return fmt.Errorf("计费窗口 %s 的倍率不能小于0", w.Name)
+	}
+	for _, weekday := range w.Weekdays {
+		if weekday < 0 || weekday > 6 {
+			return fmt.Errorf("计费窗口 %s 的星期取值必须在 0-6 之间", w.Name)
+		}
+	}
+	var err error
+	w.location = time.Local
+	if w.Timezone != "" {
+		if w.location, err = time.LoadLocation(w.Timezone); err != nil {
+			return fmt.Errorf("计费窗口 %s 的时区无效：%s", w.Name, w.Timezone)
+		}
+	}
+	if w.startMin, err = parseClockMinutes(w.Start); err != nil {
+		return err
+	}
+	if w.endMin, err = parseClockMinutes(w.End); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (w *PricingWindow) matchWeekday(weekday time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range w.Weekdays {
+		if time.Weekday(d) == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveAt 判断窗口在指定时间是否生效
+func (w *PricingWindow) ActiveAt(now time.Time) bool {
+	local := now.In(w.location)
+	minutes := local.Hour()*60 + local.Minute()
+	if w.startMin < w.endMin {
+		return minutes >= w.startMin && minutes < w.endMin && w.matchWeekday(local.Weekday())
+	}
+	// 跨零点：开始当天的 [start, 24:00) 与次日的 [00:00, end)
+	if minutes >= w.startMin {
+		return w.matchWeekday(local.Weekday())
+	}
+	if minutes < w.endMin {
+		return w.matchWeekday(local.AddDate(0, 0, -1).Weekday())
+	}
+	return false
+}
+
+func (w *PricingWindow) Match(modelName string, group string) bool {
+	if len(w.Models) > 0 && !common.StringsContains(w.Models, modelName) &&
+		!common.StringsContains(w.Models, FormatMatchingModelName(modelName)) {
+		return false
+	}
+	if len(w.Groups) > 0 && !common.StringsContains(w.Groups, group) {
+		return false
+	}
+	return true
+}
+
+func parsePricingWindows(jsonStr string) ([]*PricingWindow, error) {
+	windows := make([]*PricingWindow, 0)
+	if err := common.Unmarshal([]byte(jsonStr), &windows); err != nil {
+		return nil, err
+	}
+	for _, w := range windows {
+		if err := w.init(); err != nil {
+			return nil, err
+		}
+	}
+	return windows, nil
+}
+
+func PricingWindows2JSONString() string {
+	pricingWindowsMutex.RLock()
+	defer pricingWindowsMutex.RUnlock()
+	jsonBytes, err := common.Marshal(pricingWindows)
+	if err != nil {
+		common.SysError("error marshalling pricing windows: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func CheckPricingWindows(jsonStr string) error {
+	_, err := parsePricingWindows(jsonStr)
+	return err
+}
+
+func UpdatePricingWindowsByJSONString(jsonStr string) error {
+	windows, err := parsePricingWindows(jsonStr)
+	if err != nil {
+		return err
+	}
+	pricingWindowsMutex.Lock()
+	pricingWindows = windows
+	pricingWindowsMutex.Unlock()
+	return nil
+}
+
+// GetPricingWindows 返回全部计费窗口
+func GetPricingWindows() []*PricingWindow {
+	pricingWindowsMutex.RLock()
+	defer pricingWindowsMutex.RUnlock()
+	return pricingWindows
+}
+
+// GetActivePricingWindow 返回当前对该模型与分组生效的第一个计费窗口
+func GetActivePricingWindow(modelName string, group string, now time.Time) (*PricingWindow, bool) {
+	pricingWindowsMutex.RLock()
+	defer pricingWindowsMutex.RUnlock()
+	for _, w := range pricingWindows {
+		if w.Match(modelName, group) && w.ActiveAt(now) {
+			return w, true
+		}
+	}
+	return nil, false
+}
@@ -1,6 +1,18 @@
 package system_setting
 
-import "github.com/QuantumNous/new-api/setting/config"
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// OIDCClaimMapping 将 IdP 的组或角色映射为 new-api 的分组与权限
+type OIDCClaimMapping struct {
+	Value  string `json:"value"`   // 组或角色声明中的值
+	Group  string `json:"group"`   // 映射的分组，为空表示不由该条映射决定
+	Role   int    `json:"role"`    // 映射的权限等级（1 普通用户、10 管理员），0 表示不由该条映射决定
+	RoleId int    `json:"role_id"` // 映射的自定义管理角色，0 表示不由该条映射决定
+}
 
 type OIDCSettings struct {
 	Enabled               bool   `json:"enabled"`
@@ -10,10 +22,32 @@ type OIDCSettings struct {
 	AuthorizationEndpoint string `json:"authorization_endpoint"`
 	TokenEndpoint         string `json:"token_endpoint"`
 	UserInfoEndpoint      string `json:"user_info_endpoint"`
+
+	// 组或角色所在的声明，支持以 . 分隔的嵌套路径，如 groups、realm_access.roles
+	GroupsClaim   string             `json:"groups_claim"`
+	ClaimMappings []OIDCClaimMapping `json:"claim_mappings"`
+	// 允许注册的邮箱域名，为空表示不限制；已注册的用户不受影响
+	AllowedEmailDomains []string `json:"allowed_email_domains"`
+	// 新用户必须命中至少一条映射才能注册
+	RequireClaimMatch bool `json:"require_claim_match"`
+	// 每次登录时按映射重新同步分组与权限，超级管理员除外
+	SyncOnLogin bool `json:"sync_on_login"`
+	// 登录时若用户没有任何令牌则自动创建一个
+	AutoCreateToken bool `json:"auto_create_token"`
+}
+
+// OIDCAccess 按映射计算出的访问权限，字段为零值表示没有映射决定该项
+type OIDCAccess struct {
+	Matched bool
+	Group   string
+	Role    int
+	RoleId  int
 }
 
 // 默认配置
-var defaultOIDCSettings = OIDCSettings{}
+var defaultOIDCSettings = OIDCSettings{
+	GroupsClaim: "groups",
+}
 
 func init() {
 	// 注册到全局配置管理器
@@ -23,3 +57,66 @@ func init() {
 func GetOIDCSettings() *OIDCSettings {
 	return &defaultOIDCSettings
 }
+
+// IsEmailDomainAllowed 邮箱域名白名单，不区分大小写
+func (s *OIDCSettings) IsEmailDomainAllowed(email string) bool {
+	if len(s.AllowedEmailDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range s.AllowedEmailDomains {
+		if strings.ToLower(strings.TrimPrefix(strings.TrimSpace(allowed), "@")) == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveAccess 按映射顺序匹配声明值：分组与自定义角色取第一条命中的映射，权限等级取命中映射中最高的
+func (s *OIDCSettings) ResolveAccess(values []string) *OIDCAccess {
+	valueSet := make(map[string]bool, len(values))
+	for _, value := range values {
+		valueSet[value] = true
+	}
+	access := &OIDCAccess{}
+	for _, mapping := range s.ClaimMappings {
+		if !valueSet[mapping.Value] {
+			continue
+		}
+		access.Matched = true
+		if access.Group == "" {
+			access.Group = mapping.Group
+		}
+		if access.RoleId == 0 {
+			access.RoleId = mapping.RoleId
+		}
+		if mapping.Role > access.Role {
+			access.Role = mapping.Role
+		}
+	}
+	return access
+}
+
+// MapsRole 是否有映射决定权限等级，没有时同步不修改用户的权限等级
+func (s *OIDCSettings) MapsRole() bool {
+	for _, mapping := range s.ClaimMappings {
+		if mapping.Role != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// MapsRoleId 是否有映射决定自定义管理角色
+func (s *OIDCSettings) MapsRoleId() bool {
+	for _, mapping := range s.ClaimMappings {
+		if mapping.RoleId != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// SCIMSettings SCIM 2.0 目录同步，由 IdP 使用专用的 Bearer 令牌管理用户与分组
+type SCIMSettings struct {
+	Enabled bool   `json:"enabled"`
+	ApiKey  string `json:"api_key"` // IdP 请求时携带的 Bearer 令牌
+}
+
+var defaultSCIMSettings = SCIMSettings{}
+
+func init() {
+	config.GlobalConfig.Register("scim", &defaultSCIMSettings)
+}
+
+func GetSCIMSettings() *SCIMSettings {
+	return &defaultSCIMSettings
+}
@@ -40,6 +40,7 @@ type ErrorCode string
 const (
 	ErrorCodeInvalidRequest         ErrorCode = "invalid_request"
 	ErrorCodeSensitiveWordsDetected ErrorCode = "sensitive_words_detected"
+	ErrorCodeGuardrailBlocked       ErrorCode = "guardrail_blocked"
 	ErrorCodeViolationFeeGrokCSAM   ErrorCode = "violation_fee.grok.csam"
 
 	// new api error
@@ -50,6 +51,8 @@ const (
 	ErrorCodeDoRequestFailed    ErrorCode = "do_request_failed"
 	ErrorCodeGetChannelFailed   ErrorCode = "get_channel_failed"
 	ErrorCodeGenRelayInfoFailed ErrorCode = "gen_relay_info_failed"
+	ErrorCodeMultiKeyExhausted  ErrorCode = "multi_key_exhausted"
+	ErrorCodeNoCompliantChannel ErrorCode = "no_compliant_channel"
 
 	// channel error
 	ErrorCodeChannelNoAvailableKey        ErrorCode = "channel:no_available_key"
@@ -96,6 +99,8 @@ type NewAPIError struct {
 	errorCode      ErrorCode
 	StatusCode     int
 	Metadata       json.RawMessage
+	// RetryAfter 上游限流（429）时返回的重置等待时间（秒），0 表示未知
+	RetryAfter int64
 }
 
 // Unwrap enables errors.Is / errors.As to work with NewAPIError by exposing the underlying error.
@@ -3,9 +3,11 @@ package types
 import "fmt"
 
 type GroupRatioInfo struct {
-	GroupRatio        float64
-	GroupSpecialRatio float64
-	HasSpecialRatio   bool
+	GroupRatio         float64
+	GroupSpecialRatio  float64
+	HasSpecialRatio    bool
+	PricingWindow      string  // 命中的定时计费窗口名称
+	PricingWindowRatio float64 // 定时计费窗口倍率，已乘入 GroupRatio
 }
 
 type PriceData struct {
@@ -24,6 +26,67 @@ type PriceData struct {
 	UsePrice             bool
 	QuotaToPreConsume    int // 预消耗额度
 	GroupRatioInfo       GroupRatioInfo
+	PriceTiers           []PriceTier // 按提示词 token 数分档的倍率，按阈值升序
+	PriceTier            *PriceTier  // 结算时命中的档位
+	PriceOverrideId      int         // 命中的用户协商价格 ID，0 表示未命中
+	baseRatios           *priceTierBaseRatios
+}
+
+// PriceTier 提示词 token 数超过 Threshold 时生效的倍率，倍率为 0 表示沿用基础倍率。
+// 缓存创建倍率是相对模型倍率的，会随模型倍率一同变化
+type PriceTier struct {
+	Threshold       int     `json:"threshold"`
+	ModelRatio      float64 `json:"model_ratio"`
+	CompletionRatio float64 `json:"completion_ratio"`
+	CacheRatio      float64 `json:"cache_ratio"`
+}
+
+type priceTierBaseRatios struct {
+	modelRatio      float64
+	completionRatio float64
+	cacheRatio      float64
+}
+
+// SelectPriceTier 返回阈值小于提示词 token 数的最高档位，tiers 需按阈值升序
+func SelectPriceTier(tiers []PriceTier, promptTokens int) *PriceTier {
+	var selected *PriceTier
+	for i := range tiers {
+		if promptTokens > tiers[i].Threshold {
+			selected = &tiers[i]
+		}
+	}
+	return selected
+}
+
+// ApplyPriceTier 根据提示词 token 数选择档位并覆盖对应倍率，可重复调用（总是基于基础倍率）
+func (p *PriceData) ApplyPriceTier(promptTokens int) *PriceTier {
+	if p.UsePrice || len(p.PriceTiers) == 0 {
+		return nil
+	}
+	if p.baseRatios == nil {
+		p.baseRatios = &priceTierBaseRatios{
+			modelRatio:      p.ModelRatio,
+			completionRatio: p.CompletionRatio,
+			cacheRatio:      p.CacheRatio,
+		}
+	}
+	p.ModelRatio = p.baseRatios.modelRatio
+	p.CompletionRatio = p.baseRatios.completionRatio
+	p.CacheRatio = p.baseRatios.cacheRatio
+	p.PriceTier = SelectPriceTier(p.PriceTiers, promptTokens)
+	if p.PriceTier == nil {
+		return nil
+	}
+	if p.PriceTier.ModelRatio > 0 {
+		p.ModelRatio = p.PriceTier.ModelRatio
+	}
+	if p.PriceTier.CompletionRatio > 0 {
+		p.CompletionRatio = p.PriceTier.CompletionRatio
+	}
+	if p.PriceTier.CacheRatio > 0 {
+		p.CacheRatio = p.PriceTier.CacheRatio
+	}
+	return p.PriceTier
 }
 
 func (p *PriceData) AddOtherRatio(key string, ratio float64) {
@@ -37,9 +100,10 @@ func (p *PriceData) AddOtherRatio(key string, ratio float64) {
 }
 
 type PerCallPriceData struct {
-	ModelPrice     float64
-	Quota          int
-	GroupRatioInfo GroupRatioInfo
+	ModelPrice      float64
+	Quota           int
+	GroupRatioInfo  GroupRatioInfo
+	PriceOverrideId int
 }
 
 func (p *PriceData) ToSetting() string {
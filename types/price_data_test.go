@@ -0,0 +1,78 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectPriceTier(t *testing.T) {
+	tiers := []PriceTier{
+		{Threshold: 1000, ModelRatio: 2},
+		{Threshold: 5000, ModelRatio: 3},
+	}
+	tests := []struct {
+		name         string
+		promptTokens int
+		wantRatio    float64 // 0 表示未命中档位
+	}{
+		{name: "below first tier", promptTokens: 500},
+		{name: "threshold is exclusive", promptTokens: 1000},
+		{name: "first tier", promptTokens: 1001, wantRatio: 2},
+		{name: "highest matching tier", promptTokens: 8000, wantRatio: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tier := SelectPriceTier(tiers, tt.promptTokens)
+			if tt.wantRatio == 0 {
+				require.Nil(t, tier)
+				return
+			}
+			require.NotNil(t, tier)
+			require.Equal(t, tt.wantRatio, tier.ModelRatio)
+		})
+	}
+}
+
+func TestApplyPriceTier(t *testing.T) {
+	newPriceData := func() *PriceData {
+		return &PriceData{
+			ModelRatio:      1,
+			CompletionRatio: 4,
+			CacheRatio:      0.5,
+			PriceTiers: []PriceTier{
+				{Threshold: 1000, ModelRatio: 2},
+				{Threshold: 5000, ModelRatio: 3, CompletionRatio: 6, CacheRatio: 0.25},
+			},
+		}
+	}
+	tests := []struct {
+		name           string
+		promptTokens   []int // 依次应用，结果取最后一次
+		wantModel      float64
+		wantCompletion float64
+		wantCache      float64
+	}{
+		{name: "no tier keeps base ratios", promptTokens: []int{10}, wantModel: 1, wantCompletion: 4, wantCache: 0.5},
+		{name: "zero ratios fall back to base", promptTokens: []int{2000}, wantModel: 2, wantCompletion: 4, wantCache: 0.5},
+		{name: "all ratios overridden", promptTokens: []int{6000}, wantModel: 3, wantCompletion: 6, wantCache: 0.25},
+		{name: "reapplying resets to base", promptTokens: []int{6000, 10}, wantModel: 1, wantCompletion: 4, wantCache: 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			priceData := newPriceData()
+			for _, tokens := range tt.promptTokens {
+				priceData.ApplyPriceTier(tokens)
+			}
+			require.Equal(t, tt.wantModel, priceData.ModelRatio)
+			require.Equal(t, tt.wantCompletion, priceData.CompletionRatio)
+			require.Equal(t, tt.wantCache, priceData.CacheRatio)
+		})
+	}
+}
+
+func TestApplyPriceTierIgnoresFixedPrice(t *testing.T) {
+	priceData := &PriceData{UsePrice: true, ModelRatio: 1, PriceTiers: []PriceTier{{Threshold: 1, ModelRatio: 5}}}
+	require.Nil(t, priceData.ApplyPriceTier(100))
+	require.Equal(t, 1.0, priceData.ModelRatio)
+}
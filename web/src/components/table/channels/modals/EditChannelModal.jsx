@@ -159,6 +159,10 @@ const EditChannelModal = (props) => {
     pass_through_body_enabled: false,
     system_prompt: '',
     system_prompt_override: false,
+    provider: '',
+    region: '',
+    no_retention: false,
+    zero_data_retention: false,
     settings: '',
     // 仅 Vertex: 密钥格式（存入 settings.vertex_key_type）
     vertex_key_type: 'json',
@@ -598,6 +602,11 @@ const EditChannelModal = (props) => {
           data.system_prompt = parsedSettings.system_prompt || '';
           data.system_prompt_override =
             parsedSettings.system_prompt_override || false;
+          data.provider = parsedSettings.provider || '';
+          data.region = parsedSettings.region || '';
+          data.no_retention = parsedSettings.no_retention || false;
+          data.zero_data_retention =
+            parsedSettings.zero_data_retention || false;
         } catch (error) {
           console.error('解析渠道设置失败:', error);
           data.force_format = false;
@@ -606,6 +615,10 @@ const EditChannelModal = (props) => {
           data.pass_through_body_enabled = false;
           data.system_prompt = '';
           data.system_prompt_override = false;
+          data.provider = '';
+          data.region = '';
+          data.no_retention = false;
+          data.zero_data_retention = false;
         }
       } else {
         data.force_format = false;
@@ -614,6 +627,10 @@ const EditChannelModal = (props) => {
         data.pass_through_body_enabled = false;
         data.system_prompt = '';
         data.system_prompt_override = false;
+        data.provider = '';
+        data.region = '';
+        data.no_retention = false;
+        data.zero_data_retention = false;
       }
 
       if (data.settings) {
@@ -682,6 +699,10 @@ const EditChannelModal = (props) => {
         pass_through_body_enabled: data.pass_through_body_enabled,
         system_prompt: data.system_prompt,
         system_prompt_override: data.system_prompt_override || false,
+        provider: data.provider,
+        region: data.region,
+        no_retention: data.no_retention,
+        zero_data_retention: data.zero_data_retention,
       });
       initialModelsRef.current = (data.models || [])
         .map((model) => (model || '').trim())
@@ -1027,6 +1048,10 @@ const EditChannelModal = (props) => {
       pass_through_body_enabled: false,
       system_prompt: '',
       system_prompt_override: false,
+      provider: '',
+      region: '',
+      no_retention: false,
+      zero_data_retention: false,
     });
     // 重置密钥模式状态
     setKeyMode('append');
@@ -1354,6 +1379,10 @@ const EditChannelModal = (props) => {
       pass_through_body_enabled: localInputs.pass_through_body_enabled || false,
       system_prompt: localInputs.system_prompt || '',
       system_prompt_override: localInputs.system_prompt_override || false,
+      provider: (localInputs.provider || '').trim(),
+      region: (localInputs.region || '').trim(),
+      no_retention: localInputs.no_retention || false,
+      zero_data_retention: localInputs.zero_data_retention || false,
     };
     localInputs.setting = JSON.stringify(channelExtraSettings);
 
@@ -1405,6 +1434,10 @@ const EditChannelModal = (props) => {
     delete localInputs.pass_through_body_enabled;
     delete localInputs.system_prompt;
     delete localInputs.system_prompt_override;
+    delete localInputs.provider;
+    delete localInputs.region;
+    delete localInputs.no_retention;
+    delete localInputs.zero_data_retention;
     delete localInputs.is_enterprise_account;
     // 顶层的 vertex_key_type 不应发送给后端
     delete localInputs.vertex_key_type;
@@ -3362,6 +3395,50 @@ const EditChannelModal = (props) => {
                         '如果用户请求中包含系统提示词，则使用此设置拼接到用户的系统提示词前面',
                       )}
                     />
+
+                    <Form.Input
+                      field='provider'
+                      label={t('上游提供方')}
+                      placeholder={t('例如: openai、anthropic、azure')}
+                      onChange={(value) =>
+                        handleChannelSettingsChange('provider', value)
+                      }
+                      showClear
+                      extraText={t('用于数据驻留策略按提供方筛选渠道')}
+                    />
+                    <Form.Input
+                      field='region'
+                      label={t('数据处理地区')}
+                      placeholder={t('例如: us、eu、cn')}
+                      onChange={(value) =>
+                        handleChannelSettingsChange('region', value)
+                      }
+                      showClear
+                      extraText={t('用于数据驻留策略按地区筛选渠道')}
+                    />
+                    <Form.Switch
+                      field='no_retention'
+                      label={t('不保留数据')}
+                      checkedText={t('开')}
+                      uncheckedText={t('关')}
+                      onChange={(value) =>
+                        handleChannelSettingsChange('no_retention', value)
+                      }
+                      extraText={t('上游不保留请求数据用于训练')}
+                    />
+                    <Form.Switch
+                      field='zero_data_retention'
+                      label={t('零数据保留')}
+                      checkedText={t('开')}
+                      uncheckedText={t('关')}
+                      onChange={(value) =>
+                        handleChannelSettingsChange(
+                          'zero_data_retention',
+                          value,
+                        )
+                      }
+                      extraText={t('上游与零数据保留（ZDR）协议覆盖该渠道')}
+                    />
                   </Card>
                 </div>
               </div>